@@ -0,0 +1,111 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The cost of a message sent, from the Tariff
+type Charge struct {
+	ID        string
+	Telephone string
+	Segments  int
+	Time      time.Time
+	Cost      float64
+}
+
+// Returned by Send when a message would take spending this month over
+// Accounting.MonthlyBudget
+type BudgetExceededError struct {
+	Spent  float64
+	Cost   float64
+	Budget float64
+}
+
+func (self *BudgetExceededError) Error() string {
+	return fmt.Sprintf("Monthly budget exceeded: %.2f spent, message costs %.2f, budget %.2f", self.Spent, self.Cost, self.Budget)
+}
+
+// Tracks spending on messages sent through a modem, and so its SIM, set as
+// Modem.Accounting.
+type Accounting struct {
+	// Cost of a message to the number taking the segments, eg by
+	// destination prefix. Messages cost nothing without one.
+	Tariff func(telephone string, segments int) float64
+	// Called with the charge for each message sent, eg to record it
+	Charged func(c Charge)
+	// Spending allowed per calendar month of the host clock, 0 for no
+	// limit. Sends which would exceed it fail with a BudgetExceededError
+	// before anything is sent.
+	MonthlyBudget float64
+
+	lock  sync.Mutex
+	month time.Time
+	spent float64
+}
+
+// The first instant of t's month
+func monthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// Move on to the month of now, resetting spending. The caller must hold the
+// lock.
+func (self *Accounting) roll(now time.Time) {
+	if month := monthOf(now); !month.Equal(self.month) {
+		self.month = month
+		self.spent = 0
+	}
+}
+
+// Spent returns the spending in the month of now.
+func (self *Accounting) Spent(now time.Time) float64 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.roll(now)
+	return self.spent
+}
+
+// Restore spending in the month of now recorded before a restart, eg from
+// the charges passed to Charged.
+func (self *Accounting) Restore(now time.Time, spent float64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.roll(now)
+	self.spent = spent
+}
+
+// Cost a message and reserve it from the budget, refunded with refund if
+// the send fails
+func (self *Accounting) reserve(now time.Time, telephone string, segments int) (float64, error) {
+	if self == nil || self.Tariff == nil {
+		return 0, nil
+	}
+	cost := self.Tariff(telephone, segments)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.roll(now)
+	if self.MonthlyBudget > 0 && self.spent+cost > self.MonthlyBudget {
+		return 0, &BudgetExceededError{self.spent, cost, self.MonthlyBudget}
+	}
+	self.spent += cost
+	return cost, nil
+}
+
+func (self *Accounting) refund(now time.Time, cost float64) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if monthOf(now).Equal(self.month) {
+		self.spent -= cost
+	}
+}
+
+func (self *Accounting) charged(c Charge) {
+	if self != nil && self.Charged != nil {
+		self.Charged(c)
+	}
+}
@@ -0,0 +1,72 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestAccounting(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, sendPDUMessageReplay, sendPDUMessageReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	var charges []Charge
+	modem.Accounting = &Accounting{
+		Tariff: func(telephone string, segments int) float64 {
+			return 0.1 * float64(segments)
+		},
+		Charged: func(c Charge) {
+			charges = append(charges, c)
+		},
+		MonthlyBudget: 0.25,
+	}
+	msg := OutgoingMessage{ID: "a1", Telephone: "441234567890", Body: "Body@"}
+	for i := 0; i < 2; i++ {
+		if _, err := modem.Send(msg); err != nil {
+			t.Fatal("Expected: no error, got:", err)
+		}
+	}
+	if _, err := modem.Send(msg); err == nil {
+		t.Error("Expected: budget exceeded")
+	} else if _, ok := err.(*BudgetExceededError); !ok {
+		t.Error("Expected: budget exceeded, got:", err)
+	}
+	modem.Close()
+
+	now := DefaultClock.Now()
+	if len(charges) != 2 || charges[0].Time.IsZero() {
+		t.Fatalf("Unexpected charges: %#v", charges)
+	}
+	charges[0].Time = time.Time{}
+	if charges[0] != (Charge{"a1", "441234567890", 1, time.Time{}, 0.1}) {
+		t.Errorf("Unexpected charges: %#v", charges)
+	}
+	if spent := modem.Accounting.Spent(now); spent < 0.19 || spent > 0.21 {
+		t.Errorf("Expected: 0.2 spent, got %v", spent)
+	}
+	// a new month
+	if spent := modem.Accounting.Spent(now.AddDate(0, 1, 0)); spent != 0 {
+		t.Errorf("Expected: nothing spent next month, got %v", spent)
+	}
+}
+
+func TestAccountingRestore(t *testing.T) {
+	now := time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC)
+	accounting := &Accounting{
+		Tariff:        func(string, int) float64 { return 1 },
+		MonthlyBudget: 10,
+	}
+	accounting.Restore(now, 9.5)
+	if _, err := accounting.reserve(now, "441234567890", 1); err == nil {
+		t.Error("Expected: budget exceeded")
+	}
+	if cost, err := accounting.reserve(now.AddDate(0, 1, 0), "441234567890", 1); err != nil || cost != 1 {
+		t.Errorf("Expected: budget renewed, got %v %v", cost, err)
+	}
+}
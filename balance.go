@@ -0,0 +1,123 @@
+package gogsmmodem
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State of the modem gathered in the background
+type State struct {
+	// Last balance read by CheckBalance, the reply it was read from, and
+	// when. BalanceAt is zero if the balance has not been read.
+	Balance     float64
+	BalanceText string
+	BalanceAt   time.Time
+}
+
+// State returns a snapshot of the modem's state.
+func (self *Modem) State() State {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	return self.state
+}
+
+// Reads the balance of a prepaid SIM by USSD, see CheckBalance.
+type BalanceChecker struct {
+	// USSD code for the balance, eg "*100#"
+	Code string
+	// Finds the balance in the reply, eg `(\d+\.\d\d)`. The first
+	// subexpression is taken, or the whole match if there is none. A comma
+	// is taken as the decimal point.
+	Pattern *regexp.Regexp
+	// Interval between checks
+	Interval time.Duration
+	// LowBalance is emitted when the balance falls below this
+	Threshold float64
+}
+
+var ErrNoBalance = errors.New("No balance found in USSD reply")
+var ErrBalanceInterval = errors.New("Balance check interval must be positive")
+var ErrBalancePattern = errors.New("Balance check needs a pattern")
+
+// Context for balance checks, which give way to all other commands
+var balanceContext = WithPriority(context.Background(), PriorityLow)
+
+// CheckBalance reads the balance with c every c.Interval until stop is called
+// or the port drops, recording it in State. A LowBalance is emitted on OOB
+// when the balance falls below c.Threshold, and again only once it has
+// recovered and fallen again. It fails if c.Interval is not positive or
+// c.Pattern is nil. stop may be called more than once.
+func (self *Modem) CheckBalance(c BalanceChecker) (stop func(), err error) {
+	if c.Interval <= 0 {
+		return nil, ErrBalanceInterval
+	}
+	if c.Pattern == nil {
+		return nil, ErrBalancePattern
+	}
+	quit := make(chan struct{})
+	go func() {
+		low := false
+		for {
+			select {
+			case <-self.clock.After(c.Interval):
+				low = self.checkBalance(c, low)
+			case <-self.closed:
+				return
+			case <-self.done:
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(quit) }) }, nil
+}
+
+// Read the balance once, recording it in State and emitting LowBalance if
+// it has fallen below the threshold since the last check. Returns whether the
+// balance is low, which is unchanged if it could not be read.
+func (self *Modem) checkBalance(c BalanceChecker, low bool) bool {
+	r, err := self.ussdContext(balanceContext, PriorityLow, c.Code)
+	if err != nil {
+		log.Println("Balance check:", err)
+		return low
+	}
+	balance, err := parseBalance(c.Pattern, r.Text)
+	if err != nil {
+		log.Println("Balance check:", err, r.Text)
+		return low
+	}
+	self.stateLock.Lock()
+	self.state.Balance = balance
+	self.state.BalanceText = r.Text
+	self.state.BalanceAt = self.clock.Now()
+	self.stateLock.Unlock()
+	if balance < c.Threshold && !low {
+		self.emit(LowBalance{balance, c.Threshold, r.Text})
+	}
+	return balance < c.Threshold
+}
+
+// Find the balance in a USSD reply
+func parseBalance(re *regexp.Regexp, text string) (float64, error) {
+	m := re.FindStringSubmatch(text)
+	if m == nil {
+		return 0, ErrNoBalance
+	}
+	s := m[0]
+	if len(m) > 1 {
+		s = m[1]
+	}
+	balance, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	if err != nil {
+		return 0, ErrNoBalance
+	}
+	return balance, nil
+}
@@ -0,0 +1,90 @@
+package gogsmmodem
+
+import (
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+var balanceReplay = []string{
+	"->AT+CUSD=1,\"*100#\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 0,\"Balance: 5.20 GBP\",15\r\n",
+	"->AT+CUSD=1,\"*100#\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 0,\"Balance: 0.80 GBP\",15\r\n",
+	"->AT+CUSD=1,\"*100#\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 0,\"Balance: 0.60 GBP\",15\r\n",
+	"->AT+CUSD=1,\"*100#\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 0,\"Service unavailable\",15\r\n",
+}
+
+func TestCheckBalance(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, balanceReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	c := BalanceChecker{Code: "*100#", Pattern: regexp.MustCompile(`(\d+\.\d\d) GBP`), Threshold: 1}
+	low := modem.checkBalance(c, false)
+	if state := modem.State(); low || state.Balance != 5.2 || state.BalanceText != "Balance: 5.20 GBP" || state.BalanceAt.IsZero() {
+		t.Errorf("Expected: balance 5.20, got %#v", state)
+	}
+	// LowBalance is emitted once as the balance falls below the threshold
+	low = modem.checkBalance(c, low)
+	low = modem.checkBalance(c, low)
+	if !low || modem.State().Balance != 0.6 {
+		t.Errorf("Expected: low balance 0.60, got %#v", modem.State())
+	}
+	// unreadable replies leave the balance alone
+	if low = modem.checkBalance(c, low); !low || modem.State().Balance != 0.6 {
+		t.Errorf("Expected: balance unchanged, got %#v", modem.State())
+	}
+	modem.Close()
+	var lows []LowBalance
+	for p := range modem.OOB {
+		if l, ok := p.(LowBalance); ok {
+			lows = append(lows, l)
+		}
+	}
+	if len(lows) != 1 || lows[0] != (LowBalance{0.8, 1, "Balance: 0.80 GBP"}) {
+		t.Errorf("Expected: one LowBalance, got %#v", lows)
+	}
+	if _, err := modem.CheckBalance(c); err != ErrBalanceInterval {
+		t.Error("Expected: ErrBalanceInterval, got:", err)
+	}
+	if _, err := modem.CheckBalance(BalanceChecker{Code: "*100#", Interval: time.Hour}); err != ErrBalancePattern {
+		t.Error("Expected: ErrBalancePattern, got:", err)
+	}
+	c.Interval = time.Hour
+	stop, err := modem.CheckBalance(c)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	stop()
+	stop()
+}
+
+func TestParseBalance(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		balance float64
+	}{
+		{`(\d+\.\d\d)`, "Your balance is 12.34", 12.34},
+		{`\d+,\d\d`, "Saldo: 3,50 EUR", 3.5},
+		{`Credit (\d+)`, "Credit 7 units, expires 01/03", 7},
+	}
+	for _, test := range tests {
+		balance, err := parseBalance(regexp.MustCompile(test.pattern), test.text)
+		if err != nil || balance != test.balance {
+			t.Errorf("Expected: %v for %q, got %v, %v", test.balance, test.text, balance, err)
+		}
+	}
+	if _, err := parseBalance(regexp.MustCompile(`\d+\.\d\d`), "Try later"); err != ErrNoBalance {
+		t.Error("Expected: ErrNoBalance, got:", err)
+	}
+}
@@ -0,0 +1,177 @@
+package gogsmmodem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"time"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+)
+
+// Information element of a chunk of a blob, from the range for SME to SME
+// use: transfer ID (2 octets), chunk number from 1, number of chunks, and
+// CRC-32 of the whole blob (4 octets)
+const (
+	ieiBlobChunk = 0x81
+	blobChunkLen = 8
+)
+
+// Blob octets in each chunk, after the user data header
+const BlobChunkSize = 140 - 1 - 2 - blobChunkLen
+
+// Largest blob SendBlob can send
+const MaxBlobSize = 255 * BlobChunkSize
+
+// How long a Reassembler keeps an incomplete blob
+var BlobTimeout = time.Hour
+
+var (
+	ErrTextMode     = errors.New("Binary messages need PDU mode")
+	ErrBlobTooLarge = fmt.Errorf("Blob larger than %d bytes", MaxBlobSize)
+	ErrBlobChecksum = errors.New("Blob failed checksum")
+)
+
+// A chunk of a blob in a received message, see SendBlob
+type BlobChunk struct {
+	ID       int
+	Number   int
+	Count    int
+	Checksum uint32
+}
+
+// Decode the chunk information element of a received message, or nil
+func decodeBlobChunk(p *pdu.Message) *BlobChunk {
+	e := p.Element(ieiBlobChunk)
+	if len(e) != blobChunkLen || e[2] == 0 || e[2] > e[3] {
+		return nil
+	}
+	return &BlobChunk{int(binary.BigEndian.Uint16(e)), int(e[2]), int(e[3]), binary.BigEndian.Uint32(e[4:])}
+}
+
+// Random transfer ID, so the receiver cannot confuse a transfer with an
+// earlier one. Replaced in tests.
+var newBlobID = func() int {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return int(binary.BigEndian.Uint16(b))
+}
+
+// SendBlob sends a small binary file, such as a config file, in numbered
+// chunks of BlobChunkSize, one 8-bit message each, for the receiving device
+// to put back together with a Reassembler. It returns the transfer's ID, which
+// each chunk's MessageSent carries as "blob-<id>-<chunk>". A failed chunk
+// stops the transfer with its error; the receiver discards what it had after
+// BlobTimeout.
+func (self *Modem) SendBlob(ctx context.Context, telephone string, blob []byte) (int, error) {
+	if len(blob) > MaxBlobSize {
+		return 0, ErrBlobTooLarge
+	}
+	id := newBlobID()
+	for _, msg := range blobMessages(id, telephone, blob) {
+		if _, err := self.SendContext(ctx, msg); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// The messages carrying a blob's chunks
+func blobMessages(id int, telephone string, blob []byte) []OutgoingMessage {
+	count := (len(blob) + BlobChunkSize - 1) / BlobChunkSize
+	if count == 0 {
+		count = 1
+	}
+	var msgs []OutgoingMessage
+	for n := 1; n <= count; n++ {
+		e := make([]byte, blobChunkLen)
+		binary.BigEndian.PutUint16(e, uint16(id))
+		e[2] = byte(n)
+		e[3] = byte(count)
+		binary.BigEndian.PutUint32(e[4:], crc32.ChecksumIEEE(blob))
+		chunk := blob[(n-1)*BlobChunkSize:]
+		if len(chunk) > BlobChunkSize {
+			chunk = chunk[:BlobChunkSize]
+		}
+		msgs = append(msgs, OutgoingMessage{
+			ID:        fmt.Sprintf("blob-%d-%d", id, n),
+			Telephone: telephone,
+			udh:       pdu.AppendElement(nil, ieiBlobChunk, e),
+			data:      append([]byte{}, chunk...),
+		})
+	}
+	return msgs
+}
+
+// A blob received by a Reassembler
+type Blob struct {
+	Telephone string
+	ID        int
+	Data      []byte
+}
+
+// Puts blobs sent by SendBlob back together from received messages.
+type Reassembler struct {
+	clock   Clock
+	lock    sync.Mutex
+	pending map[blobKey]*partialBlob
+}
+
+type blobKey struct {
+	telephone string
+	id        int
+}
+
+type partialBlob struct {
+	chunks  [][]byte
+	have    int
+	started time.Time
+}
+
+func NewReassembler() *Reassembler {
+	return &Reassembler{clock: DefaultClock, pending: map[blobKey]*partialBlob{}}
+}
+
+// Add a received message, returning the blob once its last chunk arrives.
+// Messages which are not chunks are ignored, returning nil. A blob failing
+// its checksum is discarded with ErrBlobChecksum.
+func (self *Reassembler) Add(msg Message) (*Blob, error) {
+	c := msg.Chunk
+	if c == nil {
+		return nil, nil
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	now := self.clock.Now()
+	for key, p := range self.pending {
+		if now.Sub(p.started) > BlobTimeout {
+			delete(self.pending, key)
+		}
+	}
+	key := blobKey{msg.Telephone, c.ID}
+	p := self.pending[key]
+	if p == nil || len(p.chunks) != c.Count {
+		p = &partialBlob{chunks: make([][]byte, c.Count), started: now}
+		self.pending[key] = p
+	}
+	if p.chunks[c.Number-1] == nil {
+		p.chunks[c.Number-1] = []byte(msg.Body)
+		p.have++
+	}
+	if p.have < c.Count {
+		return nil, nil
+	}
+	delete(self.pending, key)
+	var data []byte
+	for _, chunk := range p.chunks {
+		data = append(data, chunk...)
+	}
+	if crc32.ChecksumIEEE(data) != c.Checksum {
+		return nil, ErrBlobChecksum
+	}
+	return &Blob{msg.Telephone, c.ID, data}, nil
+}
@@ -0,0 +1,75 @@
+package gogsmmodem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+	"github.com/tarm/serial"
+)
+
+// The messages received for a blob sent to 441234567890
+func blobChunks(t *testing.T, id int, blob []byte) ([]string, []Message) {
+	var replay []string
+	var received []Message
+	for _, msg := range blobMessages(id, "441234567890", blob) {
+		hexpdu, length, err := pdu.EncodeSubmitData(msg.Telephone, msg.udh, msg.data)
+		if err != nil {
+			t.Fatal("Expected: no error, got:", err)
+		}
+		replay = append(replay, fmt.Sprintf("->AT+CMGS=%d\r\n", length), "<-> \r\n", "->"+hexpdu+"\x1a", "<-\r\n+CMGS: 12\r\n\r\nOK\r\n")
+		m, err := decodePDUMessage(Message{Body: hexpdu})
+		if err != nil {
+			t.Fatal("Expected: no error, got:", err)
+		}
+		received = append(received, *m)
+	}
+	return replay, received
+}
+
+func TestSendBlob(t *testing.T) {
+	blob := bytes.Repeat([]byte("key=value\x00\xff\n"), 30)
+	replay, chunks := blobChunks(t, 7, blob)
+	if len(chunks) != 3 {
+		t.Fatalf("Expected: 3 chunks, got %d", len(chunks))
+	}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, replay)), nil
+	}
+	defer func(f func() int) { newBlobID = f }(newBlobID)
+	newBlobID = func() int { return 7 }
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if id, err := modem.SendBlob(context.Background(), "441234567890", blob); id != 7 || err != nil {
+		t.Error("Expected: blob sent, got:", id, err)
+	}
+	modem.Close()
+
+	r := NewReassembler()
+	for _, i := range []int{2, 0, 2} {
+		if b, err := r.Add(chunks[i]); b != nil || err != nil {
+			t.Errorf("Expected: incomplete, got %v %v", b, err)
+		}
+	}
+	if _, err := r.Add(Message{Telephone: "441234567890", Body: "not a chunk"}); err != nil {
+		t.Error("Expected: ignored, got:", err)
+	}
+	b, err := r.Add(chunks[1])
+	if err != nil || b == nil || b.ID != 7 || b.Telephone != "441234567890" || !bytes.Equal(b.Data, blob) {
+		t.Errorf("Expected: blob, got %#v %v", b, err)
+	}
+
+	_, corrupt := blobChunks(t, 8, blob)
+	corrupt[0].Body = "x" + corrupt[0].Body[1:]
+	for _, c := range corrupt[:2] {
+		r.Add(c)
+	}
+	if _, err := r.Add(corrupt[2]); err != ErrBlobChecksum {
+		t.Error("Expected: ErrBlobChecksum, got:", err)
+	}
+}
@@ -0,0 +1,90 @@
+package gogsmmodem
+
+import "log"
+
+// Default for Modem.BlockThreshold.
+var DefaultBlockThreshold = 10
+
+// +CMS ERROR codes networks give for sends from a SIM barred for spam:
+// operator determined barring, call barred, short message transfer
+// rejected, facility rejected and facility not subscribed.
+var BlockCodes = []int{8, 10, 21, 29, 50}
+
+// Signal below which failed sends are put down to coverage rather than
+// blocking, unless the signal has not been read
+var BlockMinRSSI = 10
+
+// Is err a send refused with one of BlockCodes
+func blockCode(err error) (int, bool) {
+	e, ok := err.(ERROR)
+	if !ok || e.Type != "+CMS ERROR" {
+		return 0, false
+	}
+	for _, code := range BlockCodes {
+		if e.Code == code {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// Are registration and signal good enough that failing sends are the
+// network refusing them, as far as last read
+func (self *Modem) coverageFine() bool {
+	if self.registrationLost() != nil {
+		return false
+	}
+	s := self.Stats()
+	if !s.RegistrationAt.IsZero() && !(NetworkRegistration{Status: s.Registration}).Registered() {
+		return false
+	}
+	return s.SignalAt.IsZero() || !s.Signal.Known() || s.Signal.RSSI >= BlockMinRSSI
+}
+
+// Count consecutive sends refused with BlockCodes despite good coverage,
+// emitting SIMSuspectedBlocked at BlockThreshold. A sent message clears the
+// suspicion. The caller must hold the modem.
+func (self *Modem) checkBlocked(err error) {
+	if err == nil {
+		self.blocked = 0
+		self.stateLock.Lock()
+		self.suspectedBlocked = false
+		self.stateLock.Unlock()
+		return
+	}
+	if _, ok := err.(ERROR); !ok {
+		return
+	}
+	code, ok := blockCode(err)
+	if !ok || !self.coverageFine() {
+		self.blocked = 0
+		return
+	}
+	self.blocked++
+	if self.BlockThreshold <= 0 || self.blocked < self.BlockThreshold || self.SuspectedBlocked() {
+		return
+	}
+	failures := self.blocked
+	self.blocked = 0
+	self.stateLock.Lock()
+	self.suspectedBlocked = true
+	self.stateLock.Unlock()
+	log.Printf("%d consecutive sends refused with +CMS ERROR: %d, SIM suspected blocked", failures, code)
+	self.emit(SIMSuspectedBlocked{failures, code})
+}
+
+// Forget the suspicion, emitting SIMSuspectedBlocked again after another
+// BlockThreshold refusals
+func (self *Modem) unblocked() {
+	self.stateLock.Lock()
+	self.suspectedBlocked = false
+	self.stateLock.Unlock()
+}
+
+// SuspectedBlocked reports whether the carrier appears to have blocked the
+// SIM, since SIMSuspectedBlocked was emitted and until a message is sent.
+func (self *Modem) SuspectedBlocked() bool {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	return self.suspectedBlocked
+}
@@ -0,0 +1,57 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+func blockedReplay(code string) []string {
+	return []string{
+		"->AT+CMGS=19\r\n",
+		"<-> \r\n",
+		"->0011000C814421436587090000AA05C237390F00\x1a",
+		"<-\r\n+CMS ERROR: " + code + "\r\n",
+	}
+}
+
+func TestSuspectedBlocked(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, blockedReplay("21"), blockedReplay("500"),
+			blockedReplay("21"), blockedReplay("21"), blockedReplay("21"), blockedReplay("21"))), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.BlockThreshold = 2
+	modem.StormThreshold = 0
+	for i := 0; i < 6; i++ {
+		modem.SendMessage("441234567890", "Body@")
+		// another error restarts the count
+		if blocked := modem.SuspectedBlocked(); blocked != (i >= 3) {
+			t.Errorf("Send %d: expected suspected blocked %v", i, i >= 3)
+		}
+	}
+	modem.Close()
+	refused := ERROR{"+CMS ERROR", 21}
+	assertOOBCommands(t, modem, []Packet{
+		MessageSent{"", "441234567890", 0, refused},
+		MessageSent{"", "441234567890", 0, ERROR{"+CMS ERROR", 500}},
+		MessageSent{"", "441234567890", 0, refused},
+		SIMSuspectedBlocked{2, 21},
+		MessageSent{"", "441234567890", 0, refused},
+		MessageSent{"", "441234567890", 0, refused},
+		MessageSent{"", "441234567890", 0, refused},
+	})
+}
+
+func TestSuspectedBlockedCoverage(t *testing.T) {
+	modem := &Modem{stats: newStatsCounter(DefaultClock), BlockThreshold: 1}
+	modem.stats.signal(SignalQuality{5, 0})
+	modem.checkBlocked(ERROR{"+CMS ERROR", 21})
+	if modem.SuspectedBlocked() {
+		t.Error("Expected: refusals with weak signal not counted")
+	}
+}
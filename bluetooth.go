@@ -0,0 +1,40 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// OpenRFCOMM opens a modem over Bluetooth serial (RFCOMM), such as a phone's
+// dial-up networking service or a Bluetooth GSM adapter. addr is the device
+// address, eg "00:11:22:33:44:55", and channel the RFCOMM channel of its
+// serial or DUN service, see "sdptool browse". Only supported on Linux.
+func OpenRFCOMM(addr string, channel int, opts Options) (*Modem, error) {
+	bdaddr, err := parseBDAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return openDial(func() (io.ReadWriteCloser, error) {
+		return dialRFCOMM(bdaddr, channel)
+	}, opts)
+}
+
+// Parse a Bluetooth device address into the byte order of bdaddr_t, least
+// significant byte first.
+func parseBDAddr(addr string) ([6]byte, error) {
+	var bdaddr [6]byte
+	parts := strings.Split(addr, ":")
+	if len(parts) != 6 {
+		return bdaddr, errors.New("Invalid Bluetooth address: " + addr)
+	}
+	for i, part := range parts {
+		b, err := strconv.ParseUint(part, 16, 8)
+		if err != nil || len(part) != 2 {
+			return bdaddr, errors.New("Invalid Bluetooth address: " + addr)
+		}
+		bdaddr[5-i] = byte(b)
+	}
+	return bdaddr, nil
+}
@@ -0,0 +1,39 @@
+//go:build linux && !386
+// +build linux,!386
+
+package gogsmmodem
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	afBluetooth   = 31
+	btprotoRFCOMM = 3
+)
+
+// struct sockaddr_rc
+type sockaddrRC struct {
+	family  uint16
+	bdaddr  [6]byte
+	channel uint8
+}
+
+// Connect an RFCOMM socket, which reads and writes like a serial port.
+func dialRFCOMM(bdaddr [6]byte, channel int) (io.ReadWriteCloser, error) {
+	fd, err := syscall.Socket(afBluetooth, syscall.SOCK_STREAM, btprotoRFCOMM)
+	if err != nil {
+		return nil, err
+	}
+	sa := sockaddrRC{afBluetooth, bdaddr, uint8(channel)}
+	_, _, errno := syscall.Syscall(syscall.SYS_CONNECT, uintptr(fd),
+		uintptr(unsafe.Pointer(&sa)), unsafe.Sizeof(sa))
+	if errno != 0 {
+		syscall.Close(fd)
+		return nil, errno
+	}
+	return os.NewFile(uintptr(fd), "rfcomm"), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux || 386
+// +build !linux 386
+
+package gogsmmodem
+
+import (
+	"errors"
+	"io"
+)
+
+func dialRFCOMM(bdaddr [6]byte, channel int) (io.ReadWriteCloser, error) {
+	return nil, errors.New("Bluetooth RFCOMM is only supported on Linux")
+}
@@ -0,0 +1,16 @@
+package gogsmmodem
+
+import "testing"
+
+func TestParseBDAddr(t *testing.T) {
+	bdaddr, err := parseBDAddr("00:11:22:33:44:AA")
+	expected := [6]byte{0xaa, 0x44, 0x33, 0x22, 0x11, 0x00}
+	if err != nil || bdaddr != expected {
+		t.Errorf("Expected: %x, got %x %v", expected, bdaddr, err)
+	}
+	for _, addr := range []string{"", "00:11:22:33:44", "00:11:22:33:44:5", "00:11:22:33:44:GG"} {
+		if _, err := parseBDAddr(addr); err == nil {
+			t.Errorf("Expected: error for %q", addr)
+		}
+	}
+}
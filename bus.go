@@ -0,0 +1,183 @@
+package gogsmmodem
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Number of recent events kept by a modem's bus for late subscribers.
+var EventBusReplay = 64
+
+// Default buffer of a subscription's channel.
+var DefaultSubscriptionBuffer = 16
+
+// Topic of an event, the name of its packet's type, eg "MessageNotification".
+type Topic string
+
+// TopicOf returns the topic events of packet p are published on.
+func TopicOf(p Packet) Topic {
+	if p == nil {
+		return ""
+	}
+	t := reflect.TypeOf(p)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return Topic(t.Name())
+}
+
+// An event published on a bus
+type BusEvent struct {
+	// Increasing from 1 in the order published
+	Seq    uint64
+	Time   time.Time
+	Topic  Topic
+	Packet Packet
+}
+
+// Options for EventBus.Subscribe
+type SubscribeOptions struct {
+	// Events to receive, all if empty. Built with TopicOf, eg
+	// TopicOf(MessageNotification{}).
+	Topics []Topic
+	// Receive the recent events kept by the bus before new ones
+	Replay bool
+	// Buffer of the channel, DefaultSubscriptionBuffer if 0
+	Buffer int
+}
+
+// A subscriber's view of a bus. Events are dropped, and counted, if the
+// subscriber does not keep up. C is closed by Close or when the bus closes.
+type Subscription struct {
+	C       <-chan BusEvent
+	c       chan BusEvent
+	bus     *EventBus
+	topics  map[Topic]bool
+	dropped int
+}
+
+// Dropped returns the number of events dropped because C was full.
+func (self *Subscription) Dropped() int {
+	self.bus.lock.Lock()
+	defer self.bus.lock.Unlock()
+	return self.dropped
+}
+
+// Close stops delivery and closes C.
+func (self *Subscription) Close() {
+	self.bus.lock.Lock()
+	defer self.bus.lock.Unlock()
+	if self.bus.subs[self] {
+		delete(self.bus.subs, self)
+		close(self.c)
+	}
+}
+
+func (self *Subscription) wants(e BusEvent) bool {
+	return len(self.topics) == 0 || self.topics[e.Topic]
+}
+
+// Deliver an event, with the bus locked
+func (self *Subscription) deliver(e BusEvent) {
+	select {
+	case self.c <- e:
+	default:
+		self.dropped++
+	}
+}
+
+// In-process publish/subscribe of events to any number of subscribers,
+// keeping the most recent events to replay to late subscribers. A modem's
+// unsolicited packets are published on its bus, see Modem.Subscribe.
+type EventBus struct {
+	lock    sync.Mutex
+	clock   Clock
+	subs    map[*Subscription]bool
+	history []BusEvent
+	seq     uint64
+	closed  bool
+}
+
+// NewEventBus creates a bus keeping the last replay events.
+func NewEventBus(clock Clock, replay int) *EventBus {
+	return &EventBus{clock: clock, subs: map[*Subscription]bool{}, history: make([]BusEvent, 0, replay)}
+}
+
+// Publish p to the subscribers of its topic, without blocking.
+func (self *EventBus) Publish(p Packet) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.closed {
+		return
+	}
+	self.seq++
+	e := BusEvent{Seq: self.seq, Time: self.clock.Now(), Topic: TopicOf(p), Packet: p}
+	if cap(self.history) > 0 {
+		if len(self.history) == cap(self.history) {
+			copy(self.history, self.history[1:])
+			self.history = self.history[:len(self.history)-1]
+		}
+		self.history = append(self.history, e)
+	}
+	for sub := range self.subs {
+		if sub.wants(e) {
+			sub.deliver(e)
+		}
+	}
+}
+
+// Subscribe to events published from now on, and recent ones if
+// options.Replay. Replayed events beyond the buffer are dropped.
+func (self *EventBus) Subscribe(options SubscribeOptions) *Subscription {
+	if options.Buffer == 0 {
+		options.Buffer = DefaultSubscriptionBuffer
+	}
+	c := make(chan BusEvent, options.Buffer)
+	sub := &Subscription{C: c, c: c, bus: self, topics: map[Topic]bool{}}
+	for _, t := range options.Topics {
+		sub.topics[t] = true
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.closed {
+		close(c)
+		return sub
+	}
+	if options.Replay {
+		for _, e := range self.history {
+			if sub.wants(e) {
+				sub.deliver(e)
+			}
+		}
+	}
+	self.subs[sub] = true
+	return sub
+}
+
+// Recent returns the events kept for replay, oldest first.
+func (self *EventBus) Recent() []BusEvent {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]BusEvent(nil), self.history...)
+}
+
+// Close the bus and all subscriptions.
+func (self *EventBus) Close() {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.closed {
+		return
+	}
+	self.closed = true
+	for sub := range self.subs {
+		delete(self.subs, sub)
+		close(sub.c)
+	}
+}
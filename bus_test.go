@@ -0,0 +1,66 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus(DefaultClock, 2)
+	all := bus.Subscribe(SubscribeOptions{})
+	notifications := bus.Subscribe(SubscribeOptions{Topics: []Topic{TopicOf(MessageNotification{})}, Buffer: 1})
+	bus.Publish(MessageNotification{"SM", 1})
+	bus.Publish(LowBalance{Balance: 1})
+	bus.Publish(MessageNotification{"SM", 2})
+
+	if e := <-all.C; e.Seq != 1 || e.Topic != "MessageNotification" || e.Packet != (MessageNotification{"SM", 1}) {
+		t.Errorf("Unexpected event: %#v", e)
+	}
+	if e := <-all.C; e.Topic != "LowBalance" {
+		t.Errorf("Unexpected event: %#v", e)
+	}
+	if e := <-notifications.C; e.Packet != (MessageNotification{"SM", 1}) || notifications.Dropped() != 1 {
+		t.Errorf("Expected: first notification then one dropped, got %#v, %d dropped", e, notifications.Dropped())
+	}
+
+	late := bus.Subscribe(SubscribeOptions{Replay: true})
+	for _, seq := range []uint64{2, 3} {
+		if e := <-late.C; e.Seq != seq {
+			t.Errorf("Expected: replay of event %d, got %#v", seq, e)
+		}
+	}
+
+	notifications.Close()
+	bus.Close()
+	for _, sub := range []*Subscription{all, notifications, late} {
+		for range sub.C {
+		}
+	}
+	bus.Publish(LowBalance{})
+}
+
+func TestModemSubscribe(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, receivedReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	sub := modem.Subscribe(SubscribeOptions{Topics: []Topic{TopicOf(MessageNotification{})}, Replay: true})
+	select {
+	case e := <-sub.C:
+		if e.Packet != (MessageNotification{"SM", 5}) {
+			t.Errorf("Unexpected event: %#v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected: notification")
+	}
+	modem.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("Expected: subscription closed with the modem")
+	}
+}
@@ -0,0 +1,161 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"sync"
+)
+
+// Commands answered with information text, which some modems send without a
+// prefix
+var infoTextCommands = map[string]bool{
+	"+CGMI": true,
+	"+CGMM": true,
+	"+CGMR": true,
+	"+CGSN": true,
+	"+CCID": true,
+	"+CIMI": true,
+}
+
+// Results of identity and capability queries, which don't change until the
+// modem is reset
+type capabilityCache struct {
+	lock    sync.Mutex
+	results map[string]Packet
+}
+
+func (self *capabilityCache) get(key string) (Packet, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p, ok := self.results[key]
+	return p, ok
+}
+
+func (self *capabilityCache) put(key string, p Packet) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.results == nil {
+		self.results = map[string]Packet{}
+	}
+	self.results[key] = p
+}
+
+func (self *capabilityCache) clear() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.results = nil
+}
+
+// Send a query, or return its cached result
+func (self *Modem) cached(cmd string, args ...interface{}) (Packet, error) {
+	key := formatCommand(cmd, args...)
+	if p, ok := self.caps.get(key); ok {
+		return p, nil
+	}
+	p, err := self.send(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+	self.caps.put(key, p)
+	return p, nil
+}
+
+// InvalidateCapabilities clears the cached identity and capabilities, as
+// after reconfiguring the modem. They are cleared automatically when the
+// library resets the modem.
+func (self *Modem) InvalidateCapabilities() {
+	self.caps.clear()
+}
+
+func (self *Modem) infoText(cmd string) (string, error) {
+	packet, err := self.cached(cmd)
+	if err != nil {
+		return "", err
+	}
+	if info, ok := packet.(InfoText); ok {
+		return info.Text, nil
+	}
+	return "", errors.New("Unexpected response type")
+}
+
+// Manufacturer of the modem (+CGMI), cached until it is reset.
+func (self *Modem) Manufacturer() (string, error) {
+	return self.infoText("+CGMI")
+}
+
+// Model of the modem (+CGMM), cached until it is reset.
+func (self *Modem) Model() (string, error) {
+	return self.infoText("+CGMM")
+}
+
+// ICCID of the SIM (+CCID), cached until the modem is reset.
+func (self *Modem) ICCID() (string, error) {
+	return self.infoText("+CCID")
+}
+
+// IMSI of the SIM (+CIMI), whose first digits identify its home network,
+// cached until the modem is reset.
+func (self *Modem) IMSI() (string, error) {
+	return self.infoText("+CIMI")
+}
+
+// Operator reports the name of the network the modem is registered with
+// (+COPS), or "" if it isn't registered.
+func (self *Modem) Operator() (string, error) {
+	op, err := self.OperatorName()
+	if err != nil {
+		return "", err
+	}
+	return op.Name, nil
+}
+
+// OperatorName reports the network the modem is registered with (+COPS),
+// with its selection mode and access technology.
+func (self *Modem) OperatorName() (*NetworkOperator, error) {
+	packet, err := self.send("+COPS?")
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := packet.(NetworkOperator); ok {
+		return &op, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
+
+// SubscriberNumber reports the SIM's own number (+CNUM), or "" if the SIM
+// doesn't record it.
+func (self *Modem) SubscriberNumber() (string, error) {
+	packet, err := self.send("+CNUM")
+	if err != nil {
+		return "", err
+	}
+	if number, ok := packet.(SubscriberNumber); ok {
+		return number.Number, nil
+	}
+	return "", nil
+}
+
+// Capabilities reports the modem's capability list (+GCAP), eg "+CGSM",
+// cached until it is reset.
+func (self *Modem) Capabilities() (Capabilities, error) {
+	packet, err := self.cached("+GCAP")
+	if err != nil {
+		return nil, err
+	}
+	if caps, ok := packet.(Capabilities); ok {
+		return caps, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
+
+// CharacterSets reports the character sets the modem supports (+CSCS=?),
+// cached until it is reset.
+func (self *Modem) CharacterSets() (CharacterSets, error) {
+	packet, err := self.cached("+CSCS", "?")
+	if err != nil {
+		return nil, err
+	}
+	if sets, ok := packet.(CharacterSets); ok {
+		return sets, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
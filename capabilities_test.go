@@ -0,0 +1,53 @@
+package gogsmmodem
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var capabilitiesReplay = []string{
+	"->AT+CGMI\r\n",
+	"<-\r\nZTE CORPORATION\r\n\r\nOK\r\n",
+	"->AT+CGMM\r\n",
+	"<-\r\n+CGMM: \"MF190\"\r\n\r\nOK\r\n",
+	"->AT+GCAP\r\n",
+	"<-\r\n+GCAP: +CGSM,+FCLASS,+DS\r\n\r\nOK\r\n",
+	// after invalidation
+	"->AT+CGMM\r\n",
+	"<-\r\nMF190\r\n\r\nOK\r\n",
+}
+
+func TestCapabilities(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, capabilitiesReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if m, err := modem.Manufacturer(); err != nil || m != "ZTE CORPORATION" {
+		t.Errorf("Expected: manufacturer, got %q %v", m, err)
+	}
+	// cached results are not queried again
+	for i := 0; i < 2; i++ {
+		if m, err := modem.Model(); err != nil || m != "MF190" {
+			t.Errorf("Expected: model, got %q %v", m, err)
+		}
+		caps, err := modem.Capabilities()
+		if err != nil || !reflect.DeepEqual(caps, Capabilities{"+CGSM", "+FCLASS", "+DS"}) {
+			t.Errorf("Expected: capabilities, got %#v %v", caps, err)
+		}
+		sets, err := modem.CharacterSets()
+		if err != nil || !reflect.DeepEqual(sets, CharacterSets{"IRA", "GSM", "UCS2"}) {
+			t.Errorf("Expected: character sets, got %#v %v", sets, err)
+		}
+	}
+	modem.InvalidateCapabilities()
+	if m, err := modem.Model(); err != nil || m != "MF190" {
+		t.Errorf("Expected: model, got %q %v", m, err)
+	}
+	modem.Close()
+}
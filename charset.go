@@ -0,0 +1,104 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"log"
+)
+
+var ErrCharsetUnsupported = errors.New("UCS2 character set not supported")
+
+// Find the character sets the modem supports. If it can't say, GSM and UCS2
+// are assumed.
+func (self *Modem) negotiateCharsets() {
+	sets, err := self.CharacterSets()
+	if err != nil {
+		log.Println("Character sets unknown:", err)
+		return
+	}
+	log.Println("Character sets:", sets)
+	self.charsets = sets
+}
+
+func (self *Modem) supportsCharset(charset string) bool {
+	if charset == "UCS2" && self.profile.lacks(FeatureUCS2) {
+		return false
+	}
+	if self.charsets == nil {
+		return charset == "GSM" || charset == "UCS2"
+	}
+	for _, c := range self.charsets {
+		if c == charset {
+			return true
+		}
+	}
+	return false
+}
+
+// The encoding to use for want: want itself if the modem supports it,
+// otherwise UCS2 if supported, otherwise GSM.
+func (self *Modem) negotiate(want Encoding) Encoding {
+	if want == UCS2 && !self.supportsCharset("UCS2") {
+		log.Println("UCS2 not supported, using", self.gsmCharset())
+		return GSM
+	}
+	if want == GSM && self.gsmCharset() == "GSM" && !self.supportsCharset("GSM") &&
+		self.supportsCharset("UCS2") {
+		return UCS2
+	}
+	return want
+}
+
+// Character set for GSM encoding: GSM, or if the modem lacks it HEX, which
+// carries the same alphabet, or IRA, which is limited to ASCII
+func (self *Modem) gsmCharset() string {
+	for _, charset := range []string{"GSM", "HEX", "IRA"} {
+		if self.supportsCharset(charset) {
+			return charset
+		}
+	}
+	return "GSM"
+}
+
+// Encode a text mode message body and number for the character set in use
+func (self *Modem) encodeText(body, number string) (string, string) {
+	switch self.charset {
+	case "UCS2":
+		return unicodeEncode(body), unicodeEncode(number)
+	case "HEX":
+		return hexEncode(body), number
+	case "IRA":
+		return iraEncode(body), number
+	}
+	return gsmEncode(body), number
+}
+
+// Check a text mode message body is in the GSM alphabet in strict mode, if
+// the character set in use is GSM or HEX
+func (self *Modem) checkText(body string) error {
+	if !StrictGSM || self.charset == "UCS2" || self.charset == "IRA" {
+		return nil
+	}
+	_, err := gsmEncodeStrict(body)
+	return err
+}
+
+// Decode the body of a text mode message for the character set in use
+func (self *Modem) decodeText(body string) string {
+	return decodeCharset(body, self.charset)
+}
+
+// Decode text received in the given character set
+func decodeCharset(body, charset string) string {
+	if charset == "HEX" {
+		if d, err := hexDecode(body); err == nil {
+			return d
+		}
+	}
+	return body
+}
+
+// CharacterSet reports the character set negotiated with the modem (+CSCS),
+// for deciding how to encode text.
+func (self *Modem) CharacterSet() string {
+	return self.charset
+}
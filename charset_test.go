@@ -0,0 +1,86 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var noUCS2InitReplay = appendLists(resetReplay, simReadyReplay, []string{
+	"->AT+CSCS=?\r\n",
+	"<-\r\n+CSCS: (\"IRA\",\"PCCP437\")\r\n\r\nOK\r\n",
+	"->AT+CSCS=\"IRA\"\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSMP=49,167,0,0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSCA?\r\n",
+	"<-\r\n+CSCA: \"+447802092035\",145\r\nOK\r\n",
+	"->AT+CSCA=\"+447802092035\",145\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CMGF=1\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=2,2,0,1,0\r\n",
+	"<-\r\nOK\r\n",
+})
+
+func TestCharsetNegotiation(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(noUCS2InitReplay), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if cs := modem.CharacterSet(); cs != "IRA" {
+		t.Error("Expected: IRA, got:", cs)
+	}
+	if err := modem.SendMessage("441234567890", "Привет", UCS2); err != ErrCharsetUnsupported {
+		t.Error("Expected: UCS2 unsupported, got:", err)
+	}
+	modem.Close()
+}
+
+var hexInitReplay = appendLists(resetReplay, simReadyReplay, []string{
+	"->AT+CSCS=?\r\n",
+	"<-\r\n+CSCS: (\"IRA\",\"HEX\")\r\n\r\nOK\r\n",
+	"->AT+CSCS=\"HEX\"\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSMP=49,167,0,0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSCA?\r\n",
+	"<-\r\n+CSCA: \"+447802092035\",145\r\nOK\r\n",
+	"->AT+CSCA=\"+447802092035\",145\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CMGF=1\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=2,2,0,1,0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CMGS=\"441234567890\"\r\n",
+	"<-> \r\n",
+	"->013130\x1a",
+	"<-\r\n+CMGS: 7\r\n\r\nOK\r\n",
+	"->AT+CMGR=1\r\n",
+	"<-\r\n+CMGR: \"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\"\r\n4869200131\r\n\r\nOK\r\n",
+})
+
+func TestCharsetHex(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(hexInitReplay), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if cs := modem.CharacterSet(); cs != "HEX" {
+		t.Error("Expected: HEX, got:", cs)
+	}
+	if err := modem.SendMessage("441234567890", "£10"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	msg, err := modem.GetMessage(1)
+	if err != nil || msg.Body != "Hi £1" {
+		t.Errorf("Expected: decoded body, got %#v %v", msg, err)
+	}
+	modem.Close()
+}
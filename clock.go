@@ -0,0 +1,28 @@
+package gogsmmodem
+
+import "time"
+
+// Clock provides the time functions used by the modem, so they can be
+// replaced in tests.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Clock used by modems opened after it is set. Defaults to the system clock.
+var DefaultClock Clock = systemClock{}
@@ -0,0 +1,201 @@
+// gsmctl drives a GSM modem from the command line, for diagnosing modems in
+// the field.
+//
+//	gsmctl [-port /dev/ttyUSB0] [-baud 115200] [-debug] [-text] [-profile file|name] [-readonly] command [args]
+//
+// Commands:
+//
+//	send <telephone> <message>  send a message
+//	inbox [filter]              list stored messages, default ALL
+//	delete <index>              delete a stored message
+//	signal                      show signal quality and registration
+//	monitor                     print unsolicited results until interrupted
+//	data                        show packet data counted by the modem
+//	ussd <code>                 send a USSD request, eg *100#, and print the
+//	                            reply
+//	conformance                 check the commands supported, printing a JSON
+//	                            profile
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/barnybug/gogsmmodem"
+	"github.com/barnybug/gogsmmodem/conformance"
+	"github.com/tarm/serial"
+)
+
+var (
+	port     = flag.String("port", "/dev/ttyUSB0", "serial port of the modem")
+	baud     = flag.Int("baud", 115200, "baud rate")
+	debug    = flag.Bool("debug", false, "log communication with the modem")
+	text     = flag.Bool("text", false, "use text mode rather than PDU mode")
+	profile  = flag.String("profile", "", "JSON profile of the modem's quirks, or a built-in profile name, eg huawei")
+	readOnly = flag.Bool("readonly", false, "refuse to send, write or delete messages")
+)
+
+var commands = map[string]func(modem *gogsmmodem.Modem, args []string) error{
+	"send":        send,
+	"inbox":       inbox,
+	"delete":      deleteMessage,
+	"signal":      signal,
+	"monitor":     monitor,
+	"ussd":        ussd,
+	"data":        dataUsage,
+	"conformance": checkConformance,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: gsmctl [flags] send|inbox|delete|signal|monitor|data|ussd|conformance [args]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+	}
+	if !*debug {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	conf := serial.Config{Name: *port, Baud: *baud}
+	opts := gogsmmodem.Options{
+		Debug:       *debug,
+		TextMode:    *text,
+		ProfileFile: *profile,
+		ReadOnly:    *readOnly,
+	}
+	if gogsmmodem.Profiles[*profile] != nil {
+		opts.ProfileFile, opts.ProfileName = "", *profile
+	}
+	modem, err := gogsmmodem.OpenWithOptions(&conf, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Opening modem:", err)
+		os.Exit(1)
+	}
+	defer modem.Close()
+	if err := command(modem, flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func send(modem *gogsmmodem.Modem, args []string) error {
+	if len(args) < 2 {
+		usage()
+	}
+	res, err := modem.Send(gogsmmodem.OutgoingMessage{
+		Telephone: args[0],
+		Body:      strings.Join(args[1:], " "),
+		Encoding:  gogsmmodem.Auto,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Sent, reference", res.Reference)
+	return nil
+}
+
+func inbox(modem *gogsmmodem.Modem, args []string) error {
+	filter := "ALL"
+	if len(args) > 0 {
+		filter = args[0]
+	}
+	msgs, err := modem.ListMessages(filter)
+	if err != nil {
+		return err
+	}
+	for _, msg := range *msgs {
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\n", msg.Index, msg.Status, msg.Telephone,
+			msg.Timestamp.Format("2006-01-02 15:04:05"), msg.Body)
+	}
+	return nil
+}
+
+func deleteMessage(modem *gogsmmodem.Modem, args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	return modem.DeleteMessage(n)
+}
+
+func signal(modem *gogsmmodem.Modem, args []string) error {
+	sq, err := modem.SignalQuality()
+	if err != nil {
+		return err
+	}
+	if sq.Known() {
+		fmt.Printf("Signal: %d dBm (RSSI %d, BER %d)\n", sq.DBm(), sq.RSSI, sq.BER)
+	} else {
+		fmt.Println("Signal: unknown")
+	}
+	reg, err := modem.NetworkRegistration()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Registered: %v (status %d)\n", reg.Registered(), reg.Status)
+	return nil
+}
+
+func monitor(modem *gogsmmodem.Modem, args []string) error {
+	for p := range modem.OOB {
+		switch p := p.(type) {
+		case gogsmmodem.MessageNotification:
+			msg, err := modem.GetMessageFrom(p.Storage, p.Index)
+			if err != nil {
+				fmt.Println("Message", p.Index, "unreadable:", err)
+				continue
+			}
+			fmt.Printf("Message %d from %s: %s\n", p.Index, msg.Telephone, msg.Body)
+		default:
+			fmt.Printf("%#v\n", p)
+		}
+	}
+	return nil
+}
+
+func dataUsage(modem *gogsmmodem.Modem, args []string) error {
+	usage, err := modem.DataUsage()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Sent: %d bytes\nReceived: %d bytes\n", usage.Sent, usage.Received)
+	return nil
+}
+
+func ussd(modem *gogsmmodem.Modem, args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+	r, err := modem.USSD(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(r.Text)
+	return nil
+}
+
+func checkConformance(modem *gogsmmodem.Modem, args []string) error {
+	profile, err := conformance.Run(modem)
+	if err != nil {
+		return err
+	}
+	return profile.WriteJSON(os.Stdout)
+}
@@ -0,0 +1,46 @@
+package gogsmmodem
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+)
+
+// Information element marking a compressed message, from the range for SME
+// to SME use, and its value for raw deflate
+const (
+	ieiCompressed   = 0x80
+	compressDeflate = 0x01
+)
+
+// The user data header and body deflated, for a message taking more than one
+// segment as text which fits in one compressed, or nil if compressing would
+// not save a segment
+func compressBody(body string, enc Encoding) ([]byte, []byte) {
+	if SegmentCount(body, enc) <= 1 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write([]byte(body))
+	w.Close()
+	udh := pdu.AppendElement(nil, ieiCompressed, []byte{compressDeflate})
+	if 1+len(udh)+buf.Len() > 140 {
+		return nil, nil
+	}
+	return udh, buf.Bytes()
+}
+
+// The body of a received message, inflated if it was compressed
+func decompressBody(p *pdu.Message) (string, bool) {
+	if e := p.Element(ieiCompressed); len(e) != 1 || e[0] != compressDeflate {
+		return string(p.Data), false
+	}
+	body, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(p.Data)))
+	if err != nil {
+		return string(p.Data), false
+	}
+	return string(body), true
+}
@@ -0,0 +1,46 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+	"github.com/tarm/serial"
+)
+
+func TestSendCompressed(t *testing.T) {
+	body := strings.Repeat("temp=21.5 humidity=40 battery=98 ", 8)
+	udh, data := compressBody(body, GSM)
+	if data == nil {
+		t.Fatal("Expected: body compressed into one segment")
+	}
+	hexpdu, length, _ := pdu.EncodeSubmitData("441234567890", udh, data)
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			fmt.Sprintf("->AT+CMGS=%d\r\n", length),
+			"<-> \r\n",
+			"->" + hexpdu + "\x1a",
+			"<-\r\n+CMGS: 12\r\n\r\nOK\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.MaxSegments = 1
+	res, err := modem.Send(OutgoingMessage{Telephone: "441234567890", Body: body, Compress: true})
+	if err != nil || res.Reference != 12 {
+		t.Errorf("Expected: sent compressed, got %#v %v", res, err)
+	}
+	modem.Close()
+
+	msg, err := decodePDUMessage(Message{Body: hexpdu})
+	if err != nil || msg.Body != body || !msg.Compressed {
+		t.Errorf("Expected: body inflated, got %#v %v", msg, err)
+	}
+	if _, data := compressBody("Short", GSM); data != nil {
+		t.Error("Expected: single segment message left alone")
+	}
+}
@@ -0,0 +1,214 @@
+// Package conformance checks which parts of the AT command set a live modem
+// supports, the unsolicited results it emits and how quickly it responds,
+// producing a Profile which can be saved as JSON and used to configure the
+// library for the modem.
+//
+//	modem, _ := gogsmmodem.Open(&conf, false)
+//	profile, _ := conformance.Run(modem)
+//	profile.WriteJSON(os.Stdout)
+package conformance
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Commands checked by Run, with their test form, eg AT+CNMI=?, which only
+// reports the parameters supported and changes nothing.
+var Commands = []string{
+	// messaging
+	"+CMGF", "+CSMS", "+CPMS", "+CSCA", "+CSCS", "+CSMP", "+CNMI", "+CNMA",
+	"+CMGS", "+CMGW", "+CMGR", "+CMGL", "+CMGD", "+CMSS",
+	// network and SIM
+	"+CPIN", "+CREG", "+CGREG", "+COPS", "+CSQ", "+CFUN", "+CLIP", "+CUSD",
+	// power
+	"+CSCLK", "+CPOWD",
+}
+
+// Times AT is sent to measure the round trip
+var Rounds = 5
+
+// The modem operations used, as provided by *gogsmmodem.Modem.
+type Modem interface {
+	Command(cmd string, args ...interface{}) (gogsmmodem.Packet, error)
+	RawLines() <-chan gogsmmodem.RawLine
+	Manufacturer() (string, error)
+	Model() (string, error)
+	Capabilities() (gogsmmodem.Capabilities, error)
+	CharacterSets() (gogsmmodem.CharacterSets, error)
+}
+
+// Support for a command
+type Support struct {
+	Supported bool
+	// Response to the test form, the parameters supported
+	Response string `json:",omitempty"`
+	// Error if unsupported
+	Error   string `json:",omitempty"`
+	Latency time.Duration
+}
+
+// What a modem supports, from Run
+type Profile struct {
+	Manufacturer  string
+	Model         string
+	Revision      string   `json:",omitempty"`
+	Capabilities  []string `json:",omitempty"`
+	CharacterSets []string `json:",omitempty"`
+	// Support for each of Commands by name
+	Commands map[string]Support
+	// Prefixes of unsolicited results seen during the run, eg "+CMTI"
+	Unsolicited []string `json:",omitempty"`
+	// Slowest and median round trip of AT
+	MaxRoundTrip    time.Duration
+	MedianRoundTrip time.Duration
+}
+
+// Is the command supported
+func (self *Profile) Supports(cmd string) bool {
+	return self.Commands[cmd].Supported
+}
+
+// A gogsmmodem.Profile marking the features found unsupported, as a starting
+// point for configuring the library for the modem
+func (self *Profile) ModemProfile() *gogsmmodem.Profile {
+	profile := &gogsmmodem.Profile{Name: strings.TrimSpace(self.Manufacturer + " " + self.Model)}
+	if cmgf := self.Commands["+CMGF"]; cmgf.Supported && !strings.Contains(cmgf.Response, "0") {
+		profile.Unsupported = append(profile.Unsupported, gogsmmodem.FeaturePDU)
+	}
+	if !self.Supports("+CSCS") {
+		profile.Unsupported = append(profile.Unsupported, gogsmmodem.FeatureCharsets)
+	}
+	if !self.Supports("+CNMI") {
+		profile.Unsupported = append(profile.Unsupported, gogsmmodem.FeatureCNMI)
+	}
+	return profile
+}
+
+// Write the profile as indented JSON
+func (self *Profile) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	_, err = w.Write(b)
+	return err
+}
+
+// Collects lines read from the modem while a check runs
+type recorder struct {
+	lines       <-chan gogsmmodem.RawLine
+	unsolicited map[string]bool
+}
+
+// Lines read since the last call, noting unsolicited results for prefixes
+// other than cmd's
+func (self *recorder) take(cmd string) []string {
+	var ret []string
+	for {
+		select {
+		case line, ok := <-self.lines:
+			if !ok {
+				return ret
+			}
+			if line.Direction != gogsmmodem.EventRead {
+				continue
+			}
+			prefix := strings.SplitN(line.Line, ":", 2)[0]
+			if strings.HasPrefix(prefix, "+") && prefix != cmd {
+				self.unsolicited[prefix] = true
+				continue
+			}
+			ret = append(ret, line.Line)
+		default:
+			return ret
+		}
+	}
+}
+
+// Discard lines read since the last call
+func (self *recorder) skip() {
+	for {
+		select {
+		case _, ok := <-self.lines:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Run the checks, which leave the modem's settings unchanged. The modem's
+// RawLines channel is read while running.
+func Run(modem Modem) (*Profile, error) {
+	rec := &recorder{lines: modem.RawLines(), unsolicited: map[string]bool{}}
+	clock := gogsmmodem.DefaultClock
+	profile := &Profile{Commands: map[string]Support{}}
+
+	var trips []time.Duration
+	for i := 0; i < Rounds; i++ {
+		start := clock.Now()
+		if _, err := modem.Command(""); err != nil {
+			return nil, err
+		}
+		trips = append(trips, clock.Now().Sub(start))
+	}
+	rec.take("")
+	if len(trips) > 0 {
+		sort.Slice(trips, func(i, j int) bool { return trips[i] < trips[j] })
+		profile.MaxRoundTrip = trips[len(trips)-1]
+		profile.MedianRoundTrip = trips[len(trips)/2]
+	}
+
+	var err error
+	if profile.Manufacturer, err = modem.Manufacturer(); err != nil {
+		return nil, err
+	}
+	if profile.Model, err = modem.Model(); err != nil {
+		return nil, err
+	}
+	if p, err := modem.Command("+CGMR"); err == nil {
+		if info, ok := p.(gogsmmodem.InfoText); ok {
+			profile.Revision = info.Text
+		}
+	}
+	if caps, err := modem.Capabilities(); err == nil {
+		profile.Capabilities = caps
+	}
+	if charsets, err := modem.CharacterSets(); err == nil {
+		profile.CharacterSets = charsets
+	}
+	rec.skip()
+
+	for _, cmd := range Commands {
+		start := clock.Now()
+		_, err := modem.Command(cmd + "=?")
+		support := Support{Latency: clock.Now().Sub(start)}
+		lines := rec.take(cmd)
+		if err != nil {
+			support.Error = err.Error()
+		} else {
+			support.Supported = true
+			for _, line := range lines {
+				if strings.HasPrefix(line, cmd+":") {
+					support.Response = strings.TrimSpace(strings.TrimPrefix(line, cmd+":"))
+				}
+			}
+		}
+		profile.Commands[cmd] = support
+	}
+
+	for prefix := range rec.unsolicited {
+		profile.Unsolicited = append(profile.Unsolicited, prefix)
+	}
+	sort.Strings(profile.Unsolicited)
+	return profile, nil
+}
@@ -0,0 +1,101 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Answers test forms of the commands in responses, failing others
+type fakeModem struct {
+	lines     chan gogsmmodem.RawLine
+	responses map[string][]string
+}
+
+func (self *fakeModem) read(line string) {
+	self.lines <- gogsmmodem.RawLine{Direction: gogsmmodem.EventRead, Line: line}
+}
+
+func (self *fakeModem) Command(cmd string, args ...interface{}) (gogsmmodem.Packet, error) {
+	self.lines <- gogsmmodem.RawLine{Direction: gogsmmodem.EventWrite, Line: "AT" + cmd + "\r\n"}
+	if cmd == "+CGMR" {
+		self.read("+CGMR: 1.0")
+		return gogsmmodem.InfoText{Command: "+CGMR", Text: "1.0"}, nil
+	}
+	lines, ok := self.responses[cmd]
+	if !ok && cmd != "" {
+		self.read("ERROR")
+		return nil, gogsmmodem.ERROR{}
+	}
+	for _, line := range lines {
+		self.read(line)
+	}
+	self.read("OK")
+	return gogsmmodem.OK{}, nil
+}
+
+func (self *fakeModem) RawLines() <-chan gogsmmodem.RawLine {
+	return self.lines
+}
+
+func (self *fakeModem) Manufacturer() (string, error) {
+	return "ACME", nil
+}
+
+func (self *fakeModem) Model() (string, error) {
+	return "M1", nil
+}
+
+func (self *fakeModem) Capabilities() (gogsmmodem.Capabilities, error) {
+	return gogsmmodem.Capabilities{"+CGSM"}, nil
+}
+
+func (self *fakeModem) CharacterSets() (gogsmmodem.CharacterSets, error) {
+	return gogsmmodem.CharacterSets{"GSM", "UCS2"}, nil
+}
+
+func TestRun(t *testing.T) {
+	modem := &fakeModem{
+		lines: make(chan gogsmmodem.RawLine, 100),
+		responses: map[string][]string{
+			"+CMGF=?": {"+CMGF: (1)"},
+			"+CNMI=?": {"+CMTI: \"SM\",3", "+CNMI: (0-2),(0-3),(0,2),(0-2),(0,1)"},
+			"+CSQ=?":  {"+CSQ: (0-31,99),(0-7,99)"},
+		},
+	}
+	profile, err := Run(modem)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if profile.Manufacturer != "ACME" || profile.Model != "M1" || profile.Revision != "1.0" {
+		t.Errorf("Unexpected identity: %#v", profile)
+	}
+	if !profile.Supports("+CMGF") || profile.Commands["+CMGF"].Response != "(1)" {
+		t.Errorf("Expected: +CMGF supported, got %#v", profile.Commands["+CMGF"])
+	}
+	if s := profile.Commands["+CNMI"]; !s.Supported || s.Response != "(0-2),(0-3),(0,2),(0-2),(0,1)" {
+		t.Errorf("Expected: +CNMI supported, got %#v", s)
+	}
+	if s := profile.Commands["+CUSD"]; s.Supported || s.Error == "" {
+		t.Errorf("Expected: +CUSD unsupported, got %#v", s)
+	}
+	if len(profile.Unsolicited) != 1 || profile.Unsolicited[0] != "+CMTI" {
+		t.Errorf("Expected: +CMTI seen, got %v", profile.Unsolicited)
+	}
+	seed := profile.ModemProfile()
+	if seed.Name != "ACME M1" || !reflect.DeepEqual(seed.Unsupported, []string{gogsmmodem.FeaturePDU, gogsmmodem.FeatureCharsets}) {
+		t.Errorf("Unexpected modem profile: %#v", seed)
+	}
+
+	var buf bytes.Buffer
+	if err := profile.WriteJSON(&buf); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	var decoded Profile
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Commands["+CSQ"].Response != "(0-31,99),(0-7,99)" {
+		t.Errorf("Expected: profile round trips, got %#v %v", decoded, err)
+	}
+}
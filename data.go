@@ -0,0 +1,200 @@
+package gogsmmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Silence required either side of the escape sequence for the modem to
+// recognise it
+var EscapeGuard = 1 * time.Second
+
+// Returns the modem from data mode to command mode
+const escapeSequence = "+++"
+
+var noCarrier = []byte("\r\nNO CARRIER\r\n")
+
+// Interval between reads of a data stream while the port has nothing to read
+var DataPollInterval = 100 * time.Millisecond
+
+var ErrDataModeEnded = errors.New("Data mode ended")
+
+// The raw stream of a data connection, as for CSD, PPP or firmware uploads.
+// While it is open the parser is stopped and other commands wait.
+type DataConn struct {
+	modem *Modem
+	// held while reading, so Close waits for a read in progress
+	reading sync.Mutex
+	lock    sync.Mutex
+	ended   bool
+	// ended by the escape sequence rather than NO CARRIER
+	escaped bool
+	// data read but not yet returned, and the end of the data read held
+	// back as it may be the start of NO CARRIER
+	ready []byte
+	tail  []byte
+	// closed when data mode ends
+	done chan struct{}
+}
+
+// DataMode sends a command answered by CONNECT, such as "D*99#" to start
+// PPP, and returns the data stream which follows. Data mode ends when the
+// modem reports NO CARRIER, or when the DataConn is closed, which escapes to
+// command mode with +++ and hangs up. The command's class must include
+// CONNECT in FinalResults.
+func (self *Modem) DataMode(cmd string, args ...interface{}) (*DataConn, error) {
+	if err := self.sched.acquire(context.Background(), PriorityNormal); err != nil {
+		return nil, err
+	}
+	conn := &DataConn{modem: self, done: make(chan struct{})}
+	self.setDataConn(conn)
+	packet, err := self.request(self.Timeout, cmd, args...)
+	if r, ok := packet.(FinalResult); err == nil && ok && startsWith(r.Code, "CONNECT") {
+		return conn, nil
+	}
+	self.setDataConn(nil)
+	self.sched.release()
+	if r, ok := packet.(FinalResult); err == nil && ok {
+		err = errors.New("No connection: " + r.Code)
+	} else if err == nil {
+		err = errors.New("Unexpected response type")
+	}
+	return nil, err
+}
+
+func (self *Modem) setDataConn(conn *DataConn) {
+	self.dataLock.Lock()
+	self.data = conn
+	self.dataLock.Unlock()
+}
+
+func (self *Modem) dataConn() *DataConn {
+	self.dataLock.Lock()
+	defer self.dataLock.Unlock()
+	return self.data
+}
+
+// Read from the data stream, returning io.EOF once data mode has ended. If the
+// port has no read timeout, stop reading before closing.
+func (self *DataConn) Read(b []byte) (int, error) {
+	self.reading.Lock()
+	defer self.reading.Unlock()
+	for {
+		if len(self.ready) > 0 {
+			n := copy(b, self.ready)
+			self.ready = self.ready[n:]
+			return n, nil
+		}
+		if self.isEnded() {
+			return 0, io.EOF
+		}
+		chunk := make([]byte, len(b))
+		n, err := self.modem.reader.Read(chunk)
+		data := append(self.tail, chunk[:n]...)
+		if i := bytes.Index(data, noCarrier); i != -1 {
+			// call dropped, the modem is back in command mode
+			if self.end(false) {
+				self.finish()
+			}
+			self.ready, self.tail = data[:i], nil
+			continue
+		}
+		held := partialSuffix(data, noCarrier)
+		self.ready, self.tail = data[:len(data)-held], data[len(data)-held:]
+		if err == io.EOF && n == 0 {
+			// read timeout
+			self.modem.clock.Sleep(DataPollInterval)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			if self.end(false) {
+				self.finish()
+			}
+			self.ready = append(self.ready, self.tail...)
+			self.tail = nil
+			n := copy(b, self.ready)
+			self.ready = self.ready[n:]
+			return n, err
+		}
+	}
+}
+
+// Length of the longest end of data which is the start of marker
+func partialSuffix(data, marker []byte) int {
+	n := len(marker) - 1
+	if n > len(data) {
+		n = len(data)
+	}
+	for ; n > 0; n-- {
+		if bytes.HasPrefix(marker, data[len(data)-n:]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// Write to the data stream
+func (self *DataConn) Write(b []byte) (int, error) {
+	if self.isEnded() {
+		return 0, ErrDataModeEnded
+	}
+	return self.modem.port.Write(b)
+}
+
+// Close escapes to command mode and hangs up, unless the modem has already
+// left data mode.
+func (self *DataConn) Close() error {
+	self.reading.Lock()
+	defer self.reading.Unlock()
+	if !self.end(true) {
+		return nil
+	}
+	defer self.finish()
+	if !self.escaped {
+		return ErrPortClosed
+	}
+	// the escape sequence is answered like a command
+	self.modem.generation++
+	if _, err := self.modem.receiveTimeout(self.modem.Timeout); err != nil {
+		return err
+	}
+	_, err := self.modem.request(self.modem.Timeout, "H")
+	return err
+}
+
+func (self *DataConn) isEnded() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.ended
+}
+
+// Release the modem for other commands
+func (self *DataConn) finish() {
+	self.modem.setDataConn(nil)
+	self.modem.sched.release()
+}
+
+// Leave data mode, with the escape sequence if escape is set, handing the
+// port back to the parser. Returns false if data mode had already ended.
+func (self *DataConn) end(escape bool) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.ended {
+		return false
+	}
+	self.ended = true
+	if escape {
+		self.modem.clock.Sleep(EscapeGuard)
+		self.modem.tapWrite(escapeSequence)
+		if _, err := self.modem.port.Write([]byte(escapeSequence)); err != nil {
+			escape = false
+		}
+	}
+	self.escaped = escape
+	close(self.done)
+	return true
+}
@@ -0,0 +1,136 @@
+package gogsmmodem
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var dataModeReplay = []string{
+	"->ATD*99#\r\n",
+	"<-\r\nCONNECT 115200\r\n~ppp",
+	"->~lcp",
+	"<-~ack",
+	"->+++",
+	"<-\r\nOK\r\n",
+	"->ATH\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSQ\r\n",
+	"<-\r\n+CSQ: 17,99\r\n\r\nOK\r\n",
+}
+
+func TestDataMode(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, dataModeReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	conn, err := modem.DataMode("D*99#")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	b := make([]byte, 16)
+	if n, err := conn.Read(b); err != nil || string(b[:n]) != "~ppp" {
+		t.Errorf("Expected: ~ppp, got %q %v", b[:n], err)
+	}
+	conn.Write([]byte("~lcp"))
+	if n, err := conn.Read(b); err != nil || string(b[:n]) != "~ack" {
+		t.Errorf("Expected: ~ack, got %q %v", b[:n], err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	// back in command mode
+	if sq, err := modem.SignalQuality(); err != nil || sq.RSSI != 17 {
+		t.Errorf("Expected: signal quality, got %v %v", sq, err)
+	}
+	modem.Close()
+}
+
+var dataModeDroppedReplay = []string{
+	"->ATD12345\r\n",
+	"<-\r\nCONNECT 9600\r\n",
+	"->hello",
+	"<-world\r\nNO CARRIER\r\n",
+	"->ATD12345\r\n",
+	"<-\r\nBUSY\r\n",
+}
+
+func TestDataModeNoCarrier(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, dataModeDroppedReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.Numbers.AllowShortCodes = true
+	conn, err := modem.DataMode("D12345")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	conn.Write([]byte("hello"))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil || string(data) != "world" {
+		t.Errorf("Expected: world, got %q %v", data, err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	_, err = modem.DataMode("D12345")
+	if err == nil || err.Error() != "No connection: BUSY" {
+		t.Error("Expected: no connection, got:", err)
+	}
+	modem.Close()
+}
+
+func TestDataModeNoCarrierSplit(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			"->ATD12345\r\n",
+			"<-\r\nCONNECT 9600\r\n",
+			"->hello",
+			"<-world\r\n",
+			"<-NO CAR",
+			"<-RIER\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.Numbers.AllowShortCodes = true
+	conn, err := modem.DataMode("D12345")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	conn.Write([]byte("hello"))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil || string(data) != "world" {
+		t.Errorf("Expected: world, got %q %v", data, err)
+	}
+	conn.Close()
+	modem.Close()
+}
+
+func TestPartialSuffix(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected int
+	}{
+		{"world", 0},
+		{"world\r", 1},
+		{"world\r\nNO CAR", 8},
+		{"\r\nNO CARRIER\r", 13},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if n := partialSuffix([]byte(test.data), noCarrier); n != test.expected {
+			t.Errorf("Expected: %d for %q, got %d", test.expected, test.data, n)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Packet data counted by the modem, see DataUsage
+type DataUsage struct {
+	// Bytes sent and received since the counters were last reset
+	Sent     uint64
+	Received uint64
+	// Duration of the current or last connection, if the modem reports it
+	Connected time.Duration
+}
+
+var ErrDataUsageUnsupported = errors.New("Data usage counters not supported by modem")
+
+// Vendor commands reading and resetting the data counters, by manufacturer
+var dataCounterCommands = []struct {
+	manufacturer string
+	query        string
+	reset        string
+}{
+	{"quectel", "+QGDCNT?", "+QGDCNT=0"},
+	{"huawei", "^DSFLOWQRY", "^DSFLOWCLR"},
+}
+
+// The data counter commands for the modem's manufacturer
+func (self *Modem) dataCounters() (query, reset string, err error) {
+	manufacturer, err := self.Manufacturer()
+	if err != nil {
+		return "", "", err
+	}
+	manufacturer = strings.ToLower(manufacturer)
+	for _, c := range dataCounterCommands {
+		if strings.Contains(manufacturer, c.manufacturer) {
+			return c.query, c.reset, nil
+		}
+	}
+	return "", "", ErrDataUsageUnsupported
+}
+
+// DataUsage reads the packet data counters of modems that keep them (Quectel
+// +QGDCNT, Huawei ^DSFLOWQRY), failing with ErrDataUsageUnsupported for
+// others.
+func (self *Modem) DataUsage() (*DataUsage, error) {
+	query, _, err := self.dataCounters()
+	if err != nil {
+		return nil, err
+	}
+	p, err := self.send(query)
+	if err != nil {
+		return nil, err
+	}
+	if usage, ok := p.(DataUsage); ok {
+		return &usage, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
+
+// ResetDataUsage zeroes the modem's packet data counters.
+func (self *Modem) ResetDataUsage() error {
+	_, reset, err := self.dataCounters()
+	if err != nil {
+		return err
+	}
+	_, err = self.send(reset)
+	return err
+}
+
+// Parse ^DSFLOWQRY: last connection time (seconds), sent and received bytes,
+// then the same totalled over all connections, all in hex
+func parseDSFlow(uargs string) Packet {
+	fields := strings.Split(uargs, ",")
+	if len(fields) != 6 {
+		return UnknownPacket{"^DSFLOWQRY", []interface{}{uargs}}
+	}
+	var values [6]uint64
+	for i, f := range fields {
+		v, err := strconv.ParseUint(strings.TrimSpace(f), 16, 64)
+		if err != nil {
+			return UnknownPacket{"^DSFLOWQRY", []interface{}{uargs}}
+		}
+		values[i] = v
+	}
+	return DataUsage{Sent: values[4], Received: values[5], Connected: time.Duration(values[0]) * time.Second}
+}
@@ -0,0 +1,65 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func openDataUsage(t *testing.T, replay []string) *Modem {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, replay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	return modem
+}
+
+func TestDataUsageQuectel(t *testing.T) {
+	modem := openDataUsage(t, []string{
+		"->AT+CGMI\r\n",
+		"<-\r\nQuectel\r\n\r\nOK\r\n",
+		"->AT+QGDCNT?\r\n",
+		"<-\r\n+QGDCNT: 3246,4532\r\n\r\nOK\r\n",
+		"->AT+QGDCNT=0\r\n",
+		"<-\r\nOK\r\n",
+	})
+	defer modem.Close()
+	usage, err := modem.DataUsage()
+	if err != nil || *usage != (DataUsage{Sent: 3246, Received: 4532}) {
+		t.Errorf("Expected: counters, got %#v, %v", usage, err)
+	}
+	if err := modem.ResetDataUsage(); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+}
+
+func TestDataUsageHuawei(t *testing.T) {
+	modem := openDataUsage(t, []string{
+		"->AT+CGMI\r\n",
+		"<-\r\nhuawei\r\n\r\nOK\r\n",
+		"->AT^DSFLOWQRY\r\n",
+		"<-\r\n^DSFLOWQRY:0000003C,0000000000000400,0000000000001000,00000E10,0000000000010000,00000000000A0000\r\n\r\nOK\r\n",
+	})
+	defer modem.Close()
+	usage, err := modem.DataUsage()
+	expected := DataUsage{Sent: 0x10000, Received: 0xA0000, Connected: time.Minute}
+	if err != nil || *usage != expected {
+		t.Errorf("Expected: %#v, got %#v, %v", expected, usage, err)
+	}
+}
+
+func TestDataUsageUnsupported(t *testing.T) {
+	modem := openDataUsage(t, []string{
+		"->AT+CGMI\r\n",
+		"<-\r\nZTE CORPORATION\r\n\r\nOK\r\n",
+	})
+	defer modem.Close()
+	if _, err := modem.DataUsage(); err != ErrDataUsageUnsupported {
+		t.Error("Expected: ErrDataUsageUnsupported, got:", err)
+	}
+}
@@ -0,0 +1,41 @@
+package gogsmmodem
+
+import (
+	"context"
+	"errors"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+)
+
+// Decode a hex SMS-STATUS-REPORT, or nil if it is not one
+func decodeDeliveryReport(hexpdu string) *DeliveryReport {
+	p, err := pdu.Decode(hexpdu)
+	if err != nil || p.Type != pdu.StatusReport {
+		return nil
+	}
+	return &DeliveryReport{int(p.Reference), p.Address, p.Timestamp, p.Discharged, int(p.Status)}
+}
+
+// GetDeliveryReport reads a delivery report the modem stored, as notified by
+// +CDSI, in PDU mode even if the modem is in text mode.
+func (self *Modem) GetDeliveryReport(n DeliveryReportNotification) (*DeliveryReport, error) {
+	var packet Packet
+	err := self.hold(context.Background(), func() error {
+		return self.inStorage(n.Storage, func() error {
+			return self.inPDUMode(func() error {
+				var err error
+				packet, err = self.request(self.Timeout, "+CMGR", n.Index)
+				return err
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if msg, ok := packet.(Message); ok && isPDUMessage(msg) {
+		if report := decodeDeliveryReport(msg.Body); report != nil {
+			return report, nil
+		}
+	}
+	return nil, errors.New("Delivery report not found")
+}
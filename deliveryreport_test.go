@@ -0,0 +1,58 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+	"github.com/tarm/serial"
+)
+
+const statusReportPDU = "00062A0C91442143658709412010517034004120105170540000"
+
+func TestParseDeliveryReport(t *testing.T) {
+	parser := NewParser()
+	d := &recordingDispatcher{}
+	for _, line := range []string{
+		"+CDS: 25", statusReportPDU,
+		`+CDS: 6,42,"+441234567890",145,"14/02/01,15:07:43+00","14/02/01,15:07:45+00",0`,
+		`+CDSI: "SR",3`,
+	} {
+		parser.Line(line, d)
+	}
+	report := DeliveryReport{42, "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), time.Date(2014, 2, 1, 15, 7, 45, 0, time.UTC), 0}
+	expected := []Packet{report, report, DeliveryReportNotification{"SR", 3}}
+	if !reflect.DeepEqual(d.unsolicited, expected) {
+		t.Errorf("Expected: %#v, got %#v", expected, d.unsolicited)
+	}
+	if !report.Delivered() || report.Pending() {
+		t.Error("Expected: delivered")
+	}
+}
+
+func TestSendStatusReport(t *testing.T) {
+	hexpdu, length, _ := pdu.Encode(pdu.SMSSubmit{Address: "+441234567890", Text: "Hi", StatusReport: true})
+	replay := appendLists(initReplay, []string{
+		fmt.Sprintf("->AT+CMGS=%d\r\n", length), "<-> \r\n", "->" + hexpdu + "\x1a", "<-\r\n+CMGS: 42\r\n\r\nOK\r\n",
+		"->AT+CMGR=3\r\n", "<-\r\n+CMGR: 0,,25\r\n" + statusReportPDU + "\r\n\r\nOK\r\n",
+	})
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(replay), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	res, err := modem.Send(OutgoingMessage{Telephone: "+441234567890", Body: "Hi", StatusReport: true})
+	if err != nil || res.Reference != 42 {
+		t.Errorf("Expected: reference 42, got %#v %v", res, err)
+	}
+	report, err := modem.GetDeliveryReport(DeliveryReportNotification{"", 3})
+	if err != nil || report.Reference != res.Reference || !report.Delivered() {
+		t.Errorf("Expected: report for the message, got %#v %v", report, err)
+	}
+	modem.Close()
+}
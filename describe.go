@@ -0,0 +1,156 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Tables of Descriptions
+const (
+	TableCMS          = "+CMS ERROR"
+	TableCME          = "+CME ERROR"
+	TableRegistration = "+CREG"
+)
+
+// Descriptions of codes by table, eg TableCMS, then code
+type Descriptions map[string]map[int]string
+
+// English descriptions, from 3GPP TS 27.005 and 27.007
+var EnglishDescriptions = Descriptions{
+	TableCMS: {
+		1:   "Unassigned (unallocated) number",
+		8:   "Operator determined barring",
+		10:  "Call barred",
+		21:  "Short message transfer rejected",
+		27:  "Destination out of service",
+		28:  "Unidentified subscriber",
+		29:  "Facility rejected",
+		30:  "Unknown subscriber",
+		38:  "Network out of order",
+		41:  "Temporary failure",
+		42:  "Congestion",
+		47:  "Resources unavailable",
+		50:  "Requested facility not subscribed",
+		69:  "Requested facility not implemented",
+		81:  "Invalid short message transfer reference value",
+		95:  "Invalid message, unspecified",
+		96:  "Invalid mandatory information",
+		97:  "Message type non-existent or not implemented",
+		98:  "Message not compatible with short message protocol state",
+		99:  "Information element non-existent or not implemented",
+		111: "Protocol error, unspecified",
+		127: "Interworking, unspecified",
+		300: "ME failure",
+		301: "SMS service of ME reserved",
+		302: "Operation not allowed",
+		303: "Operation not supported",
+		304: "Invalid PDU mode parameter",
+		305: "Invalid text mode parameter",
+		310: "SIM not inserted",
+		311: "SIM PIN required",
+		312: "PH-SIM PIN required",
+		313: "SIM failure",
+		314: "SIM busy",
+		315: "SIM wrong",
+		316: "SIM PUK required",
+		317: "SIM PIN2 required",
+		318: "SIM PUK2 required",
+		320: "Memory failure",
+		321: "Invalid memory index",
+		322: "Memory full",
+		330: "SMSC address unknown",
+		331: "No network service",
+		332: "Network timeout",
+		340: "No +CNMA acknowledgement expected",
+		500: "Unknown error",
+	},
+	TableCME: {
+		0:   "Phone failure",
+		1:   "No connection to phone",
+		2:   "Phone adaptor link reserved",
+		3:   "Operation not allowed",
+		4:   "Operation not supported",
+		5:   "PH-SIM PIN required",
+		10:  "SIM not inserted",
+		11:  "SIM PIN required",
+		12:  "SIM PUK required",
+		13:  "SIM failure",
+		14:  "SIM busy",
+		15:  "SIM wrong",
+		16:  "Incorrect password",
+		17:  "SIM PIN2 required",
+		18:  "SIM PUK2 required",
+		20:  "Memory full",
+		21:  "Invalid index",
+		22:  "Not found",
+		23:  "Memory failure",
+		24:  "Text string too long",
+		25:  "Invalid characters in text string",
+		26:  "Dial string too long",
+		27:  "Invalid characters in dial string",
+		30:  "No network service",
+		31:  "Network timeout",
+		32:  "Network not allowed, emergency calls only",
+		100: "Unknown",
+	},
+	TableRegistration: {
+		RegNotSearching: "Not registered, not searching",
+		RegHome:         "Registered, home network",
+		RegSearching:    "Not registered, searching",
+		RegDenied:       "Registration denied",
+		RegUnknown:      "Unknown",
+		RegRoaming:      "Registered, roaming",
+	},
+}
+
+var (
+	translationsLock sync.RWMutex
+	translations     = map[string]Descriptions{}
+)
+
+// RegisterDescriptions adds translations for a language, eg "de", used by
+// Describe in place of the English descriptions. Registering a language again
+// adds to and replaces its earlier descriptions.
+func RegisterDescriptions(lang string, d Descriptions) {
+	translationsLock.Lock()
+	defer translationsLock.Unlock()
+	t := translations[lang]
+	if t == nil {
+		t = Descriptions{}
+		translations[lang] = t
+	}
+	for table, codes := range d {
+		if t[table] == nil {
+			t[table] = map[int]string{}
+		}
+		for code, text := range codes {
+			t[table][code] = text
+		}
+	}
+}
+
+// Describe a code from a table in a language such as "de-AT", falling back
+// to "de", then English, then the table and code.
+func Describe(table string, code int, lang string) string {
+	translationsLock.RLock()
+	defer translationsLock.RUnlock()
+	for _, l := range []string{lang, strings.SplitN(lang, "-", 2)[0]} {
+		if text, ok := translations[l][table][code]; ok {
+			return text
+		}
+	}
+	if text, ok := EnglishDescriptions[table][code]; ok {
+		return text
+	}
+	return fmt.Sprintf("%s %d", table, code)
+}
+
+// Describe the error in a language, see Describe. A plain ERROR has no code
+// to describe.
+func (self ERROR) Describe(lang string) string {
+	if self.Type == "" {
+		return self.Error()
+	}
+	return Describe(self.Type, self.Code, lang)
+}
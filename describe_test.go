@@ -0,0 +1,27 @@
+package gogsmmodem
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	RegisterDescriptions("de", Descriptions{TableCMS: {322: "Speicher voll"}})
+	defer delete(translations, "de")
+	tests := []struct {
+		err      ERROR
+		lang     string
+		expected string
+	}{
+		{ERROR{"+CMS ERROR", 322}, "de-AT", "Speicher voll"},
+		{ERROR{"+CMS ERROR", 321}, "de", "Invalid memory index"},
+		{ERROR{"+CME ERROR", 10}, "", "SIM not inserted"},
+		{ERROR{"+CMS ERROR", 999}, "de", "+CMS ERROR 999"},
+		{ERROR{}, "de", "Response was ERROR"},
+	}
+	for _, test := range tests {
+		if text := test.err.Describe(test.lang); text != test.expected {
+			t.Errorf("Expected: %q, got %q", test.expected, text)
+		}
+	}
+	if text := Describe(TableRegistration, RegRoaming, "fr"); text != "Registered, roaming" {
+		t.Errorf("Unexpected description: %q", text)
+	}
+}
@@ -0,0 +1,30 @@
+package gogsmmodem
+
+import (
+	"context"
+	"sync"
+)
+
+// Records the commands and bodies a dry run would have sent
+type dryRun struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+type dryRunKey struct{}
+
+func withDryRun(ctx context.Context, d *dryRun) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, d)
+}
+
+// The dry run of ctx, or nil if it sends for real
+func dryRunFrom(ctx context.Context) *dryRun {
+	d, _ := ctx.Value(dryRunKey{}).(*dryRun)
+	return d
+}
+
+func (self *dryRun) add(lines ...string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.lines = append(self.lines, lines...)
+}
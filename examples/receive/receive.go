@@ -21,10 +21,10 @@ func main() {
 		switch p := packet.(type) {
 		case gogsmmodem.MessageNotification:
 			log.Println("Message notification:", p)
-			msg, err := modem.GetMessage(p.Index)
+			msg, err := modem.GetMessageFrom(p.Storage, p.Index)
 			if err == nil {
 				fmt.Printf("Message from %s: %s\n", msg.Telephone, msg.Body)
-				modem.DeleteMessage(p.Index)
+				modem.DeleteMessageFrom(p.Storage, p.Index)
 			}
 		}
 	}
@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"errors"
+	"log"
+)
+
+var (
+	ErrNotFailed  = errors.New("Message not failed")
+	ErrNotStarted = errors.New("Gateway not started")
+)
+
+// Queue lists the messages waiting to be sent, the one being sent first,
+// in the order they will be sent. Messages deferred by Config.Shaping or
+// waiting to retry are not in the queue until they are due.
+func (self *Gateway) Queue() ([]Outgoing, error) {
+	var queue []Outgoing
+	for _, id := range self.outbox.ids() {
+		out, err := self.store.GetOutgoing(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, *out)
+	}
+	return queue, nil
+}
+
+// Messages lists outgoing messages with the status, or all if empty,
+// oldest first.
+func (self *Gateway) Messages(status Status) ([]Outgoing, error) {
+	return self.store.ListOutgoing(status)
+}
+
+// Requeue a failed message by ID to be sent again, with its attempts reset.
+// Fails with ErrNotFailed unless the message failed.
+func (self *Gateway) Requeue(id string) error {
+	self.statusLock.Lock()
+	defer self.statusLock.Unlock()
+	out, err := self.store.GetOutgoing(id)
+	if err != nil {
+		return err
+	}
+	if out.Status != Failed {
+		return ErrNotFailed
+	}
+	out.Status = Queued
+	out.Attempts = 0
+	out.Error = ""
+	if err := self.store.SaveOutgoing(*out); err != nil {
+		return err
+	}
+	self.outbox.push(out.ID)
+	self.audit(out, AuditRequeued, nil)
+	status := *out
+	self.event(Event{Type: EventStatus, Outgoing: &status})
+	return nil
+}
+
+// Pause sending, eg while swapping the SIM. Messages are queued as usual and
+// a message being sent is finished. Independent of pausing while
+// registration is recovered.
+func (self *Gateway) Pause() {
+	log.Println("Outbox: paused")
+	self.outbox.hold(true)
+}
+
+// Resume sending after Pause.
+func (self *Gateway) Resume() {
+	log.Println("Outbox: resumed")
+	self.outbox.hold(false)
+}
+
+// FlushInbox fetches and processes every message stored on the modem now,
+// including those the handler failed, rather than waiting for their
+// notification or redelivery.
+func (self *Gateway) FlushInbox() error {
+	if self.quit == nil {
+		return ErrNotStarted
+	}
+	reply := make(chan error, 1)
+	select {
+	case self.flushes <- reply:
+	case <-self.quit:
+		return ErrNotStarted
+	}
+	return <-reply
+}
+
+// Process stored messages for FlushInbox, from receiveLoop
+func (self *Gateway) flush() error {
+	for n := range self.unacked {
+		delete(self.unacked, n)
+	}
+	return self.receiveStored()
+}
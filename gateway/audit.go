@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Stages in the life of an outgoing message, reported by EventAudit
+const (
+	// Saved to the outbox
+	AuditQueued = "queued"
+	// Held for confirmation, see Config.Confirmation
+	AuditUnconfirmed = "unconfirmed"
+	// Confirmed with Gateway.Confirm
+	AuditConfirmed = "confirmed"
+	// Held back by Config.Shaping until a daily limit allows it
+	AuditDeferred = "deferred"
+	// Passed to the modem to send
+	AuditSubmitted = "submitted"
+	// Accepted by the SMSC, with the message reference
+	AuditAccepted = "accepted"
+	// Delivery report received from the SMSC
+	AuditDeliveryReport = "delivery-report"
+	// Send attempt failed, with the +CMS ERROR code if the modem gave one
+	AuditFailed = "failed"
+	// Failed unsent at its expiry, see Outgoing.Expires
+	AuditExpired = "expired"
+	// Failed message queued again by Gateway.Requeue
+	AuditRequeued = "requeued"
+	// Cancelled by Gateway.Cancel
+	AuditCancelled = "cancelled"
+)
+
+// A step in the life of an outgoing message
+type Audit struct {
+	ID      string
+	Stage   string
+	Time    time.Time
+	Attempt int `json:",omitempty"`
+	// Message reference from the modem
+	Reference int `json:",omitempty"`
+	// +CMS ERROR or +CME ERROR code of a failed send
+	Code  int    `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// Report a step in the life of an outgoing message
+func (self *Gateway) audit(out *Outgoing, stage string, err error) {
+	a := Audit{
+		ID:        out.ID,
+		Stage:     stage,
+		Time:      self.clock.Now(),
+		Attempt:   out.Attempts,
+		Reference: out.Reference,
+	}
+	if err != nil {
+		a.Error = err.Error()
+		if e, ok := err.(gogsmmodem.ERROR); ok {
+			a.Code = e.Code
+		}
+	}
+	self.event(Event{Type: EventAudit, Audit: &a})
+}
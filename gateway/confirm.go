@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Holds back messages scoring at or above a threshold until they are
+// confirmed with Gateway.Confirm, so a bug cannot blast a contact list, see
+// Config.Confirmation.
+type Confirmation struct {
+	// Severity or price of a message, eg its cost by the modem's tariff
+	Score func(msg gogsmmodem.OutgoingMessage) float64
+	// Messages scoring this or more wait as Unconfirmed
+	Threshold float64
+	// Confirm requires a token signed with this key by ConfirmationToken,
+	// eg by a separate approver, rather than the message ID alone
+	Key []byte
+	// Unconfirmed messages are cancelled if confirmed after this long,
+	// default 1 hour
+	Expiry time.Duration
+}
+
+var (
+	ErrNotUnconfirmed      = errors.New("Message not awaiting confirmation")
+	ErrBadConfirmation     = errors.New("Invalid confirmation token")
+	ErrConfirmationExpired = errors.New("Confirmation expired")
+)
+
+// ConfirmationToken signs a message awaiting confirmation with key, as
+// required by Gateway.Confirm when Confirmation.Key is set.
+func ConfirmationToken(key []byte, out Outgoing) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\x00%s\x00%s", out.ID, out.Telephone, out.Body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Does a message need confirming before it is sent
+func (self *Gateway) needsConfirmation(msg gogsmmodem.OutgoingMessage) bool {
+	c := self.config.Confirmation
+	return c != nil && c.Score != nil && c.Score(msg) >= c.Threshold
+}
+
+// Confirm a message awaiting confirmation by ID, queueing it to send. The
+// token is ignored unless Confirmation.Key is set, when it must be the
+// message's ConfirmationToken. A message confirmed after Confirmation.Expiry
+// is cancelled instead, failing with ErrConfirmationExpired.
+func (self *Gateway) Confirm(id, token string) error {
+	self.statusLock.Lock()
+	defer self.statusLock.Unlock()
+	out, err := self.store.GetOutgoing(id)
+	if err != nil {
+		return err
+	}
+	if out.Status != Unconfirmed {
+		return ErrNotUnconfirmed
+	}
+	c := self.config.Confirmation
+	if c != nil && c.Key != nil && !hmac.Equal([]byte(token), []byte(ConfirmationToken(c.Key, *out))) {
+		return ErrBadConfirmation
+	}
+	if c != nil && self.clock.Now().Sub(out.Queued) > c.Expiry {
+		self.cancelled(out)
+		return ErrConfirmationExpired
+	}
+	out.Status = Queued
+	if err := self.store.SaveOutgoing(*out); err != nil {
+		return err
+	}
+	self.outbox.push(out.ID)
+	self.audit(out, AuditConfirmed, nil)
+	status := *out
+	self.event(Event{Type: EventStatus, Outgoing: &status})
+	return nil
+}
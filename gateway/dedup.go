@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"errors"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+var ErrDuplicate = errors.New("Identical message sent recently")
+
+type dedupKey struct {
+	telephone, body string
+}
+
+// The latest message with a number and body, and when it was queued or sent
+type dedupEntry struct {
+	id string
+	at time.Time
+}
+
+// The message identical to msg, to the same number with the same body,
+// queued or sent within Config.DedupWindow, if any. Messages which failed
+// or were cancelled don't count. The caller must hold dedupLock.
+func (self *Gateway) duplicate(msg gogsmmodem.OutgoingMessage) (*Outgoing, error) {
+	if self.dedup == nil {
+		if err := self.loadDedup(); err != nil {
+			return nil, err
+		}
+	}
+	since := self.clock.Now().Add(-self.config.DedupWindow)
+	for key, e := range self.dedup {
+		if !e.at.After(since) {
+			delete(self.dedup, key)
+		}
+	}
+	e, ok := self.dedup[dedupKey{msg.Telephone, msg.Body}]
+	if !ok {
+		return nil, nil
+	}
+	out, err := self.store.GetOutgoing(e.id)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch out.Status {
+	case Queued, Unconfirmed, Sent, Delivered:
+		return out, nil
+	}
+	return nil, nil
+}
+
+// Index the messages queued or sent within the window, once, so duplicates
+// are found across a restart
+func (self *Gateway) loadDedup() error {
+	dedup := map[dedupKey]dedupEntry{}
+	since := self.clock.Now().Add(-self.config.DedupWindow)
+	for _, status := range []Status{Queued, Unconfirmed, Sent, Delivered} {
+		outs, err := self.store.ListOutgoing(status)
+		if err != nil {
+			return err
+		}
+		for _, out := range outs {
+			at := dedupTime(out)
+			key := dedupKey{out.Telephone, out.Body}
+			if at.After(since) && at.After(dedup[key].at) {
+				dedup[key] = dedupEntry{out.ID, at}
+			}
+		}
+	}
+	self.dedup = dedup
+	return nil
+}
+
+// Note a message queued or sent, if duplicates are refused
+func (self *Gateway) remember(out *Outgoing) {
+	if self.config.DedupWindow == 0 {
+		return
+	}
+	self.dedupLock.Lock()
+	defer self.dedupLock.Unlock()
+	self.rememberLocked(out)
+}
+
+// remember with dedupLock held
+func (self *Gateway) rememberLocked(out *Outgoing) {
+	if self.dedup != nil {
+		self.dedup[dedupKey{out.Telephone, out.Body}] = dedupEntry{out.ID, dedupTime(*out)}
+	}
+}
+
+// When a message was sent, or queued if not yet sent
+func dedupTime(out Outgoing) time.Time {
+	if !out.Sent.IsZero() {
+		return out.Sent
+	}
+	return out.Queued
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// How long a report for a reference not yet noted is kept for a send still
+// returning
+var EarlyReportWindow = time.Minute
+
+type earlyReport struct {
+	report gogsmmodem.DeliveryReport
+	at     time.Time
+}
+
+// Note a sent message awaits its delivery report, applying one which
+// arrived before its send returned
+func (self *Gateway) awaitReport(out *Outgoing) {
+	if !self.config.DeliveryReports {
+		return
+	}
+	self.refsLock.Lock()
+	// references wrap, so an older message's report is no longer expected
+	self.refs[out.Reference] = out.ID
+	e, early := self.early[out.Reference]
+	delete(self.early, out.Reference)
+	self.refsLock.Unlock()
+	if early && self.clock.Now().Sub(e.at) < EarlyReportWindow {
+		self.deliveryReport(e.report)
+	}
+}
+
+// Read and delete a delivery report the modem stored
+func (self *Gateway) storedReport(n gogsmmodem.DeliveryReportNotification) {
+	if !self.config.DeliveryReports {
+		return
+	}
+	r, err := self.modem.GetDeliveryReport(n)
+	if err != nil {
+		log.Println("Delivery report:", n.Storage, n.Index, err)
+		return
+	}
+	self.deliveryReport(*r)
+	if err := self.modem.DeleteMessageFrom(n.Storage, n.Index); err != nil {
+		log.Println("Delivery report: deleting", n.Storage, n.Index, err)
+	}
+}
+
+// Mark the message a delivery report is for delivered or failed
+func (self *Gateway) deliveryReport(r gogsmmodem.DeliveryReport) {
+	self.refsLock.Lock()
+	id, ok := self.refs[r.Reference]
+	if ok && !r.Pending() {
+		delete(self.refs, r.Reference)
+	}
+	if !ok && self.config.DeliveryReports {
+		self.early[r.Reference] = earlyReport{r, self.clock.Now()}
+	}
+	self.refsLock.Unlock()
+	if !ok {
+		return
+	}
+	out, err := self.store.GetOutgoing(id)
+	if err != nil {
+		log.Println("Delivery report:", id, err)
+		return
+	}
+	var failure error
+	switch {
+	case r.Delivered():
+		out.Status = Delivered
+		out.Delivered = r.Discharged
+	case r.Pending():
+		failure = fmt.Errorf("Delivery pending, status %d", r.Status)
+	default:
+		failure = fmt.Errorf("Delivery failed, status %d", r.Status)
+		out.Status = Failed
+		out.Error = failure.Error()
+	}
+	self.audit(out, AuditDeliveryReport, failure)
+	if r.Pending() {
+		return
+	}
+	if err := self.store.SaveOutgoing(*out); err != nil {
+		log.Println("Delivery report:", id, err)
+	}
+	status := *out
+	self.event(Event{Type: EventStatus, Outgoing: &status})
+}
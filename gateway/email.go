@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Sends email, replaced in tests
+var sendMail = smtp.SendMail
+
+// Default templates for emailed messages
+const (
+	DefaultEmailSubject = `{{if eq (len .) 1}}SMS from {{(index . 0).Telephone}}{{else}}{{len .}} SMS messages{{end}}`
+	DefaultEmailBody    = "From: {{.Telephone}}\nSent: {{.Timestamp.Format \"2006-01-02 15:04:05\"}}\n\n{{.Body}}\n"
+)
+
+// Emails received messages, see Config.Email.
+type EmailConfig struct {
+	// SMTP server as host:port
+	Addr string
+	// Authentication with the server, none if nil
+	Auth smtp.Auth
+	From string
+	To   []string
+	// text/template for the subject, executed with the messages in the
+	// email, DefaultEmailSubject if empty
+	Subject string
+	// text/template for each message in the body, executed with the
+	// message, DefaultEmailBody if empty
+	Body string
+	// Collect messages for this long and email them together. 0 emails
+	// each message as it is received.
+	BatchWindow time.Duration
+}
+
+// Formats and sends emails of received messages
+type mailer struct {
+	config  EmailConfig
+	subject *template.Template
+	body    *template.Template
+}
+
+func newMailer(config EmailConfig) (*mailer, error) {
+	if config.Subject == "" {
+		config.Subject = DefaultEmailSubject
+	}
+	if config.Body == "" {
+		config.Body = DefaultEmailBody
+	}
+	subject, err := template.New("subject").Parse(config.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("Email subject: %v", err)
+	}
+	body, err := template.New("body").Parse(config.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Email body: %v", err)
+	}
+	return &mailer{config, subject, body}, nil
+}
+
+// Format an email of the messages
+func (self *mailer) format(msgs []gogsmmodem.Message, now time.Time) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := self.subject.Execute(&subject, msgs); err != nil {
+		return nil, err
+	}
+	for i, msg := range msgs {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		if err := self.body.Execute(&body, msg); err != nil {
+			return nil, err
+		}
+	}
+	var email bytes.Buffer
+	fmt.Fprintf(&email, "From: %s\r\n", self.config.From)
+	fmt.Fprintf(&email, "To: %s\r\n", strings.Join(self.config.To, ", "))
+	fmt.Fprintf(&email, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject.String()))
+	fmt.Fprintf(&email, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	email.WriteString("MIME-Version: 1.0\r\n")
+	email.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	email.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	email.WriteString(strings.Replace(body.String(), "\n", "\r\n", -1))
+	return email.Bytes(), nil
+}
+
+func (self *mailer) send(msgs []gogsmmodem.Message, now time.Time) error {
+	email, err := self.format(msgs, now)
+	if err != nil {
+		return err
+	}
+	return sendMail(self.config.Addr, self.config.Auth, self.config.From, self.config.To, email)
+}
+
+// Email received messages until stopped, sending any still batched
+func (self *Gateway) emailLoop() {
+	defer self.wg.Done()
+	var batch []gogsmmodem.Message
+	var window <-chan time.Time
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := self.mailer.send(batch, self.clock.Now()); err != nil {
+			log.Println("Email:", err)
+			self.metrics.emailFailed()
+		}
+		batch = nil
+		window = nil
+	}
+	for {
+		select {
+		case msg := <-self.mails:
+			batch = append(batch, msg)
+			if self.mailer.config.BatchWindow == 0 {
+				flush()
+			} else if window == nil {
+				window = self.clock.After(self.mailer.config.BatchWindow)
+			}
+		case <-window:
+			flush()
+		case <-self.quit:
+			for len(self.mails) > 0 {
+				batch = append(batch, <-self.mails)
+			}
+			flush()
+			return
+		}
+	}
+}
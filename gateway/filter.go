@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// What a Filter does with an incoming message
+type Action int
+
+const (
+	// Deliver the message
+	Accept Action = iota
+	// Deliver the message with a tag
+	Tag
+	// Store the message as quarantined instead of delivering it
+	Quarantine
+	// Discard the message
+	Drop
+)
+
+// Verdict of a Filter. Reason is the tag for Tag, otherwise why the message
+// was quarantined or dropped.
+type Verdict struct {
+	Action Action
+	Reason string
+}
+
+// Filters incoming messages before they are handled and delivered. Filters
+// run in order until one quarantines or drops the message.
+type Filter func(msg gogsmmodem.Message) Verdict
+
+// KeywordFilter applies the action to messages containing any of the
+// keywords, ignoring case.
+func KeywordFilter(action Action, reason string, keywords ...string) Filter {
+	lower := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		lower[i] = strings.ToLower(keyword)
+	}
+	return func(msg gogsmmodem.Message) Verdict {
+		body := strings.ToLower(msg.Body)
+		for _, keyword := range lower {
+			if strings.Contains(body, keyword) {
+				return Verdict{action, reason}
+			}
+		}
+		return Verdict{}
+	}
+}
+
+// SenderFilter applies the action to messages from senders matching the
+// pattern.
+func SenderFilter(action Action, reason string, pattern *regexp.Regexp) Filter {
+	return func(msg gogsmmodem.Message) Verdict {
+		if pattern.MatchString(msg.Telephone) {
+			return Verdict{action, reason}
+		}
+		return Verdict{}
+	}
+}
+
+// Run the filters, returning the final verdict and any tags
+func (self *Gateway) filter(msg gogsmmodem.Message) (Verdict, []string) {
+	var tags []string
+	for _, f := range self.config.Filters {
+		v := f(msg)
+		switch v.Action {
+		case Tag:
+			tags = append(tags, v.Reason)
+		case Quarantine, Drop:
+			return v, tags
+		}
+	}
+	return Verdict{}, tags
+}
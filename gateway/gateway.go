@@ -0,0 +1,309 @@
+// Package gateway is an embeddable SMS gateway: it sends messages from a
+// persistent outbox, receives messages into the store, and reports both to a
+// webhook and as events.
+//
+//	modem, _ := gogsmmodem.Open(&conf, false)
+//	store, _ := gateway.NewFileStore("/var/lib/sms/store.json")
+//	gw := gateway.New(modem, modem.OOB, gateway.Config{
+//		Store:      store,
+//		WebhookURL: "http://localhost:8080/sms",
+//	})
+//	gw.Start()
+//	defer gw.Stop()
+//	gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "447712345678", Body: "Hi"})
+package gateway
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// The modem operations used by the gateway, as provided by
+// *gogsmmodem.Modem.
+type Modem interface {
+	SendContext(ctx context.Context, msg gogsmmodem.OutgoingMessage) (*gogsmmodem.SendResult, error)
+	GetMessageFrom(storage string, n int) (*gogsmmodem.Message, error)
+	ListMessages(filter string) (*gogsmmodem.MessageList, error)
+	DeleteMessageFrom(storage string, n int) error
+	GetDeliveryReport(n gogsmmodem.DeliveryReportNotification) (*gogsmmodem.DeliveryReport, error)
+}
+
+type Config struct {
+	// Defaults to a MemoryStore
+	Store Store
+	// URL to post events to as JSON, none if empty
+	WebhookURL string
+	// Email received messages, none if nil. An invalid template is logged
+	// and emailing disabled.
+	Email *EmailConfig
+	// Publish events to and take messages to send from MQTT, none if nil
+	MQTT *MQTTConfig
+	// Attempts to send a message before it fails, default 3
+	MaxAttempts int
+	// Hold back messages for confirmation, none if nil
+	Confirmation *Confirmation
+	// Request delivery reports, audited as AuditDeliveryReport, marking
+	// messages Delivered or Failed. The modem must route reports to the
+	// gateway with +CNMI, either directly as its default settings do, or
+	// stored and notified with +CDSI, when the gateway reads and deletes
+	// them.
+	DeliveryReports bool
+	// Limits on sending, eg an operator's, or a named profile of
+	// ShapingProfiles if nil. An unknown profile is logged and sending not
+	// shaped.
+	Shaping        *Shaping
+	ShapingProfile string
+	// Refuse to enqueue a message identical to one queued or sent this
+	// recently, with ErrDuplicate, eg alerts from a flapping sensor. 0
+	// allows duplicates.
+	DedupWindow time.Duration
+	// Delay before retrying a failed send, default 30s
+	RetryDelay time.Duration
+	// Leave received messages on the modem rather than deleting them
+	KeepReceived bool
+	// Filters for received messages, applied before Handler
+	Filters []Filter
+	// Processes each received message. An error leaves the message on the
+	// modem to be redelivered later.
+	Handler func(msg gogsmmodem.Message) error
+	// Handle received messages matching a rule by the first rule matched,
+	// instead of Handler, see LoadRules. Invalid rules are logged and
+	// ignored.
+	Rules []Rule
+	// Name of the modem's port, matched by Rule.Port
+	Port string
+	// Interval between redeliveries of messages the handler failed, default
+	// 1 minute
+	RedeliverInterval time.Duration
+	// Collect notifications of received messages for this long and fetch
+	// them together with one listing, deleting them from the modem once all
+	// are processed, so a flood of messages cannot starve sending. 0 fetches
+	// each message as it is notified.
+	BatchWindow time.Duration
+	// Defaults to gogsmmodem.DefaultClock
+	Clock gogsmmodem.Clock
+}
+
+// Types of Event
+const (
+	// Outgoing message queued, sent, retried or failed
+	EventStatus = "status"
+	// Message received
+	EventIncoming = "incoming"
+	// Message quarantined by a filter
+	EventQuarantined = "quarantined"
+	// Other unsolicited packet from the modem
+	EventModem = "modem"
+	// Step in the life of an outgoing message, for tracing sends
+	EventAudit = "audit"
+)
+
+type Event struct {
+	Type     string
+	Outgoing *Outgoing           `json:",omitempty"`
+	Incoming *gogsmmodem.Message `json:",omitempty"`
+	Packet   gogsmmodem.Packet   `json:",omitempty"`
+	Audit    *Audit              `json:",omitempty"`
+	// Tags from filters, or the reason for quarantine
+	Tags []string `json:",omitempty"`
+}
+
+type Gateway struct {
+	// Events, dropped if not read
+	Events  chan Event
+	modem   Modem
+	events  <-chan gogsmmodem.Packet
+	config  Config
+	store   Store
+	clock   gogsmmodem.Clock
+	outbox  *outbox
+	shaper  *shaper
+	metrics *metricsCounter
+	webhook *webhook
+	hooks   chan Event
+	flushes chan chan error
+	mailer  *mailer
+	mails   chan gogsmmodem.Message
+	mqtt    chan Event
+	// messages the handler failed, owned by receiveLoop
+	unacked map[gogsmmodem.MessageNotification]bool
+	// messages to delete at the end of a batch, owned by
+	// receiveLoop
+	deletes  []gogsmmodem.MessageNotification
+	batching bool
+	// IDs of sent messages awaiting delivery reports, by message reference
+	refsLock sync.Mutex
+	refs     map[int]string
+	// reports for references not yet noted, in case a report arrives before
+	// its send returns
+	early map[int]earlyReport
+	// held checking for a duplicate until the message is saved
+	dedupLock sync.Mutex
+	// the latest message by number and body within DedupWindow, loaded
+	// from the store when first needed
+	dedup map[dedupKey]dedupEntry
+	// held checking and changing a message's status for Confirm, Requeue
+	// and Cancel, and expiring queued messages
+	statusLock sync.Mutex
+	quit       chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+// New creates a gateway for the modem, taking over its unsolicited packets,
+// usually the modem's OOB channel.
+func New(modem Modem, events <-chan gogsmmodem.Packet, config Config) *Gateway {
+	if config.Store == nil {
+		config.Store = NewMemoryStore()
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 3
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = 30 * time.Second
+	}
+	if config.RedeliverInterval == 0 {
+		config.RedeliverInterval = time.Minute
+	}
+	if config.Clock == nil {
+		config.Clock = gogsmmodem.DefaultClock
+	}
+	if c := config.Confirmation; c != nil && c.Expiry == 0 {
+		confirmation := *c
+		confirmation.Expiry = time.Hour
+		config.Confirmation = &confirmation
+	}
+	var rules []Rule
+	for _, r := range config.Rules {
+		if err := r.compile(); err != nil {
+			log.Println("Gateway: ignoring rule", err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	config.Rules = rules
+	self := &Gateway{
+		Events:  make(chan Event, 64),
+		modem:   modem,
+		events:  events,
+		config:  config,
+		store:   config.Store,
+		clock:   config.Clock,
+		outbox:  newOutbox(),
+		shaper:  newShaper(config),
+		metrics: &metricsCounter{},
+		hooks:   make(chan Event, 64),
+		flushes: make(chan chan error),
+		unacked: map[gogsmmodem.MessageNotification]bool{},
+		refs:    map[int]string{},
+		early:   map[int]earlyReport{},
+	}
+	if config.WebhookURL != "" {
+		self.webhook = newWebhook(config.WebhookURL)
+	}
+	if config.Email != nil {
+		if m, err := newMailer(*config.Email); err != nil {
+			log.Println("Gateway: email disabled", err)
+		} else {
+			self.mailer = m
+			self.mails = make(chan gogsmmodem.Message, 64)
+		}
+	}
+	if config.MQTT != nil {
+		mqtt := *config.MQTT
+		if mqtt.Prefix == "" {
+			mqtt.Prefix = "gsm"
+		}
+		if mqtt.HealthInterval == 0 {
+			mqtt.HealthInterval = time.Minute
+		}
+		self.config.MQTT = &mqtt
+		self.mqtt = make(chan Event, 64)
+	}
+	return self
+}
+
+// Start the gateway, requeueing messages left queued in the store and
+// receiving messages already stored on the modem.
+func (self *Gateway) Start() error {
+	queued, err := self.store.ListOutgoing(Queued)
+	if err != nil {
+		return err
+	}
+	for _, out := range queued {
+		self.outbox.push(out.ID)
+	}
+	if self.shaper != nil {
+		if err := self.shaper.restore(self.store, self.clock.Now()); err != nil {
+			return err
+		}
+	}
+	if err := self.receiveStored(); err != nil {
+		return err
+	}
+	self.quit = make(chan struct{})
+	self.wg.Add(2)
+	go self.sendLoop()
+	go self.receiveLoop()
+	if self.webhook != nil {
+		self.wg.Add(1)
+		go self.webhookLoop()
+	}
+	if self.mailer != nil {
+		self.wg.Add(1)
+		go self.emailLoop()
+	}
+	if self.mqtt != nil {
+		if err := self.config.MQTT.Client.Subscribe(self.config.MQTT.Prefix+"/send", self.mqttSend); err != nil {
+			log.Println("MQTT:", err)
+		}
+		self.wg.Add(1)
+		go self.mqttLoop()
+	}
+	return nil
+}
+
+// Stop the gateway, waiting for a send in progress to finish. Stopping a
+// gateway not started, or again, does nothing.
+func (self *Gateway) Stop() {
+	if self.quit == nil {
+		return
+	}
+	self.stopOnce.Do(func() { close(self.quit) })
+	self.wg.Wait()
+}
+
+// Deliver an event, dropping it if the reader, webhook, email or MQTT is
+// behind
+func (self *Gateway) event(e Event) {
+	select {
+	case self.Events <- e:
+	default:
+	}
+	if self.mqtt != nil && self.mqttTopic(e) != "" {
+		select {
+		case self.mqtt <- e:
+		default:
+			self.metrics.mqttFailed()
+		}
+	}
+	if self.mailer != nil && e.Type == EventIncoming {
+		select {
+		case self.mails <- *e.Incoming:
+		default:
+			self.metrics.emailFailed()
+		}
+	}
+	if self.webhook == nil {
+		return
+	}
+	select {
+	case self.hooks <- e:
+	default:
+		self.metrics.webhookFailed()
+	}
+}
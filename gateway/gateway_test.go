@@ -0,0 +1,1108 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+type fakeModem struct {
+	lock sync.Mutex
+	sent []gogsmmodem.OutgoingMessage
+	fail int
+	// block sends until cancelled
+	block   bool
+	stored  gogsmmodem.MessageList
+	fetched []int
+	deleted []int
+	// stored delivery reports by index
+	reports map[int]gogsmmodem.DeliveryReport
+}
+
+func (self *fakeModem) SendContext(ctx context.Context, msg gogsmmodem.OutgoingMessage) (*gogsmmodem.SendResult, error) {
+	if self.block {
+		<-ctx.Done()
+		return nil, gogsmmodem.ErrCancelled
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.fail > 0 {
+		self.fail--
+		return nil, gogsmmodem.ERROR{Type: "+CMS ERROR", Code: 500}
+	}
+	self.sent = append(self.sent, msg)
+	return &gogsmmodem.SendResult{ID: msg.ID, Reference: len(self.sent)}, nil
+}
+
+func (self *fakeModem) GetMessageFrom(storage string, n int) (*gogsmmodem.Message, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.fetched = append(self.fetched, n)
+	return &gogsmmodem.Message{Index: n, Telephone: "+441234567890", Body: "Incoming", Storage: storage}, nil
+}
+
+func (self *fakeModem) ListMessages(filter string) (*gogsmmodem.MessageList, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	stored := append(gogsmmodem.MessageList(nil), self.stored...)
+	return &stored, nil
+}
+
+func (self *fakeModem) DeleteMessageFrom(storage string, n int) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.deleted = append(self.deleted, n)
+	return nil
+}
+
+func (self *fakeModem) GetDeliveryReport(n gogsmmodem.DeliveryReportNotification) (*gogsmmodem.DeliveryReport, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	r, ok := self.reports[n.Index]
+	if !ok {
+		return nil, errors.New("Delivery report not found")
+	}
+	return &r, nil
+}
+
+// Wait for an event of the type
+func nextEvent(t *testing.T, gw *Gateway, typ string) Event {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-gw.Events:
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatal("Expected: event", typ)
+		}
+	}
+}
+
+func TestGatewaySend(t *testing.T) {
+	modem := &fakeModem{fail: 1}
+	gw := New(modem, nil, Config{RetryDelay: time.Millisecond})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	id, err := gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a1", Telephone: "4412", Body: "Hi"})
+	if err != nil || id != "a1" {
+		t.Fatalf("Expected: id a1, got %q %v", id, err)
+	}
+	for {
+		e := nextEvent(t, gw, EventStatus)
+		if e.Outgoing.Status == Sent {
+			break
+		}
+	}
+	gw.Stop()
+	out, err := gw.Status("a1")
+	if err != nil || out.Status != Sent || out.Attempts != 2 || out.Reference != 1 {
+		t.Errorf("Unexpected status: %#v %v", out, err)
+	}
+	m := gw.Metrics()
+	if m.Queued != 1 || m.Sent != 1 || m.Failed != 0 || m.OutboxLength != 0 {
+		t.Errorf("Unexpected metrics: %#v", m)
+	}
+}
+
+func TestGatewayStop(t *testing.T) {
+	gw := New(&fakeModem{}, nil, Config{})
+	// never started
+	gw.Stop()
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Stop()
+	gw.Stop()
+}
+
+func TestGatewayAudit(t *testing.T) {
+	modem := &fakeModem{fail: 1}
+	gw := New(modem, nil, Config{RetryDelay: time.Millisecond})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a1", Telephone: "4412", Body: "Hi"})
+	expected := []Audit{
+		{ID: "a1", Stage: AuditQueued},
+		{ID: "a1", Stage: AuditSubmitted, Attempt: 1},
+		{ID: "a1", Stage: AuditFailed, Attempt: 1, Code: 500, Error: "Response was +CMS ERROR: 500"},
+		{ID: "a1", Stage: AuditSubmitted, Attempt: 2},
+		{ID: "a1", Stage: AuditAccepted, Attempt: 2, Reference: 1},
+	}
+	for _, exp := range expected {
+		a := *nextEvent(t, gw, EventAudit).Audit
+		a.Time = time.Time{}
+		if a != exp {
+			t.Errorf("Expected: %#v, got %#v", exp, a)
+		}
+	}
+	gw.Stop()
+}
+
+func TestGatewayRetryDelay(t *testing.T) {
+	modem := &fakeModem{fail: 1}
+	clock := gogsmmodem.NewMockClock(time.Date(2014, 2, 1, 12, 0, 0, 0, time.UTC))
+	gw := New(modem, nil, Config{Clock: clock, RetryDelay: time.Hour})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a1", Telephone: "4412", Body: "Hi"})
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a2", Telephone: "4413", Body: "Hi"})
+	// the failed message waits to retry without holding up the next
+	for {
+		if e := nextEvent(t, gw, EventStatus); e.Outgoing.Status == Sent {
+			if e.Outgoing.ID != "a2" {
+				t.Fatal("Expected: a2 sent first, got:", e.Outgoing.ID)
+			}
+			break
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if out, _ := gw.Status("a1"); out.Status == Sent {
+			break
+		}
+		clock.Advance(time.Hour)
+		time.Sleep(10 * time.Millisecond)
+	}
+	gw.Stop()
+	if out, _ := gw.Status("a1"); out.Status != Sent || out.Attempts != 2 {
+		t.Errorf("Expected: a1 sent on retry, got %#v", out)
+	}
+}
+
+func TestGatewayReceive(t *testing.T) {
+	var posted []Event
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		lock.Lock()
+		posted = append(posted, e)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	modem := &fakeModem{stored: gogsmmodem.MessageList{{Index: 1, Body: "Stored"}}}
+	events := make(chan gogsmmodem.Packet, 1)
+	store := NewMemoryStore()
+	gw := New(modem, events, Config{Store: store, WebhookURL: server.URL})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	events <- gogsmmodem.MessageNotification{Storage: "SM", Index: 4}
+	nextEvent(t, gw, EventIncoming)
+	nextEvent(t, gw, EventIncoming)
+	for i := 0; i < 100 && webhookPosts(&lock, &posted) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	gw.Stop()
+
+	if len(store.Received) != 2 || store.Received[0].Body != "Stored" || store.Received[1].Index != 4 {
+		t.Errorf("Unexpected received: %#v", store.Received)
+	}
+	if len(modem.deleted) != 2 {
+		t.Errorf("Expected: received messages deleted, got %v", modem.deleted)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(posted) != 2 || posted[1].Incoming.Body != "Incoming" {
+		t.Errorf("Unexpected webhook posts: %#v", posted)
+	}
+}
+
+func TestGatewayBatch(t *testing.T) {
+	modem := &fakeModem{}
+	events := make(chan gogsmmodem.Packet, 3)
+	gw := New(modem, events, Config{BatchWindow: 10 * time.Millisecond})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.lock.Lock()
+	modem.stored = gogsmmodem.MessageList{{Index: 5}, {Index: 6}, {Index: 7}}
+	modem.lock.Unlock()
+	for i := 5; i <= 7; i++ {
+		events <- gogsmmodem.MessageNotification{Storage: "SM", Index: i}
+	}
+	for i := 0; i < 3; i++ {
+		nextEvent(t, gw, EventIncoming)
+	}
+	gw.Stop()
+	modem.lock.Lock()
+	defer modem.lock.Unlock()
+	if len(modem.fetched) != 0 || !reflect.DeepEqual(modem.deleted, []int{5, 6, 7}) {
+		t.Errorf("Expected: one listing then deletes, got fetched %v deleted %v", modem.fetched, modem.deleted)
+	}
+}
+
+func TestGatewayBatchStorage(t *testing.T) {
+	modem := &fakeModem{}
+	events := make(chan gogsmmodem.Packet, 3)
+	gw := New(modem, events, Config{BatchWindow: 10 * time.Millisecond})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.lock.Lock()
+	modem.stored = gogsmmodem.MessageList{{Index: 5, Storage: "SM"}, {Index: 6, Storage: "SM"}}
+	modem.lock.Unlock()
+	events <- gogsmmodem.MessageNotification{Storage: "SM", Index: 5}
+	events <- gogsmmodem.MessageNotification{Storage: "ME", Index: 6}
+	var storages []string
+	for i := 0; i < 3; i++ {
+		storages = append(storages, nextEvent(t, gw, EventIncoming).Incoming.Storage)
+	}
+	gw.Stop()
+	if !reflect.DeepEqual(storages, []string{"SM", "SM", "ME"}) {
+		t.Errorf("Expected: ME message fetched separately, got %v", storages)
+	}
+	modem.lock.Lock()
+	defer modem.lock.Unlock()
+	if !reflect.DeepEqual(modem.fetched, []int{6}) {
+		t.Errorf("Expected: ME message fetched, got %v", modem.fetched)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gateway")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	store.SaveOutgoing(Outgoing{ID: "a1", Status: Queued})
+	store.SaveOutgoing(Outgoing{ID: "a2", Status: Sent})
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	queued, _ := store.ListOutgoing(Queued)
+	if len(queued) != 1 || queued[0].ID != "a1" {
+		t.Errorf("Unexpected queued: %#v", queued)
+	}
+}
+
+func webhookPosts(lock *sync.Mutex, posted *[]Event) int {
+	lock.Lock()
+	defer lock.Unlock()
+	return len(*posted)
+}
+
+func TestGatewayHandlerRedelivery(t *testing.T) {
+	modem := &fakeModem{}
+	events := make(chan gogsmmodem.Packet, 1)
+	failures := 1
+	gw := New(modem, events, Config{
+		RedeliverInterval: 10 * time.Millisecond,
+		Handler: func(msg gogsmmodem.Message) error {
+			if failures > 0 {
+				failures--
+				return errors.New("Database down")
+			}
+			return nil
+		},
+	})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	events <- gogsmmodem.MessageNotification{Storage: "SM", Index: 5}
+	e := nextEvent(t, gw, EventIncoming)
+	gw.Stop()
+
+	if e.Incoming.Index != 5 {
+		t.Errorf("Unexpected message: %#v", e.Incoming)
+	}
+	if len(modem.deleted) != 1 || modem.deleted[0] != 5 {
+		t.Errorf("Expected: message deleted once handled, got %v", modem.deleted)
+	}
+	if m := gw.Metrics(); m.HandlerFailed != 1 || m.Received != 1 {
+		t.Errorf("Unexpected metrics: %#v", m)
+	}
+}
+
+func TestGatewayFilters(t *testing.T) {
+	modem := &fakeModem{stored: gogsmmodem.MessageList{
+		{Index: 1, Telephone: "+441234567890", Body: "WIN a PRIZE"},
+		{Index: 2, Telephone: "+900123", Body: "Hello"},
+		{Index: 3, Telephone: "+441234567890", Body: "Urgent: call me"},
+		{Index: 4, Telephone: "+441234567890", Body: "Hello"},
+	}}
+	store := NewMemoryStore()
+	gw := New(modem, nil, Config{
+		Store: store,
+		Filters: []Filter{
+			KeywordFilter(Tag, "urgent", "urgent"),
+			KeywordFilter(Drop, "spam", "prize"),
+			SenderFilter(Quarantine, "premium rate", regexp.MustCompile(`^\+90`)),
+		},
+	})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Stop()
+
+	if len(store.Received) != 2 || len(store.Quarantined) != 1 || store.Quarantined[0].Reason != "premium rate" {
+		t.Errorf("Unexpected store: %#v", store)
+	}
+	if len(modem.deleted) != 4 {
+		t.Errorf("Expected: all messages deleted, got %v", modem.deleted)
+	}
+	m := gw.Metrics()
+	if m.Dropped != 1 || m.Quarantined != 1 || m.Tagged != 1 || m.Received != 2 {
+		t.Errorf("Unexpected metrics: %#v", m)
+	}
+	for e := range drain(gw.Events) {
+		if e.Type == EventIncoming && e.Incoming.Index == 3 && (len(e.Tags) != 1 || e.Tags[0] != "urgent") {
+			t.Errorf("Expected: urgent tag, got %#v", e.Tags)
+		}
+	}
+}
+
+func TestGatewayRules(t *testing.T) {
+	var forwarded []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		json.NewDecoder(r.Body).Decode(&e)
+		forwarded = append(forwarded, e)
+	}))
+	defer server.Close()
+	rules, err := ParseRules([]byte(`[
+		{"Body": "(?i)^stop", "Action": "reply", "Reply": "Unsubscribed {{.Telephone}}"},
+		{"Sender": "^\\+4477", "Action": "forward", "URL": "` + server.URL + `"},
+		{"Body": "prize", "Action": "drop"},
+		{"Port": "ttyUSB1", "Action": "store"}
+	]`))
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem := &fakeModem{stored: gogsmmodem.MessageList{
+		{Index: 1, Telephone: "+441234567890", Body: "STOP"},
+		{Index: 2, Telephone: "+447712345678", Body: "Hello"},
+		{Index: 3, Telephone: "+441234567890", Body: "You won a prize"},
+		{Index: 4, Telephone: "+441234567890", Body: "Hello"},
+	}}
+	store := NewMemoryStore()
+	handled := 0
+	gw := New(modem, nil, Config{
+		Store:   store,
+		Rules:   rules,
+		Port:    "/dev/ttyUSB1",
+		Handler: func(msg gogsmmodem.Message) error { handled++; return nil },
+	})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Stop()
+
+	if handled != 0 || len(store.Received) != 3 || len(modem.deleted) != 4 {
+		t.Errorf("Expected: 3 messages stored by rules, got %d handled, %#v", handled, store.Received)
+	}
+	if len(forwarded) != 1 || forwarded[0].Incoming.Index != 2 {
+		t.Errorf("Expected: message 2 forwarded, got %#v", forwarded)
+	}
+	replies, _ := store.ListOutgoing(Queued)
+	sent, _ := store.ListOutgoing(Sent)
+	replies = append(replies, sent...)
+	if len(replies) != 1 || replies[0].Telephone != "+441234567890" || replies[0].Body != "Unsubscribed +441234567890" {
+		t.Errorf("Expected: reply queued, got %#v", replies)
+	}
+	if m := gw.Metrics(); m.Dropped != 1 {
+		t.Errorf("Unexpected metrics: %#v", m)
+	}
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	for _, data := range []string{
+		`[{"Action": "explode"}]`,
+		`[{"Action": "forward"}]`,
+		`[{"Body": "(", "Action": "drop"}]`,
+		`[{"Action": "reply", "Reply": "{{.Nope"}]`,
+	} {
+		if _, err := ParseRules([]byte(data)); err == nil {
+			t.Error("Expected: error for", data)
+		}
+	}
+}
+
+func TestGatewayEmail(t *testing.T) {
+	var mails []string
+	var to []string
+	sendMail = func(addr string, a smtp.Auth, from string, rcpt []string, msg []byte) error {
+		mails = append(mails, string(msg))
+		to = rcpt
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+	modem := &fakeModem{stored: gogsmmodem.MessageList{
+		{Index: 1, Telephone: "+441234567890", Body: "First"},
+		{Index: 2, Telephone: "+447712345678", Body: "Second"},
+	}}
+	gw := New(modem, nil, Config{Email: &EmailConfig{
+		From:        "gateway@example.com",
+		To:          []string{"ops@example.com"},
+		Body:        "{{.Telephone}}: {{.Body}}\n",
+		BatchWindow: time.Hour,
+	}})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Stop()
+
+	if len(mails) != 1 || !reflect.DeepEqual(to, []string{"ops@example.com"}) {
+		t.Fatalf("Expected: one email of the batch, got %q to %v", mails, to)
+	}
+	for _, s := range []string{"Subject: 2 SMS messages\r\n", "\r\n\r\n+441234567890: First\r\n\r\n+447712345678: Second\r\n"} {
+		if !strings.Contains(mails[0], s) {
+			t.Errorf("Expected: %q in email, got %q", s, mails[0])
+		}
+	}
+}
+
+type fakeMQTT struct {
+	lock      sync.Mutex
+	published map[string][]string
+	handlers  map[string]func(payload []byte)
+}
+
+func (self *fakeMQTT) Publish(topic string, payload []byte) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.published[topic] = append(self.published[topic], string(payload))
+	return nil
+}
+
+func (self *fakeMQTT) Subscribe(topic string, handler func(payload []byte)) error {
+	self.handlers[topic] = handler
+	return nil
+}
+
+func (self *fakeMQTT) count(topic string) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.published[topic])
+}
+
+func TestGatewayMQTT(t *testing.T) {
+	client := &fakeMQTT{published: map[string][]string{}, handlers: map[string]func([]byte){}}
+	modem := &fakeModem{stored: gogsmmodem.MessageList{{Index: 1, Telephone: "+441234567890", Body: "Hello"}}}
+	gw := New(modem, nil, Config{MQTT: &MQTTConfig{Client: client, Prefix: "home/sms", HealthInterval: 10 * time.Millisecond}})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	client.handlers["home/sms/send"]([]byte(`{"Telephone": "+447712345678", "Body": "Reply"}`))
+	for i := 0; i < 100 && (client.count("home/sms/status") < 2 || client.count("home/sms/health") == 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	gw.Stop()
+
+	modem.lock.Lock()
+	if len(modem.sent) != 1 || modem.sent[0].Body != "Reply" {
+		t.Errorf("Expected: message from send topic sent, got %#v", modem.sent)
+	}
+	modem.lock.Unlock()
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	var msg gogsmmodem.Message
+	if len(client.published["home/sms/incoming"]) != 1 || json.Unmarshal([]byte(client.published["home/sms/incoming"][0]), &msg) != nil || msg.Body != "Hello" {
+		t.Errorf("Expected: incoming message published, got %q", client.published["home/sms/incoming"])
+	}
+	if len(client.published["home/sms/status"]) < 2 || len(client.published["home/sms/health"]) == 0 || len(client.published["home/sms/audit"]) != 0 {
+		t.Errorf("Unexpected topics published: %v", client.published)
+	}
+}
+
+func TestMQTTConn(t *testing.T) {
+	conn, broker := net.Pipe()
+	failed := make(chan string, 1)
+	go func() {
+		r := bufio.NewReader(broker)
+		expect := func(typ byte, body string) {
+			got, b, err := mqttRead(r)
+			if err != nil || got != typ || !strings.Contains(string(b), body) {
+				failed <- fmt.Sprintf("expected packet %x containing %q, got %x %q %v", typ, body, got, b, err)
+			}
+		}
+		expect(0x10, "\x00\x04MQTT\x04\xc2\x00\x3c\x00\x03gsm\x00\x04user\x00\x04pass")
+		broker.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		expect(0x82, "\x00\x08gsm/send\x00")
+		broker.Write(mqttPacket(0x30, append(mqttString("gsm/send"), "payload"...)))
+		expect(0x30, "\x00\x0cgsm/incoming{}")
+		expect(0xe0, "")
+		close(failed)
+	}()
+	c, err := NewMQTTConn(conn, MQTTOptions{ClientID: "gsm", Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	received := make(chan string, 1)
+	c.Subscribe("gsm/send", func(payload []byte) { received <- string(payload) })
+	select {
+	case p := <-received:
+		if p != "payload" {
+			t.Error("Expected: payload, got:", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected: message on subscribed topic")
+	}
+	c.Publish("gsm/incoming", []byte("{}"))
+	c.Close()
+	if err, ok := <-failed; ok {
+		t.Error("Broker", err)
+	}
+	if err := c.Publish("gsm/incoming", nil); err != ErrMQTTClosed {
+		t.Error("Expected: ErrMQTTClosed, got:", err)
+	}
+}
+
+func TestGatewayRegistrationResume(t *testing.T) {
+	events := make(chan gogsmmodem.Packet, 1)
+	gw := New(&fakeModem{}, events, Config{})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	lost := gogsmmodem.RegistrationState{State: gogsmmodem.RegistrationLost, Status: gogsmmodem.RegSearching}
+	resumes := []gogsmmodem.Packet{
+		// recovery abandoned
+		gogsmmodem.RegistrationState{State: gogsmmodem.RegistrationStopped, Status: gogsmmodem.RegSearching},
+		// registered, with the recovered state dropped
+		gogsmmodem.NetworkRegistration{Mode: -1, Status: gogsmmodem.RegHome},
+		// registered on LTE alone
+		gogsmmodem.EPSRegistration{Mode: -1, Status: gogsmmodem.RegRoaming},
+	}
+	for _, p := range resumes {
+		events <- lost
+		nextEvent(t, gw, EventModem)
+		if !gw.Metrics().OutboxPaused {
+			t.Error("Expected: paused")
+		}
+		events <- p
+		nextEvent(t, gw, EventModem)
+		if gw.Metrics().OutboxPaused {
+			t.Errorf("Expected: resumed by %#v", p)
+		}
+	}
+	gw.Stop()
+}
+
+func TestMQTTConnOptions(t *testing.T) {
+	tests := []struct {
+		options  MQTTOptions
+		expected error
+	}{
+		{MQTTOptions{ClientID: "gsm", Password: "pass"}, ErrMQTTPassword},
+		{MQTTOptions{ClientID: "gsm", KeepAlive: time.Nanosecond}, ErrMQTTKeepAlive},
+		{MQTTOptions{ClientID: "gsm", KeepAlive: -time.Second}, ErrMQTTKeepAlive},
+		{MQTTOptions{ClientID: "gsm", KeepAlive: 0x10000 * time.Second}, ErrMQTTKeepAlive},
+	}
+	for _, test := range tests {
+		// refused before anything is written
+		conn, broker := net.Pipe()
+		if _, err := NewMQTTConn(conn, test.options); err != test.expected {
+			t.Errorf("Expected: %v for %+v, got %v", test.expected, test.options, err)
+		}
+		conn.Close()
+		broker.Close()
+	}
+}
+
+func TestGatewayRegistrationPause(t *testing.T) {
+	modem := &fakeModem{}
+	events := make(chan gogsmmodem.Packet, 1)
+	gw := New(modem, events, Config{})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	events <- gogsmmodem.RegistrationState{State: gogsmmodem.RegistrationLost, Status: gogsmmodem.RegSearching}
+	nextEvent(t, gw, EventModem)
+	gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Hi"})
+	time.Sleep(20 * time.Millisecond)
+	if m := gw.Metrics(); m.Sent != 0 || !m.OutboxPaused || m.OutboxLength != 1 {
+		t.Errorf("Expected: message held while paused, got %#v", m)
+	}
+	events <- gogsmmodem.RegistrationState{State: gogsmmodem.RegistrationRecovered, Status: gogsmmodem.RegSearching, Attempt: 1}
+	for i := 0; i < 100 && gw.Metrics().Sent == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	gw.Stop()
+	if m := gw.Metrics(); m.Sent != 1 || m.Failed != 0 || m.OutboxPaused {
+		t.Errorf("Expected: message sent once resumed, got %#v", m)
+	}
+}
+
+func TestGatewayDeliveryReports(t *testing.T) {
+	modem := &fakeModem{}
+	events := make(chan gogsmmodem.Packet, 3)
+	gw := New(modem, events, Config{DeliveryReports: true})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	delivered, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Hi"})
+	failed, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567891", Body: "Hi"})
+	for i := 0; i < 100 && gw.Metrics().Sent < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	events <- gogsmmodem.DeliveryReport{Reference: 2, Telephone: "+441234567891", Status: 0x20}
+	events <- gogsmmodem.DeliveryReport{Reference: 1, Telephone: "+441234567890", Status: 0}
+	events <- gogsmmodem.DeliveryReport{Reference: 2, Telephone: "+441234567891", Status: 0x41}
+	for i := 0; i < 100; i++ {
+		if out, _ := gw.Status(failed); out.Status == Failed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	gw.Stop()
+	if out, _ := gw.Status(delivered); out.Status != Delivered {
+		t.Errorf("Expected: delivered, got %#v", out)
+	}
+	if out, _ := gw.Status(failed); out.Status != Failed || out.Error != "Delivery failed, status 65" {
+		t.Errorf("Expected: failed, got %#v", out)
+	}
+	if !modem.sent[0].StatusReport {
+		t.Error("Expected: delivery report requested")
+	}
+}
+
+func TestGatewayStoredDeliveryReport(t *testing.T) {
+	modem := &fakeModem{reports: map[int]gogsmmodem.DeliveryReport{
+		3: {Reference: 1, Telephone: "+441234567890", Status: 0},
+	}}
+	events := make(chan gogsmmodem.Packet, 1)
+	gw := New(modem, events, Config{DeliveryReports: true})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	id, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Hi"})
+	for {
+		e := nextEvent(t, gw, EventStatus)
+		if e.Outgoing.Status == Sent {
+			break
+		}
+	}
+	events <- gogsmmodem.DeliveryReportNotification{Storage: "SR", Index: 3}
+	e := nextEvent(t, gw, EventStatus)
+	if e.Outgoing.ID != id || e.Outgoing.Status != Delivered {
+		t.Errorf("Expected: delivered, got %#v", e.Outgoing)
+	}
+	gw.Stop()
+	if !reflect.DeepEqual(modem.deleted, []int{3}) {
+		t.Error("Expected: stored report deleted, got:", modem.deleted)
+	}
+}
+
+func TestGatewayEarlyDeliveryReport(t *testing.T) {
+	clock := gogsmmodem.NewMockClock(time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC))
+	gw := New(&fakeModem{}, nil, Config{DeliveryReports: true, Clock: clock})
+	send := func(ref int) string {
+		id, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Hi"})
+		out, _ := gw.Status(id)
+		out.Status, out.Reference = Sent, ref
+		gw.store.SaveOutgoing(*out)
+		gw.awaitReport(out)
+		out, _ = gw.Status(id)
+		return string(out.Status)
+	}
+	// reported before the send returned
+	gw.deliveryReport(gogsmmodem.DeliveryReport{Reference: 1, Status: 0})
+	if status := send(1); status != string(Delivered) {
+		t.Error("Expected: delivered, got:", status)
+	}
+	// a stale report for the reference is not applied
+	gw.deliveryReport(gogsmmodem.DeliveryReport{Reference: 2, Status: 0})
+	clock.Advance(EarlyReportWindow)
+	if status := send(2); status != string(Sent) {
+		t.Error("Expected: sent, got:", status)
+	}
+}
+
+func TestGatewayConfirmation(t *testing.T) {
+	modem := &fakeModem{}
+	key := []byte("secret")
+	gw := New(modem, nil, Config{Confirmation: &Confirmation{
+		Score:     func(msg gogsmmodem.OutgoingMessage) float64 { return float64(len(msg.Body)) },
+		Threshold: 10,
+		Key:       key,
+	}})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	small, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Hi"})
+	big, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Everyone: offer ends today"})
+	stale, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Everyone: old news"})
+	for i := 0; i < 100 && gw.Metrics().Sent == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if out, _ := gw.Status(big); out.Status != Unconfirmed {
+		t.Errorf("Expected: message held for confirmation, got %#v", out)
+	}
+	if err := gw.Confirm(small, ""); err != ErrNotUnconfirmed {
+		t.Error("Expected: ErrNotUnconfirmed, got:", err)
+	}
+	if err := gw.Confirm(big, "forged"); err != ErrBadConfirmation {
+		t.Error("Expected: ErrBadConfirmation, got:", err)
+	}
+	out, _ := gw.Status(big)
+	if err := gw.Confirm(big, ConfirmationToken(key, *out)); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	for i := 0; i < 100 && gw.Metrics().Sent < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	gw.config.Confirmation.Expiry = 0
+	out, _ = gw.Status(stale)
+	if err := gw.Confirm(stale, ConfirmationToken(key, *out)); err != ErrConfirmationExpired {
+		t.Error("Expected: ErrConfirmationExpired, got:", err)
+	}
+	gw.Stop()
+
+	if out, _ := gw.Status(stale); out.Status != Cancelled {
+		t.Errorf("Expected: expired message cancelled, got %#v", out)
+	}
+	modem.lock.Lock()
+	defer modem.lock.Unlock()
+	if len(modem.sent) != 2 || modem.sent[1].ID != big {
+		t.Errorf("Expected: small and confirmed messages sent, got %#v", modem.sent)
+	}
+}
+
+func TestGatewayConfirmConcurrent(t *testing.T) {
+	gw := New(&fakeModem{}, nil, Config{Confirmation: &Confirmation{
+		Score: func(msg gogsmmodem.OutgoingMessage) float64 { return 1 },
+	}})
+	id, _ := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "+441234567890", Body: "Hi"})
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- gw.Confirm(id, "") }()
+	}
+	confirmed := 0
+	for i := 0; i < cap(errs); i++ {
+		switch err := <-errs; err {
+		case nil:
+			confirmed++
+		case ErrNotUnconfirmed:
+		default:
+			t.Error("Unexpected error:", err)
+		}
+	}
+	if confirmed != 1 {
+		t.Error("Expected: confirmed once, got:", confirmed)
+	}
+	if n := gw.Metrics().OutboxLength; n != 1 {
+		t.Error("Expected: queued once, got:", n)
+	}
+}
+
+func TestGatewayCancel(t *testing.T) {
+	modem := &fakeModem{block: true}
+	gw := New(modem, nil, Config{})
+	// queued
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a1", Telephone: "4412", Body: "Hi"})
+	if err := gw.Cancel("a1"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if err := gw.Cancel("a1"); err != ErrNotQueued {
+		t.Error("Expected: not queued, got:", err)
+	}
+	if out, _ := gw.Status("a1"); out.Status != Cancelled {
+		t.Errorf("Expected: cancelled, got %#v", out)
+	}
+	if gw.Metrics().OutboxLength != 0 {
+		t.Error("Expected: empty outbox")
+	}
+
+	// being sent
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a2", Telephone: "4412", Body: "Hi"})
+	for {
+		e := nextEvent(t, gw, EventAudit)
+		if e.Audit.Stage == AuditSubmitted {
+			break
+		}
+	}
+	if err := gw.Cancel("a2"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	e := nextEvent(t, gw, EventStatus)
+	if e.Outgoing.ID != "a2" || e.Outgoing.Status != Cancelled || e.Outgoing.Attempts != 1 {
+		t.Errorf("Expected: a2 cancelled, got %#v", e.Outgoing)
+	}
+	gw.Stop()
+	if m := gw.Metrics(); m.Cancelled != 2 || m.Failed != 0 {
+		t.Errorf("Unexpected metrics: %#v", m)
+	}
+}
+
+// Events buffered so far
+func drain(events chan Event) chan Event {
+	ret := make(chan Event, len(events))
+	for len(events) > 0 {
+		ret <- <-events
+	}
+	close(ret)
+	return ret
+}
+
+func TestGatewayShaping(t *testing.T) {
+	modem := &fakeModem{}
+	clock := gogsmmodem.NewMockClock(time.Date(2014, 2, 1, 12, 0, 0, 0, time.UTC))
+	gw := New(modem, nil, Config{Clock: clock, Shaping: &Shaping{Gap: time.Second, IdenticalPerDay: 2}})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	sent := func(n int) {
+		for i := 0; i < 100; i++ {
+			modem.lock.Lock()
+			done := len(modem.sent) >= n
+			modem.lock.Unlock()
+			if done {
+				return
+			}
+			clock.Advance(time.Second)
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("Expected: sent", n)
+	}
+	for _, id := range []string{"a1", "a2", "a3"} {
+		gw.Enqueue(gogsmmodem.OutgoingMessage{ID: id, Telephone: "4412", Body: "Offer"})
+	}
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "b1", Telephone: "4412", Body: "Hi"})
+	sent(3)
+	for {
+		if e := nextEvent(t, gw, EventAudit); e.Audit.Stage == AuditDeferred {
+			if e.Audit.ID != "a3" {
+				t.Errorf("Expected: a3 deferred, got %#v", e.Audit)
+			}
+			break
+		}
+	}
+	clock.Advance(24 * time.Hour)
+	sent(4)
+	gw.Stop()
+	var ids []string
+	for _, msg := range modem.sent {
+		ids = append(ids, msg.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"a1", "a2", "b1", "a3"}) {
+		t.Errorf("Expected: third identical message held a day, got %v", ids)
+	}
+
+	if gw := New(modem, nil, Config{ShapingProfile: "standard"}); gw.shaper == nil || gw.shaper.Gap != 2*time.Second {
+		t.Error("Expected: standard profile")
+	}
+	if gw := New(modem, nil, Config{ShapingProfile: "unknown"}); gw.shaper != nil {
+		t.Error("Expected: unknown profile not shaping")
+	}
+}
+
+func TestRegisterShapingConcurrent(t *testing.T) {
+	defer delete(ShapingProfiles, "operator")
+	done := make(chan struct{})
+	go func() {
+		RegisterShaping(Shaping{Name: "operator", Gap: time.Second})
+		close(done)
+	}()
+	New(&fakeModem{}, nil, Config{ShapingProfile: "standard"})
+	<-done
+	if s, ok := lookupShaping("operator"); !ok || s.Gap != time.Second {
+		t.Error("Expected: operator profile, got:", s)
+	}
+}
+
+func TestGatewayExpiry(t *testing.T) {
+	modem := &fakeModem{fail: 1}
+	clock := gogsmmodem.NewMockClock(time.Date(2014, 2, 1, 12, 0, 0, 0, time.UTC))
+	gw := New(modem, nil, Config{Clock: clock, RetryDelay: time.Minute})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "old", Telephone: "4412", Body: "Code 1234", Expires: clock.Now()})
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "otp", Telephone: "4412", Body: "Code 5678", Expires: clock.Now().Add(30 * time.Second)})
+	for {
+		if e := nextEvent(t, gw, EventAudit); e.Audit.Stage == AuditFailed {
+			break
+		}
+	}
+	// retried after expiry
+	for i := 0; i < 100; i++ {
+		if out, _ := gw.Status("otp"); out.Status == Failed {
+			break
+		}
+		clock.Advance(time.Minute)
+		time.Sleep(10 * time.Millisecond)
+	}
+	gw.Stop()
+	for _, id := range []string{"old", "otp"} {
+		if out, _ := gw.Status(id); out.Status != Failed || out.Error != gogsmmodem.ErrExpired.Error() {
+			t.Errorf("Expected: %s expired, got %#v", id, out)
+		}
+	}
+	if len(modem.sent) != 0 {
+		t.Errorf("Expected: nothing sent, got %#v", modem.sent)
+	}
+}
+
+func TestGatewayExpiryPaused(t *testing.T) {
+	modem := &fakeModem{}
+	events := make(chan gogsmmodem.Packet, 1)
+	clock := gogsmmodem.NewMockClock(time.Date(2014, 2, 1, 12, 0, 0, 0, time.UTC))
+	gw := New(modem, events, Config{Clock: clock})
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	events <- gogsmmodem.RegistrationState{State: gogsmmodem.RegistrationLost, Status: gogsmmodem.RegSearching}
+	nextEvent(t, gw, EventModem)
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "otp", Telephone: "4412", Body: "Code 5678", Expires: clock.Now().Add(30 * time.Second)})
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "news", Telephone: "4412", Body: "Weekly news"})
+	for i := 0; i < 100; i++ {
+		if out, _ := gw.Status("otp"); out.Status == Failed {
+			break
+		}
+		clock.Advance(ExpiryCheckInterval)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if out, _ := gw.Status("otp"); out.Status != Failed || out.Error != gogsmmodem.ErrExpired.Error() {
+		t.Errorf("Expected: expired while paused, got %#v", out)
+	}
+	if ids := gw.outbox.ids(); !reflect.DeepEqual(ids, []string{"news"}) {
+		t.Error("Expected: only the unexpired message queued, got:", ids)
+	}
+	gw.Stop()
+	if len(modem.sent) != 0 {
+		t.Errorf("Expected: nothing sent, got %#v", modem.sent)
+	}
+}
+
+func TestGatewayDedup(t *testing.T) {
+	clock := gogsmmodem.NewMockClock(time.Date(2014, 2, 1, 12, 0, 0, 0, time.UTC))
+	gw := New(&fakeModem{}, nil, Config{Clock: clock, DedupWindow: 10 * time.Minute})
+	alert := gogsmmodem.OutgoingMessage{Telephone: "4412", Body: "Sensor 3 offline"}
+	first, err := gw.Enqueue(alert)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	clock.Advance(5 * time.Minute)
+	if id, err := gw.Enqueue(alert); err != ErrDuplicate || id != first {
+		t.Errorf("Expected: duplicate of %s, got %s %v", first, id, err)
+	}
+	if _, err := gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "4413", Body: "Sensor 3 offline"}); err != nil {
+		t.Error("Expected: another recipient enqueued, got:", err)
+	}
+	gw.Cancel(first)
+	if _, err := gw.Enqueue(alert); err != nil {
+		t.Error("Expected: enqueued once the first was cancelled, got:", err)
+	}
+	clock.Advance(11 * time.Minute)
+	if _, err := gw.Enqueue(alert); err != nil {
+		t.Error("Expected: enqueued after the window, got:", err)
+	}
+	if m := gw.Metrics(); m.Duplicates != 1 || m.Queued != 4 {
+		t.Errorf("Unexpected metrics: %#v", m)
+	}
+}
+
+// Counts the outbox listed
+type listCountingStore struct {
+	*MemoryStore
+	lists int
+}
+
+func (self *listCountingStore) ListOutgoing(status Status) ([]Outgoing, error) {
+	self.lists++
+	return self.MemoryStore.ListOutgoing(status)
+}
+
+func TestGatewayDedupIndex(t *testing.T) {
+	clock := gogsmmodem.NewMockClock(time.Date(2014, 2, 1, 12, 0, 0, 0, time.UTC))
+	store := &listCountingStore{MemoryStore: NewMemoryStore()}
+	config := Config{Clock: clock, Store: store, DedupWindow: 10 * time.Minute}
+	gw := New(&fakeModem{}, nil, config)
+	alert := gogsmmodem.OutgoingMessage{Telephone: "4412", Body: "Sensor 3 offline"}
+	first, _ := gw.Enqueue(alert)
+	for i := 0; i < 10; i++ {
+		gw.Enqueue(gogsmmodem.OutgoingMessage{Telephone: "4412", Body: fmt.Sprint("Reading ", i)})
+	}
+	lists := store.lists
+	if _, err := gw.Enqueue(alert); err != ErrDuplicate {
+		t.Error("Expected: ErrDuplicate, got:", err)
+	}
+	if store.lists != lists || lists > 4 {
+		t.Errorf("Expected: the outbox listed only once, got %d lists", store.lists)
+	}
+
+	// found after a restart
+	gw = New(&fakeModem{}, nil, config)
+	clock.Advance(5 * time.Minute)
+	if id, err := gw.Enqueue(alert); err != ErrDuplicate || id != first {
+		t.Errorf("Expected: duplicate of %s, got %s %v", first, id, err)
+	}
+}
+
+func TestGatewayAdmin(t *testing.T) {
+	modem := &fakeModem{fail: 2}
+	gw := New(modem, nil, Config{MaxAttempts: 1})
+	if err := gw.FlushInbox(); err != ErrNotStarted {
+		t.Error("Expected: ErrNotStarted, got:", err)
+	}
+	if err := gw.Start(); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	gw.Pause()
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a1", Telephone: "4412", Body: "Hi"})
+	gw.Enqueue(gogsmmodem.OutgoingMessage{ID: "a2", Telephone: "4412", Body: "Hi"})
+	queue, err := gw.Queue()
+	if err != nil || len(queue) != 2 || queue[0].ID != "a1" || !gw.Metrics().OutboxPaused {
+		t.Errorf("Expected: both queued while paused, got %#v %v", queue, err)
+	}
+	gw.Resume()
+	for i := 0; i < 100; i++ {
+		if failed, _ := gw.Messages(Failed); len(failed) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := gw.Requeue("a1"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	for e := nextEvent(t, gw, EventStatus); e.Outgoing.Status != Sent; e = nextEvent(t, gw, EventStatus) {
+	}
+	if err := gw.Requeue("a1"); err != ErrNotFailed {
+		t.Error("Expected: ErrNotFailed, got:", err)
+	}
+
+	modem.lock.Lock()
+	modem.stored = gogsmmodem.MessageList{{Index: 3, Body: "Stored"}}
+	modem.lock.Unlock()
+	if err := gw.FlushInbox(); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	gw.Stop()
+	if out, _ := gw.Status("a2"); out.Status != Failed {
+		t.Errorf("Expected: a2 still failed, got %#v", out)
+	}
+	modem.lock.Lock()
+	defer modem.lock.Unlock()
+	if len(modem.sent) != 1 || !reflect.DeepEqual(modem.deleted, []int{3}) {
+		t.Errorf("Expected: a1 sent and the stored message flushed, got %#v %v", modem.sent, modem.deleted)
+	}
+}
@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"log"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Receive messages the modem notifies until stopped, passing on other
+// unsolicited packets as modem events.
+func (self *Gateway) receiveLoop() {
+	defer self.wg.Done()
+	redeliver := self.clock.After(self.config.RedeliverInterval)
+	var batch <-chan time.Time
+	var notified []gogsmmodem.MessageNotification
+	for {
+		select {
+		case <-redeliver:
+			self.redeliver()
+			redeliver = self.clock.After(self.config.RedeliverInterval)
+		case reply := <-self.flushes:
+			reply <- self.flush()
+		case <-batch:
+			self.receiveBatch(notified)
+			batch = nil
+			notified = nil
+		case p, ok := <-self.events:
+			if !ok {
+				return
+			}
+			if n, ok := p.(gogsmmodem.MessageNotification); ok {
+				if self.config.BatchWindow == 0 {
+					self.receive(n)
+					continue
+				}
+				notified = append(notified, n)
+				if batch == nil {
+					batch = self.clock.After(self.config.BatchWindow)
+				}
+			} else {
+				if r, ok := p.(gogsmmodem.RegistrationState); ok {
+					self.registration(r)
+				}
+				if r, ok := p.(gogsmmodem.NetworkRegistration); ok && r.Registered() {
+					self.registered("registered")
+				}
+				if r, ok := p.(gogsmmodem.EPSRegistration); ok && r.Registered() {
+					self.registered("registered on LTE")
+				}
+				if r, ok := p.(gogsmmodem.DeliveryReport); ok {
+					self.deliveryReport(r)
+				}
+				if n, ok := p.(gogsmmodem.DeliveryReportNotification); ok {
+					self.storedReport(n)
+				}
+				self.event(Event{Type: EventModem, Packet: p})
+			}
+		case <-self.quit:
+			return
+		}
+	}
+}
+
+// Pause the outbox while the modem is recovering lost registration, so
+// messages wait rather than each failing
+func (self *Gateway) registration(r gogsmmodem.RegistrationState) {
+	switch r.State {
+	case gogsmmodem.RegistrationLost:
+		if self.outbox.pause(true) {
+			log.Println("Outbox: paused, registration lost")
+		}
+	case gogsmmodem.RegistrationRecovered, gogsmmodem.RegistrationStopped:
+		self.registered("registration " + r.State)
+	}
+}
+
+// Resume the outbox if paused for lost registration. A registered status
+// resumes it too, in case the modem's recovered state was dropped.
+func (self *Gateway) registered(reason string) {
+	if self.outbox.pause(false) {
+		log.Println("Outbox: resumed,", reason)
+	}
+}
+
+// Process messages already stored on the SIM
+func (self *Gateway) receiveStored() error {
+	msgs, err := self.modem.ListMessages("ALL")
+	if err != nil {
+		return err
+	}
+	for _, msg := range *msgs {
+		self.received(msg)
+	}
+	return nil
+}
+
+// Fetch a notified message from the storage area it was notified in
+func (self *Gateway) receive(n gogsmmodem.MessageNotification) {
+	msg, err := self.modem.GetMessageFrom(n.Storage, n.Index)
+	if err != nil {
+		log.Println("Inbox: reading message", n.Storage, n.Index, err)
+		return
+	}
+	self.received(*msg)
+}
+
+// Fetch the notified messages, listing unread messages if there are several,
+// and delete them once all are processed. Messages not listed, as when
+// notified in another storage area, are fetched individually.
+func (self *Gateway) receiveBatch(notified []gogsmmodem.MessageNotification) {
+	if len(notified) == 1 {
+		self.receive(notified[0])
+		return
+	}
+	msgs, err := self.modem.ListMessages("REC UNREAD")
+	if err != nil {
+		log.Println("Inbox: listing messages", err)
+		return
+	}
+	self.batching = true
+	// storage areas listed by index, "" if unknown
+	listed := map[int]string{}
+	for _, msg := range *msgs {
+		listed[msg.Index] = msg.Storage
+		self.received(msg)
+	}
+	for _, n := range notified {
+		if storage, ok := listed[n.Index]; !ok || storage != "" && storage != n.Storage {
+			self.receive(n)
+		}
+	}
+	self.batching = false
+	for _, n := range self.deletes {
+		self.delete(n)
+	}
+	self.deletes = nil
+}
+
+// The notification for a stored message
+func notification(msg gogsmmodem.Message) gogsmmodem.MessageNotification {
+	return gogsmmodem.MessageNotification{Storage: msg.Storage, Index: msg.Index}
+}
+
+// Retry messages the handler failed
+func (self *Gateway) redeliver() {
+	for n := range self.unacked {
+		delete(self.unacked, n)
+		self.receive(n)
+	}
+}
+
+// Filter, handle, store and deliver a received message, then delete it from
+// the modem. It is left on the modem for redelivery if the handler fails.
+func (self *Gateway) received(msg gogsmmodem.Message) {
+	verdict, tags := self.filter(msg)
+	switch verdict.Action {
+	case Drop:
+		log.Println("Inbox: dropped message", msg.Index, verdict.Reason)
+		self.metrics.dropped()
+		self.consumed(msg)
+		return
+	case Quarantine:
+		if err := self.store.QuarantineIncoming(msg, verdict.Reason); err != nil {
+			log.Println("Inbox: quarantining message", msg.Index, err)
+			return
+		}
+		self.metrics.quarantined()
+		self.event(Event{Type: EventQuarantined, Incoming: &msg, Tags: []string{verdict.Reason}})
+		self.consumed(msg)
+		return
+	}
+	if len(tags) > 0 {
+		self.metrics.tagged()
+	}
+	handler := self.config.Handler
+	if r := self.rule(msg); r != nil {
+		if r.Action == RuleDrop {
+			log.Println("Inbox: dropped message", msg.Index, "by rule")
+			self.metrics.dropped()
+			self.consumed(msg)
+			return
+		}
+		handler = func(msg gogsmmodem.Message) error { return self.apply(r, msg) }
+	}
+	if handler != nil {
+		if err := handler(msg); err != nil {
+			log.Println("Inbox: handler failed for message", msg.Index, err)
+			self.unacked[notification(msg)] = true
+			self.metrics.handlerFailed()
+			return
+		}
+	}
+	if err := self.store.SaveIncoming(msg); err != nil {
+		log.Println("Inbox: storing message", msg.Index, err)
+		return
+	}
+	self.metrics.received()
+	self.event(Event{Type: EventIncoming, Incoming: &msg, Tags: tags})
+	self.consumed(msg)
+}
+
+// Delete a message from the modem once processed
+func (self *Gateway) consumed(msg gogsmmodem.Message) {
+	if self.config.KeepReceived {
+		return
+	}
+	if self.batching {
+		self.deletes = append(self.deletes, notification(msg))
+		return
+	}
+	self.delete(notification(msg))
+}
+
+func (self *Gateway) delete(n gogsmmodem.MessageNotification) {
+	if err := self.modem.DeleteMessageFrom(n.Storage, n.Index); err != nil {
+		log.Println("Inbox: deleting message", n.Storage, n.Index, err)
+	}
+}
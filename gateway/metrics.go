@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Gateway counters
+type Metrics struct {
+	Queued    int
+	Sent      int
+	Failed    int
+	Cancelled int
+	// Messages refused as duplicates, see Config.DedupWindow
+	Duplicates    int
+	Received      int
+	WebhookFailed int
+	HandlerFailed int
+	EmailFailed   int
+	MQTTFailed    int
+	// Incoming messages dropped, quarantined or tagged by filters
+	Dropped      int
+	Quarantined  int
+	Tagged       int
+	OutboxLength int
+	// Sending paused while the modem recovers registration, or by
+	// Gateway.Pause
+	OutboxPaused bool
+}
+
+type metricsCounter struct {
+	lock sync.Mutex
+	m    Metrics
+}
+
+func (self *metricsCounter) add(f func(m *Metrics)) {
+	self.lock.Lock()
+	f(&self.m)
+	self.lock.Unlock()
+}
+
+func (self *metricsCounter) queued()        { self.add(func(m *Metrics) { m.Queued++ }) }
+func (self *metricsCounter) sent()          { self.add(func(m *Metrics) { m.Sent++ }) }
+func (self *metricsCounter) failed()        { self.add(func(m *Metrics) { m.Failed++ }) }
+func (self *metricsCounter) cancelled()     { self.add(func(m *Metrics) { m.Cancelled++ }) }
+func (self *metricsCounter) duplicate()     { self.add(func(m *Metrics) { m.Duplicates++ }) }
+func (self *metricsCounter) received()      { self.add(func(m *Metrics) { m.Received++ }) }
+func (self *metricsCounter) webhookFailed() { self.add(func(m *Metrics) { m.WebhookFailed++ }) }
+func (self *metricsCounter) handlerFailed() { self.add(func(m *Metrics) { m.HandlerFailed++ }) }
+func (self *metricsCounter) emailFailed()   { self.add(func(m *Metrics) { m.EmailFailed++ }) }
+func (self *metricsCounter) mqttFailed()    { self.add(func(m *Metrics) { m.MQTTFailed++ }) }
+func (self *metricsCounter) dropped()       { self.add(func(m *Metrics) { m.Dropped++ }) }
+func (self *metricsCounter) quarantined()   { self.add(func(m *Metrics) { m.Quarantined++ }) }
+func (self *metricsCounter) tagged()        { self.add(func(m *Metrics) { m.Tagged++ }) }
+
+func (self *metricsCounter) snapshot() Metrics {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.m
+}
+
+// Metrics returns the gateway's counters.
+func (self *Gateway) Metrics() Metrics {
+	m := self.metrics.snapshot()
+	m.OutboxLength = self.outbox.len()
+	m.OutboxPaused = self.outbox.isPaused()
+	return m
+}
+
+// MetricsHandler serves the counters in the Prometheus text format.
+func (self *Gateway) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := self.Metrics()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintf(w, "gsm_gateway_queued_total %d\n", m.Queued)
+		fmt.Fprintf(w, "gsm_gateway_sent_total %d\n", m.Sent)
+		fmt.Fprintf(w, "gsm_gateway_failed_total %d\n", m.Failed)
+		fmt.Fprintf(w, "gsm_gateway_cancelled_total %d\n", m.Cancelled)
+		fmt.Fprintf(w, "gsm_gateway_duplicates_total %d\n", m.Duplicates)
+		fmt.Fprintf(w, "gsm_gateway_received_total %d\n", m.Received)
+		fmt.Fprintf(w, "gsm_gateway_webhook_failed_total %d\n", m.WebhookFailed)
+		fmt.Fprintf(w, "gsm_gateway_handler_failed_total %d\n", m.HandlerFailed)
+		fmt.Fprintf(w, "gsm_gateway_email_failed_total %d\n", m.EmailFailed)
+		fmt.Fprintf(w, "gsm_gateway_mqtt_failed_total %d\n", m.MQTTFailed)
+		fmt.Fprintf(w, "gsm_gateway_dropped_total %d\n", m.Dropped)
+		fmt.Fprintf(w, "gsm_gateway_quarantined_total %d\n", m.Quarantined)
+		fmt.Fprintf(w, "gsm_gateway_tagged_total %d\n", m.Tagged)
+		fmt.Fprintf(w, "gsm_gateway_outbox_length %d\n", m.OutboxLength)
+		paused := 0
+		if m.OutboxPaused {
+			paused = 1
+		}
+		fmt.Fprintf(w, "gsm_gateway_outbox_paused %d\n", paused)
+	})
+}
@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Publishes to and subscribes to MQTT topics. MQTTConn is a minimal client,
+// or other clients can be adapted to this.
+type MQTTClient interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, handler func(payload []byte)) error
+}
+
+// Bridges the gateway to MQTT, see Config.MQTT. Events are published as
+// JSON to topics under Prefix:
+//
+//	gsm/incoming     received messages
+//	gsm/status       outgoing messages queued, sent or failed
+//	gsm/delivery     delivery reports for sent messages
+//	gsm/quarantined  received messages quarantined by a filter
+//	gsm/modem        other unsolicited packets, eg signal or registration
+//	gsm/health       the gateway's Metrics and modem's Stats, periodically
+//
+// An OutgoingMessage published as JSON to gsm/send is queued for sending.
+type MQTTConfig struct {
+	Client MQTTClient
+	// Prefix of the topics, default "gsm"
+	Prefix string
+	// Interval between health reports, default 1 minute
+	HealthInterval time.Duration
+}
+
+// Published on the health topic
+type Health struct {
+	Metrics Metrics
+	// Counters of the modem, if it reports them
+	Modem *gogsmmodem.Stats `json:",omitempty"`
+}
+
+// Modems reporting counters for the health topic
+type statsModem interface {
+	Stats() gogsmmodem.Stats
+}
+
+// Queue a message published to the send topic
+func (self *Gateway) mqttSend(payload []byte) {
+	var msg gogsmmodem.OutgoingMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Println("MQTT send:", err)
+		return
+	}
+	if _, err := self.Enqueue(msg); err != nil {
+		log.Println("MQTT send:", err)
+	}
+}
+
+// Topic to publish an event on, or "" if it is not published
+func (self *Gateway) mqttTopic(e Event) string {
+	switch e.Type {
+	case EventAudit:
+		if e.Audit.Stage != AuditDeliveryReport {
+			return ""
+		}
+		return self.config.MQTT.Prefix + "/delivery"
+	}
+	return self.config.MQTT.Prefix + "/" + e.Type
+}
+
+func (self *Gateway) publish(topic string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = self.config.MQTT.Client.Publish(topic, data)
+	}
+	if err != nil {
+		log.Println("MQTT:", err)
+		self.metrics.mqttFailed()
+	}
+}
+
+// Publish events and health reports until stopped
+func (self *Gateway) mqttLoop() {
+	defer self.wg.Done()
+	health := self.clock.After(self.config.MQTT.HealthInterval)
+	for {
+		select {
+		case e := <-self.mqtt:
+			switch e.Type {
+			case EventIncoming, EventQuarantined:
+				self.publish(self.mqttTopic(e), e.Incoming)
+			case EventStatus:
+				self.publish(self.mqttTopic(e), e.Outgoing)
+			case EventModem:
+				self.publish(self.mqttTopic(e), e.Packet)
+			default:
+				self.publish(self.mqttTopic(e), e.Audit)
+			}
+		case <-health:
+			h := Health{Metrics: self.Metrics()}
+			if m, ok := self.modem.(statsModem); ok {
+				stats := m.Stats()
+				h.Modem = &stats
+			}
+			self.publish(self.config.MQTT.Prefix+"/health", h)
+			health = self.clock.After(self.config.MQTT.HealthInterval)
+		case <-self.quit:
+			return
+		}
+	}
+}
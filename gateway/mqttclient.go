@@ -0,0 +1,260 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MQTT control packet types
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttSubscribe  = 8
+	mqttPingReq    = 12
+	mqttDisconnect = 14
+)
+
+var (
+	ErrMQTTClosed    = errors.New("MQTT connection closed")
+	ErrMQTTPassword  = errors.New("MQTT password given without a username")
+	ErrMQTTKeepAlive = errors.New("MQTT keep alive must be from 1s to 65535s")
+)
+
+// Options for DialMQTT
+type MQTTOptions struct {
+	ClientID string
+	Username string
+	Password string
+	// Interval the broker expects to hear from the client, in whole seconds,
+	// default 60s
+	KeepAlive time.Duration
+}
+
+// A minimal MQTT 3.1.1 client, publishing and subscribing at QoS 0 to exact
+// topics (no wildcards). It does not reconnect: once the connection drops,
+// Done is closed and publishing fails with ErrMQTTClosed.
+type MQTTConn struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	handlers  map[string]func(payload []byte)
+	packetID  uint16
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// DialMQTT connects to the broker at addr, eg "localhost:1883".
+func DialMQTT(addr string, options MQTTOptions) (*MQTTConn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewMQTTConn(conn, options)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewMQTTConn connects over an established connection to the broker.
+func NewMQTTConn(conn net.Conn, options MQTTOptions) (*MQTTConn, error) {
+	if options.KeepAlive == 0 {
+		options.KeepAlive = 60 * time.Second
+	}
+	if options.KeepAlive < time.Second || options.KeepAlive > 0xffff*time.Second {
+		return nil, ErrMQTTKeepAlive
+	}
+	// a password can't be sent without a username in MQTT 3.1.1
+	if options.Password != "" && options.Username == "" {
+		return nil, ErrMQTTPassword
+	}
+	var flags byte = 0x02 // clean session
+	payload := mqttString(options.ClientID)
+	if options.Username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(options.Username)...)
+	}
+	if options.Password != "" {
+		flags |= 0x40
+		payload = append(payload, mqttString(options.Password)...)
+	}
+	header := append(mqttString("MQTT"), 4, flags, 0, 0)
+	binary.BigEndian.PutUint16(header[len(header)-2:], uint16(options.KeepAlive/time.Second))
+	if _, err := conn.Write(mqttPacket(mqttConnect<<4, append(header, payload...))); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := mqttRead(r)
+	if err != nil {
+		return nil, err
+	}
+	if typ>>4 != mqttConnAck || len(body) != 2 {
+		return nil, fmt.Errorf("MQTT expected CONNACK, got packet type %d", typ>>4)
+	}
+	if body[1] != 0 {
+		return nil, fmt.Errorf("MQTT connection refused with code %d", body[1])
+	}
+	self := &MQTTConn{
+		conn:     conn,
+		handlers: map[string]func(payload []byte){},
+		done:     make(chan struct{}),
+	}
+	go self.readLoop(r)
+	go self.keepAlive(options.KeepAlive / 2)
+	return self, nil
+}
+
+// Publish the payload to the topic.
+func (self *MQTTConn) Publish(topic string, payload []byte) error {
+	return self.write(mqttPacket(mqttPublish<<4, append(mqttString(topic), payload...)))
+}
+
+// Subscribe calls handler with the payload of each message published to the
+// topic.
+func (self *MQTTConn) Subscribe(topic string, handler func(payload []byte)) error {
+	self.lock.Lock()
+	self.handlers[topic] = handler
+	self.packetID++
+	id := self.packetID
+	self.lock.Unlock()
+	body := []byte{byte(id >> 8), byte(id)}
+	body = append(body, mqttString(topic)...)
+	return self.write(mqttPacket(mqttSubscribe<<4|0x02, append(body, 0)))
+}
+
+// Done is closed when the connection drops.
+func (self *MQTTConn) Done() <-chan struct{} {
+	return self.done
+}
+
+// Close disconnects from the broker.
+func (self *MQTTConn) Close() error {
+	self.write(mqttPacket(mqttDisconnect<<4, nil))
+	self.close()
+	return nil
+}
+
+func (self *MQTTConn) close() {
+	self.closeOnce.Do(func() {
+		close(self.done)
+		self.conn.Close()
+	})
+}
+
+func (self *MQTTConn) write(packet []byte) error {
+	select {
+	case <-self.done:
+		return ErrMQTTClosed
+	default:
+	}
+	self.writeLock.Lock()
+	defer self.writeLock.Unlock()
+	_, err := self.conn.Write(packet)
+	return err
+}
+
+// Dispatch published messages to subscribers until the connection drops
+func (self *MQTTConn) readLoop(r *bufio.Reader) {
+	defer self.close()
+	for {
+		typ, body, err := mqttRead(r)
+		if err != nil {
+			return
+		}
+		if typ>>4 != mqttPublish || len(body) < 2 {
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+n {
+			return
+		}
+		topic := string(body[2 : 2+n])
+		payload := body[2+n:]
+		if qos := typ >> 1 & 0x03; qos > 0 && len(payload) >= 2 {
+			// packet identifier, not acknowledged as subscriptions are QoS 0
+			payload = payload[2:]
+		}
+		self.lock.Lock()
+		handler := self.handlers[topic]
+		self.lock.Unlock()
+		if handler != nil {
+			handler(payload)
+		}
+	}
+}
+
+// Ping the broker so it keeps the connection open
+func (self *MQTTConn) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if self.write(mqttPacket(mqttPingReq<<4, nil)) != nil {
+				self.close()
+				return
+			}
+		case <-self.done:
+			return
+		}
+	}
+}
+
+// Length prefixed UTF-8 string
+func mqttString(s string) []byte {
+	b := []byte{byte(len(s) >> 8), byte(len(s))}
+	return append(b, s...)
+}
+
+// Packet of the type and flags byte with the body
+func mqttPacket(typ byte, body []byte) []byte {
+	packet := []byte{typ}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// Read a packet, returning its type and flags byte and its body
+func mqttRead(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, uint(0)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("MQTT packet length too long")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
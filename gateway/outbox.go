@@ -0,0 +1,393 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// How often messages queued while the outbox is paused are checked for
+// expiry
+var ExpiryCheckInterval = time.Minute
+
+// Queue of messages to send, persisted in the store so queued messages
+// survive a restart.
+type outbox struct {
+	lock  sync.Mutex
+	queue []string
+	// signalled when a message is queued
+	wake chan struct{}
+	// message being sent, and cancels sending it
+	current string
+	cancel  context.CancelFunc
+	// nothing is taken while the modem is unregistered, or while held by
+	// Gateway.Pause
+	paused bool
+	held   bool
+}
+
+func newOutbox() *outbox {
+	return &outbox{wake: make(chan struct{}, 1)}
+}
+
+func (self *outbox) push(id string) {
+	self.lock.Lock()
+	self.queue = append(self.queue, id)
+	self.lock.Unlock()
+	select {
+	case self.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Take the next message to send, with a context cancelled by cancel. done
+// must be called once it is sent.
+func (self *outbox) pop() (string, context.Context, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.queue) == 0 || self.paused || self.held {
+		return "", nil, false
+	}
+	id := self.queue[0]
+	self.queue = self.queue[1:]
+	var ctx context.Context
+	ctx, self.cancel = context.WithCancel(context.Background())
+	self.current = id
+	return id, ctx, true
+}
+
+func (self *outbox) done() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.cancel()
+	self.current = ""
+	self.cancel = nil
+}
+
+// Remove a message from the queue, or cancel sending it if it's being sent,
+// reporting whether it was being sent.
+func (self *outbox) remove(id string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.current == id {
+		self.cancel()
+		return true
+	}
+	for i, queued := range self.queue {
+		if queued == id {
+			self.queue = append(self.queue[:i], self.queue[i+1:]...)
+			break
+		}
+	}
+	return false
+}
+
+// Remove a queued message, reporting whether it was queued
+func (self *outbox) take(id string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for i, queued := range self.queue {
+		if queued == id {
+			self.queue = append(self.queue[:i], self.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Pause or resume taking messages to send, reporting whether this changed
+// anything
+func (self *outbox) pause(paused bool) bool {
+	self.lock.Lock()
+	changed := self.paused != paused
+	self.paused = paused
+	self.lock.Unlock()
+	if !changed {
+		return false
+	}
+	select {
+	case self.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Hold or release the outbox, see Gateway.Pause
+func (self *outbox) hold(held bool) {
+	self.lock.Lock()
+	self.held = held
+	self.lock.Unlock()
+	select {
+	case self.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (self *outbox) isPaused() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.paused || self.held
+}
+
+// IDs of the message being sent and those queued, in order
+func (self *outbox) ids() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ids []string
+	if self.current != "" {
+		ids = append(ids, self.current)
+	}
+	return append(ids, self.queue...)
+}
+
+func (self *outbox) len() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.queue)
+}
+
+// A random message ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Enqueue a message for sending, returning its ID. The message's ID is used
+// if set, otherwise one is generated. A message needing confirmation is held
+// as Unconfirmed until Confirm is called. A message identical to one queued
+// or sent within Config.DedupWindow fails with ErrDuplicate, returning the
+// earlier message's ID.
+func (self *Gateway) Enqueue(msg gogsmmodem.OutgoingMessage) (string, error) {
+	if msg.ID == "" {
+		msg.ID = newID()
+	}
+	if self.config.DedupWindow > 0 {
+		self.dedupLock.Lock()
+		defer self.dedupLock.Unlock()
+		dup, err := self.duplicate(msg)
+		if err != nil {
+			return "", err
+		}
+		if dup != nil {
+			self.metrics.duplicate()
+			return dup.ID, ErrDuplicate
+		}
+	}
+	out := Outgoing{
+		ID:        msg.ID,
+		Telephone: msg.Telephone,
+		Body:      msg.Body,
+		Encoding:  msg.Encoding,
+		Compress:  msg.Compress,
+		Status:    Queued,
+		Queued:    self.clock.Now(),
+		Expires:   msg.Expires,
+	}
+	if self.needsConfirmation(msg) {
+		out.Status = Unconfirmed
+	}
+	if err := self.store.SaveOutgoing(out); err != nil {
+		return "", err
+	}
+	if self.config.DedupWindow > 0 {
+		self.rememberLocked(&out)
+	}
+	self.metrics.queued()
+	if out.Status == Unconfirmed {
+		self.audit(&out, AuditUnconfirmed, nil)
+	} else {
+		self.outbox.push(out.ID)
+		self.audit(&out, AuditQueued, nil)
+	}
+	self.event(Event{Type: EventStatus, Outgoing: &out})
+	return out.ID, nil
+}
+
+// Status of a queued or sent message by ID.
+func (self *Gateway) Status(id string) (*Outgoing, error) {
+	return self.store.GetOutgoing(id)
+}
+
+var ErrNotQueued = errors.New("Message not queued")
+
+// Cancel a queued or unconfirmed message by ID, which is then Cancelled. A message being
+// sent has its entry aborted if the modem has yet to send it; the outcome is
+// reported by its EventStatus. Fails with ErrNotQueued if the message was
+// already sent or failed.
+func (self *Gateway) Cancel(id string) error {
+	self.statusLock.Lock()
+	defer self.statusLock.Unlock()
+	out, err := self.store.GetOutgoing(id)
+	if err != nil {
+		return err
+	}
+	if out.Status != Queued && out.Status != Unconfirmed {
+		return ErrNotQueued
+	}
+	if self.outbox.remove(id) {
+		return nil
+	}
+	self.cancelled(out)
+	return nil
+}
+
+// Mark a message cancelled
+func (self *Gateway) cancelled(out *Outgoing) {
+	out.Status = Cancelled
+	self.metrics.cancelled()
+	self.audit(out, AuditCancelled, nil)
+	if err := self.store.SaveOutgoing(*out); err != nil {
+		log.Println("Outbox:", out.ID, err)
+	}
+	status := *out
+	self.event(Event{Type: EventStatus, Outgoing: &status})
+}
+
+// Fail a message not sent before its expiry
+func (self *Gateway) expired(out *Outgoing) {
+	log.Printf("Outbox: %s expired", out.ID)
+	out.Status = Failed
+	out.Error = gogsmmodem.ErrExpired.Error()
+	self.metrics.failed()
+	self.audit(out, AuditExpired, gogsmmodem.ErrExpired)
+	if err := self.store.SaveOutgoing(*out); err != nil {
+		log.Println("Outbox:", out.ID, err)
+	}
+	status := *out
+	self.event(Event{Type: EventStatus, Outgoing: &status})
+}
+
+// Send queued messages until stopped
+func (self *Gateway) sendLoop() {
+	defer self.wg.Done()
+	for {
+		id, ctx, ok := self.outbox.pop()
+		if !ok {
+			// messages waiting on a paused outbox still expire
+			var check <-chan time.Time
+			if self.outbox.isPaused() && self.outbox.len() > 0 {
+				check = self.clock.After(ExpiryCheckInterval)
+			}
+			select {
+			case <-self.outbox.wake:
+				continue
+			case <-check:
+				self.expireQueued()
+				continue
+			case <-self.quit:
+				return
+			}
+		}
+		out, err := self.store.GetOutgoing(id)
+		if err != nil {
+			log.Println("Outbox:", id, err)
+			self.outbox.done()
+			continue
+		}
+		// cancelled while deferred or waiting to retry
+		if out.Status == Queued && self.shape(ctx, out) {
+			self.send(ctx, out)
+		}
+		self.outbox.done()
+	}
+}
+
+// Fail queued messages past their expiry
+func (self *Gateway) expireQueued() {
+	self.statusLock.Lock()
+	defer self.statusLock.Unlock()
+	now := self.clock.Now()
+	for _, id := range self.outbox.ids() {
+		out, err := self.store.GetOutgoing(id)
+		if err != nil || out.Status != Queued || out.Expires.IsZero() || now.Before(out.Expires) {
+			continue
+		}
+		// unless taken to send meanwhile
+		if self.outbox.take(id) {
+			self.expired(out)
+		}
+	}
+}
+
+// Send a message, requeueing it on failure until MaxAttempts, unless ctx is
+// cancelled
+func (self *Gateway) send(ctx context.Context, out *Outgoing) {
+	if ctx.Err() != nil {
+		self.cancelled(out)
+		return
+	}
+	if !out.Expires.IsZero() && !self.clock.Now().Before(out.Expires) {
+		self.expired(out)
+		return
+	}
+	out.Attempts++
+	self.audit(out, AuditSubmitted, nil)
+	res, err := self.modem.SendContext(ctx, gogsmmodem.OutgoingMessage{
+		ID:           out.ID,
+		Telephone:    out.Telephone,
+		Body:         out.Body,
+		Encoding:     out.Encoding,
+		Compress:     out.Compress,
+		StatusReport: self.config.DeliveryReports,
+		Expires:      out.Expires,
+	})
+	if err == nil {
+		out.Status = Sent
+		out.Reference = res.Reference
+		if self.shaper != nil {
+			self.shaper.add(out, self.clock.Now())
+		}
+		out.Sent = res.Sent
+		self.remember(out)
+		out.Error = ""
+		self.metrics.sent()
+		self.audit(out, AuditAccepted, nil)
+	} else if ctx.Err() != nil {
+		self.cancelled(out)
+		return
+	} else if err == gogsmmodem.ErrExpired {
+		self.expired(out)
+		return
+	} else {
+		log.Printf("Outbox: sending %s failed: %s", out.ID, err)
+		out.Error = err.Error()
+		self.audit(out, AuditFailed, err)
+		if out.Attempts >= self.config.MaxAttempts {
+			out.Status = Failed
+			self.metrics.failed()
+		}
+	}
+	if err := self.store.SaveOutgoing(*out); err != nil {
+		log.Println("Outbox:", out.ID, err)
+	}
+	status := *out
+	self.event(Event{Type: EventStatus, Outgoing: &status})
+	if out.Status == Queued {
+		self.requeueAfter(out.ID, self.config.RetryDelay)
+	}
+	// once saved as sent, so a report's status is not overwritten
+	if out.Status == Sent {
+		self.awaitReport(out)
+	}
+}
+
+// Queue a message again after wait, without holding up those behind it. It
+// is left queued in the store if stopped, for the next Start.
+func (self *Gateway) requeueAfter(id string, wait time.Duration) {
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		select {
+		case <-self.clock.After(wait):
+			self.outbox.push(id)
+		case <-self.quit:
+		}
+	}()
+}
@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"text/template"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Actions of a Rule
+const (
+	// Post the message to URL as an incoming Event
+	RuleForward = "forward"
+	// Queue Reply to the sender
+	RuleReply = "reply"
+	// Store and deliver the message without calling Config.Handler
+	RuleStore = "store"
+	// Discard the message
+	RuleDrop = "drop"
+)
+
+// A declarative handler for received messages, in place of Config.Handler.
+// Rules are read from JSON with LoadRules, eg:
+//
+//	[
+//	  {"Body": "(?i)^stop", "Action": "reply", "Reply": "You have been unsubscribed"},
+//	  {"Sender": "^\\+4477", "Action": "forward", "URL": "http://crm.local/sms"},
+//	  {"Port": "ttyUSB1", "Action": "store"},
+//	  {"Action": "drop"}
+//	]
+type Rule struct {
+	// Regular expressions the sender, body and the gateway's Config.Port
+	// must match, empty to match any
+	Sender string
+	Body   string
+	Port   string
+	// RuleForward etc.
+	Action string
+	// Where to forward the message
+	URL string
+	// Text of the reply, a text/template executed with the message, eg
+	// "Thanks, we got {{.Body}}"
+	Reply string
+
+	sender, body, port *regexp.Regexp
+	reply              *template.Template
+	webhook            *webhook
+}
+
+// Parse rules from JSON
+func ParseRules(b []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Read rules from a JSON file
+func LoadRules(path string) ([]Rule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(b)
+}
+
+// Compile the rule's patterns and reply, checking its action
+func (self *Rule) compile() error {
+	var err error
+	compile := func(pattern string) *regexp.Regexp {
+		if pattern == "" || err != nil {
+			return nil
+		}
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(pattern); err != nil {
+			err = fmt.Errorf("Rule pattern %q: %v", pattern, err)
+		}
+		return re
+	}
+	self.sender = compile(self.Sender)
+	self.body = compile(self.Body)
+	self.port = compile(self.Port)
+	if err != nil {
+		return err
+	}
+	switch self.Action {
+	case RuleForward:
+		if self.URL == "" {
+			return fmt.Errorf("Rule forwards without a URL")
+		}
+		self.webhook = newWebhook(self.URL)
+	case RuleReply:
+		if self.reply, err = template.New("reply").Parse(self.Reply); err != nil {
+			return fmt.Errorf("Rule reply %q: %v", self.Reply, err)
+		}
+	case RuleStore, RuleDrop:
+	default:
+		return fmt.Errorf("Unknown rule action %q", self.Action)
+	}
+	return nil
+}
+
+// Does the message received on port match the rule
+func (self *Rule) matches(msg gogsmmodem.Message, port string) bool {
+	return (self.sender == nil || self.sender.MatchString(msg.Telephone)) &&
+		(self.body == nil || self.body.MatchString(msg.Body)) &&
+		(self.port == nil || self.port.MatchString(port))
+}
+
+// The first rule matching a message, or nil
+func (self *Gateway) rule(msg gogsmmodem.Message) *Rule {
+	for i := range self.config.Rules {
+		if r := &self.config.Rules[i]; r.matches(msg, self.config.Port) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Carry out a rule's forward or reply for a message, as the handler would
+func (self *Gateway) apply(r *Rule, msg gogsmmodem.Message) error {
+	switch r.Action {
+	case RuleForward:
+		return r.webhook.post(Event{Type: EventIncoming, Incoming: &msg})
+	case RuleReply:
+		var body bytes.Buffer
+		if err := r.reply.Execute(&body, msg); err != nil {
+			return err
+		}
+		_, err := self.Enqueue(gogsmmodem.OutgoingMessage{Telephone: msg.Telephone, Body: body.String()})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limits an operator's anti-spam systems place on sending, applied by the
+// outbox so the SIM is not blocked, see Config.Shaping. Zero fields are not
+// limited.
+type Shaping struct {
+	Name string
+	// Least time between messages
+	Gap time.Duration
+	// Most messages in any 24 hours, with the same body, and to one number
+	PerDay          int
+	IdenticalPerDay int
+	RecipientPerDay int
+}
+
+// Named shaping profiles for Config.ShapingProfile, added to with
+// RegisterShaping, which is safe while gateways are created.
+var ShapingProfiles = map[string]Shaping{
+	"standard": {Name: "standard", Gap: 2 * time.Second, IdenticalPerDay: 100},
+	"cautious": {Name: "cautious", Gap: 5 * time.Second, PerDay: 1000, IdenticalPerDay: 50, RecipientPerDay: 20},
+}
+
+// Held reading or changing ShapingProfiles
+var shapingLock sync.Mutex
+
+// Add or replace a named shaping profile, eg an operator's rules
+func RegisterShaping(s Shaping) {
+	shapingLock.Lock()
+	defer shapingLock.Unlock()
+	ShapingProfiles[s.Name] = s
+}
+
+// The named shaping profile
+func lookupShaping(name string) (Shaping, bool) {
+	shapingLock.Lock()
+	defer shapingLock.Unlock()
+	s, ok := ShapingProfiles[name]
+	return s, ok
+}
+
+// A message sent, counted against the daily limits
+type shapedSend struct {
+	at        time.Time
+	telephone string
+	body      string
+}
+
+// Messages sent in the last day, owned by sendLoop
+type shaper struct {
+	Shaping
+	sent []shapedSend
+}
+
+// How long until the message may be sent, 0 if now
+func (self *shaper) wait(out *Outgoing, now time.Time) time.Duration {
+	self.expire(now)
+	var wait time.Duration
+	later := func(at time.Time) {
+		if d := at.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if n := len(self.sent); n > 0 {
+		later(self.sent[n-1].at.Add(self.Gap))
+	}
+	limit := func(max int, match func(s shapedSend) bool) {
+		if max == 0 {
+			return
+		}
+		var matched []time.Time
+		for _, s := range self.sent {
+			if match(s) {
+				matched = append(matched, s.at)
+			}
+		}
+		// until enough of the day's sends have aged out
+		if len(matched) >= max {
+			later(matched[len(matched)-max].Add(24 * time.Hour))
+		}
+	}
+	limit(self.PerDay, func(s shapedSend) bool { return true })
+	limit(self.IdenticalPerDay, func(s shapedSend) bool { return s.body == out.Body })
+	limit(self.RecipientPerDay, func(s shapedSend) bool { return s.telephone == out.Telephone })
+	return wait
+}
+
+// Count a sent message
+func (self *shaper) add(out *Outgoing, at time.Time) {
+	self.sent = append(self.sent, shapedSend{at, out.Telephone, out.Body})
+}
+
+// Forget messages sent over a day ago
+func (self *shaper) expire(now time.Time) {
+	i := 0
+	for i < len(self.sent) && now.Sub(self.sent[i].at) >= 24*time.Hour {
+		i++
+	}
+	self.sent = self.sent[i:]
+}
+
+// Count the messages sent in the last day from the store, so limits hold
+// across a restart
+func (self *shaper) restore(store Store, now time.Time) error {
+	var sent []Outgoing
+	for _, status := range []Status{Sent, Delivered} {
+		outs, err := store.ListOutgoing(status)
+		if err != nil {
+			return err
+		}
+		sent = append(sent, outs...)
+	}
+	self.sent = nil
+	for i := range sent {
+		if now.Sub(sent[i].Sent) < 24*time.Hour {
+			self.add(&sent[i], sent[i].Sent)
+		}
+	}
+	sort.Slice(self.sent, func(i, j int) bool { return self.sent[i].at.Before(self.sent[j].at) })
+	return nil
+}
+
+// The shaping configured, if any
+func newShaper(config Config) *shaper {
+	s := config.Shaping
+	if s == nil && config.ShapingProfile != "" {
+		profile, ok := lookupShaping(config.ShapingProfile)
+		if !ok {
+			log.Printf("Gateway: unknown shaping profile %q, not shaping", config.ShapingProfile)
+			return nil
+		}
+		s = &profile
+	}
+	if s == nil {
+		return nil
+	}
+	return &shaper{Shaping: *s}
+}
+
+// Hold a message until shaping allows it to be sent, reporting whether to
+// send it now. A wait within the gap is made here; a longer one defers the
+// message, requeueing it when it may be sent.
+func (self *Gateway) shape(ctx context.Context, out *Outgoing) bool {
+	if self.shaper == nil {
+		return true
+	}
+	wait := self.shaper.wait(out, self.clock.Now())
+	if wait == 0 {
+		return true
+	}
+	if wait <= self.shaper.Gap {
+		select {
+		case <-self.clock.After(wait):
+			return true
+		case <-ctx.Done():
+			self.cancelled(out)
+		case <-self.quit:
+		}
+		return false
+	}
+	self.audit(out, AuditDeferred, nil)
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		select {
+		case <-self.clock.After(wait):
+			self.outbox.push(out.ID)
+		case <-self.quit:
+		}
+	}()
+	return false
+}
@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Status of an outgoing message
+type Status string
+
+const (
+	Queued Status = "queued"
+	// Waiting for Gateway.Confirm before it is sent, see Config.Confirmation
+	Unconfirmed Status = "unconfirmed"
+	Sent        Status = "sent"
+	// Sent and reported delivered, see Config.DeliveryReports
+	Delivered Status = "delivered"
+	Failed    Status = "failed"
+	// Cancelled before it was sent, see Gateway.Cancel
+	Cancelled Status = "cancelled"
+)
+
+// An outgoing message in the outbox
+type Outgoing struct {
+	ID        string
+	Telephone string
+	Body      string
+	Encoding  gogsmmodem.Encoding
+	Compress  bool `json:",omitempty"`
+	Status    Status
+	Attempts  int
+	// Message reference from the modem once sent
+	Reference int
+	// Last failure
+	Error  string
+	Queued time.Time
+	Sent   time.Time
+	// Failed with ErrExpired if not sent by then, see
+	// gogsmmodem.OutgoingMessage.Expires
+	Expires time.Time `json:",omitempty"`
+	// When the delivery report says it was delivered
+	Delivered time.Time `json:",omitempty"`
+}
+
+var ErrNotFound = errors.New("Message not found")
+
+// Persists the outbox and received messages.
+type Store interface {
+	// Insert or update an outgoing message by ID
+	SaveOutgoing(msg Outgoing) error
+	GetOutgoing(id string) (*Outgoing, error)
+	// Outgoing messages with the status, or all if empty, oldest first
+	ListOutgoing(status Status) ([]Outgoing, error)
+	SaveIncoming(msg gogsmmodem.Message) error
+	// Keep a message held back by a filter
+	QuarantineIncoming(msg gogsmmodem.Message, reason string) error
+}
+
+// A message held back by a filter
+type Quarantined struct {
+	Message gogsmmodem.Message
+	Reason  string
+}
+
+// In-memory Store, which loses messages on restart.
+type MemoryStore struct {
+	lock        sync.Mutex
+	Outbox      map[string]Outgoing
+	Received    []gogsmmodem.Message
+	Quarantined []Quarantined
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{Outbox: map[string]Outgoing{}}
+}
+
+func (self *MemoryStore) SaveOutgoing(msg Outgoing) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.Outbox[msg.ID] = msg
+	return nil
+}
+
+func (self *MemoryStore) GetOutgoing(id string) (*Outgoing, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	msg, ok := self.Outbox[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &msg, nil
+}
+
+func (self *MemoryStore) ListOutgoing(status Status) ([]Outgoing, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret []Outgoing
+	for _, msg := range self.Outbox {
+		if status == "" || msg.Status == status {
+			ret = append(ret, msg)
+		}
+	}
+	sort.Sort(byQueued(ret))
+	return ret, nil
+}
+
+func (self *MemoryStore) SaveIncoming(msg gogsmmodem.Message) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.Received = append(self.Received, msg)
+	return nil
+}
+
+func (self *MemoryStore) QuarantineIncoming(msg gogsmmodem.Message, reason string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.Quarantined = append(self.Quarantined, Quarantined{msg, reason})
+	return nil
+}
+
+type byQueued []Outgoing
+
+func (self byQueued) Len() int           { return len(self) }
+func (self byQueued) Swap(i, j int)      { self[i], self[j] = self[j], self[i] }
+func (self byQueued) Less(i, j int) bool { return self[i].Queued.Before(self[j].Queued) }
+
+// Store in a JSON file, rewritten on every change. Suitable for the modest
+// volumes a single modem handles.
+type FileStore struct {
+	MemoryStore
+	path   string
+	saving sync.Mutex
+}
+
+// Open a FileStore, loading the file if it exists.
+func NewFileStore(path string) (*FileStore, error) {
+	self := &FileStore{MemoryStore: *NewMemoryStore(), path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return self, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &self.MemoryStore); err != nil {
+		return nil, err
+	}
+	if self.Outbox == nil {
+		self.Outbox = map[string]Outgoing{}
+	}
+	return self, nil
+}
+
+func (self *FileStore) SaveOutgoing(msg Outgoing) error {
+	self.MemoryStore.SaveOutgoing(msg)
+	return self.save()
+}
+
+func (self *FileStore) SaveIncoming(msg gogsmmodem.Message) error {
+	self.MemoryStore.SaveIncoming(msg)
+	return self.save()
+}
+
+func (self *FileStore) QuarantineIncoming(msg gogsmmodem.Message, reason string) error {
+	self.MemoryStore.QuarantineIncoming(msg, reason)
+	return self.save()
+}
+
+// Write the file atomically by renaming a temporary file over it
+func (self *FileStore) save() error {
+	self.saving.Lock()
+	defer self.saving.Unlock()
+	self.lock.Lock()
+	data, err := json.Marshal(&self.MemoryStore)
+	self.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := self.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, self.path)
+}
@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Timeout for webhook requests
+var WebhookTimeout = 10 * time.Second
+
+// Posts events as JSON to a URL.
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhook(url string) *webhook {
+	return &webhook{url, &http.Client{Timeout: WebhookTimeout}}
+}
+
+func (self *webhook) post(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := self.client.Post(self.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Post events to the webhook until stopped
+func (self *Gateway) webhookLoop() {
+	defer self.wg.Done()
+	for {
+		select {
+		case e := <-self.hooks:
+			if err := self.webhook.post(e); err != nil {
+				log.Println("Webhook:", err)
+				self.metrics.webhookFailed()
+			}
+		case <-self.quit:
+			return
+		}
+	}
+}
@@ -2,110 +2,547 @@ package gogsmmodem
 
 import (
 	"bufio"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/barnybug/gogsmmodem/pdu"
 	"github.com/tarm/serial"
 )
 
-type encodeMode uint8
+// Character encoding for text mode messages
+type Encoding uint8
 
 const (
-	GSM = encodeMode(iota)
+	GSM = Encoding(iota)
 	UCS2
+	// GSM if the message can be encoded in the GSM alphabet, otherwise UCS2.
+	// Only valid for a single message.
+	Auto
 )
 
-var EncodeMode encodeMode
+// Deprecated: the encoding modems start with if Options.Encoding is nil.
+// Use Modem.SetEncoding and Modem.Encoding.
+var EncodeMode Encoding
+
+// Deprecated: the SMSC address last read by any modem for each encoding. Use
+// Modem.SMSC.
 var SMSCGsm interface{}
 var SMSCUcs2 interface{}
 
+// Held while setting the deprecated SMSC globals
+var smscLock sync.Mutex
+
 type Modem struct {
 	OOB   chan Packet
 	Debug bool
-	port  io.ReadWriteCloser
-	rx    chan Packet
-	tx    chan string
+	// Minimum RSSI (0-31) required before sending, 0 disables the check.
+	MinRSSI int
+	// Require network registration before sending.
+	RequireRegistration bool
+	// How long to wait for coverage before failing a send with ErrNoCoverage.
+	CoverageWait time.Duration
+	// Maximum segments per message, 0 for no limit. Longer messages fail
+	// with a SegmentLimitError before anything is sent.
+	MaxSegments int
+	// How long to wait for a response to a command before failing with
+	// ErrTimeout.
+	Timeout time.Duration
+	// Cleanup of received message bodies, none by default
+	Normalize Normalization
+	// Consecutive "+CMS ERROR: 500" send failures after which the modem is
+	// soft reset and re-registered, 0 disables.
+	StormThreshold int
+	// Consecutive sends refused with BlockCodes despite good registration
+	// and signal after which SIMSuspectedBlocked is emitted, 0 disables.
+	BlockThreshold int
+	// Keep a copy of each message sent in storage as "STO SENT" (+CMGW), so
+	// the modem's history shows sent messages as a phone would.
+	KeepSent bool
+	// Dry run every Send, see OutgoingMessage.DryRun
+	DryRun bool
+	// Numbers refused by Send and when dialling
+	Numbers NumberPolicy
+	// Spending on messages sent, none tracked if nil
+	Accounting *Accounting
+	clock      Clock
+	port       io.ReadWriteCloser
+	// buffered reads from port, shared with a DataConn in data mode
+	reader *bufio.Reader
+	rx     chan tagged
+	tx     chan string
+	stats  *statsCounter
+	// messaging in text mode rather than PDU mode
+	textMode bool
+	reset    ResetMode
+	// parse responses by prefix alone
+	prefixOnly bool
+	parseMode  ParseMode
+	// closed when the port drops
+	closed chan struct{}
+	// closed by Close, stopping background loops, with the OOB channel
+	// closed under doneLock so nothing is emitted on it afterwards
+	done     chan struct{}
+	doneLock sync.RWMutex
+	// secondary ports for unsolicited results
+	urcPorts []io.ReadCloser
+	recent   *recentEvents
+	dispatch Dispatcher
+	// held for the duration of each command and its response(s)
+	sched scheduler
+	// consecutive +CMS ERROR: 500 failures, updated while held
+	storm int
+	// consecutive sends refused with BlockCodes, updated while held, and
+	// whether SIMSuspectedBlocked was emitted, guarded by stateLock
+	blocked          int
+	suspectedBlocked bool
+	// sequence number of the command awaiting a response, see
+	// Parser.Sequence
+	generation uint64
+	// owned by listen
+	parser *Parser
+	// set when responses may have lost track of commands
+	desynced int32
+	// identity and capability query results
+	caps capabilityCache
+	// message service to select, and that reported by the modem
+	smsService int
+	service    *SMSService
+	// character sets supported, nil if unknown, and the one in use
+	charsets CharacterSets
+	charset  string
+	// connection being made or in data mode
+	dataLock sync.Mutex
+	data     *DataConn
+	// copies lines for RawLines
+	raw rawTap
+	// quirks of the modem, nil if none
+	profile *Profile
+	// character set for messages, see SetEncoding, and the SMSC address read
+	// when it was set, guarded by stateLock
+	encoding Encoding
+	smsc     string
+	// +CNMI parameters, and spacing of sends, see Settings
+	cnmi     []int
+	throttle throttle
+	// reference of the last concatenated message sent
+	concatRef uint32
+	// +CNMI accepted, and +CMGL status filters rejected, see Limitations
+	cnmiSet    bool
+	unfiltered bool
+	// +CEREG rejected, see FeatureEPS, guarded by stateLock
+	epsRejected bool
+	// lock file of the port, if locked
+	lock *portLock
+	// serial device of the port, "" if not opened by name
+	device string
+	// read storage area (+CPMS), "" if unknown
+	storage string
+	// refuse mutatingCommands
+	readOnly bool
+	// 1 while a command is waiting for the prompt for its body, accessed
+	// atomically
+	prompting int32
+	// replies to USSD requests, see USSD
+	ussd chan USSDResponse
+	// held for a USSD request, or while a USSD session is active
+	ussdLock sync.Mutex
+	// the active USSD session, nil if none, guarded by stateLock
+	ussdSession *USSDSession
+	// gathered in the background, see State
+	stateLock sync.Mutex
+	state     State
+	// unsolicited packets for subscribers, see Subscribe
+	bus *EventBus
+	// closed once registration is recovered, nil while registered, see
+	// WatchRegistration
+	unregistered chan struct{}
+}
+
+// Context for health checks, which jump the queue of pending commands
+var healthCheck = WithPriority(context.Background(), PriorityHigh)
+
+var ErrNoCoverage = errors.New("No network coverage")
+var ErrTimeout = errors.New("Timeout waiting for response")
+var ErrSIMNotReady = errors.New("SIM not ready")
+var ErrPortClosed = errors.New("Port closed")
+var ErrCancelled = errors.New("Message cancelled")
+var ErrExpired = errors.New("Message expired before it was sent")
+var ErrReadOnly = errors.New("Modem is read only")
+var ErrMessageNotFound = errors.New("Message not found")
+
+// Default response timeout for commands.
+var DefaultTimeout = 60 * time.Second
+
+// How long to wait for the prompt for a message body before failing with
+// ErrTimeout
+var PromptTimeout = 10 * time.Second
+
+var ErrNoPrompt = errors.New("Modem did not prompt for the message body")
+
+// Interval between coverage checks while waiting to send.
+var CoveragePollInterval = 5 * time.Second
+
+// How long init waits for the SIM and SMS service to become ready before
+// failing with ErrSIMNotReady, and the interval between checks.
+var SIMReadyTimeout = 30 * time.Second
+var SIMPollInterval = 2 * time.Second
+
+// Delay before reopening a port that dropped during init, giving USB modems
+// time to reappear.
+var ReopenDelay = 5 * time.Second
+
+// How Open resets the modem's settings. If the port drops during the reset,
+// Open reopens it and retries with the next gentler mode.
+type ResetMode int
+
+const (
+	// ATZ, restoring the user profile
+	ResetATZ ResetMode = iota
+	// AT&F, restoring factory defaults
+	ResetFactory
+	// No reset
+	ResetNone
+)
+
+var resetCommands = map[ResetMode]string{
+	ResetATZ:     "Z",
+	ResetFactory: "&F",
 }
 
 var OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
 	return serial.OpenPort(config)
 }
 
+// Options for OpenWithOptions
+type Options struct {
+	// Log all communication with the modem
+	Debug bool
+	// Use text mode (AT+CMGF=1) for messaging instead of PDU mode, for modems
+	// with broken PDU support. Text mode is also used if the modem rejects
+	// PDU mode.
+	TextMode bool
+	// How to reset the modem, ATZ by default
+	Reset ResetMode
+	// Secondary port streaming unsolicited results, for modems exposing
+	// one, see AttachURCPort
+	URCPort *serial.Config
+	// Identify responses by prefix alone, see Parser.PrefixOnly, for ports
+	// shared with other software such as ModemManager
+	PrefixOnly bool
+	// Treatment of lines the parser cannot make sense of, see ParseStrict
+	// and ParseLenient
+	ParseMode ParseMode
+	// Character set for messages, GSM or UCS2, see Modem.SetEncoding.
+	// EncodeMode is used if nil.
+	Encoding *Encoding
+	// Wraps the modem's dispatcher, eg to route unsolicited results from
+	// several modems to one place. Responses must be passed on.
+	Dispatcher func(Dispatcher) Dispatcher
+	// Message service to select with +CSMS: 1 for phase 2+, which some
+	// modems need for status reports and +CNMA acknowledgements to work.
+	// 0 leaves the modem's default.
+	SMSService int
+	// Quirks of the modem, see Profile. ProfileFile is loaded with
+	// LoadProfile if Profile is nil, otherwise the built-in profile
+	// ProfileName is used, see Profiles.
+	Profile     *Profile
+	ProfileFile string
+	ProfileName string
+	// Lock the port with a UUCP style lock file, LCK..ttyUSB0, so other
+	// programs honouring such locks don't use it at the same time. Open
+	// fails with a PortLockedError if another process holds the lock.
+	Lock bool
+	// Directory for the lock file, DefaultLockDir if empty
+	LockDir string
+	// Refuse commands which send, write or delete messages with
+	// ErrReadOnly, for monitoring and inspecting an inbox without altering
+	// it. Reading an unread message still marks it read on most modems.
+	ReadOnly bool
+}
+
 func Open(config *serial.Config, debug bool) (*Modem, error) {
-	port, err := OpenPort(config)
+	return OpenWithOptions(config, Options{Debug: debug})
+}
+
+func OpenWithOptions(config *serial.Config, opts Options) (*Modem, error) {
+	var lock *portLock
+	if opts.Lock {
+		var err error
+		if lock, err = lockPort(opts.LockDir, config.Name); err != nil {
+			return nil, err
+		}
+	}
+	modem, err := openDial(func() (io.ReadWriteCloser, error) {
+		return OpenPort(config)
+	}, opts)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+	modem.lock = lock
+	modem.device = config.Name
+	return modem, nil
+}
+
+// Open the modem on the port from dial, redialling if the port drops during
+// init.
+func openDial(dial func() (io.ReadWriteCloser, error), opts Options) (*Modem, error) {
+	for {
+		modem, err := open(dial, opts)
+		if err != ErrPortClosed || opts.Reset >= ResetNone {
+			return modem, err
+		}
+		opts.Reset++
+		log.Println("Port dropped during init, retrying with gentler reset")
+		DefaultClock.Sleep(ReopenDelay)
+	}
+}
+
+func open(dial func() (io.ReadWriteCloser, error), opts Options) (*Modem, error) {
+	if opts.Profile == nil && opts.ProfileFile != "" {
+		profile, err := LoadProfile(opts.ProfileFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Profile = profile
+	}
+	if opts.Profile == nil && opts.ProfileName != "" {
+		profile, ok := lookupProfile(opts.ProfileName)
+		if !ok {
+			return nil, fmt.Errorf("Unknown profile %q", opts.ProfileName)
+		}
+		opts.Profile = profile
+	}
+	debug := opts.Debug
+	port, err := dial()
 	if debug {
-		port = LogReadWriteCloser{port}
+		port = NewLogReadWriteCloser(port)
 	}
 	if err != nil {
 		return nil, err
 	}
 	oob := make(chan Packet, 16)
-	rx := make(chan Packet)
+	rx := make(chan tagged, responseBuffer)
 	tx := make(chan string)
+	clock := DefaultClock
+	encoding := EncodeMode
+	if opts.Encoding != nil {
+		encoding = *opts.Encoding
+	}
 	modem := &Modem{
-		OOB:   oob,
-		Debug: debug,
-		port:  port,
-		rx:    rx,
-		tx:    tx,
+		OOB:            oob,
+		Debug:          debug,
+		Timeout:        DefaultTimeout,
+		StormThreshold: DefaultStormThreshold,
+		BlockThreshold: DefaultBlockThreshold,
+		clock:          clock,
+		port:           port,
+		reader:         bufio.NewReader(port),
+		rx:             rx,
+		tx:             tx,
+		stats:          newStatsCounter(clock),
+		textMode:       opts.TextMode,
+		reset:          opts.Reset,
+		prefixOnly:     opts.PrefixOnly,
+		parseMode:      opts.ParseMode,
+		encoding:       encoding,
+		smsService:     opts.SMSService,
+		readOnly:       opts.ReadOnly,
+		closed:         make(chan struct{}),
+		done:           make(chan struct{}),
+		recent:         newRecentEvents(clock),
+		cnmi:           DefaultCNMI,
+		ussd:           make(chan USSDResponse, 1),
+		bus:            NewEventBus(clock, EventBusReplay),
+	}
+	if err := modem.applyProfile(opts.Profile); err != nil {
+		port.Close()
+		return nil, err
+	}
+	modem.dispatch = modemDispatcher{modem}
+	if opts.Dispatcher != nil {
+		modem.dispatch = opts.Dispatcher(modem.dispatch)
 	}
 	// run send/receive goroutine
 	go modem.listen()
 
 	err = modem.init()
 	if err != nil {
+		modem.Close()
 		return nil, err
 	}
+	if opts.URCPort != nil {
+		urc, err := OpenPort(opts.URCPort)
+		if err != nil {
+			modem.Close()
+			return nil, err
+		}
+		modem.AttachURCPort(urc)
+	}
 	return modem, nil
 }
 
+// Close the modem, its port and any URC ports, stopping background loops
+// such as WatchRegistration's. Closing it again does nothing.
 func (self *Modem) Close() error {
+	self.doneLock.Lock()
+	if self.stopped() {
+		self.doneLock.Unlock()
+		return nil
+	}
+	close(self.done)
 	close(self.OOB)
-	close(self.rx)
+	self.bus.Close()
+	self.doneLock.Unlock()
+	for _, urc := range self.urcPorts {
+		urc.Close()
+	}
+	self.raw.close()
 	// close(self.tx)
-	return self.port.Close()
+	err := self.port.Close()
+	self.lock.release()
+	return err
 }
 
 // Commands
 
-// GetMessage by index n from memory.
+// GetMessage by index n from memory. The message's Index is n, for
+// DeleteMessage.
 func (self *Modem) GetMessage(n int) (*Message, error) {
-	packet, err := self.send("+CMGR", n)
-	if err != nil {
-		return nil, err
-	}
-	if msg, ok := packet.(Message); ok {
-		return &msg, nil
+	return self.GetMessageContext(context.Background(), n)
+}
+
+// GetMessageContext is GetMessage with a context for cancelling while queued
+// behind other commands. Incoming message fetches run at PriorityHigh unless
+// the context sets a priority.
+func (self *Modem) GetMessageContext(ctx context.Context, n int) (*Message, error) {
+	return self.getMessage(ctx, "", n)
+}
+
+// Stamp a message read from the modem with the host clock and normalize its
+// body
+func (self *Modem) received(msg *Message) {
+	msg.ReceivedAt = self.clock.Now()
+	if self.textMode {
+		msg.Body = self.decodeText(msg.Body)
 	}
-	return nil, errors.New("Message not found")
+	self.normalize(msg)
 }
 
-// GetMessagePDU by index n from memory in pdu format.
+// GetMessagePDU by index n from memory, read in PDU mode even if the modem is
+// in text mode, and decoded.
 func (self *Modem) GetMessagePDU(n int) (*Message, error) {
-	time.Sleep(1 * time.Second)
-	self.send("+CMGF", 0)
-	time.Sleep(1 * time.Second)
-	packet, err := self.send("+CMGR", n)
+	var packet Packet
+	err := self.hold(context.Background(), func() error {
+		return self.inPDUMode(func() error {
+			var err error
+			packet, err = self.request(self.Timeout, "+CMGR", n)
+			return err
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
-	time.Sleep(1 * time.Second)
-	self.send("+CMGF", 1)
 	if msg, ok := packet.(Message); ok {
+		if isPDUMessage(msg) {
+			decoded, err := decodePDUMessage(msg)
+			if err != nil {
+				return nil, err
+			}
+			msg = *decoded
+		}
+		msg.Index = n
+		msg.ReceivedAt = self.clock.Now()
 		return &msg, nil
 	}
-	return nil, errors.New("Message not found")
+	return nil, ErrMessageNotFound
+}
+
+// Run f in PDU mode, switching from text mode and back if necessary. The
+// caller must hold the modem.
+func (self *Modem) inPDUMode(f func() error) error {
+	return self.inMode(0, !self.textMode, f)
+}
+
+func (self *Modem) inMode(cmgf int, current bool, f func() error) error {
+	if current {
+		return f()
+	}
+	if _, err := self.request(self.Timeout, "+CMGF", cmgf); err != nil {
+		return err
+	}
+	err := f()
+	self.request(self.Timeout, "+CMGF", 1-cmgf)
+	return err
 }
 
 // ListMessages stored in memory. Filter should be "ALL", "REC UNREAD", "REC READ", etc.
 func (self *Modem) ListMessages(filter string) (*MessageList, error) {
-	packet, err := self.send("+CMGL", filter)
+	return self.ListMessagesContext(context.Background(), filter)
+}
+
+// ListMessagesContext is ListMessages with a context for cancelling while
+// queued behind other commands.
+func (self *Modem) ListMessagesContext(ctx context.Context, filter string) (*MessageList, error) {
+	var res *MessageList
+	err := self.hold(ctx, func() error {
+		var err error
+		res, err = self.listMessages(filter)
+		if res != nil {
+			for i := range *res {
+				(*res)[i].Storage = self.storage
+			}
+		}
+		return err
+	})
+	if res != nil {
+		for i := range *res {
+			self.received(&(*res)[i])
+		}
+	}
+	return res, err
+}
+
+func (self *Modem) listMessages(filter string) (*MessageList, error) {
+	if filter != "ALL" && !self.profile.lacks(FeatureListFilters) && !self.listUnfiltered() {
+		res, err := self.listMessagesBy(filter)
+		if _, ok := err.(ERROR); !ok {
+			return res, err
+		}
+		log.Printf("Listing %q rejected, filtering ALL instead: %v", filter, err)
+		self.stateLock.Lock()
+		self.unfiltered = true
+		self.stateLock.Unlock()
+	}
+	res, err := self.listMessagesBy("ALL")
+	if err != nil || filter == "ALL" {
+		return res, err
+	}
+	filtered := MessageList{}
+	for _, msg := range *res {
+		if msg.Status == filter {
+			filtered = append(filtered, msg)
+		}
+	}
+	return &filtered, nil
+}
+
+func (self *Modem) listMessagesBy(filter string) (*MessageList, error) {
+	var stat interface{} = filter
+	if !self.textMode {
+		stat = pduStat(filter)
+	}
+	packet, err := self.request(self.Timeout, "+CMGL", stat)
 	if err != nil {
 		return nil, err
 	}
@@ -115,8 +552,22 @@ func (self *Modem) ListMessages(filter string) (*MessageList, error) {
 		return &res, nil
 	}
 
+	var pduErr error
 	for {
-		if msg, ok := packet.(Message); ok {
+		if e, ok := packet.(PDULengthError); ok {
+			// read the rest of the list before failing
+			pduErr = e
+			if e.last {
+				break
+			}
+		} else if msg, ok := packet.(Message); ok {
+			if isPDUMessage(msg) {
+				decoded, err := decodePDUMessage(msg)
+				if err != nil {
+					return nil, err
+				}
+				msg = *decoded
+			}
 			res = append(res, msg)
 			if msg.Last {
 				break
@@ -125,13 +576,21 @@ func (self *Modem) ListMessages(filter string) (*MessageList, error) {
 			return nil, errors.New("Unexpected error")
 		}
 
-		packet = <-self.rx
+		packet, err = self.receive()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pduErr != nil {
+		return nil, pduErr
 	}
 	return &res, nil
 }
 
+// SupportedStorageAreas reports the message storage areas of the modem,
+// cached until it is reset.
 func (self *Modem) SupportedStorageAreas() (*StorageAreas, error) {
-	packet, err := self.send("+CPMS", "?")
+	packet, err := self.cached("+CPMS", "?")
 	if err != nil {
 		return nil, err
 	}
@@ -141,65 +600,398 @@ func (self *Modem) SupportedStorageAreas() (*StorageAreas, error) {
 	return nil, errors.New("Unexpected response type")
 }
 
+// StorageUsage reports the used and total space of the current storage areas.
+func (self *Modem) StorageUsage() (*StorageInfo, error) {
+	packet, err := self.exec(context.Background(), PriorityNormal, func() (Packet, error) {
+		packet, err := self.request(self.Timeout, "+CPMS?")
+		if info, ok := packet.(StorageInfo); ok && info.ReadStorage != "" {
+			self.storage = info.ReadStorage
+		}
+		return packet, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := packet.(StorageInfo); ok {
+		return &info, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
+
 func (self *Modem) DeleteMessage(n int) error {
 	_, err := self.send("+CMGD", n)
 	return err
 }
 
-func (self *Modem) SendMessage(telephone, body string) error {
-	var enc string
-	if EncodeMode == UCS2 {
-		enc = unicodeEncode(body)
-		telephone = unicodeEncode(telephone)
-	} else {
-		enc = body
+// Command sends an AT command not otherwise supported, eg "+CGMR" or
+// "+CNMI=?", returning its response: an UnknownPacket for responses not
+// parsed, or OK. Failures are returned as an ERROR.
+func (self *Modem) Command(cmd string, args ...interface{}) (Packet, error) {
+	return self.send(cmd, args...)
+}
+
+// SIMStatus reports whether the SIM is ready or waiting for a PIN or PUK.
+func (self *Modem) SIMStatus() (*PINStatus, error) {
+	packet, err := self.sendContext(healthCheck, PriorityHigh, "+CPIN?")
+	if err != nil {
+		return nil, err
+	}
+	if pin, ok := packet.(PINStatus); ok {
+		return &pin, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
+
+// SMSCAddress reports the configured service centre address.
+func (self *Modem) SMSCAddress() (*SMSCAddress, error) {
+	packet, err := self.send("+CSCA?")
+	if err != nil {
+		return nil, err
+	}
+	if smsc, ok := packet.(SMSCAddress); ok {
+		return &smsc, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
+
+// SignalQuality reports the received signal strength and bit error rate.
+func (self *Modem) SignalQuality() (*SignalQuality, error) {
+	return self.signalQuality(healthCheck)
+}
+
+func (self *Modem) signalQuality(ctx context.Context) (*SignalQuality, error) {
+	packet, err := self.sendContext(ctx, PriorityHigh, "+CSQ")
+	if err != nil {
+		return nil, err
+	}
+	if sq, ok := packet.(SignalQuality); ok {
+		self.stats.signal(sq)
+		return &sq, nil
+	}
+	return nil, errors.New("Unexpected response type")
+}
+
+// NetworkRegistration reports the network registration status (+CREG), or
+// the LTE registration status (+CEREG) of a modem registered on LTE alone.
+func (self *Modem) NetworkRegistration() (*NetworkRegistration, error) {
+	return self.networkRegistration(healthCheck)
+}
+
+func (self *Modem) networkRegistration(ctx context.Context) (*NetworkRegistration, error) {
+	packet, err := self.sendContext(ctx, PriorityHigh, "+CREG?")
+	if err != nil {
+		return nil, err
+	}
+	reg, ok := packet.(NetworkRegistration)
+	if !ok {
+		return nil, errors.New("Unexpected response type")
+	}
+	if !reg.Registered() && self.Supports(FeatureEPS) {
+		packet, err := self.sendContext(ctx, PriorityHigh, "+CEREG?")
+		if eps, ok := packet.(EPSRegistration); ok && err == nil && eps.Registered() {
+			reg.Status = eps.Status
+		} else if _, ok := err.(ERROR); ok {
+			self.stateLock.Lock()
+			self.epsRejected = true
+			self.stateLock.Unlock()
+		}
+	}
+	self.stats.registered(reg.Status)
+	return &reg, nil
+}
+
+// ReportRegistration enables unsolicited registration results with the
+// location (+CREG=2, and +CEREG=2 where supported), emitted on OOB as
+// NetworkRegistration and EPSRegistration when registration changes.
+func (self *Modem) ReportRegistration() error {
+	if _, err := self.send("+CREG", 2); err != nil {
+		return err
+	}
+	if !self.Supports(FeatureEPS) {
+		return nil
+	}
+	if _, err := self.send("+CEREG", 2); err != nil {
+		if _, ok := err.(ERROR); !ok {
+			return err
+		}
+		self.stateLock.Lock()
+		self.epsRejected = true
+		self.stateLock.Unlock()
+	}
+	return nil
+}
+
+func (self *Modem) hasCoverage() (bool, error) {
+	if self.MinRSSI > 0 {
+		sq, err := self.SignalQuality()
+		if err != nil {
+			return false, err
+		}
+		if !sq.Known() || sq.RSSI < self.MinRSSI {
+			return false, nil
+		}
+	}
+	if self.RequireRegistration {
+		reg, err := self.NetworkRegistration()
+		if err != nil {
+			return false, err
+		}
+		if !reg.Registered() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Wait up to CoverageWait for sufficient signal and registration, if
+// MinRSSI or RequireRegistration are set, or for WatchRegistration to recover
+// lost registration.
+func (self *Modem) checkCoverage() error {
+	if lost := self.registrationLost(); lost != nil {
+		select {
+		case <-lost:
+		case <-self.clock.After(self.CoverageWait):
+			return ErrNotRegistered
+		}
+	}
+	if self.MinRSSI == 0 && !self.RequireRegistration {
+		return nil
+	}
+	deadline := self.clock.Now().Add(self.CoverageWait)
+	for {
+		ok, err := self.hasCoverage()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if !self.clock.Now().Before(deadline) {
+			return ErrNoCoverage
+		}
+		self.clock.Sleep(CoveragePollInterval)
+	}
+}
+
+// SendMessage sends a text message. An encoding may be given to send this
+// message as GSM, UCS2 or Auto, switching the modem's character set for this
+// message only; otherwise the modem's Encoding is used.
+func (self *Modem) SendMessage(telephone, body string, encoding ...Encoding) error {
+	return self.SendMessageContext(context.Background(), telephone, body, encoding...)
+}
+
+// SendMessageContext is SendMessage with a context for cancelling while
+// queued behind other commands.
+func (self *Modem) SendMessageContext(ctx context.Context, telephone, body string, encoding ...Encoding) error {
+	msg := OutgoingMessage{Telephone: telephone, Body: body, Encoding: self.Encoding()}
+	if len(encoding) > 0 {
+		msg.Encoding = encoding[0]
 	}
-	_, err := self.sendBody("+CMGS", enc, telephone)
+	_, err := self.SendContext(ctx, msg)
 	return err
 }
 
+// Send the message in PDU or text mode, returning the message reference
+// reported by the modem, and the index of the copy kept in storage if
+// KeepSent is set, or -1. A status report is requested in PDU mode if report
+// is set. Entry of the message is aborted with ErrCancelled if ctx is
+// cancelled. The caller must hold the modem.
+func (self *Modem) sendMessage(ctx context.Context, telephone, body string, enc Encoding, report bool) (int, int, error) {
+	if !self.textMode {
+		submit := pdu.SMSSubmit{Address: telephone, StatusReport: report}
+		if enc == UCS2 || !pdu.IsGSM7(body) {
+			submit.Alphabet = pdu.AlphabetUCS2
+		}
+		if parts := pdu.Split(body, enc == UCS2); len(parts) > 1 {
+			return self.sendParts(ctx, submit, parts)
+		}
+		submit.Text = body
+		hexpdu, length, err := pdu.Encode(submit)
+		if err != nil {
+			return 0, -1, err
+		}
+		return self.sendPDU(ctx, hexpdu, length)
+	}
+	if enc == UCS2 && !self.supportsCharset("UCS2") {
+		return 0, -1, ErrCharsetUnsupported
+	}
+	current := self.Encoding()
+	if enc != current {
+		if err := self.setEncoding(enc); err != nil {
+			return 0, -1, err
+		}
+		defer func() {
+			if err := self.setEncoding(current); err != nil {
+				log.Println("Restoring encoding:", err)
+			}
+		}()
+	}
+	if err := self.checkText(body); err != nil {
+		return 0, -1, err
+	}
+	text, number := self.encodeText(body, telephone)
+	packet, err := self.requestBodyContext(ctx, "+CMGS", text, number)
+	if err != nil {
+		return 0, -1, err
+	}
+	ref, _ := packet.(MessageReference)
+	return ref.Reference, self.storeSent(ctx, func() (Packet, error) {
+		return self.requestBody("+CMGW", text, number, addressType(telephone), "STO SENT")
+	}), nil
+}
+
+// Send 8-bit data with a user data header in PDU mode
+func (self *Modem) sendData(ctx context.Context, telephone string, udh, data []byte) (int, int, error) {
+	hexpdu, length, err := pdu.EncodeSubmitData(telephone, udh, data)
+	if err != nil {
+		return 0, -1, err
+	}
+	return self.sendPDU(ctx, hexpdu, length)
+}
+
+func (self *Modem) sendPDU(ctx context.Context, hexpdu string, length int) (int, int, error) {
+	packet, err := self.requestBodyContext(ctx, "+CMGS", hexpdu, length)
+	if err != nil {
+		return 0, -1, err
+	}
+	ref, _ := packet.(MessageReference)
+	return ref.Reference, self.storeSent(ctx, func() (Packet, error) {
+		return self.requestBody("+CMGW", hexpdu, length, pduStat("STO SENT"))
+	}), nil
+}
+
+// Keep a copy of a sent message in storage with store if KeepSent is set,
+// returning its index or -1. The message has been sent, so failures are only
+// logged.
+func (self *Modem) storeSent(ctx context.Context, store func() (Packet, error)) int {
+	if !self.KeepSent || dryRunFrom(ctx) != nil {
+		return -1
+	}
+	packet, err := store()
+	if err != nil {
+		log.Println("Storing sent message:", err)
+		return -1
+	}
+	if stored, ok := packet.(StoredMessage); ok {
+		return stored.Index
+	}
+	return -1
+}
+
+// Type of address for a number, international if it starts with +
+func addressType(telephone string) int {
+	if strings.HasPrefix(telephone, "+") {
+		return 145
+	}
+	return 129
+}
+
+// Resolve Auto to the encoding needed for body
+func resolveEncoding(encoding Encoding, body string) Encoding {
+	if encoding != Auto {
+		return encoding
+	}
+	if _, ok := gsmSeptets(body); ok {
+		return GSM
+	}
+	return UCS2
+}
+
+// SendMessagePDU sends a hex PDU of a single segment, with the TPDU length for
+// AT+CMGS, see SendSubmit.
 func (self *Modem) SendMessagePDU(length int, body string) error {
-	time.Sleep(1 * time.Second)
-	self.send("+CMGF", 0)
-	time.Sleep(1 * time.Second)
-	_, err := self.sendBody("+CMGS", body, length)
-	time.Sleep(1 * time.Second)
-	self.send("+CMGF", 1)
+	if err := self.checkCoverage(); err != nil {
+		return err
+	}
+	err := self.hold(context.Background(), func() error {
+		return self.inPDUMode(func() error {
+			_, err := self.requestBody("+CMGS", body, length)
+			return err
+		})
+	})
+	self.stats.messageSent(err)
 	return err
 }
 
-func lineChannel(r io.Reader) chan string {
-	ret := make(chan string)
-	go func() {
-		buffer := bufio.NewReader(r)
-		for {
-			line, _ := buffer.ReadString(10)
-			line = strings.TrimRight(line, "\r\n")
-			if line == "" {
-				continue
-			}
-			log.Println("ret <- line")
-			ret <- line
-		}
-	}()
-	return ret
+// SendSubmit encodes and sends an SMS-SUBMIT built field by field, eg with a
+// status report or validity period.
+func (self *Modem) SendSubmit(submit pdu.SMSSubmit) error {
+	hexpdu, length, err := pdu.Encode(submit)
+	if err != nil {
+		return err
+	}
+	return self.SendMessagePDU(length, hexpdu)
 }
 
-var reQuestion = regexp.MustCompile(`AT(\+[A-Z]+)`)
+var reQuestion = regexp.MustCompile(`AT([+^][A-Z]+)`)
+
+// Maximum size of a packet's header and body read from the modem, see
+// Parser.MaxSize
+var MaxResponseSize = 64 * 1024
+
+// Final result of +CPOWD=1, the module sends nothing further
+const normalPowerDown = "NORMAL POWER DOWN"
+
+// Final result codes which end a command besides OK and the errors, by
+// command class: the extended command name, eg "+CUSD", or the letter of a
+// basic command, eg "D" for dial. Codes match a whole line, or its start
+// followed by a space as for "CONNECT 9600". They are returned as a
+// FinalResult.
+var FinalResults = map[string][]string{
+	"D": {"CONNECT", "NO CARRIER", "BUSY", "NO DIALTONE", "NO ANSWER"},
+	"A": {"CONNECT", "NO CARRIER"},
+	"O": {"CONNECT", "NO CARRIER"},
+}
+
+// The class of a command line for FinalResults
+func commandClass(line string) string {
+	if len(line) < 3 || !strings.EqualFold(line[:2], "AT") {
+		return ""
+	}
+	if m := reQuestion.FindStringSubmatch(strings.ToUpper(line)); len(m) > 0 {
+		return m[1]
+	}
+	return strings.ToUpper(line[2:3])
+}
 
 func isFinalStatus(status string) bool {
 	return status == "OK" ||
+		status == normalPowerDown ||
 		status == "ERROR" ||
 		strings.Contains(status, "+CMS ERROR") ||
 		strings.Contains(status, "+CME ERROR")
 }
 
+// Parse ERROR, +CMS ERROR: n or +CME ERROR: n
+func parseError(status string) ERROR {
+	ls := strings.SplitN(status, ":", 2)
+	if len(ls) != 2 {
+		return ERROR{}
+	}
+	code, _ := strconv.Atoi(strings.TrimSpace(ls[1]))
+	return ERROR{strings.TrimSpace(ls[0]), code}
+}
+
+// Registration from +CREG or +CEREG: n,stat[,lac,ci[,AcT]] when read, or
+// stat[,lac,ci[,AcT]] when unsolicited, without the mode, told apart by the
+// number of fields or the quoted area code following the status
+func parseRegistration(args []interface{}) NetworkRegistration {
+	quoted := false
+	if len(args) > 1 {
+		_, quoted = args[1].(string)
+	}
+	if len(args) == 1 || len(args) == 3 || quoted {
+		return NetworkRegistration{-1, intArg(args, 0)}
+	}
+	return NetworkRegistration{intArg(args, 0), intArg(args, 1)}
+}
+
 func parsePacket(status, header, body string) Packet {
 	if header == "" && isFinalStatus(status) {
-		if status == "OK" {
+		if status == "OK" || status == normalPowerDown {
 			return OK{}
 		} else {
-			return ERROR{}
+			return parseError(status)
 		}
 	}
 
@@ -219,17 +1011,85 @@ func parsePacket(status, header, body string) Packet {
 		return NetworkStatus{args[0].(string)}
 	case "+CMTI":
 		return MessageNotification{args[0].(string), args[1].(int)}
+	case "+CDSI":
+		return DeliveryReportNotification{args[0].(string), args[1].(int)}
+	case "+CDS":
+		if len(args) == 1 {
+			// PDU mode: length, with the PDU as body
+			body, err := checkPDULength(body, intArg(args, 0))
+			if err != nil {
+				return *err
+			}
+			if report := decodeDeliveryReport(body); report != nil {
+				return *report
+			}
+			break
+		}
+		// fo,mr,[ra],[tora],scts,dt,st
+		return DeliveryReport{intArg(args, 1), stringArg(args, 2), parseTime(args[4].(string)),
+			parseTime(args[5].(string)), intArg(args, 6)}
 	case "+CSCA":
-		return SMSCAddress{args}
+		return parseSMSCAddress(args)
+	case "+CPIN":
+		return PINStatus{fmt.Sprint(args[0])}
+	case "+CMGS":
+		return MessageReference{intArg(args, 0)}
+	case "+CMGW":
+		return StoredMessage{intArg(args, 0)}
+	case "+QGDCNT":
+		return DataUsage{Sent: uint64(intArg(args, 0)), Received: uint64(intArg(args, 1))}
+	case "^DSFLOWQRY":
+		return parseDSFlow(uargs)
+	case "+COPS":
+		return NetworkOperator{intArg(args, 0), stringArg(args, 2), intArg(args, 3)}
+	case "+CNUM":
+		if len(args) >= 2 {
+			return SubscriberNumber{stringArg(args, 0), fmt.Sprint(args[1]), intArg(args, 2)}
+		}
+	case "+CUSD":
+		return USSDResponse{intArg(args, 0), stringArg(args, 1), intArg(args, 2)}
+	case "+CSMS":
+		if len(args) == 3 {
+			// set response, without the service
+			return SMSService{-1, intArg(args, 0), intArg(args, 1), intArg(args, 2)}
+		}
+		return SMSService{intArg(args, 0), intArg(args, 1), intArg(args, 2), intArg(args, 3)}
+	case "+CSQ":
+		return SignalQuality{intArg(args, 0), intArg(args, 1)}
+	case "+CREG":
+		return parseRegistration(args)
+	case "+CEREG":
+		return EPSRegistration(parseRegistration(args))
 	case "+CMGR":
 		//if CMGF=0 then we just need the body in pdu format
 		if args[1] == "" {
-			return Message{Body: body}
+			// PDU mode: stat,[alpha],length
+			body, err := checkPDULength(body, intArg(args, 2))
+			if err != nil {
+				return *err
+			}
+			return Message{Status: messageStatus(args[0]), Body: body}
 		} else {
 			return Message{Status: args[0].(string), Telephone: args[1].(string),
 				Timestamp: parseTime(args[3].(string)), Body: body}
 		}
 	case "+CMGL":
+		if _, ok := args[1].(int); ok {
+			// PDU mode, with a numeric status and the PDU as body:
+			// index,stat,[alpha],length
+			body, err := checkPDULength(body, intArg(args, 3))
+			if err != nil {
+				err.Index = intArg(args, 0)
+				err.last = status != ""
+				return *err
+			}
+			return Message{
+				Index:  args[0].(int),
+				Status: messageStatus(args[1]),
+				Body:   body,
+				Last:   status != "",
+			}
+		}
 		if reflect.TypeOf(args[2]).String() == "int" {
 			return Message{
 				Index:     args[0].(int),
@@ -249,6 +1109,18 @@ func parsePacket(status, header, body string) Packet {
 			}
 		}
 
+	case "+GCAP":
+		var caps []string
+		for _, c := range strings.Split(uargs, ",") {
+			caps = append(caps, strings.TrimSpace(c))
+		}
+		return Capabilities(caps)
+	case "+CSCS":
+		if strings.HasPrefix(uargs, "(") {
+			return CharacterSets(stringsUnquotes(strings.Trim(uargs, "()")))
+		}
+	case "+CGMI", "+CGMM", "+CGMR", "+CGSN", "+CCID", "+CIMI":
+		return InfoText{ls[0], strings.Trim(uargs, "\"")}
 	case "+CPMS":
 		s := uargs
 		if strings.HasPrefix(s, "(") {
@@ -263,26 +1135,11 @@ func parsePacket(status, header, body string) Packet {
 				stringsUnquotes(areas[2]),
 			}
 		} else {
-			// set response
-			// 0,100,0,100,0,100
-			// get ints
-			var iargs []int
-			for _, arg := range args {
-				if iarg, ok := arg.(int); ok {
-					iargs = append(iargs, iarg)
-				}
-			}
-			if len(iargs) == 6 {
-				return StorageInfo{
-					iargs[0], iargs[1], iargs[2], iargs[3], iargs[4], iargs[5],
-				}
-			} else if len(iargs) == 4 {
-				return StorageInfo{
-					iargs[0], iargs[1], iargs[2], iargs[3], 0, 0,
-				}
+			// query or set response
+			// "SM",0,100,"SM",0,100,"SM",0,100 or 0,100,0,100,0,100
+			if info, ok := parseStorageInfo(args); ok {
+				return info
 			}
-			break
-
 		}
 	case "":
 		if status == "OK" {
@@ -294,66 +1151,163 @@ func parsePacket(status, header, body string) Packet {
 	return UnknownPacket{ls[0], args}
 }
 
+// Parse +CPMS storage counts for two or three areas, each optionally preceded
+// by the storage name.
+func parseStorageInfo(args []interface{}) (StorageInfo, bool) {
+	var names [3]string
+	var counts [6]int
+	area, n := 0, 0
+	for _, arg := range args {
+		if area == 3 {
+			break
+		}
+		switch v := arg.(type) {
+		case string:
+			if v != "" {
+				names[area] = v
+			}
+		case int:
+			counts[area*2+n] = v
+			n++
+			if n == 2 {
+				area++
+				n = 0
+			}
+		}
+	}
+	if area < 2 || n != 0 {
+		return StorageInfo{}, false
+	}
+	return StorageInfo{
+		ReadStorage:    names[0],
+		UsedRead:       counts[0],
+		TotalRead:      counts[1],
+		WriteStorage:   names[1],
+		UsedWrite:      counts[2],
+		TotalWrite:     counts[3],
+		ReceiveStorage: names[2],
+		UsedReceive:    counts[4],
+		TotalReceive:   counts[5],
+	}, true
+}
+
+// Parse a +CSCA response: "<sca>",<tosca>. The address may be hex encoded
+// when the character set is UCS2.
+func parseSMSCAddress(args []interface{}) SMSCAddress {
+	smsc := SMSCAddress{}
+	if len(args) > 0 {
+		smsc.Address = decodeAddress(fmt.Sprint(args[0]))
+	}
+	if len(args) > 1 {
+		if t, ok := args[1].(int); ok {
+			smsc.Type = t
+		}
+	}
+	if smsc.Type == TOAInternational && !startsWith(smsc.Address, "+") {
+		smsc.Address = "+" + smsc.Address
+	}
+	return smsc
+}
+
 func (self *Modem) listen() {
-	in := lineChannel(self.port)
-	var echo, last, header, body string
+	next := make(chan struct{})
+	in := readLines(self.reader, next, &self.prompting)
+	parser := NewParser()
+	parser.PrefixOnly = self.prefixOnly
+	parser.Patterns = self.profile.patterns()
+	parser.Mode = self.parseMode
+	self.parser = parser
 	for {
 		select {
-		case line := <-in:
-			log.Println("case line := <-in")
-			if line == echo {
-				continue // ignore echo of command
-			} else if last != "" && startsWith(line, last) {
-				if header != "" {
-					// first of multiple responses (eg CMGL)
-					packet := parsePacket("", header, body)
-					self.rx <- packet
-				}
-				header = line
-				body = ""
-			} else if isFinalStatus(line) {
-				packet := parsePacket(line, header, body)
-				self.rx <- packet
-				header = ""
-				body = ""
-			} else if header != "" {
-				// the body following a header
-				body += line
-			} else if line == "> " {
-				// raw mode for body
-			} else {
-				// OOB packet
-				log.Println("OOB packet")
-				log.Println("line", line)
-				log.Println("header", header)
-				p := parsePacket("OK", line, "")
-				if p != nil {
-					log.Println("self.OOB <- p", p)
-					// self.OOB <- p
+		case line, ok := <-in:
+			if !ok {
+				log.Println("Port closed")
+				close(self.closed)
+				return
+			}
+			self.tapRead(line)
+			parser.Line(line, self.dispatch)
+			if conn := self.dataConn(); conn != nil && startsWith(line, "CONNECT") {
+				// the DataConn has the port until data mode ends
+				<-conn.done
+				if conn.escaped {
+					parser.Command(escapeSequence)
 				}
 			}
+			next <- struct{}{}
 		case line := <-self.tx:
-			log.Println("**listen**")
-			m := reQuestion.FindStringSubmatch(line)
-			if len(m) > 0 {
-				last = m[1]
+			parser.Command(line)
+			self.tapWrite(line)
+			if _, err := self.port.Write([]byte(line)); err != nil {
+				log.Println("Port closed:", err)
+				close(self.closed)
+				return
 			}
-			echo = strings.TrimRight(line, "\r\n")
-			self.port.Write([]byte(line))
-			// //channel for timeout process
-			// c1 := make(chan string, 1)
-			// go func() {
-			// 	self.port.Write([]byte(line))
-			// 	c1 <- ""
-			// }()
-			// select {
-			// case <-c1:
-			// case <-time.After(10 * time.Second):
-			// }
 		}
 	}
 }
 
+// Has the port dropped or the modem been closed
+func (self *Modem) down() bool {
+	select {
+	case <-self.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Has Close been called
+func (self *Modem) stopped() bool {
+	select {
+	case <-self.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Subscribe to the modem's unsolicited packets, as delivered on OOB, with
+// any number of subscribers each receiving every packet of their topics.
+func (self *Modem) Subscribe(options SubscribeOptions) *Subscription {
+	return self.bus.Subscribe(options)
+}
+
+// Publish an unsolicited packet to subscribers and deliver it on the OOB
+// channel, dropping it if the channel is full so a slow reader cannot stall
+// the modem. Nothing is emitted once the modem is closed.
+func (self *Modem) emit(p Packet) {
+	self.doneLock.RLock()
+	defer self.doneLock.RUnlock()
+	if self.stopped() {
+		return
+	}
+	self.bus.Publish(p)
+	select {
+	case self.OOB <- p:
+	default:
+		log.Println("OOB channel full, dropped:", p)
+	}
+}
+
+// Commands refused in read only mode, which send, write or delete messages
+var mutatingCommands = map[string]bool{
+	"+CMGS": true,
+	"+CMGW": true,
+	"+CMGD": true,
+	"+CMSS": true,
+	"+CMGC": true,
+}
+
+// Is cmd, eg "+CMGD" or "+CMGD=1", a mutating command other than its test
+// form
+func isMutating(cmd string) bool {
+	if strings.HasSuffix(cmd, "=?") {
+		return false
+	}
+	return mutatingCommands[strings.ToUpper(strings.SplitN(cmd, "=", 2)[0])]
+}
+
 func formatCommand(cmd string, args ...interface{}) string {
 	line := "AT" + cmd
 	if len(args) > 0 {
@@ -363,124 +1317,363 @@ func formatCommand(cmd string, args ...interface{}) string {
 	return line
 }
 
+// Wait for the next response packet, up to the modem's timeout.
+func (self *Modem) receive() (Packet, error) {
+	return self.receiveTimeout(self.Timeout)
+}
+
+func (self *Modem) receiveTimeout(timeout time.Duration) (Packet, error) {
+	expired := self.clock.After(timeout)
+	for {
+		select {
+		case response := <-self.rx:
+			if response.generation != self.generation {
+				log.Printf("Discarded stale response: %#v", response.packet)
+				self.desynchronise()
+				continue
+			}
+			return response.packet, nil
+		case <-self.closed:
+			return nil, ErrPortClosed
+		case <-expired:
+			self.desynchronise()
+			return nil, ErrTimeout
+		}
+	}
+}
+
 func (self *Modem) sendBody(cmd string, body string, args ...interface{}) (Packet, error) {
-	self.tx <- formatCommand(cmd, args...)
-	time.Sleep(1 * time.Second)
-	self.tx <- body + "\x1A"
-	time.Sleep(1 * time.Second)
-	response := <-self.rx
-	if _, e := response.(ERROR); e {
-		return response, errors.New("Response was ERROR")
+	return self.sendBodyContext(context.Background(), cmd, body, args...)
+}
+
+func (self *Modem) sendBodyContext(ctx context.Context, cmd string, body string, args ...interface{}) (Packet, error) {
+	return self.exec(ctx, PriorityNormal, func() (Packet, error) {
+		return self.requestBody(cmd, body, args...)
+	})
+}
+
+// Send a command followed by a body, as for +CMGS. The caller must hold the
+// modem.
+func (self *Modem) requestBody(cmd string, body string, args ...interface{}) (Packet, error) {
+	return self.requestBodyContext(context.Background(), cmd, body, args...)
+}
+
+// requestBodyContext is requestBody, aborting entry of the body with ESC if
+// ctx is cancelled by the time the modem prompts for it.
+func (self *Modem) requestBodyContext(ctx context.Context, cmd string, body string, args ...interface{}) (Packet, error) {
+	if d := dryRunFrom(ctx); d != nil {
+		d.add(strings.TrimRight(formatCommand(cmd, args...), "\r\n"), body)
+		return MessageReference{}, nil
+	}
+	atomic.StoreInt32(&self.prompting, 1)
+	if err := self.command(cmd, args...); err != nil {
+		atomic.StoreInt32(&self.prompting, 0)
+		return nil, err
+	}
+	// wait for the prompt, or an error refusing the command
+	prompt, err := self.receiveTimeout(PromptTimeout)
+	atomic.StoreInt32(&self.prompting, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := prompt.(Prompt); !ok {
+		if e, ok := prompt.(error); ok {
+			return prompt, e
+		}
+		return nil, ErrNoPrompt
+	}
+	if ctx.Err() != nil {
+		if err := self.write("\x1B"); err != nil {
+			return nil, err
+		}
+		// the modem answers OK, sending nothing
+		self.receive()
+		return nil, ErrCancelled
+	}
+	if err := self.write(body + "\x1A"); err != nil {
+		return nil, err
+	}
+	response, err := self.receive()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := response.(error); ok {
+		return response, e
 	}
 	return response, nil
 }
 
 func (self *Modem) send(cmd string, args ...interface{}) (Packet, error) {
-	self.tx <- formatCommand(cmd, args...)
-	response := <-self.rx
-	if _, e := response.(ERROR); e {
-		return response, errors.New("Response was ERROR")
+	return self.sendTimeout(self.Timeout, cmd, args...)
+}
+
+func (self *Modem) sendTimeout(timeout time.Duration, cmd string, args ...interface{}) (Packet, error) {
+	return self.exec(context.Background(), PriorityNormal, func() (Packet, error) {
+		return self.request(timeout, cmd, args...)
+	})
+}
+
+// Send a command, queued at the priority from ctx or def if it has none.
+func (self *Modem) sendContext(ctx context.Context, def Priority, cmd string, args ...interface{}) (Packet, error) {
+	return self.exec(ctx, def, func() (Packet, error) {
+		return self.request(self.Timeout, cmd, args...)
+	})
+}
+
+// Write a command, resynchronising first if responses have lost track of
+// commands. Responses to earlier commands are discarded from then on. The
+// caller must hold the modem.
+func (self *Modem) command(cmd string, args ...interface{}) error {
+	if self.readOnly && isMutating(cmd) {
+		return ErrReadOnly
+	}
+	if n := dialledNumber(cmd); n != "" {
+		if err := self.Numbers.Check(n); err != nil {
+			return err
+		}
+	}
+	if self.desynchronised() {
+		if err := self.resync(); err != nil {
+			return err
+		}
+	}
+	self.stats.commandIssued()
+	self.generation++
+	return self.write(formatCommand(cmd, args...))
+}
+
+// Write to the port, failing if it has dropped.
+func (self *Modem) write(line string) error {
+	select {
+	case self.tx <- line:
+		return nil
+	case <-self.closed:
+		return ErrPortClosed
+	}
+}
+
+// Send a command and wait for its response. The caller must hold the modem,
+// see exec.
+func (self *Modem) request(timeout time.Duration, cmd string, args ...interface{}) (Packet, error) {
+	if err := self.command(cmd, args...); err != nil {
+		return nil, err
+	}
+	response, err := self.receiveTimeout(timeout)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := response.(error); ok {
+		return response, e
 	}
 	return response, nil
 }
 
 func (self *Modem) init() error {
 	self.send("")
-	time.Sleep(1 * time.Second)
 	// clear settings
-	self.send("Z")
-	log.Println("Reset")
-	time.Sleep(1 * time.Second)
-
-	if EncodeMode == UCS2 {
-		err := self.setSMSC(GSM)
-		if err != nil {
+	if cmd, ok := resetCommands[self.reset]; ok {
+		if _, err := self.send(cmd); err == ErrPortClosed {
 			return err
 		}
-		time.Sleep(1 * time.Second)
-		err = self.ChangeToUCS2()
-		if err != nil {
-			return err
-		}
-		time.Sleep(1 * time.Second)
-	} else {
-		self.ChangeToUCS2()
-		time.Sleep(1 * time.Second)
-		self.ChangeToGSM()
-		time.Sleep(1 * time.Second)
+		log.Println("Reset")
 	}
+	self.emit(InitProgress{InitReset, ""})
+	self.profileInit(true)
 
-	// set SMS text mode - easiest to implement. Ignore response which is
-	// often a benign error.
-	self.send("+CMGF", 1)
-	log.Println("Set SMS text mode")
-	time.Sleep(1 * time.Second)
+	// SMS configuration fails while the SIM is still initialising
+	if err := self.waitForSIM(); err != nil {
+		return err
+	}
+	self.emit(InitProgress{InitConfigure, ""})
+	if err := self.selectSMSService(); err != nil {
+		return err
+	}
+
+	if !self.profile.lacks(FeatureCharsets) {
+		self.negotiateCharsets()
+	}
+	if err := self.initEncoding(); err != nil {
+		return err
+	}
+
+	// PDU mode unless text mode is forced. Fall back to text mode if PDU mode
+	// is rejected.
+	if !self.textMode {
+		if _, err := self.send("+CMGF", 0); err == nil {
+			log.Println("Set SMS PDU mode")
+		} else {
+			log.Println("PDU mode not supported, using text mode")
+			self.textMode = true
+		}
+	}
+	if self.textMode {
+		// Ignore response which is often a benign error.
+		self.send("+CMGF", 1)
+		log.Println("Set SMS text mode")
+	}
 
 	//set delivery
-	self.send("+CNMI", 2, 2, 0, 1, 0)
-	log.Println("Set SMS delivery")
-	time.Sleep(1 * time.Second)
+	if !self.profile.lacks(FeatureCNMI) {
+		_, err := self.send("+CNMI", intArgs(self.cnmi)...)
+		self.cnmiSet = err == nil
+		log.Println("Set SMS delivery")
+	}
+	self.profileInit(false)
+	self.emit(InitProgress{InitReady, ""})
 
 	return nil
 }
 
-func (self *Modem) setSMSC(encode encodeMode) error {
-	r, err := self.send("+CSCA?")
+// Wait for the SIM to be ready and the SMS service to respond, polling until
+// SIMReadyTimeout. A SIM waiting for a PIN or PUK fails immediately.
+func (self *Modem) waitForSIM() error {
+	deadline := self.clock.Now().Add(SIMReadyTimeout)
+	for {
+		packet, err := self.send("+CPIN?")
+		if err == ErrPortClosed {
+			return err
+		}
+		if pin, ok := packet.(PINStatus); ok && err == nil {
+			if !pin.Ready() {
+				self.emit(InitProgress{InitWaitSIM, pin.Status})
+				return errors.New("SIM requires " + pin.Status)
+			}
+			var service Packet
+			if service, err = self.send("+CSMS?"); err == nil {
+				if service, ok := service.(SMSService); ok {
+					self.service = &service
+				}
+				log.Println("SIM ready")
+				self.emit(InitProgress{InitSIMReady, ""})
+				return nil
+			}
+		}
+		detail := "SMS service not ready"
+		if err != nil {
+			detail = err.Error()
+		}
+		self.emit(InitProgress{InitWaitSIM, detail})
+		if !self.clock.Now().Before(deadline) {
+			return ErrSIMNotReady
+		}
+		self.clock.Sleep(SIMPollInterval)
+	}
+}
+
+// Reset the SMSC address, encoded for the character set. The caller must hold
+// the modem.
+func (self *Modem) setSMSC(encode Encoding) error {
+	r, err := self.request(self.Timeout, "+CSCA?")
 	if err != nil {
 		return err
 	}
-	smsc := r.(SMSCAddress)
-	log.Println("Got SMSC: ", smsc.Args)
-	time.Sleep(1 * time.Second)
+	smsc, ok := r.(SMSCAddress)
+	if !ok || smsc.Address == "" {
+		return errors.New("SMSC address not found")
+	}
+	log.Println("Got SMSC: ", smsc.Address, smsc.Type)
+	self.stateLock.Lock()
+	self.smsc = smsc.Address
+	self.stateLock.Unlock()
+	smscLock.Lock()
 	if encode == UCS2 {
-		SMSCUcs2 = smsc.Args[0]
+		SMSCUcs2 = smsc.Address
 	} else {
-		SMSCGsm = smsc.Args[0]
+		SMSCGsm = smsc.Address
 	}
-	r, err = self.send("+CSCA", smsc.Args...)
+	smscLock.Unlock()
+	r, err = self.request(self.Timeout, "+CSCA", encodeSMSCAddress(smsc, encode)...)
 	if err != nil {
 		return err
 	}
-	log.Println("Set SMSC to:", smsc.Args)
+	log.Println("Set SMSC to:", smsc.Address, smsc.Type)
 	return nil
 }
 
-func (self *Modem) ChangeToUCS2() error {
-	EncodeMode = UCS2
-	if _, err := self.send("+CSCS", "UCS2"); err != nil {
-		return err
+// Arguments for setting +CSCA, with the address encoded for the character set.
+func encodeSMSCAddress(smsc SMSCAddress, encode Encoding) []interface{} {
+	address := smsc.Address
+	if encode == UCS2 {
+		address = unicodeEncode(address)
 	}
-	log.Println("Set SMS character encoding")
-	time.Sleep(1 * time.Second)
-
-	if _, err := self.send("+CSMP", 49, 167, 0, 8); err != nil {
-		return err
+	if smsc.Type == 0 {
+		return []interface{}{address}
 	}
-	log.Println("Set data coding schema")
-	time.Sleep(1 * time.Second)
-	err := self.setSMSC(UCS2)
-	if err != nil {
-		return err
+	return []interface{}{address, smsc.Type}
+}
+
+// Select the character set and SMSC for the modem's encoding
+func (self *Modem) initEncoding() error {
+	if self.negotiate(self.Encoding()) == UCS2 {
+		err := self.hold(context.Background(), func() error {
+			return self.setSMSC(GSM)
+		})
+		if err != nil {
+			return err
+		}
+		err = self.ChangeToUCS2()
+		if err != nil {
+			return err
+		}
+	} else {
+		if self.supportsCharset("UCS2") {
+			self.ChangeToUCS2()
+		}
+		self.ChangeToGSM()
 	}
 	return nil
 }
 
+// SetEncoding switches the modem's character set for messages to GSM or
+// UCS2, used by SendMessage unless it is given another.
+func (self *Modem) SetEncoding(encoding Encoding) error {
+	return self.hold(context.Background(), func() error {
+		return self.setEncoding(encoding)
+	})
+}
+
+// Encoding reports the modem's character set for messages, see SetEncoding.
+func (self *Modem) Encoding() Encoding {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	return self.encoding
+}
+
+// SMSC reports the service centre address read when the encoding was last
+// set, or "" if it has not been read.
+func (self *Modem) SMSC() string {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	return self.smsc
+}
+
+func (self *Modem) ChangeToUCS2() error {
+	return self.SetEncoding(UCS2)
+}
+
 func (self *Modem) ChangeToGSM() error {
-	EncodeMode = GSM
-	if _, err := self.send("+CSCS", "GSM"); err != nil {
+	return self.SetEncoding(GSM)
+}
+
+// Switch the character set and data coding scheme. The caller must hold the
+// modem.
+func (self *Modem) setEncoding(encoding Encoding) error {
+	charset, dcs := self.gsmCharset(), 0
+	if encoding == UCS2 {
+		charset, dcs = "UCS2", 8
+	}
+	if _, err := self.request(self.Timeout, "+CSCS", charset); err != nil {
 		return err
 	}
+	self.stateLock.Lock()
+	self.encoding = encoding
+	self.stateLock.Unlock()
+	self.charset = charset
 	log.Println("Set SMS character encoding")
-	time.Sleep(1 * time.Second)
 
-	if _, err := self.send("+CSMP", 49, 167, 0, 0); err != nil {
+	if _, err := self.request(self.Timeout, "+CSMP", 49, 167, 0, dcs); err != nil {
 		return err
 	}
 	log.Println("Set data coding schema")
-	time.Sleep(1 * time.Second)
-	err := self.setSMSC(GSM)
-	if err != nil {
-		return err
-	}
-	return nil
+	return self.setSMSC(encoding)
 }
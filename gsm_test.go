@@ -8,18 +8,40 @@ import (
 	"testing"
 	"time"
 
+	"github.com/barnybug/gogsmmodem/pdu"
 	"github.com/tarm/serial"
 )
 
-var initReplay = []string{
+var initPrefix = appendLists(resetReplay, simReadyReplay, configureReplay)
+
+var resetReplay = []string{
+	"->AT\r\n",
+	"<-\r\nOK\r\n",
 	"->ATZ\r\n",
 	"<-\r\nOK\r\n",
-	"->ATE0\r\n",
-	"<-ATE0\n",
+}
+
+var simReadyReplay = []string{
+	"->AT+CPIN?\r\n",
+	"<-\r\n+CPIN: READY\r\n\r\nOK\r\n",
+	"->AT+CSMS?\r\n",
+	"<-\r\n+CSMS: 0,1,1,1\r\n\r\nOK\r\n",
+}
+
+var configureReplay = []string{
+	"->AT+CSCS=?\r\n",
+	"<-\r\n+CSCS: (\"IRA\",\"GSM\",\"UCS2\")\r\n\r\nOK\r\n",
+	"->AT+CSCS=\"UCS2\"\r\n",
 	"<-\r\nOK\r\n",
-	"->AT+CPMS=\"SM\",\"SM\",\"SM\"\r\n",
-	"<-\r\n+CPMS: 50,50,50,50,50,50\r\nOK\n\n",
-	"->AT+CMGF=1\r\n",
+	"->AT+CSMP=49,167,0,8\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSCA?\r\n",
+	"<-\r\n+CSCA: \"002B003400340037003800300032003000390032003000330035\",145\r\nOK\r\n",
+	"->AT+CSCA=\"002b003400340037003800300032003000390032003000330035\",145\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSCS=\"GSM\"\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSMP=49,167,0,0\r\n",
 	"<-\r\nOK\r\n",
 	"->AT+CSCA?\r\n",
 	"<-\r\n+CSCA: \"+447802092035\",145\r\nOK\r\n",
@@ -27,6 +49,29 @@ var initReplay = []string{
 	"<-\r\nOK\r\n",
 }
 
+var initReplay = appendLists(initPrefix, []string{
+	"->AT+CMGF=0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=2,2,0,1,0\r\n",
+	"<-\r\nOK\r\n",
+})
+
+var textInitReplay = appendLists(initPrefix, []string{
+	"->AT+CMGF=1\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=2,2,0,1,0\r\n",
+	"<-\r\nOK\r\n",
+})
+
+// Open a modem in text mode
+func openText() (*Modem, error) {
+	return OpenWithOptions(&serial.Config{}, Options{Debug: true, TextMode: true})
+}
+
+func init() {
+	DefaultClock = NewMockClock(time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC))
+}
+
 func appendLists(ls ...[]string) []string {
 	size := 0
 	for _, l := range ls {
@@ -54,6 +99,9 @@ func TestInit(t *testing.T) {
 
 func assertOOBCommands(t *testing.T, modem *Modem, commands []Packet) {
 	for i := range modem.OOB {
+		if _, ok := i.(InitProgress); ok {
+			continue
+		}
 		if len(commands) == 0 {
 			t.Errorf("Unexpected extra command: %#v", i)
 			break
@@ -129,16 +177,17 @@ var messageReplay = []string{
 
 func TestGetMessage(t *testing.T) {
 	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
-		replay := appendLists(initReplay, messageReplay)
+		replay := appendLists(textInitReplay, messageReplay)
 		return NewMockSerialPort(replay), nil
 	}
-	modem, err := Open(&serial.Config{}, true)
+	modem, err := openText()
 	if err != nil {
 		t.Error("Expected: no error, got:", err)
 	}
 
 	msg, _ := modem.GetMessage(1)
-	expected := Message{0, "REC UNREAD", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Hi", false}
+	now := DefaultClock.Now()
+	expected := Message{1, "REC UNREAD", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Hi", false, now, "", false, nil, nil}
 	if *msg != expected {
 		t.Errorf("Expected: %#v, got %#v", expected, msg)
 	}
@@ -176,10 +225,10 @@ var sendMessageReplay = []string{
 
 func TestSendMessage(t *testing.T) {
 	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
-		replay := appendLists(initReplay, sendMessageReplay)
+		replay := appendLists(textInitReplay, sendMessageReplay)
 		return NewMockSerialPort(replay), nil
 	}
-	modem, err := Open(&serial.Config{}, true)
+	modem, err := openText()
 	if err != nil {
 		t.Error("Expected: no error, got:", err)
 	}
@@ -199,19 +248,20 @@ var listMessagesReplay = []string{
 
 func TestListMessages(t *testing.T) {
 	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
-		replay := appendLists(initReplay, listMessagesReplay)
+		replay := appendLists(textInitReplay, listMessagesReplay)
 		return NewMockSerialPort(replay), nil
 	}
-	modem, err := Open(&serial.Config{}, true)
+	modem, err := openText()
 	if err != nil {
 		t.Error("Expected: no error, got:", err)
 	}
 
 	msg, _ := modem.ListMessages("ALL")
+	now := DefaultClock.Now()
 	expected := MessageList{
-		Message{0, "REC UNREAD", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Hi", false},
-		Message{1, "REC READ", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Ola", false},
-		Message{2, "REC UNREAD", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Ja", true},
+		Message{0, "REC UNREAD", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Hi", false, now, "", false, nil, nil},
+		Message{1, "REC READ", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Ola", false, now, "", false, nil, nil},
+		Message{2, "REC UNREAD", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Ja", true, now, "", false, nil, nil},
 	}
 	if len(*msg) != len(expected) {
 		t.Errorf("Expected: %#v, got %#v", expected, msg)
@@ -231,10 +281,10 @@ var listMessagesEmptyReplay = []string{
 
 func TestListMessagesEmpty(t *testing.T) {
 	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
-		replay := appendLists(initReplay, listMessagesEmptyReplay)
+		replay := appendLists(textInitReplay, listMessagesEmptyReplay)
 		return NewMockSerialPort(replay), nil
 	}
-	modem, err := Open(&serial.Config{}, true)
+	modem, err := openText()
 	if err != nil {
 		t.Error("Expected: no error, got:", err)
 	}
@@ -274,3 +324,524 @@ func TestSupportedStorageAreas(t *testing.T) {
 	}
 	modem.Close()
 }
+
+func TestParseSMSCAddress(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected SMSCAddress
+	}{
+		{`+CSCA: "+447802092035",145`, SMSCAddress{"+447802092035", 145}},
+		{`+CSCA: "002B003400340037003800300032003000390032003000330035",145`, SMSCAddress{"+447802092035", 145}},
+		{`+CSCA: "447802092035",145`, SMSCAddress{"+447802092035", 145}},
+		{`+CSCA: "07802092035",129`, SMSCAddress{"07802092035", 129}},
+	}
+	for _, test := range tests {
+		packet := parsePacket("OK", test.header, "")
+		if packet != test.expected {
+			t.Errorf("Expected: %#v, got %#v", test.expected, packet)
+		}
+	}
+}
+
+func TestParseStorageInfo(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected StorageInfo
+	}{
+		{`+CPMS: 5,50,5,50,5,50`, StorageInfo{"", 5, 50, "", 5, 50, "", 5, 50}},
+		{`+CPMS: 5,50,0,20`, StorageInfo{"", 5, 50, "", 0, 20, "", 0, 0}},
+		{`+CPMS: "SM",5,50,"ME",0,20,"SM",5,50`, StorageInfo{"SM", 5, 50, "ME", 0, 20, "SM", 5, 50}},
+		{`+CPMS: "SM",5,50,"SM",5,50`, StorageInfo{"SM", 5, 50, "SM", 5, 50, "", 0, 0}},
+	}
+	for _, test := range tests {
+		packet := parsePacket("OK", test.header, "")
+		if packet != test.expected {
+			t.Errorf("Expected: %#v, got %#v", test.expected, packet)
+		}
+	}
+	info := StorageInfo{UsedRead: 5, TotalRead: 50}
+	if info.ReadPercent() != 10 || info.ReceivePercent() != 0 {
+		t.Errorf("Unexpected percentages: %v %v", info.ReadPercent(), info.ReceivePercent())
+	}
+}
+
+func TestParseSignalAndRegistration(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected Packet
+	}{
+		{`+CSQ: 17,99`, SignalQuality{17, 99}},
+		{`+CSQ: 99,99`, SignalQuality{99, 99}},
+		{`+CREG: 0,1`, NetworkRegistration{0, RegHome}},
+		{`+CREG: 0,2`, NetworkRegistration{0, RegSearching}},
+		{`+CREG: 3`, NetworkRegistration{-1, RegDenied}},
+		{`+CREG: 1,"00C3","0010"`, NetworkRegistration{-1, RegHome}},
+		{`+CREG: 5,"00C3","0010",7`, NetworkRegistration{-1, RegRoaming}},
+		{`+CREG: 2,1,"00C3","0010",7`, NetworkRegistration{2, RegHome}},
+		{`+CEREG: 0,1`, EPSRegistration{0, RegHome}},
+		{`+CEREG: 1,"1A2B","01A2B3C4",7`, EPSRegistration{-1, RegHome}},
+	}
+	for _, test := range tests {
+		packet := parsePacket("OK", test.header, "")
+		if packet != test.expected {
+			t.Errorf("Expected: %#v, got %#v", test.expected, packet)
+		}
+	}
+	if (SignalQuality{17, 99}).DBm() != -79 || (SignalQuality{99, 99}).Known() {
+		t.Error("Unexpected signal quality conversion")
+	}
+}
+
+func TestURCDuringCommand(t *testing.T) {
+	port := NewMockSerialPort(appendLists(textInitReplay, messageReplay))
+	port.InjectAfter("AT+CMGR=1\r\n", "\r\n+CMTI: \"SM\",6\r\n")
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return port, nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	msg, err := modem.GetMessage(1)
+	if err != nil || msg.Body != "Hi" {
+		t.Errorf("Expected message, got %#v %v", msg, err)
+	}
+	modem.Close()
+	assertOOBCommands(t, modem, []Packet{MessageNotification{"SM", 6}})
+}
+
+var powerDownReplay = []string{
+	"->AT+CPOWD=1\r\n",
+	"<-\r\nNORMAL POWER DOWN\r\n",
+}
+
+func TestPowerDown(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, powerDownReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	err = modem.PowerDown()
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	modem.Close()
+}
+
+// Port recording the levels its DTR line is set to
+type dtrPort struct {
+	*MockSerialPort
+	levels []bool
+}
+
+func (self *dtrPort) SetDTR(on bool) error {
+	self.levels = append(self.levels, on)
+	return nil
+}
+
+func TestWakeUpDTR(t *testing.T) {
+	port := &dtrPort{MockSerialPort: NewMockSerialPort(appendLists(initReplay, []string{
+		"->AT\r\n",
+		"<-\r\nOK\r\n",
+	}))}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return port, nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer modem.Close()
+	if err := modem.WakeUp(); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if err := modem.AllowSleep(); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	// toggled to wake, then released
+	if expected := []bool{false, true, false}; !reflect.DeepEqual(port.levels, expected) {
+		t.Errorf("Expected: DTR %v, got %v", expected, port.levels)
+	}
+}
+
+var sendUCS2MessageReplay = []string{
+	"->AT+CSCS=\"UCS2\"\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSMP=49,167,0,8\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSCA?\r\n",
+	"<-\r\n+CSCA: \"002B003400340037003800300032003000390032003000330035\",145\r\nOK\r\n",
+	"->AT+CSCA=\"002b003400340037003800300032003000390032003000330035\",145\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CMGS=\"0034003400310032\"\r\n",
+	"<-> \r\n",
+	"->04220435043a0441044200200021\x1a",
+	"<-\r\n+CMGS: 12\r\n\r\nOK\r\n",
+	"->AT+CSCS=\"GSM\"\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSMP=49,167,0,0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CSCA?\r\n",
+	"<-\r\n+CSCA: \"+447802092035\",145\r\nOK\r\n",
+	"->AT+CSCA=\"+447802092035\",145\r\n",
+	"<-\r\nOK\r\n",
+}
+
+func TestOptionsEncoding(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(textInitReplay), nil
+	}
+	// an explicit GSM is not overridden by the deprecated global
+	EncodeMode = UCS2
+	defer func() { EncodeMode = GSM }()
+	gsm := GSM
+	modem, err := OpenWithOptions(&serial.Config{}, Options{Debug: true, TextMode: true, Encoding: &gsm})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if modem.Encoding() != GSM {
+		t.Error("Expected: GSM, got:", modem.Encoding())
+	}
+	modem.Close()
+}
+
+func TestSetEncodingRejected(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, []string{
+			"->AT+CSCS=\"UCS2\"\r\n",
+			"<-\r\nERROR\r\n",
+		})), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	charset := modem.charset
+	if err := modem.SetEncoding(UCS2); err == nil {
+		t.Error("Expected: error")
+	}
+	if modem.Encoding() != GSM || modem.charset != charset {
+		t.Errorf("Expected: %s unchanged, got: %v %s", charset, modem.Encoding(), modem.charset)
+	}
+	modem.Close()
+}
+
+func TestSendMessageAutoEncoding(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, sendUCS2MessageReplay)), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	modem.Numbers.AllowShortCodes = true
+	err = modem.SendMessage("4412", "Текст !", Auto)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if modem.Encoding() != GSM || EncodeMode != GSM {
+		t.Error("Expected: encoding to be restored")
+	}
+	if smsc := modem.SMSC(); smsc != "+447802092035" {
+		t.Error("Expected: SMSC read, got:", smsc)
+	}
+	modem.Close()
+}
+
+var pduInitFallbackReplay = appendLists(initPrefix, []string{
+	"->AT+CMGF=0\r\n",
+	"<-\r\nERROR\r\n",
+	"->AT+CMGF=1\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=2,2,0,1,0\r\n",
+	"<-\r\nOK\r\n",
+})
+
+func TestInitTextModeFallback(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(pduInitFallbackReplay), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if !modem.textMode {
+		t.Error("Expected: fallback to text mode")
+	}
+	modem.Close()
+}
+
+var pduMessageReplay = []string{
+	"->AT+CMGR=1\r\n",
+	"<-\r\n+CMGR: 0,,21\r\n00040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+}
+
+func TestGetMessagePDUMode(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, pduMessageReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	msg, err := modem.GetMessage(1)
+	expected := Message{1, "REC UNREAD", "+441234567890", time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), "Hi", false, DefaultClock.Now(), "", false, nil, nil}
+	if err != nil || msg.Status != expected.Status || msg.Telephone != expected.Telephone ||
+		!msg.Timestamp.Equal(expected.Timestamp) || msg.Body != expected.Body ||
+		!msg.ReceivedAt.Equal(expected.ReceivedAt) {
+		t.Errorf("Expected: %#v, got %#v %v", expected, msg, err)
+	}
+	modem.Close()
+}
+
+func TestGetMessagePDUFromTextMode(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, []string{
+			"->AT+CMGF=0\r\n",
+			"<-\r\nOK\r\n",
+		}, pduMessageReplay, []string{
+			"->AT+CMGF=1\r\n",
+			"<-\r\nOK\r\n",
+		})), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+
+	msg, err := modem.GetMessagePDU(1)
+	if err != nil || msg.Index != 1 || msg.Telephone != "+441234567890" || msg.Body != "Hi" {
+		t.Errorf("Expected: decoded message, got %#v %v", msg, err)
+	}
+	modem.Close()
+}
+
+var sendPDUMessageReplay = []string{
+	"->AT+CMGS=19\r\n",
+	"<-> \r\n",
+	"->0011000C814421436587090000AA05C237390F00\x1a",
+	"<-\r\n+CMGS: 12\r\n\r\nOK\r\n",
+}
+
+func TestSendMessagePDUMode(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, sendPDUMessageReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	err = modem.SendMessage("441234567890", "Body@")
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	modem.Close()
+}
+
+func TestSendSubmit(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, sendPDUMessageReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	err = modem.SendSubmit(pdu.SMSSubmit{Address: "441234567890", Text: "Body@"})
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	modem.Close()
+}
+
+var listMessagesPDUReplay = []string{
+	"->AT+CMGL=4\r\n",
+	"<-\r\n+CMGL: 1,0,,21\r\n00040C9144214365870900004120105170340002C834\r\n+CMGL: 3,1,,21\r\n00040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+}
+
+func TestListMessagesPDUMode(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, listMessagesPDUReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	msgs, err := modem.ListMessages("ALL")
+	if err != nil || len(*msgs) != 2 {
+		t.Fatalf("Expected: 2 messages, got %#v %v", msgs, err)
+	}
+	first, second := (*msgs)[0], (*msgs)[1]
+	if first.Index != 1 || first.Status != "REC UNREAD" || first.Telephone != "+441234567890" || first.Body != "Hi" || first.Last {
+		t.Errorf("Unexpected first message: %#v", first)
+	}
+	if second.Index != 3 || second.Status != "REC READ" || !second.Last {
+		t.Errorf("Unexpected second message: %#v", second)
+	}
+	modem.Close()
+}
+
+var listMessagesPDULengthReplay = []string{
+	"->AT+CMGL=4\r\n",
+	"<-\r\n+CMGL: 1,0,,21\r\n040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+	"->AT+CMGL=4\r\n",
+	"<-\r\n+CMGL: 1,0,,21\r\n00040C914421436587\r\n+CMGL: 3,1,,21\r\n040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+	"->AT+CSQ\r\n",
+	"<-\r\n+CSQ: 17,99\r\n\r\nOK\r\n",
+}
+
+func TestListMessagesPDULength(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, listMessagesPDULengthReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	// PDU without an SMSC prefix
+	msgs, err := modem.ListMessages("ALL")
+	if err != nil || len(*msgs) != 1 || (*msgs)[0].Body != "Hi" {
+		t.Fatalf("Expected: 1 message, got %#v %v", msgs, err)
+	}
+	// truncated PDU
+	_, err = modem.ListMessages("ALL")
+	if e, ok := err.(PDULengthError); !ok || e.Index != 1 || e.Length != 21 || e.Octets != 8 {
+		t.Errorf("Expected: PDU length error, got %#v", err)
+	}
+	if sq, err := modem.SignalQuality(); err != nil || sq.RSSI != 17 {
+		t.Errorf("Expected: signal quality, got %v %v", sq, err)
+	}
+	modem.Close()
+}
+
+var readOnlyReplay = []string{
+	"->AT+CMGD=?\r\n",
+	"<-\r\n+CMGD: (1-20),(0-4)\r\n\r\nOK\r\n",
+}
+
+func TestReadOnly(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, readOnlyReplay)), nil
+	}
+	modem, err := OpenWithOptions(&serial.Config{}, Options{Debug: true, ReadOnly: true})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if err := modem.DeleteMessage(1); err != ErrReadOnly {
+		t.Error("Expected: read only, got:", err)
+	}
+	if err := modem.SendMessage("441234567890", "Hi"); err != ErrReadOnly {
+		t.Error("Expected: read only, got:", err)
+	}
+	if _, err := modem.Command("+CMGD=1"); err != ErrReadOnly {
+		t.Error("Expected: read only, got:", err)
+	}
+	if _, err := modem.Command("+CMGD=?"); err != nil {
+		t.Error("Expected: test form allowed, got:", err)
+	}
+	modem.Close()
+}
+
+var simBusyReplay = appendLists(resetReplay, []string{
+	"->AT+CPIN?\r\n",
+	"<-\r\n+CME ERROR: 14\r\n",
+}, simReadyReplay, configureReplay, []string{
+	"->AT+CMGF=0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=2,2,0,1,0\r\n",
+	"<-\r\nOK\r\n",
+})
+
+func TestInitWaitsForSIM(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(simBusyReplay), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.Close()
+
+	var stages []string
+	for p := range modem.OOB {
+		if progress, ok := p.(InitProgress); ok {
+			stages = append(stages, progress.Stage)
+		}
+	}
+	expected := []string{InitReset, InitWaitSIM, InitSIMReady, InitConfigure, InitReady}
+	if !reflect.DeepEqual(stages, expected) {
+		t.Errorf("Expected: %v, got %v", expected, stages)
+	}
+}
+
+var simPINReplay = appendLists(resetReplay, []string{
+	"->AT+CPIN?\r\n",
+	"<-\r\n+CPIN: SIM PIN\r\n\r\nOK\r\n",
+})
+
+// Port recording whether it was closed
+type closeRecordingPort struct {
+	io.ReadWriteCloser
+	closed bool
+}
+
+func (self *closeRecordingPort) Close() error {
+	self.closed = true
+	return self.ReadWriteCloser.Close()
+}
+
+func TestInitSIMPINRequired(t *testing.T) {
+	port := &closeRecordingPort{ReadWriteCloser: NewMockSerialPort(simPINReplay)}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return port, nil
+	}
+	_, err := Open(&serial.Config{}, true)
+	if fmt.Sprint(err) != "SIM requires SIM PIN" {
+		t.Error("Expected: SIM PIN error, got:", err)
+	}
+	if !port.closed {
+		t.Error("Expected: port closed when init fails")
+	}
+}
+
+func TestInitResetPortDrop(t *testing.T) {
+	dropping := NewMockSerialPort(appendLists(initReplay))
+	dropping.DisconnectAfter("ATZ\r\n")
+	gentle := appendLists(initReplay)
+	gentle[2] = "->AT&F\r\n"
+	ports := []io.ReadWriteCloser{dropping, NewMockSerialPort(gentle)}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		port := ports[0]
+		ports = ports[1:]
+		return port, nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if modem.reset != ResetFactory {
+		t.Error("Expected: factory reset, got:", modem.reset)
+	}
+	modem.Close()
+}
+
+func TestInitNoReset(t *testing.T) {
+	replay := appendLists(initReplay[:2], initReplay[4:])
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(replay), nil
+	}
+	modem, err := OpenWithOptions(&serial.Config{}, Options{Debug: true, Reset: ResetNone})
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	modem.Close()
+}
@@ -0,0 +1,126 @@
+package gogsmmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Default body of a heartbeat message
+const DefaultHeartbeatBody = `Heartbeat {{.Time.Format "2006-01-02 15:04"}} up {{.Stats.Uptime}} signal {{.Stats.Signal.RSSI}}`
+
+// How long a heartbeat call rings before hanging up
+var HeartbeatRingTime = 10 * time.Second
+
+// Reports to a monitoring number that the device is alive, see Heartbeat.
+type Heartbeat struct {
+	Telephone string
+	// text/template for the message, executed with HeartbeatData,
+	// DefaultHeartbeatBody if empty
+	Body string
+	// Ring the number briefly and hang up instead of sending a message
+	Call bool
+	// Interval between heartbeats
+	Interval time.Duration
+	// Random delay of up to this added to each interval, so a fleet does
+	// not report all at once
+	Jitter time.Duration
+	// HeartbeatFailed is emitted after this many consecutive failures,
+	// default 3
+	FailureThreshold int
+}
+
+// The data a heartbeat message is executed with
+type HeartbeatData struct {
+	Time  time.Time
+	Stats Stats
+	State State
+}
+
+var ErrHeartbeatInterval = errors.New("Heartbeat interval must be positive")
+
+// Context for heartbeats, which give way to all other commands
+var heartbeatContext = WithPriority(context.Background(), PriorityLow)
+
+// Heartbeat sends h every h.Interval, plus jitter, until stop is called or
+// the port drops. It fails if h.Interval is not positive or h.Body is not a
+// valid template. stop may be called more than once.
+func (self *Modem) Heartbeat(h Heartbeat) (stop func(), err error) {
+	if h.Interval <= 0 {
+		return nil, ErrHeartbeatInterval
+	}
+	if h.Body == "" {
+		h.Body = DefaultHeartbeatBody
+	}
+	if h.FailureThreshold == 0 {
+		h.FailureThreshold = 3
+	}
+	body, err := template.New("heartbeat").Parse(h.Body)
+	if err != nil {
+		return nil, err
+	}
+	quit := make(chan struct{})
+	go func() {
+		failures := 0
+		for {
+			wait := h.Interval
+			if h.Jitter > 0 {
+				wait += time.Duration(rand.Int63n(int64(h.Jitter)))
+			}
+			select {
+			case <-self.clock.After(wait):
+				failures = self.heartbeat(h, body, failures)
+			case <-self.closed:
+				return
+			case <-self.done:
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(quit) }) }, nil
+}
+
+// Send one heartbeat, returning the number of consecutive failures and
+// emitting HeartbeatFailed when it reaches the threshold
+func (self *Modem) heartbeat(h Heartbeat, body *template.Template, failures int) int {
+	var err error
+	if h.Call {
+		err = self.heartbeatCall(h.Telephone)
+	} else {
+		var text bytes.Buffer
+		data := HeartbeatData{self.clock.Now(), self.Stats(), self.State()}
+		if err = body.Execute(&text, data); err == nil {
+			_, err = self.SendContext(heartbeatContext, OutgoingMessage{Telephone: h.Telephone, Body: text.String(), Encoding: Auto})
+		}
+	}
+	if err == nil {
+		return 0
+	}
+	failures++
+	log.Printf("Heartbeat failed %d times: %s", failures, err)
+	if failures == h.FailureThreshold {
+		self.emit(HeartbeatFailed{failures, err})
+	}
+	return failures
+}
+
+// Ring the number and hang up
+func (self *Modem) heartbeatCall(telephone string) error {
+	if err := self.Numbers.Check(telephone); err != nil {
+		return err
+	}
+	if _, err := self.sendContext(heartbeatContext, PriorityLow, "D"+telephone+";"); err != nil {
+		return err
+	}
+	self.clock.Sleep(HeartbeatRingTime)
+	_, err := self.sendContext(heartbeatContext, PriorityLow, "H")
+	return err
+}
@@ -0,0 +1,58 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestHeartbeat(t *testing.T) {
+	sent := replyReplay("alive")
+	failed := append(append([]string{}, sent[:3]...), "<-\r\n+CMS ERROR: 500\r\n")
+	call := []string{"->ATD+441234567890;\r\n", "<-\r\nOK\r\n", "->ATH\r\n", "<-\r\nOK\r\n"}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, sent, failed, failed, call)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	h := Heartbeat{Telephone: "+441234567890", FailureThreshold: 2}
+	body := template.Must(template.New("").Parse("alive"))
+	failures := 0
+	for i, expected := range []int{0, 1, 2} {
+		if failures = modem.heartbeat(h, body, failures); failures != expected {
+			t.Errorf("Expected: %d failures after heartbeat %d, got %d", expected, i, failures)
+		}
+	}
+	h.Call = true
+	if failures = modem.heartbeat(h, body, failures); failures != 0 {
+		t.Errorf("Expected: call to succeed, got %d failures", failures)
+	}
+	modem.Close()
+
+	var events []HeartbeatFailed
+	for p := range modem.OOB {
+		if f, ok := p.(HeartbeatFailed); ok {
+			events = append(events, f)
+		}
+	}
+	if len(events) != 1 || events[0] != (HeartbeatFailed{2, ERROR{"+CMS ERROR", 500}}) {
+		t.Errorf("Expected: one HeartbeatFailed, got %#v", events)
+	}
+	if _, err := modem.Heartbeat(Heartbeat{Body: "{{", Interval: time.Hour}); err == nil || err == ErrHeartbeatInterval {
+		t.Error("Expected: template error, got:", err)
+	}
+	if _, err := modem.Heartbeat(Heartbeat{}); err != ErrHeartbeatInterval {
+		t.Error("Expected: ErrHeartbeatInterval, got:", err)
+	}
+	stop, err := modem.Heartbeat(Heartbeat{Interval: time.Hour})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	stop()
+	stop()
+}
@@ -0,0 +1,55 @@
+package gogsmmodem
+
+// Features reported by Limitations
+var features = []string{FeaturePDU, FeatureCharsets, FeatureCNMI, FeatureUCS2, FeatureDeliveryReports, FeatureListFilters, FeatureEPS}
+
+// Limitations reports the features, see FeaturePDU etc., the modem lacks as
+// found by init, marked by its Profile, or learnt in use, so applications can
+// adapt rather than meet errors. Capabilities is the modem's own +GCAP list.
+func (self *Modem) Limitations() []string {
+	var ret []string
+	for _, f := range features {
+		if !self.Supports(f) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// Supports reports whether the modem has a feature, see Limitations.
+func (self *Modem) Supports(feature string) bool {
+	if self.profile.lacks(feature) {
+		return false
+	}
+	switch feature {
+	case FeaturePDU:
+		return !self.textMode
+	case FeatureCharsets:
+		return self.charsets != nil
+	case FeatureCNMI:
+		return self.cnmiSet
+	case FeatureUCS2:
+		return !self.textMode || self.supportsCharset("UCS2")
+	case FeatureDeliveryReports:
+		return self.cnmiSet && len(self.cnmi) > 3 && self.cnmi[3] != 0
+	case FeatureListFilters:
+		return !self.listUnfiltered()
+	case FeatureEPS:
+		return !self.noEPS()
+	}
+	return true
+}
+
+// Has +CEREG been rejected
+func (self *Modem) noEPS() bool {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	return self.epsRejected
+}
+
+// Have +CMGL status filters been rejected
+func (self *Modem) listUnfiltered() bool {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	return self.unfiltered
+}
@@ -0,0 +1,46 @@
+package gogsmmodem
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var listRejectedReplay = []string{
+	"->AT+CMGL=0\r\n",
+	"<-\r\nERROR\r\n",
+	"->AT+CMGL=4\r\n",
+	"<-\r\n+CMGL: 1,0,,21\r\n00040C9144214365870900004120105170340002C834\r\n+CMGL: 3,1,,21\r\n00040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+	"->AT+CMGL=4\r\n",
+	"<-\r\n+CMGL: 1,0,,21\r\n00040C9144214365870900004120105170340002C834\r\n+CMGL: 3,1,,21\r\n00040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+}
+
+func TestLimitations(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, listRejectedReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if l := modem.Limitations(); l != nil {
+		t.Errorf("Expected: no limitations, got %v", l)
+	}
+	for i := 0; i < 2; i++ {
+		msgs, err := modem.ListMessages("REC UNREAD")
+		if err != nil || len(*msgs) != 1 || (*msgs)[0].Index != 1 {
+			t.Errorf("Expected: unread message 1, got %#v %v", msgs, err)
+		}
+	}
+	if l := modem.Limitations(); !reflect.DeepEqual(l, []string{FeatureListFilters}) {
+		t.Errorf("Expected: list filters unsupported, got %v", l)
+	}
+	modem.Close()
+
+	modem = &Modem{textMode: true, charsets: CharacterSets{"GSM"}, profile: &Profile{Unsupported: []string{FeatureCNMI}}}
+	if l := modem.Limitations(); !reflect.DeepEqual(l, []string{FeaturePDU, FeatureCNMI, FeatureUCS2, FeatureDeliveryReports}) {
+		t.Errorf("Unexpected limitations: %v", l)
+	}
+}
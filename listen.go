@@ -0,0 +1,342 @@
+package gogsmmodem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// ReadLines reads lines from the modem, without line endings and skipping
+// blank lines. The channel is closed if the port fails.
+func ReadLines(r io.Reader) <-chan string {
+	return readLines(bufio.NewReader(r), nil, nil)
+}
+
+// As ReadLines, but if next is set waiting for a value on it after each line
+// before reading any further, so the reader can be handed over for data mode.
+// While prompting is set to 1, a "> " prompt is read as a line and prompting
+// cleared.
+func readLines(buffer *bufio.Reader, next <-chan struct{}, prompting *int32) <-chan string {
+	ret := make(chan string)
+	go func() {
+		for {
+			line, err := readLine(buffer, prompting)
+			line = strings.TrimRight(line, "\r\n")
+			if err != nil && err != io.EOF {
+				// the port has gone, eg a USB modem unplugged or reset. EOF is
+				// a read timeout.
+				if line != "" {
+					ret <- line
+				}
+				close(ret)
+				return
+			}
+			if line == "" {
+				continue
+			}
+			ret <- line
+			if next != nil {
+				<-next
+			}
+		}
+	}()
+	return ret
+}
+
+// Read up to and including a newline, keeping no more than MaxResponseSize+1
+// bytes of it so a modem sending garbage cannot exhaust memory. The parser
+// rejects the truncated line as too long.
+func readLine(buffer *bufio.Reader, prompting *int32) (string, error) {
+	// the prompt for a message body has no newline. Checked once data
+	// arrives, as the command is written after prompting is set.
+	if b, err := buffer.Peek(2); err == nil && string(b) == "> " &&
+		prompting != nil && atomic.CompareAndSwapInt32(prompting, 1, 0) {
+		buffer.Discard(2)
+		return "> ", nil
+	}
+	var line []byte
+	for {
+		chunk, err := buffer.ReadSlice(10)
+		if MaxResponseSize <= 0 || len(line) <= MaxResponseSize {
+			line = append(line, chunk...)
+			if MaxResponseSize > 0 && len(line) > MaxResponseSize+1 {
+				line = line[:MaxResponseSize+1]
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// Routes packets parsed from the modem's output.
+type Dispatcher interface {
+	// A response to the command in progress. The modem must receive these
+	// for its commands to complete.
+	Response(p Packet)
+	// An unsolicited result
+	Unsolicited(p Packet)
+}
+
+// How the parser treats lines it cannot make sense of
+type ParseMode int
+
+const (
+	// Unrecognised lines are delivered as UnknownPackets, and lines dropped
+	// or with malformed fields are logged
+	ParseDefault ParseMode = iota
+	// As ParseDefault, also reporting each such line as a ParseDiagnostic,
+	// for development
+	ParseStrict
+	// Such lines are tolerated quietly, without logging, for production
+	ParseLenient
+)
+
+// Parser groups lines read from the modem into packets, ignoring the echo of
+// commands and telling responses from unsolicited results.
+type Parser struct {
+	// Maximum size of a packet's header and body, 0 for no limit. A
+	// response growing beyond this is discarded up to its final result code,
+	// and the command fails with a ResponseOverflowError.
+	MaxSize int
+	// Identify responses by their prefixes and final result codes alone,
+	// silently ignoring every echoed command rather than only the last one
+	// sent, and results with no command pending. This tolerates other
+	// software sending commands on the same port.
+	PrefixOnly bool
+	// Unsolicited results dispatched as ProfileEvents, see Profile
+	Patterns []UnsolicitedPattern
+	// Treatment of lines the parser cannot make sense of
+	Mode ParseMode
+
+	echo, last, header, body string
+	// header of an unsolicited result awaiting its PDU
+	unsolicited string
+	// commands written, and answered by a final result code. Responses
+	// belong to the oldest command unanswered.
+	written, answered uint64
+	// extra final result codes of the pending command
+	finals []string
+	// bytes discarded from an overflowing response
+	discarded int
+}
+
+func NewParser() *Parser {
+	return &Parser{MaxSize: MaxResponseSize}
+}
+
+// Command notes a command written to the modem, so its echo is ignored and
+// its response lines are recognised.
+func (self *Parser) Command(line string) {
+	m := reQuestion.FindStringSubmatch(line)
+	if len(m) > 0 {
+		self.last = m[1]
+	}
+	self.echo = strings.TrimRight(line, "\r\n")
+	if !strings.HasSuffix(line, "\x1A") && line != "\x1B" {
+		if strings.EqualFold(self.echo, "AT") {
+			// AT resynchronises, so give up on commands unanswered
+			self.answered = self.written
+		}
+		self.written++
+	}
+	self.finals = FinalResults[commandClass(self.echo)]
+}
+
+// Sequence number of the command the next response belongs to, counting
+// commands from 1 in the order written, not counting message bodies or an
+// ESC aborting one.
+func (self *Parser) Sequence() uint64 {
+	return self.answered + 1
+}
+
+// Is a command awaiting its final result
+func (self *Parser) pending() bool {
+	return self.written > self.answered
+}
+
+// Line parses a line read from the modem, dispatching any packets completed.
+// Signs of another process using the port are dispatched as unsolicited
+// PortContention packets.
+func (self *Parser) Line(line string, d Dispatcher) {
+	if self.overflow(line, d) {
+		return
+	} else if header := self.unsolicited; header != "" {
+		self.unsolicited = ""
+		d.Unsolicited(self.parse("OK", header, line, d))
+	} else if line == self.echo {
+		return // ignore echo of command
+	} else if self.header == "" && isEcho(line) {
+		// echo of a command we didn't send
+		if !self.PrefixOnly {
+			d.Unsolicited(PortContention{ContentionEcho, line})
+		}
+	} else if !self.pending() && isFinalStatus(line) {
+		if !self.PrefixOnly {
+			d.Unsolicited(PortContention{ContentionResponse, line})
+		}
+	} else if self.pending() && self.last != "" && startsWith(line, self.last) {
+		if self.header != "" {
+			// first of multiple responses (eg CMGL)
+			d.Response(self.parse("", self.header, self.body, d))
+		}
+		self.header = line
+		self.body = ""
+	} else if isFinalStatus(line) {
+		if self.header == "" && self.body != "" && line == "OK" {
+			// information text without a prefix, as for +CGMM
+			self.header = self.last + ": " + self.body
+			self.body = ""
+		}
+		d.Response(self.parse(line, self.header, self.body, d))
+		self.done()
+	} else if self.pending() && self.isFinalResult(line) {
+		d.Response(FinalResult{line})
+		self.done()
+	} else if self.header != "" {
+		// the body following a header
+		self.body += line
+	} else if self.pending() && infoTextCommands[self.last] && !startsWith(line, "+") {
+		self.body += line
+	} else if line == "> " {
+		// raw mode for body
+		if self.pending() {
+			d.Response(Prompt{})
+		}
+	} else if startsWith(line, "+CDS:") && !strings.Contains(line, ",") {
+		// PDU mode delivery report, its PDU on the next line
+		self.unsolicited = line
+	} else if p, ok := matchPattern(self.Patterns, line); ok {
+		d.Unsolicited(p)
+	} else if p := self.parse("OK", line, "", d); p != nil {
+		if _, ok := p.(UnknownPacket); ok && self.Mode == ParseStrict {
+			d.Unsolicited(ParseDiagnostic{DiagnosticUnrecognised, line})
+		}
+		d.Unsolicited(p)
+	}
+}
+
+// Parse a packet, tolerating fields too few or of the wrong type for its
+// command, which make it an UnknownPacket
+func (self *Parser) parse(status, header, body string, d Dispatcher) (p Packet) {
+	defer func() {
+		if recover() != nil {
+			self.problem(d, DiagnosticMalformed, header)
+			p = UnknownPacket{strings.SplitN(header, ":", 2)[0], []interface{}{}}
+		}
+	}()
+	return parsePacket(status, header, body)
+}
+
+// Report a line the parser could not make sense of, as the Mode directs
+func (self *Parser) problem(d Dispatcher, reason, line string) {
+	switch self.Mode {
+	case ParseDefault:
+		log.Printf("Parser: %s: %q", reason, line)
+	case ParseStrict:
+		log.Printf("Parser: %s: %q", reason, line)
+		d.Unsolicited(ParseDiagnostic{reason, line})
+	}
+}
+
+// Discard lines of a response which has grown beyond MaxSize, until its final
+// result code completes the command with a ResponseOverflowError. Overlong
+// unsolicited lines are dropped.
+func (self *Parser) overflow(line string, d Dispatcher) bool {
+	if self.MaxSize <= 0 {
+		return false
+	}
+	final := isFinalStatus(line) || self.isFinalResult(line)
+	if self.discarded == 0 {
+		size := len(self.header) + len(self.body) + len(line)
+		if size <= self.MaxSize || final {
+			return false
+		}
+		if !self.pending() {
+			if len(line) > 40 {
+				line = line[:40]
+			}
+			self.problem(d, DiagnosticOverlong, line)
+			return true
+		}
+		self.discarded = len(self.header) + len(self.body)
+		self.header = ""
+		self.body = ""
+	}
+	if !final {
+		self.discarded += len(line)
+		return true
+	}
+	d.Response(ResponseOverflowError{self.discarded, self.MaxSize})
+	self.discarded = 0
+	self.done()
+	return true
+}
+
+// The command has completed
+func (self *Parser) done() {
+	self.header = ""
+	self.body = ""
+	if self.pending() {
+		self.answered++
+	}
+	self.finals = nil
+}
+
+// Is the line one of the pending command's extra final result codes
+func (self *Parser) isFinalResult(line string) bool {
+	for _, code := range self.finals {
+		if line == code || startsWith(line, code+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// Is the line an echoed command
+func isEcho(line string) bool {
+	return len(line) >= 2 && strings.EqualFold(line[:2], "AT")
+}
+
+// Default dispatcher, delivering responses to the command in progress and
+// unsolicited results on OOB.
+type modemDispatcher struct {
+	modem *Modem
+}
+
+func (self modemDispatcher) Response(p Packet) {
+	self.modem.recent.packet(p)
+	select {
+	case self.modem.rx <- tagged{self.modem.parser.Sequence(), p}:
+	default:
+		self.modem.parser.problem(self, DiagnosticUnexpected, fmt.Sprintf("%#v", p))
+		self.modem.desynchronise()
+	}
+}
+
+func (self modemDispatcher) Unsolicited(p Packet) {
+	if self.modem.Debug && self.modem.parseMode != ParseLenient {
+		log.Printf("OOB packet: %#v", redactPacket(p))
+	}
+	if c, ok := p.(PortContention); ok && c.Reason == ContentionResponse {
+		self.modem.desynchronise()
+	}
+	if _, ok := p.(MessageNotification); ok {
+		self.modem.stats.messageReceived()
+	}
+	if r, ok := p.(USSDResponse); ok {
+		self.modem.ussdReply(r)
+	}
+	self.modem.recent.packet(p)
+	self.modem.emit(p)
+}
+
+// Dispatcher for secondary ports, which have no commands in progress.
+type urcDispatcher struct {
+	Dispatcher
+}
+
+func (self urcDispatcher) Response(p Packet) {}
@@ -0,0 +1,255 @@
+package gogsmmodem
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type recordingDispatcher struct {
+	responses, unsolicited []Packet
+}
+
+func (self *recordingDispatcher) Response(p Packet) {
+	self.responses = append(self.responses, p)
+}
+
+func (self *recordingDispatcher) Unsolicited(p Packet) {
+	self.unsolicited = append(self.unsolicited, p)
+}
+
+func TestParser(t *testing.T) {
+	parser := NewParser()
+	d := &recordingDispatcher{}
+	parser.Command("AT+CSQ\r\n")
+	for _, line := range []string{"AT+CSQ", "+CMTI: \"SM\",2", "+CSQ: 14,99", "OK"} {
+		parser.Line(line, d)
+	}
+	if !reflect.DeepEqual(d.responses, []Packet{SignalQuality{14, 99}}) {
+		t.Errorf("Unexpected responses: %#v", d.responses)
+	}
+	if !reflect.DeepEqual(d.unsolicited, []Packet{MessageNotification{"SM", 2}}) {
+		t.Errorf("Unexpected unsolicited: %#v", d.unsolicited)
+	}
+}
+
+func TestParserMultipleResponses(t *testing.T) {
+	parser := NewParser()
+	d := &recordingDispatcher{}
+	parser.Command("AT+CMGL=\"ALL\"\r\n")
+	for _, line := range []string{
+		"+CMGL: 0,\"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\"", "One",
+		"+CMGL: 1,\"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\"", "Two",
+		"+CMS ERROR: 321",
+	} {
+		parser.Line(line, d)
+	}
+	if len(d.responses) != 2 || d.responses[0].(Message).Body != "One" || d.responses[1].(Message).Body != "Two" {
+		t.Errorf("Unexpected responses: %#v", d.responses)
+	}
+}
+
+func TestParserFinalResults(t *testing.T) {
+	parser := NewParser()
+	d := &recordingDispatcher{}
+	parser.Command("ATD+441234567890;\r\n")
+	parser.Line("NO CARRIER", d)
+	parser.Command("ATD+441234567890\r\n")
+	parser.Line("CONNECT 9600", d)
+	if !reflect.DeepEqual(d.responses, []Packet{FinalResult{"NO CARRIER"}, FinalResult{"CONNECT 9600"}}) {
+		t.Errorf("Unexpected responses: %#v", d.responses)
+	}
+	// only final for commands which expect it
+	parser.Command("AT+CSQ\r\n")
+	parser.Line("BUSY", d)
+	if len(d.responses) != 2 {
+		t.Errorf("Unexpected responses: %#v", d.responses)
+	}
+}
+
+func TestParserOverflow(t *testing.T) {
+	parser := NewParser()
+	parser.MaxSize = 20
+	d := &recordingDispatcher{}
+	parser.Command("AT+CMGR=1\r\n")
+	header := "+CMGR: \"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\""
+	for _, line := range []string{
+		header, "garbage", "OK",
+		// resynchronised for the next command
+		"+CMTI: \"SM\",2",
+	} {
+		parser.Line(line, d)
+	}
+	parser.Command("AT+CSQ\r\n")
+	parser.Line("+CSQ: 14,99", d)
+	parser.Line("OK", d)
+	expected := []Packet{ResponseOverflowError{len(header) + 7, 20}, SignalQuality{14, 99}}
+	if !reflect.DeepEqual(d.responses, expected) {
+		t.Errorf("Expected: %#v, got %#v", expected, d.responses)
+	}
+	if !reflect.DeepEqual(d.unsolicited, []Packet{MessageNotification{"SM", 2}}) {
+		t.Errorf("Unexpected unsolicited: %#v", d.unsolicited)
+	}
+}
+
+func TestParserModes(t *testing.T) {
+	for _, mode := range []ParseMode{ParseStrict, ParseLenient} {
+		parser := NewParser()
+		parser.Mode = mode
+		d := &recordingDispatcher{}
+		parser.Command("AT+CMGR=1\r\n")
+		for _, line := range []string{"+CMGR: 1", "OK", "^FOO: 1"} {
+			parser.Line(line, d)
+		}
+		if !reflect.DeepEqual(d.responses, []Packet{UnknownPacket{"+CMGR", []interface{}{}}}) {
+			t.Errorf("Unexpected responses: %#v", d.responses)
+		}
+		expected := []Packet{UnknownPacket{"^FOO", []interface{}{1}}}
+		if mode == ParseStrict {
+			expected = []Packet{
+				ParseDiagnostic{DiagnosticMalformed, "+CMGR: 1"},
+				ParseDiagnostic{DiagnosticUnrecognised, "^FOO: 1"},
+				expected[0],
+			}
+		}
+		if !reflect.DeepEqual(d.unsolicited, expected) {
+			t.Errorf("Expected: %#v, got %#v", expected, d.unsolicited)
+		}
+	}
+}
+
+func TestReadLinesLimit(t *testing.T) {
+	defer func(size int) { MaxResponseSize = size }(MaxResponseSize)
+	MaxResponseSize = 8
+	var lines []string
+	long := strings.Repeat("x", 5000)
+	for line := range ReadLines(&failingReader{strings.NewReader(long + "\r\nOK\r\n")}) {
+		lines = append(lines, line)
+	}
+	if !reflect.DeepEqual(lines, []string{"xxxxxxxxx", "OK"}) {
+		t.Errorf("Unexpected lines: %#v", lines)
+	}
+}
+
+// Records the sequence number of each response
+type sequenceDispatcher struct {
+	recordingDispatcher
+	parser    *Parser
+	sequences []uint64
+}
+
+func (self *sequenceDispatcher) Response(p Packet) {
+	self.sequences = append(self.sequences, self.parser.Sequence())
+	self.recordingDispatcher.Response(p)
+}
+
+func TestParserSequence(t *testing.T) {
+	parser := NewParser()
+	d := &sequenceDispatcher{parser: parser}
+	parser.Command("AT+CSQ\r\n")
+	// the CSQ timed out, its response arrives after the next command
+	parser.Command("AT+CMGS=19\r\n")
+	parser.Command("0011000C814421436587090000AA05C237390F00\x1a")
+	for _, line := range []string{"+CSQ: 14,99", "OK", "+CMGS: 12", "OK"} {
+		parser.Line(line, d)
+	}
+	if !reflect.DeepEqual(d.sequences, []uint64{1, 2}) {
+		t.Errorf("Unexpected sequences: %#v", d.sequences)
+	}
+	// AT resynchronises, abandoning unanswered commands
+	parser.Command("AT+CSQ\r\n")
+	parser.Command("AT\r\n")
+	parser.Line("OK", d)
+	if !reflect.DeepEqual(d.sequences, []uint64{1, 2, 4}) {
+		t.Errorf("Unexpected sequences: %#v", d.sequences)
+	}
+}
+
+func TestCommandClass(t *testing.T) {
+	tests := map[string]string{
+		"ATD+441234567890;":   "D",
+		"ata":                 "A",
+		"AT+CUSD=1,\"*100#\"": "+CUSD",
+		"AT":                  "",
+	}
+	for line, expected := range tests {
+		if class := commandClass(line); class != expected {
+			t.Errorf("Expected: %q for %q, got %q", expected, line, class)
+		}
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	var lines []string
+	// a message body line is not a prompt
+	for line := range ReadLines(&failingReader{strings.NewReader("\r\nOK\r\n\r\n> OK\r\n+CSQ: 1,2")}) {
+		lines = append(lines, line)
+	}
+	if !reflect.DeepEqual(lines, []string{"OK", "> OK", "+CSQ: 1,2"}) {
+		t.Errorf("Unexpected lines: %#v", lines)
+	}
+}
+
+func TestReadLinesPrompt(t *testing.T) {
+	var lines []string
+	// the prompt comes without a newline, and only the first is expected
+	prompting := int32(1)
+	for line := range readLines(bufio.NewReader(&failingReader{strings.NewReader("> > OK\r\n")}), nil, &prompting) {
+		lines = append(lines, line)
+	}
+	if !reflect.DeepEqual(lines, []string{"> ", "> OK"}) {
+		t.Errorf("Unexpected lines: %#v", lines)
+	}
+	if prompting != 0 {
+		t.Error("Expected: prompting cleared")
+	}
+}
+
+// Fails with a non-EOF error once the data is read, as a dropped port
+type failingReader struct {
+	r *strings.Reader
+}
+
+func (self *failingReader) Read(b []byte) (int, error) {
+	if self.r.Len() == 0 {
+		return 0, errMockDisconnected
+	}
+	return self.r.Read(b)
+}
+
+func TestParserPrefixOnly(t *testing.T) {
+	parser := NewParser()
+	parser.PrefixOnly = true
+	d := &recordingDispatcher{}
+	parser.Command("AT+CSQ\r\n")
+	// another process probing the port between our command and its response
+	for _, line := range []string{"AT+CSQ", "AT+CGMI", "+CSQ: 14,99", "OK"} {
+		parser.Line(line, d)
+	}
+	if !reflect.DeepEqual(d.responses, []Packet{SignalQuality{14, 99}}) {
+		t.Errorf("Unexpected responses: %#v", d.responses)
+	}
+	if len(d.unsolicited) != 0 {
+		t.Errorf("Unexpected unsolicited: %#v", d.unsolicited)
+	}
+}
+
+func TestParserContention(t *testing.T) {
+	parser := NewParser()
+	d := &recordingDispatcher{}
+	for _, line := range []string{"AT+CGMI", "huawei", "OK"} {
+		parser.Line(line, d)
+	}
+	expected := []Packet{
+		PortContention{ContentionEcho, "AT+CGMI"},
+		UnknownPacket{"huawei", []interface{}{}},
+		PortContention{ContentionResponse, "OK"},
+	}
+	if !reflect.DeepEqual(d.unsolicited, expected) {
+		t.Errorf("Expected: %#v, got %#v", expected, d.unsolicited)
+	}
+	if len(d.responses) != 0 {
+		t.Errorf("Unexpected responses: %#v", d.responses)
+	}
+}
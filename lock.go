@@ -0,0 +1,87 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Directory for port lock files when Options.LockDir is empty
+var DefaultLockDir = "/var/lock"
+
+// Returned by Open when another process holds the port's lock file.
+type PortLockedError struct {
+	Path string
+	PID  int
+}
+
+func (self *PortLockedError) Error() string {
+	return fmt.Sprintf("Port locked by process %d (%s)", self.PID, self.Path)
+}
+
+// A UUCP style lock file, LCK..ttyUSB0, holding the owner's PID as used by
+// minicom, ModemManager and other serial tools
+type portLock struct {
+	path string
+}
+
+// Lock the port by creating its lock file in dir, replacing a stale lock
+// left by a process no longer running.
+func lockPort(dir, port string) (*portLock, error) {
+	if dir == "" {
+		dir = DefaultLockDir
+	}
+	path := filepath.Join(dir, "LCK.."+filepath.Base(port))
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%10d\n", os.Getpid())
+			f.Close()
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &portLock{path}, nil
+		}
+		if !os.IsExist(err) || attempt > 0 {
+			return nil, err
+		}
+		pid := lockOwner(path)
+		if pid > 0 && processAlive(pid) {
+			return nil, &PortLockedError{path, pid}
+		}
+		log.Println("Removing stale lock", path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// The PID in a lock file, written as ASCII or by older tools as a binary
+// int, or 0 if unreadable
+func lockOwner(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+		return pid
+	}
+	if len(b) == 4 {
+		return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24
+	}
+	return 0
+}
+
+func (self *portLock) release() {
+	if self == nil {
+		return
+	}
+	if err := os.Remove(self.path); err != nil {
+		log.Println("Removing lock:", err)
+	}
+}
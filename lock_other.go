@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package gogsmmodem
+
+import "syscall"
+
+// Is a process running, or owned by another user
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,67 @@
+package gogsmmodem
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+func TestLockPort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "LCK..ttyUSB0")
+
+	lock, err := lockPort(dir, "/dev/ttyUSB0")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if pid := lockOwner(path); pid != os.Getpid() {
+		t.Errorf("Expected: lock owned by %d, got %d", os.Getpid(), pid)
+	}
+	_, err = lockPort(dir, "/dev/ttyUSB0")
+	if e, ok := err.(*PortLockedError); !ok || e.PID != os.Getpid() {
+		t.Errorf("Expected: port locked, got %v", err)
+	}
+	lock.release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected: lock removed, got:", err)
+	}
+
+	// stale lock of a process no longer running
+	ioutil.WriteFile(path, []byte("2147483646\n"), 0644)
+	lock, err = lockPort(dir, "/dev/ttyUSB0")
+	if err != nil {
+		t.Fatal("Expected: stale lock replaced, got:", err)
+	}
+	lock.release()
+}
+
+func TestOpenLocked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(initReplay), nil
+	}
+	opts := Options{Debug: true, Lock: true, LockDir: dir}
+	modem, err := OpenWithOptions(&serial.Config{Name: "/dev/ttyUSB0"}, opts)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if _, err := OpenWithOptions(&serial.Config{Name: "/dev/ttyUSB0"}, opts); err == nil {
+		t.Error("Expected: port locked")
+	}
+	modem.Close()
+	if _, err := os.Stat(filepath.Join(dir, "LCK..ttyUSB0")); !os.IsNotExist(err) {
+		t.Error("Expected: lock removed on close, got:", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package gogsmmodem
+
+// Processes can't be checked, so locks are never stale
+func processAlive(pid int) bool {
+	return true
+}
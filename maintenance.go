@@ -0,0 +1,92 @@
+package gogsmmodem
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Tasks run by Maintain. Tasks left zero are skipped.
+type Maintenance struct {
+	// Interval between runs
+	Interval time.Duration
+	// Refresh the signal quality and registration status in Stats
+	RefreshStatus bool
+	// Delete read messages with a service centre timestamp older than this
+	PurgeAfter time.Duration
+	// Drop events older than this from RecentEvents
+	EventMaxAge time.Duration
+}
+
+var ErrMaintenanceInterval = errors.New("Maintenance interval must be positive")
+
+// Context for maintenance, which gives way to all other commands
+var maintenanceContext = WithPriority(context.Background(), PriorityLow)
+
+// Maintain runs the maintenance tasks every m.Interval until stop is called or
+// the port drops. A run is skipped if the modem is busy, and its commands
+// queue behind any others so foreground operations are not held up. It fails
+// if m.Interval is not positive. stop may be called more than once.
+func (self *Modem) Maintain(m Maintenance) (stop func(), err error) {
+	if m.Interval <= 0 {
+		return nil, ErrMaintenanceInterval
+	}
+	quit := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-self.clock.After(m.Interval):
+				if self.sched.idle() {
+					self.maintain(m)
+				}
+			case <-self.closed:
+				return
+			case <-self.done:
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(quit) }) }, nil
+}
+
+// Run the maintenance tasks once
+func (self *Modem) maintain(m Maintenance) {
+	if m.RefreshStatus {
+		if _, err := self.signalQuality(maintenanceContext); err != nil {
+			log.Println("Maintenance: signal quality", err)
+		}
+		if _, err := self.networkRegistration(maintenanceContext); err != nil {
+			log.Println("Maintenance: registration", err)
+		}
+	}
+	if m.PurgeAfter > 0 {
+		if err := self.purgeMessages(self.clock.Now().Add(-m.PurgeAfter)); err != nil {
+			log.Println("Maintenance: purging messages", err)
+		}
+	}
+	if m.EventMaxAge > 0 {
+		self.recent.expire(self.clock.Now().Add(-m.EventMaxAge))
+	}
+}
+
+// Delete read messages sent before cutoff
+func (self *Modem) purgeMessages(cutoff time.Time) error {
+	msgs, err := self.ListMessagesContext(maintenanceContext, "REC READ")
+	if err != nil {
+		return err
+	}
+	for _, msg := range *msgs {
+		if msg.Timestamp.IsZero() || !msg.Timestamp.Before(cutoff) {
+			continue
+		}
+		if _, err := self.sendContext(maintenanceContext, PriorityLow, "+CMGD", msg.Index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+var maintenanceReplay = []string{
+	"->AT+CSQ\r\n",
+	"<-\r\n+CSQ: 17,99\r\n\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,1\r\n\r\nOK\r\n",
+	"->AT+CMGL=\"REC READ\"\r\n",
+	"<-\r\n+CMGL: 3,\"REC READ\",\"+441234567890\",,\"14/01/01,09:00:00+00\"\r\nOld\r\n+CMGL: 4,\"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\"\r\nNew\r\n\r\nOK\r\n",
+	"->AT+CMGD=3\r\n",
+	"<-\r\nOK\r\n",
+}
+
+func TestMaintain(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, maintenanceReplay)), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.maintain(Maintenance{RefreshStatus: true, PurgeAfter: 7 * 24 * time.Hour})
+	stats := modem.Stats()
+	if stats.Signal != (SignalQuality{17, 99}) || stats.Registration != RegHome ||
+		stats.SignalAt.IsZero() || stats.RegistrationAt.IsZero() {
+		t.Errorf("Expected: refreshed status, got %#v", stats)
+	}
+	if _, err := modem.Maintain(Maintenance{RefreshStatus: true}); err != ErrMaintenanceInterval {
+		t.Error("Expected: ErrMaintenanceInterval, got:", err)
+	}
+	stop, err := modem.Maintain(Maintenance{Interval: time.Hour, RefreshStatus: true})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	stop()
+	stop()
+	modem.Close()
+}
@@ -1,31 +1,125 @@
 package gogsmmodem
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
+	"time"
 )
 
 type MockSerialPort struct {
 	replay  []string
 	receive chan string
+	lock    sync.Mutex
+	clock   Clock
+	latency time.Duration
+	flip    float64
+	drop    float64
+	rand    *rand.Rand
+	urcs    map[string][]string
+	// closed when the port is disconnected
+	gone       chan struct{}
+	disconnect string
 }
 
+var errMockDisconnected = errors.New("Mock port disconnected")
+
 func NewMockSerialPort(replay []string) *MockSerialPort {
 	self := &MockSerialPort{
 		replay:  replay,
 		receive: make(chan string, 16),
+		clock:   DefaultClock,
+		urcs:    map[string][]string{},
+		gone:    make(chan struct{}),
 	}
 	self.enqueueReads()
 	return self
 }
 
+// Delay each read by the given duration per byte, simulating a slow line.
+func (self *MockSerialPort) SetLatency(perByte time.Duration) {
+	self.lock.Lock()
+	self.latency = perByte
+	self.lock.Unlock()
+}
+
+// Clock the latency is slept on, DefaultClock when the port was created.
+func (self *MockSerialPort) SetClock(clock Clock) {
+	self.lock.Lock()
+	self.clock = clock
+	self.lock.Unlock()
+}
+
+// Corrupt data read with the given probabilities per byte of flipping a bit
+// or dropping the byte. The seed makes the noise reproducible.
+func (self *MockSerialPort) SetNoise(flip, drop float64, seed int64) {
+	self.lock.Lock()
+	self.flip = flip
+	self.drop = drop
+	self.rand = rand.New(rand.NewSource(seed))
+	self.lock.Unlock()
+}
+
+// Deliver an unsolicited line immediately.
+func (self *MockSerialPort) Inject(line string) {
+	self.receive <- line
+}
+
+// Deliver an unsolicited line after the given data is written, ahead of the
+// replayed response.
+func (self *MockSerialPort) InjectAfter(write, line string) {
+	self.lock.Lock()
+	self.urcs[write] = append(self.urcs[write], line)
+	self.lock.Unlock()
+}
+
+// Disconnect the port after the given data is written, as a USB modem
+// dropping off the bus. Further reads and writes fail.
+func (self *MockSerialPort) DisconnectAfter(write string) {
+	self.lock.Lock()
+	self.disconnect = write
+	self.lock.Unlock()
+}
+
 func (self *MockSerialPort) Read(b []byte) (int, error) {
-	line := <-self.receive
-	data := []byte(line)
+	var line string
+	select {
+	case line = <-self.receive:
+	case <-self.gone:
+		return 0, errMockDisconnected
+	}
+	data := self.distort([]byte(line))
+	self.lock.Lock()
+	latency, clock := self.latency, self.clock
+	self.lock.Unlock()
+	if latency > 0 {
+		clock.Sleep(latency * time.Duration(len(data)))
+	}
 	copy(b, data)
 	return len(data), nil
 }
 
+func (self *MockSerialPort) distort(data []byte) []byte {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.rand == nil {
+		return data
+	}
+	var ret []byte
+	for _, c := range data {
+		if self.rand.Float64() < self.drop {
+			continue
+		}
+		if self.rand.Float64() < self.flip {
+			c ^= 1 << uint(self.rand.Intn(8))
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
+
 func (self *MockSerialPort) enqueueReads() {
 	// enqueue response(s) from replay
 	for {
@@ -39,6 +133,11 @@ func (self *MockSerialPort) enqueueReads() {
 }
 
 func (self *MockSerialPort) Write(b []byte) (int, error) {
+	select {
+	case <-self.gone:
+		return 0, errMockDisconnected
+	default:
+	}
 	if len(self.replay) == 0 {
 		fmt.Printf("Expected: no more interactions, got: %#v", string(b))
 		panic("fail")
@@ -54,6 +153,18 @@ func (self *MockSerialPort) Write(b []byte) (int, error) {
 		panic("fail")
 	}
 	self.replay = self.replay[1:]
+	self.lock.Lock()
+	urcs := self.urcs[expected]
+	delete(self.urcs, expected)
+	disconnect := self.disconnect == expected
+	self.lock.Unlock()
+	if disconnect {
+		close(self.gone)
+		return len(b), nil
+	}
+	for _, urc := range urcs {
+		self.receive <- urc
+	}
 	self.enqueueReads()
 	return len(b), nil
 }
@@ -61,3 +172,58 @@ func (self *MockSerialPort) Write(b []byte) (int, error) {
 func (self *MockSerialPort) Close() error {
 	return nil
 }
+
+type mockTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// A clock for tests which advances instantly when slept on.
+type MockClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []mockTimer
+}
+
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+func (self *MockClock) Now() time.Time {
+	self.Lock()
+	defer self.Unlock()
+	return self.now
+}
+
+func (self *MockClock) Sleep(d time.Duration) {
+	self.Advance(d)
+}
+
+func (self *MockClock) After(d time.Duration) <-chan time.Time {
+	self.Lock()
+	defer self.Unlock()
+	c := make(chan time.Time, 1)
+	at := self.now.Add(d)
+	if d <= 0 {
+		c <- at
+	} else {
+		self.timers = append(self.timers, mockTimer{at, c})
+	}
+	return c
+}
+
+// Advance the clock, firing any timers which are due.
+func (self *MockClock) Advance(d time.Duration) {
+	self.Lock()
+	defer self.Unlock()
+	self.now = self.now.Add(d)
+	var pending []mockTimer
+	for _, t := range self.timers {
+		if t.at.After(self.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- self.now
+		}
+	}
+	self.timers = pending
+}
@@ -0,0 +1,65 @@
+package gogsmmodem
+
+import (
+	"testing"
+	"time"
+)
+
+func readMock(t *testing.T, port *MockSerialPort) string {
+	b := make([]byte, 64)
+	n, err := port.Read(b)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	return string(b[:n])
+}
+
+func TestMockLatency(t *testing.T) {
+	start := time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC)
+	clock := NewMockClock(start)
+	port := NewMockSerialPort([]string{"<-\r\nOK\r\n", "<-\r\nOK\r\n"})
+	port.SetClock(clock)
+
+	if data := readMock(t, port); data != "\r\nOK\r\n" {
+		t.Errorf("Expected: OK, got: %q", data)
+	}
+	if now := clock.Now(); !now.Equal(start) {
+		t.Error("Expected: no latency by default, got:", now.Sub(start))
+	}
+	port.SetLatency(time.Millisecond)
+	readMock(t, port)
+	if elapsed := clock.Now().Sub(start); elapsed != 6*time.Millisecond {
+		t.Error("Expected: 6ms latency for 6 bytes, got:", elapsed)
+	}
+}
+
+func TestMockNoise(t *testing.T) {
+	line := "\r\n+CMTI: \"SM\",6\r\n"
+	replay := []string{"<-" + line}
+
+	port := NewMockSerialPort(replay)
+	port.SetNoise(0, 1, 1)
+	if data := readMock(t, port); data != "" {
+		t.Errorf("Expected: every byte dropped, got: %q", data)
+	}
+
+	port = NewMockSerialPort(replay)
+	port.SetNoise(1, 0, 1)
+	flipped := readMock(t, port)
+	if len(flipped) != len(line) {
+		t.Fatalf("Expected: %d bytes, got: %q", len(line), flipped)
+	}
+	for i := range line {
+		if diff := line[i] ^ flipped[i]; diff == 0 || diff&(diff-1) != 0 {
+			t.Errorf("Byte %d: expected one bit flipped, got %08b", i, diff)
+		}
+	}
+
+	// the same seed gives the same noise
+	a, b := NewMockSerialPort(replay), NewMockSerialPort(replay)
+	a.SetNoise(0.1, 0.1, 42)
+	b.SetNoise(0.1, 0.1, 42)
+	if x, y := readMock(t, a), readMock(t, b); x != y {
+		t.Errorf("Expected: reproducible noise, got %q and %q", x, y)
+	}
+}
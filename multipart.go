@@ -0,0 +1,181 @@
+package gogsmmodem
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+)
+
+// Information elements of a concatenated message, with an 8-bit or 16-bit
+// reference, then the number of parts and this part's number from 1
+const (
+	ieiConcat   = 0x00
+	ieiConcat16 = 0x08
+)
+
+// Most parts a concatenated message can have, counted in one byte
+const maxParts = 255
+
+// How long a Joiner keeps an incomplete multipart message
+var MultipartTimeout = time.Hour
+
+// A part of a concatenated message
+type MessagePart struct {
+	Reference int
+	// Number of this part from 1, or 0 for a message joined by a Joiner
+	Number int
+	Count  int
+	// Storage indexes of the parts of a joined message
+	Indexes []int `json:",omitempty"`
+}
+
+// Decode the concatenation information element of a received message, or nil
+func decodeMessagePart(p *pdu.Message) *MessagePart {
+	var part MessagePart
+	if e := p.Element(ieiConcat); len(e) == 3 {
+		part = MessagePart{Reference: int(e[0]), Number: int(e[2]), Count: int(e[1])}
+	} else if e := p.Element(ieiConcat16); len(e) == 4 {
+		part = MessagePart{Reference: int(e[0])<<8 | int(e[1]), Number: int(e[3]), Count: int(e[2])}
+	} else {
+		return nil
+	}
+	if part.Number == 0 || part.Number > part.Count {
+		return nil
+	}
+	return &part
+}
+
+// Send a message too long for one segment as concatenated parts of submit in
+// PDU mode, returning the reference and stored index of the first. Fails
+// with SegmentLimitError, sending nothing, above 255 parts. The caller must
+// hold the modem.
+func (self *Modem) sendParts(ctx context.Context, submit pdu.SMSSubmit, parts []string) (int, int, error) {
+	if len(parts) > maxParts {
+		return 0, -1, &SegmentLimitError{len(parts), maxParts}
+	}
+	concat := byte(atomic.AddUint32(&self.concatRef, 1))
+	ref, stored := 0, -1
+	for i, part := range parts {
+		submit.UDH = pdu.AppendElement(nil, ieiConcat, []byte{concat, byte(len(parts)), byte(i + 1)})
+		submit.Text = part
+		hexpdu, length, err := pdu.Encode(submit)
+		if err != nil {
+			return 0, -1, err
+		}
+		r, s, err := self.sendPDU(ctx, hexpdu, length)
+		if err != nil {
+			return 0, -1, err
+		}
+		if i == 0 {
+			ref, stored = r, s
+		}
+	}
+	return ref, stored, nil
+}
+
+// Joins the parts of received concatenated messages into whole messages.
+type Joiner struct {
+	clock   Clock
+	lock    sync.Mutex
+	pending map[partKey]*partialMessage
+}
+
+type partKey struct {
+	telephone string
+	reference int
+	count     int
+}
+
+type partialMessage struct {
+	parts   []*Message
+	have    int
+	started time.Time
+}
+
+func NewJoiner() *Joiner {
+	return &Joiner{clock: DefaultClock, pending: map[partKey]*partialMessage{}}
+}
+
+// Add a received message, returning it whole: at once if it is not a part,
+// or joined with the others once its last part arrives, with Index that of
+// the first part and Part.Indexes those of all of them. Until then it returns
+// nil.
+// Parts still incomplete after MultipartTimeout are discarded.
+func (self *Joiner) Add(msg Message) *Message {
+	part := msg.Part
+	if part == nil || part.Number == 0 {
+		return &msg
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	now := self.clock.Now()
+	for key, p := range self.pending {
+		if now.Sub(p.started) > MultipartTimeout {
+			delete(self.pending, key)
+		}
+	}
+	key := partKey{msg.Telephone, part.Reference, part.Count}
+	p := self.pending[key]
+	if p == nil {
+		p = &partialMessage{parts: make([]*Message, part.Count), started: now}
+		self.pending[key] = p
+	}
+	if p.parts[part.Number-1] == nil {
+		p.parts[part.Number-1] = &msg
+		p.have++
+	}
+	if p.have < part.Count {
+		return nil
+	}
+	delete(self.pending, key)
+	joined := *p.parts[0]
+	joined.Part = &MessagePart{Reference: part.Reference, Count: part.Count}
+	var body []string
+	for _, m := range p.parts {
+		body = append(body, m.Body)
+		joined.Part.Indexes = append(joined.Part.Indexes, m.Index)
+	}
+	joined.Body = strings.Join(body, "")
+	return &joined
+}
+
+// DeliverMessages reads each message the modem is notified of and emits it
+// on OOB as a Message, joining the parts of multipart messages first, until
+// stop is called. Messages are left in storage; a joined message's
+// Part.Indexes are all its parts'.
+func (self *Modem) DeliverMessages() (stop func()) {
+	sub := self.Subscribe(SubscribeOptions{Topics: []Topic{TopicOf(MessageNotification{})}})
+	quit := make(chan struct{})
+	joiner := NewJoiner()
+	joiner.clock = self.clock
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				n := e.Packet.(MessageNotification)
+				msg, err := self.GetMessageFrom(n.Storage, n.Index)
+				if err != nil {
+					log.Println("Delivering message", n.Storage, n.Index, err)
+					continue
+				}
+				if whole := joiner.Add(*msg); whole != nil {
+					self.emit(*whole)
+				}
+			case <-self.done:
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() { close(quit) }
+}
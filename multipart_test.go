@@ -0,0 +1,80 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+	"github.com/tarm/serial"
+)
+
+// Replay of sending the parts of a concatenated message
+func partsReplay(ref byte, parts []string) []string {
+	var replay []string
+	for i, part := range parts {
+		udh := pdu.AppendElement(nil, ieiConcat, []byte{ref, byte(len(parts)), byte(i + 1)})
+		hexpdu, length, _ := pdu.Encode(pdu.SMSSubmit{Address: "+441234567890", UDH: udh, Text: part})
+		replay = append(replay, fmt.Sprintf("->AT+CMGS=%d\r\n", length), "<-> \r\n", "->"+hexpdu+"\x1a", fmt.Sprintf("<-\r\n+CMGS: %d\r\n\r\nOK\r\n", 20+i))
+	}
+	return replay
+}
+
+func TestSendMultipart(t *testing.T) {
+	body := strings.Repeat("0123456789", 20)
+	parts := []string{body[:153], body[153:]}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, partsReplay(1, parts))), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	res, err := modem.Send(OutgoingMessage{Telephone: "+441234567890", Body: body})
+	if err != nil || res.Reference != 20 {
+		t.Errorf("Expected: reference of the first part, got %#v %v", res, err)
+	}
+	modem.Close()
+}
+
+func TestSendMultipartLimit(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(initReplay), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	body := strings.Repeat("0", 153*256)
+	_, err = modem.Send(OutgoingMessage{Telephone: "+441234567890", Body: body})
+	if e, ok := err.(*SegmentLimitError); !ok || *e != (SegmentLimitError{256, 255}) {
+		t.Error("Expected: SegmentLimitError, got:", err)
+	}
+	modem.Close()
+}
+
+func TestJoiner(t *testing.T) {
+	var received []Message
+	for i, text := range []string{"Hello ", "world"} {
+		udh := pdu.AppendElement(nil, ieiConcat, []byte{7, 2, byte(i + 1)})
+		hexpdu, _, _ := pdu.Encode(pdu.SMSSubmit{Address: "+441234567890", UDH: udh, Text: text})
+		msg, err := decodePDUMessage(Message{Index: 3 + i, Body: hexpdu})
+		if err != nil {
+			t.Fatal("Expected: no error, got:", err)
+		}
+		received = append(received, *msg)
+	}
+	joiner := NewJoiner()
+	if msg := joiner.Add(received[1]); msg != nil {
+		t.Errorf("Expected: nil until complete, got %#v", msg)
+	}
+	msg := joiner.Add(received[0])
+	if msg == nil || msg.Body != "Hello world" || msg.Index != 3 || !reflect.DeepEqual(msg.Part, &MessagePart{Reference: 7, Count: 2, Indexes: []int{3, 4}}) {
+		t.Errorf("Unexpected message: %#v", msg)
+	}
+	if msg := joiner.Add(Message{Body: "single"}); msg == nil || msg.Body != "single" {
+		t.Errorf("Expected: single message passed through, got %#v", msg)
+	}
+}
@@ -0,0 +1,39 @@
+package gogsmmodem
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Cleanup applied to the bodies of received messages, see Modem.Normalize.
+type Normalization struct {
+	// Strip trailing NULs and whitespace some carriers pad messages with
+	TrimPadding bool
+	// Strip a "(1/2)" style part marker carriers insert at the start of
+	// each part of a long message
+	StripPartMarkers bool
+	// Convert CRLF and CR line endings to LF
+	NormalizeNewlines bool
+}
+
+var rePartMarker = regexp.MustCompile(`^\s*\(\d+/\d+\)\s*`)
+
+// Apply the normalization to a message body
+func (self Normalization) Apply(body string) string {
+	if self.NormalizeNewlines {
+		body = strings.Replace(body, "\r\n", "\n", -1)
+		body = strings.Replace(body, "\r", "\n", -1)
+	}
+	if self.StripPartMarkers {
+		body = rePartMarker.ReplaceAllString(body, "")
+	}
+	if self.TrimPadding {
+		body = strings.TrimRight(body, "\x00 \t\r\n")
+	}
+	return body
+}
+
+// Normalize the body of a received message
+func (self *Modem) normalize(msg *Message) {
+	msg.Body = self.Normalize.Apply(msg.Body)
+}
@@ -0,0 +1,24 @@
+package gogsmmodem
+
+import "testing"
+
+func TestNormalization(t *testing.T) {
+	all := Normalization{TrimPadding: true, StripPartMarkers: true, NormalizeNewlines: true}
+	tests := []struct {
+		n        Normalization
+		body     string
+		expected string
+	}{
+		{Normalization{}, "(1/2) Hi\r\n\x00\x00", "(1/2) Hi\r\n\x00\x00"},
+		{Normalization{TrimPadding: true}, "Hi  \x00\x00", "Hi"},
+		{Normalization{StripPartMarkers: true}, "(1/2) Hi", "Hi"},
+		{Normalization{StripPartMarkers: true}, "Hi (1/2)", "Hi (1/2)"},
+		{Normalization{NormalizeNewlines: true}, "a\r\nb\rc", "a\nb\nc"},
+		{all, " (2/2)Line\r\nLine\r\n\x00", "Line\nLine"},
+	}
+	for _, test := range tests {
+		if actual := test.n.Apply(test.body); actual != test.expected {
+			t.Errorf("Expected: %q, got %q", test.expected, actual)
+		}
+	}
+}
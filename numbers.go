@@ -0,0 +1,70 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Emergency numbers refused unless NumberPolicy.AllowEmergency is set
+var EmergencyNumbers = []string{"112", "911", "999", "000", "08", "110", "118", "119", "100", "101", "102", "103"}
+
+// Longest number treated as a short code, without a + prefix
+const maxShortCode = 6
+
+// Numbers the modem refuses to send messages to or dial, as a safety net
+// against misrouted jobs. Emergency numbers and short codes are refused
+// unless allowed.
+type NumberPolicy struct {
+	// Patterns of numbers refused, eg "+4490*", matched as by path.Match
+	// with spaces removed from both
+	Blocked []string
+	// Allow short codes, numbers of up to 6 digits without a + prefix
+	AllowShortCodes bool
+	// Allow EmergencyNumbers, which are also short codes
+	AllowEmergency bool
+}
+
+// Returned when a number is refused by the modem's NumberPolicy
+type BlockedNumberError struct {
+	Number string
+	Reason string
+}
+
+func (self *BlockedNumberError) Error() string {
+	return fmt.Sprintf("Number %s blocked: %s", self.Number, self.Reason)
+}
+
+// Check a number against the policy
+func (self NumberPolicy) Check(number string) error {
+	n := strings.Replace(number, " ", "", -1)
+	for _, pattern := range self.Blocked {
+		if ok, _ := path.Match(strings.Replace(pattern, " ", "", -1), n); ok {
+			return &BlockedNumberError{number, "matches " + pattern}
+		}
+	}
+	if !self.AllowEmergency {
+		for _, e := range EmergencyNumbers {
+			if n == e {
+				return &BlockedNumberError{number, "emergency number"}
+			}
+		}
+	}
+	if !self.AllowShortCodes && !startsWith(n, "+") && len(n) <= maxShortCode {
+		return &BlockedNumberError{number, "short code"}
+	}
+	return nil
+}
+
+// The number dialled by a command such as "D07712345678;", or "" if it is
+// not a dial command or dials a service code such as *99#
+func dialledNumber(cmd string) string {
+	if len(cmd) < 2 || !strings.EqualFold(cmd[:1], "D") {
+		return ""
+	}
+	n := strings.TrimRight(cmd[1:], "; ")
+	if !isDialString(n) || strings.ContainsAny(n, "*#") {
+		return ""
+	}
+	return n
+}
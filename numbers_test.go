@@ -0,0 +1,45 @@
+package gogsmmodem
+
+import "testing"
+
+func TestNumberPolicy(t *testing.T) {
+	policy := NumberPolicy{Blocked: []string{"+4490*", "+44 7700 900*"}}
+	var tests = []struct {
+		policy  NumberPolicy
+		number  string
+		blocked bool
+	}{
+		{policy, "+447712345678", false},
+		{policy, "+449012345678", true},
+		{policy, "+44 7700 900123", true},
+		{policy, "112", true},
+		{policy, "81010", true},
+		{NumberPolicy{AllowShortCodes: true}, "81010", false},
+		{NumberPolicy{AllowShortCodes: true}, "999", true},
+		{NumberPolicy{AllowShortCodes: true, AllowEmergency: true}, "999", false},
+	}
+	for _, test := range tests {
+		err := test.policy.Check(test.number)
+		if _, ok := err.(*BlockedNumberError); ok != test.blocked {
+			t.Errorf("%s: expected blocked %v, got %v", test.number, test.blocked, err)
+		}
+	}
+}
+
+func TestDialledNumber(t *testing.T) {
+	var tests = []struct {
+		cmd    string
+		number string
+	}{
+		{"D07712345678;", "07712345678"},
+		{"D112", "112"},
+		{"D*99#", ""},
+		{"+CMGS", ""},
+		{"DT", ""},
+	}
+	for _, test := range tests {
+		if n := dialledNumber(test.cmd); n != test.number {
+			t.Errorf("%s: expected %q, got %q", test.cmd, test.number, n)
+		}
+	}
+}
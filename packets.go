@@ -1,6 +1,9 @@
 package gogsmmodem
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type Packet interface{}
 
@@ -20,9 +23,268 @@ type MessageNotification struct {
 	Index   int
 }
 
+// Type-of-address values for +CSCA
+const (
+	TOAUnknown       = 129
+	TOAInternational = 145
+)
+
 // +CSCA
 type SMSCAddress struct {
-	Args []interface{}
+	Address string
+	Type    int
+}
+
+// Is the SMSC address in international format
+func (self SMSCAddress) International() bool {
+	return self.Type == TOAInternational || startsWith(self.Address, "+")
+}
+
+// +CPIN?
+type PINStatus struct {
+	Status string
+}
+
+// Is the SIM ready, with no PIN or PUK required
+func (self PINStatus) Ready() bool {
+	return self.Status == "READY"
+}
+
+// +CSMS. Each of MT, MO and BM is 1 if the service supports receiving,
+// sending and cell broadcast messages respectively.
+type SMSService struct {
+	// 0 for phase 2, 1 for phase 2+, -1 if not reported
+	Service int
+	MT      int
+	MO      int
+	BM      int
+}
+
+// Stages of modem initialisation reported by InitProgress
+const (
+	InitReset     = "reset"
+	InitWaitSIM   = "wait-sim"
+	InitSIMReady  = "sim-ready"
+	InitConfigure = "configure"
+	InitReady     = "ready"
+)
+
+// Progress of initialisation, emitted on OOB while opening the modem
+type InitProgress struct {
+	Stage  string
+	Detail string
+}
+
+// +CMGS
+type MessageReference struct {
+	Reference int
+}
+
+// An unsolicited result matching a pattern of the modem's Profile, with the
+// pattern's submatches
+type ProfileEvent struct {
+	Event   string
+	Line    string
+	Matches []string
+}
+
+// +CMGW
+type StoredMessage struct {
+	Index int
+}
+
+// +COPS, the operator is "" when not registered
+type NetworkOperator struct {
+	Mode int
+	Name string
+	// Access technology, 0 GSM, 2 UTRAN, 7 E-UTRAN
+	AcT int
+}
+
+// +CNUM
+type SubscriberNumber struct {
+	Alpha  string
+	Number string
+	Type   int
+}
+
+// +CUSD, the network's reply to a USSD request, see Modem.USSD. Status is
+// one of USSDDone etc.
+type USSDResponse struct {
+	Status int
+	Text   string
+	DCS    int
+}
+
+// Emitted on OOB when the balance read by CheckBalance falls below the
+// checker's threshold.
+type LowBalance struct {
+	Balance   float64
+	Threshold float64
+	Text      string
+}
+
+// Outcome of sending a message, emitted on OOB. ID is the caller's ID from
+// OutgoingMessage.
+type MessageSent struct {
+	ID        string
+	Telephone string
+	Reference int
+	Error     error
+}
+
+// Soft reset of the modem after an error storm, emitted on OOB. Error is
+// set if the modem failed to reset or register again.
+type StormReset struct {
+	Failures int
+	Error    error
+}
+
+// The "> " prompt for the body of a command such as +CMGS
+type Prompt struct{}
+
+// Sends refused Failures times in a row with the +CMS ERROR Code, one of
+// BlockCodes, while registration and signal were fine, suggesting the
+// carrier has blocked the SIM for spam. Emitted on OOB once BlockThreshold
+// is reached, then not again until a message is sent.
+type SIMSuspectedBlocked struct {
+	Failures int
+	Code     int
+}
+
+// Heartbeats failed Failures times in a row, emitted on OOB once the
+// Heartbeat's FailureThreshold is reached. Error is the last failure.
+type HeartbeatFailed struct {
+	Failures int
+	Error    error
+}
+
+// States of RegistrationState
+const (
+	// Registration lost, sends wait for recovery
+	RegistrationLost = "lost"
+	// Reselecting the network automatically (+COPS=0)
+	RegistrationSelecting = "selecting"
+	// Cycling the radio (+CFUN)
+	RegistrationResetting = "resetting"
+	// Registered again
+	RegistrationRecovered = "recovered"
+	// Watching stopped or the port dropped while registration was lost;
+	// sends no longer wait for recovery
+	RegistrationStopped = "stopped"
+)
+
+// Transition in recovering network registration, emitted on OOB by
+// WatchRegistration. Status is the +CREG status that lost registration and
+// Attempt counts recovery attempts since.
+type RegistrationState struct {
+	State   string
+	Status  int
+	Attempt int
+}
+
+// Reasons for PortContention
+const (
+	ContentionEcho     = "echo of a command not sent by this modem"
+	ContentionResponse = "response with no command pending"
+)
+
+// +CDS, a delivery report for a sent message, matched to it by the
+// reference from +CMGS, see OutgoingMessage.StatusReport
+type DeliveryReport struct {
+	Reference int
+	Telephone string
+	// When the service centre received the message, and delivered it or
+	// last tried to
+	Timestamp  time.Time
+	Discharged time.Time
+	// TP-ST: below 0x20 delivered, below 0x40 still trying, otherwise failed
+	Status int
+}
+
+func (self DeliveryReport) Delivered() bool {
+	return self.Status < 0x20
+}
+
+// The service centre is still trying to deliver the message
+func (self DeliveryReport) Pending() bool {
+	return self.Status >= 0x20 && self.Status < 0x40
+}
+
+// +CDSI, a delivery report stored by the modem, see GetDeliveryReport
+type DeliveryReportNotification struct {
+	Storage string
+	Index   int
+}
+
+// Reasons for ParseDiagnostic
+const (
+	DiagnosticUnrecognised = "unrecognised line"
+	DiagnosticMalformed    = "malformed fields"
+	DiagnosticOverlong     = "overlong line dropped"
+	DiagnosticUnexpected   = "response with no command waiting dropped"
+)
+
+// A line the parser could not make sense of, emitted on OOB in ParseStrict
+// mode
+type ParseDiagnostic struct {
+	Reason string
+	Line   string
+}
+
+// Signs of another process using the port, such as ModemManager probing the
+// modem, emitted on OOB. Stop the other process or have it ignore the modem.
+type PortContention struct {
+	Reason string
+	Line   string
+}
+
+// +CSQ
+type SignalQuality struct {
+	RSSI int // 0-31, 99 if unknown
+	BER  int // 0-7, 99 if unknown
+}
+
+// Is the signal strength known
+func (self SignalQuality) Known() bool {
+	return self.RSSI != 99
+}
+
+// Signal strength in dBm, or 0 if unknown
+func (self SignalQuality) DBm() int {
+	if !self.Known() {
+		return 0
+	}
+	return -113 + 2*self.RSSI
+}
+
+// Network registration status values for +CREG
+const (
+	RegNotSearching = 0
+	RegHome         = 1
+	RegSearching    = 2
+	RegDenied       = 3
+	RegUnknown      = 4
+	RegRoaming      = 5
+)
+
+// +CREG?, or an unsolicited +CREG with Mode -1
+type NetworkRegistration struct {
+	Mode   int
+	Status int
+}
+
+// Is the modem registered on the home network or roaming
+func (self NetworkRegistration) Registered() bool {
+	return self.Status == RegHome || self.Status == RegRoaming
+}
+
+// +CEREG, registration on an LTE (EPS) network, as NetworkRegistration
+type EPSRegistration NetworkRegistration
+
+// Is the modem registered on the home network or roaming
+func (self EPSRegistration) Registered() bool {
+	return NetworkRegistration(self).Registered()
 }
 
 // +CMGR
@@ -30,9 +292,34 @@ type Message struct {
 	Index     int
 	Status    string
 	Telephone string
+	// Service centre timestamp, as reported by the network
 	Timestamp time.Time
 	Body      string
 	Last      bool
+	// Host clock time the message was read from the modem. Unlike Timestamp
+	// this does not depend on the carrier setting its clock correctly.
+	ReceivedAt time.Time
+	// Storage area read from, eg "SM", if known
+	Storage string
+	// Body was inflated, see OutgoingMessage.Compress
+	Compressed bool `json:",omitempty"`
+	// Body is a chunk of a blob, see SendBlob
+	Chunk *BlobChunk `json:",omitempty"`
+	// Body is a part of a concatenated message, or all of them joined, see
+	// Joiner
+	Part *MessagePart `json:",omitempty"`
+}
+
+// +GCAP
+type Capabilities []string
+
+// +CSCS=?
+type CharacterSets []string
+
+// +CGMI, +CGMM, +CGMR or +CGSN
+type InfoText struct {
+	Command string
+	Text    string
 }
 
 // +CPMS=?
@@ -42,9 +329,38 @@ type StorageAreas struct {
 	New      []string
 }
 
-// +CPMS=...
+// +CPMS=... or +CPMS?
+// Storage names are only reported by +CPMS?. Modems supporting two areas leave
+// the receive fields empty.
 type StorageInfo struct {
-	UsedSpace1, MaxSpace1, UsedSpace2, MaxSpace2, UsedSpace3, MaxSpace3 int
+	ReadStorage               string
+	UsedRead, TotalRead       int
+	WriteStorage              string
+	UsedWrite, TotalWrite     int
+	ReceiveStorage            string
+	UsedReceive, TotalReceive int
+}
+
+func percent(used, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(total)
+}
+
+// Percentage of the read storage area in use
+func (self StorageInfo) ReadPercent() float64 {
+	return percent(self.UsedRead, self.TotalRead)
+}
+
+// Percentage of the write storage area in use
+func (self StorageInfo) WritePercent() float64 {
+	return percent(self.UsedWrite, self.TotalWrite)
+}
+
+// Percentage of the receive storage area in use
+func (self StorageInfo) ReceivePercent() float64 {
+	return percent(self.UsedReceive, self.TotalReceive)
 }
 
 // +CMGL
@@ -53,8 +369,35 @@ type MessageList []Message
 // Simple OK response
 type OK struct{}
 
-// Simple ERROR response
-type ERROR struct{}
+// ERROR, +CMS ERROR or +CME ERROR response
+type ERROR struct {
+	// "+CMS ERROR" or "+CME ERROR" and the error code, empty for ERROR
+	Type string
+	Code int
+}
+
+func (self ERROR) Error() string {
+	if self.Type == "" {
+		return "Response was ERROR"
+	}
+	return fmt.Sprintf("Response was %s: %d", self.Type, self.Code)
+}
+
+// Final result code from FinalResults, such as "NO CARRIER" for a dial
+type FinalResult struct {
+	Code string
+}
+
+// A response larger than the parser's MaxSize, which was discarded
+type ResponseOverflowError struct {
+	// bytes discarded
+	Size  int
+	Limit int
+}
+
+func (self ResponseOverflowError) Error() string {
+	return fmt.Sprintf("Response of %d bytes exceeded limit of %d", self.Size, self.Limit)
+}
 
 // Unknown
 type UnknownPacket struct {
@@ -0,0 +1,67 @@
+package gogsmmodem
+
+import "context"
+
+// Paged listing yields to other commands
+var pageContext = WithPriority(context.Background(), PriorityLow)
+
+// ListMessagesPage reads stored messages one slot at a time, starting at
+// index start, and returns up to count messages matching filter ("ALL",
+// "REC UNREAD", etc.) along with the index to resume from, or -1 when the
+// end of storage is reached.
+//
+// Unlike ListMessages, the modem is only held for a single slot at a time so
+// other commands and unsolicited results are handled in between. As with
+// GetMessage, reading an unread message marks it as read.
+func (self *Modem) ListMessagesPage(filter string, start, count int) (*MessageList, int, error) {
+	info, err := self.StorageUsage()
+	if err != nil {
+		return nil, -1, err
+	}
+	res := MessageList{}
+	i := start
+	for ; i <= info.TotalRead && len(res) < count; i++ {
+		msg, err := self.GetMessageContext(pageContext, i)
+		if emptySlot(err) {
+			continue
+		}
+		if err != nil {
+			return nil, -1, err
+		}
+		if filter != "ALL" && msg.Status != filter {
+			continue
+		}
+		res = append(res, *msg)
+	}
+	if i > info.TotalRead {
+		i = -1
+	}
+	return &res, i, nil
+}
+
+// Is the error that of reading an empty storage slot, which modems answer
+// with no message or "+CMS ERROR: 321" (invalid memory index)
+func emptySlot(err error) bool {
+	return err == ErrMessageNotFound || err == ERROR{"+CMS ERROR", 321}
+}
+
+// WalkMessages calls f with each stored message matching filter, reading
+// pageSize messages at a time with ListMessagesPage. Walking stops at the
+// first error returned by f.
+func (self *Modem) WalkMessages(filter string, pageSize int, f func(Message) error) error {
+	next := 0
+	for next != -1 {
+		var page *MessageList
+		var err error
+		page, next, err = self.ListMessagesPage(filter, next, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, msg := range *page {
+			if err := f(msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
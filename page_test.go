@@ -0,0 +1,65 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var pageReplay = []string{
+	"->AT+CPMS?\r\n",
+	"<-\r\n+CPMS: \"SM\",2,3,\"SM\",2,3,\"SM\",2,3\r\n\r\nOK\r\n",
+	"->AT+CMGR=1\r\n",
+	"<-\r\n+CMGR: \"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\"\r\nOne\r\n\r\nOK\r\n",
+	"->AT+CPMS?\r\n",
+	"<-\r\n+CPMS: \"SM\",2,3,\"SM\",2,3,\"SM\",2,3\r\n\r\nOK\r\n",
+	"->AT+CMGR=2\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CMGR=3\r\n",
+	"<-\r\n+CMGR: \"REC UNREAD\",\"+441234567890\",,\"14/02/01,15:07:43+00\"\r\nTwo\r\n\r\nOK\r\n",
+}
+
+func TestListMessagesPage(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, pageReplay)), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	page, next, err := modem.ListMessagesPage("ALL", 1, 1)
+	if err != nil || len(*page) != 1 || (*page)[0].Body != "One" || (*page)[0].Index != 1 || next != 2 {
+		t.Errorf("Unexpected first page: %#v %d %v", page, next, err)
+	}
+	page, next, err = modem.ListMessagesPage("ALL", next, 1)
+	if err != nil || len(*page) != 1 || (*page)[0].Body != "Two" || (*page)[0].Index != 3 || next != -1 {
+		t.Errorf("Unexpected second page: %#v %d %v", page, next, err)
+	}
+	modem.Close()
+}
+
+func TestListMessagesPageErrors(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, []string{
+			"->AT+CPMS?\r\n",
+			"<-\r\n+CPMS: \"SM\",1,3,\"SM\",1,3,\"SM\",1,3\r\n\r\nOK\r\n",
+			"->AT+CMGR=1\r\n",
+			"<-\r\n+CMS ERROR: 321\r\n",
+			"->AT+CMGR=2\r\n",
+			"<-\r\n+CMS ERROR: 310\r\n",
+		})), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer modem.Close()
+
+	// an empty slot is skipped, other errors end the listing
+	_, _, err = modem.ListMessagesPage("ALL", 1, 2)
+	if err != (ERROR{"+CMS ERROR", 310}) {
+		t.Error("Expected: SIM not inserted error, got:", err)
+	}
+}
@@ -0,0 +1,121 @@
+package pdu
+
+import "errors"
+
+const esc = 0x1b
+
+// GSM 03.38 default alphabet
+var gsm7Alphabet = [128]rune{
+	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì', 'ò', 'Ç', '\n', 'Ø', 'ø', '\r', 'Å', 'å',
+	'Δ', '_', 'Φ', 'Γ', 'Λ', 'Ω', 'Π', 'Ψ', 'Σ', 'Θ', 'Ξ', esc, 'Æ', 'æ', 'ß', 'É',
+	' ', '!', '"', '#', '¤', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§',
+	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à',
+}
+
+// GSM 03.38 extension table, following an escape
+var gsm7Extension = map[byte]rune{
+	0x0a: '\f',
+	0x14: '^',
+	0x28: '{',
+	0x29: '}',
+	0x2f: '\\',
+	0x3c: '[',
+	0x3d: '~',
+	0x3e: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+var gsm7Reverse = map[rune][]byte{}
+
+func init() {
+	for i, r := range gsm7Alphabet {
+		if i != esc {
+			gsm7Reverse[r] = []byte{byte(i)}
+		}
+	}
+	for b, r := range gsm7Extension {
+		gsm7Reverse[r] = []byte{esc, b}
+	}
+}
+
+var errNotGSM7 = errors.New("Text is not encodable in the GSM 7-bit alphabet")
+
+// Encode text to GSM 7-bit septets, one per byte.
+func encodeGSM7(text string) ([]byte, error) {
+	var ret []byte
+	for _, r := range text {
+		s, ok := gsm7Reverse[r]
+		if !ok {
+			return nil, errNotGSM7
+		}
+		ret = append(ret, s...)
+	}
+	return ret, nil
+}
+
+// IsGSM7 reports whether text can be encoded in the GSM 7-bit alphabet.
+func IsGSM7(text string) bool {
+	_, err := encodeGSM7(text)
+	return err == nil
+}
+
+// Decode GSM 7-bit septets, one per byte.
+func decodeGSM7(septets []byte) string {
+	var ret []rune
+	for i := 0; i < len(septets); i++ {
+		s := septets[i] & 0x7f
+		if s == esc && i+1 < len(septets) {
+			i++
+			if r, ok := gsm7Extension[septets[i]]; ok {
+				ret = append(ret, r)
+			} else {
+				// unknown extension, use the default character
+				ret = append(ret, gsm7Alphabet[septets[i]&0x7f])
+			}
+			continue
+		}
+		ret = append(ret, gsm7Alphabet[s])
+	}
+	return string(ret)
+}
+
+// Pack septets into octets, after fill bits of padding.
+func pack7(septets []byte, fill uint) []byte {
+	bits := fill + uint(len(septets))*7
+	ret := make([]byte, (bits+7)/8)
+	pos := fill
+	for _, s := range septets {
+		s &= 0x7f
+		i, shift := pos/8, pos%8
+		ret[i] |= s << shift
+		if shift > 1 {
+			ret[i+1] |= s >> (8 - shift)
+		}
+		pos += 7
+	}
+	return ret
+}
+
+// Unpack n septets from octets, skipping fill bits of padding.
+func unpack7(octets []byte, n int, fill uint) []byte {
+	ret := make([]byte, 0, n)
+	pos := fill
+	for len(ret) < n {
+		i, shift := pos/8, pos%8
+		if int(i) >= len(octets) {
+			break
+		}
+		s := octets[i] >> shift
+		if shift > 1 && int(i+1) < len(octets) {
+			s |= octets[i+1] << (8 - shift)
+		}
+		ret = append(ret, s&0x7f)
+		pos += 7
+	}
+	return ret
+}
@@ -0,0 +1,485 @@
+// Package pdu encodes and decodes SMS messages in PDU format, as used by
+// modems in PDU mode (AT+CMGF=0).
+package pdu
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Message types, from the TP-MTI bits of the first octet
+const (
+	Deliver      = 0
+	Submit       = 1
+	StatusReport = 2
+)
+
+// Data coding alphabets
+const (
+	AlphabetGSM7 = 0
+	Alphabet8Bit = 1
+	AlphabetUCS2 = 2
+)
+
+// Type-of-address values
+const (
+	TypeUnknown       = 0x81
+	TypeInternational = 0x91
+	TypeAlphanumeric  = 0xd0
+)
+
+// A decoded SMS-DELIVER, SMS-SUBMIT or SMS-STATUS-REPORT
+type Message struct {
+	Type int
+	SMSC string
+	// Originator of an SMS-DELIVER, or destination of an SMS-SUBMIT or the
+	// message a status report is for
+	Address   string
+	Timestamp time.Time
+	// Message reference of an SMS-SUBMIT, or of the message a status report
+	// is for
+	Reference byte
+	// Time a status report's message was delivered or last attempted, and
+	// its status (TP-ST), 0 for delivered
+	Discharged time.Time
+	Status     byte
+	PID        byte
+	DCS        byte
+	UDH        []byte
+	Text       string
+	// User data of 8-bit messages
+	Data []byte
+}
+
+var errTruncated = errors.New("PDU truncated")
+
+// Encode a telephone number as length, type-of-address and semi-octets.
+func encodeAddress(number string) ([]byte, error) {
+	toa := byte(TypeUnknown)
+	if strings.HasPrefix(number, "+") {
+		toa = TypeInternational
+		number = number[1:]
+	}
+	digits, err := semiOctets(number)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(len(number)), toa}, digits...), nil
+}
+
+func semiOctets(number string) ([]byte, error) {
+	var ret []byte
+	for i := 0; i < len(number); i += 2 {
+		lo, err := semiOctet(number[i])
+		if err != nil {
+			return nil, err
+		}
+		hi := byte(0xf)
+		if i+1 < len(number) {
+			if hi, err = semiOctet(number[i+1]); err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, hi<<4|lo)
+	}
+	return ret, nil
+}
+
+func semiOctet(c byte) (byte, error) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', nil
+	case c == '*':
+		return 0xa, nil
+	case c == '#':
+		return 0xb, nil
+	}
+	return 0, fmt.Errorf("Invalid character in number: %q", c)
+}
+
+func decodeSemiOctets(b []byte, digits int) string {
+	const chars = "0123456789*#abc"
+	ret := make([]byte, 0, digits)
+	for _, o := range b {
+		for _, n := range []byte{o & 0xf, o >> 4} {
+			if len(ret) < digits && n != 0xf {
+				ret = append(ret, chars[n])
+			}
+		}
+	}
+	return string(ret)
+}
+
+// Decode an address given the type-of-address and semi-octets.
+func decodeAddress(toa byte, b []byte, digits int) string {
+	if toa&0x70 == 0x50 {
+		// alphanumeric, packed GSM 7-bit
+		return decodeGSM7(unpack7(b, digits*4/7, 0))
+	}
+	number := decodeSemiOctets(b, digits)
+	if toa&0x70 == 0x10 {
+		number = "+" + number
+	}
+	return number
+}
+
+// An SMS-SUBMIT to encode with Encode
+type SMSSubmit struct {
+	// Service centre, or empty for the modem's default
+	SMSC string
+	// Destination number, international if it starts with +
+	Address string
+	// Message reference, zero to have the modem assign one
+	Reference byte
+	// Protocol identifier, zero for plain SMS
+	PID byte
+	// Alphabet of the user data, AlphabetGSM7 for Text, AlphabetUCS2 for
+	// Text, or Alphabet8Bit for Data
+	Alphabet int
+	// Relative validity period, rounded up to a representable value, or
+	// zero for 4 days
+	Validity time.Duration
+	// Request a status report
+	StatusReport bool
+	// User data header, eg from AppendElement, or empty
+	UDH  []byte
+	Text string
+	Data []byte
+}
+
+// Encode an SMS-SUBMIT for a single segment. It returns the hex PDU and the
+// TPDU length for AT+CMGS.
+func Encode(s SMSSubmit) (string, int, error) {
+	smsc := []byte{0x00}
+	if s.SMSC != "" {
+		addr, err := encodeAddress(s.SMSC)
+		if err != nil {
+			return "", 0, err
+		}
+		// length in octets rather than digits
+		smsc = append([]byte{byte(len(addr) - 1)}, addr[1:]...)
+	}
+	da, err := encodeAddress(s.Address)
+	if err != nil {
+		return "", 0, err
+	}
+	// SMS-SUBMIT with relative validity period
+	fo := byte(0x11)
+	if s.StatusReport {
+		fo |= 0x20
+	}
+	header := []byte(nil)
+	if len(s.UDH) > 0 {
+		// user data header indicator
+		fo |= 0x40
+		header = append([]byte{byte(len(s.UDH))}, s.UDH...)
+	}
+
+	var dcs, udl byte
+	var ud []byte
+	switch s.Alphabet {
+	case AlphabetGSM7:
+		septets, err := encodeGSM7(s.Text)
+		if err != nil {
+			return "", 0, err
+		}
+		// the header is padded to a septet boundary
+		skip := (len(header)*8 + 6) / 7
+		if skip+len(septets) > 160 {
+			return "", 0, errors.New("Message too long for a single segment")
+		}
+		udl = byte(skip + len(septets))
+		ud = append(header, pack7(septets, uint(skip*7-len(header)*8))...)
+	case AlphabetUCS2:
+		dcs = 0x08
+		ud = append(header, encodeUCS2(s.Text)...)
+	case Alphabet8Bit:
+		dcs = 0x04
+		ud = append(header, s.Data...)
+	default:
+		return "", 0, fmt.Errorf("Unsupported alphabet: %d", s.Alphabet)
+	}
+	if s.Alphabet != AlphabetGSM7 {
+		if len(ud) > 140 {
+			return "", 0, errors.New("Message too long for a single segment")
+		}
+		udl = byte(len(ud))
+	}
+
+	tpdu := []byte{fo, s.Reference}
+	tpdu = append(tpdu, da...)
+	tpdu = append(tpdu, s.PID, dcs, validityPeriod(s.Validity), udl)
+	tpdu = append(tpdu, ud...)
+	pdu := append(smsc, tpdu...)
+	return strings.ToUpper(hex.EncodeToString(pdu)), len(tpdu), nil
+}
+
+// The relative validity period octet for d, rounded up
+func validityPeriod(d time.Duration) byte {
+	const day = 24 * time.Hour
+	ceil := func(d, unit time.Duration) int {
+		return int((d + unit - 1) / unit)
+	}
+	switch {
+	case d <= 0:
+		return 0xaa
+	case d <= 12*time.Hour:
+		return byte(ceil(d, 5*time.Minute) - 1)
+	case d <= day:
+		return byte(143 + ceil(d-12*time.Hour, 30*time.Minute))
+	case d <= 30*day:
+		return byte(166 + ceil(d, day))
+	case d <= 63*7*day:
+		return byte(192 + ceil(d, 7*day))
+	}
+	return 0xff
+}
+
+// EncodeSubmit builds an SMS-SUBMIT for a single segment message, using UCS2
+// if ucs2 is set or the text is not encodable in the GSM 7-bit alphabet. The
+// modem's default SMSC is used. It returns the hex PDU and the TPDU length for
+// AT+CMGS.
+func EncodeSubmit(number, text string, ucs2 bool) (string, int, error) {
+	s := SMSSubmit{Address: number, Text: text}
+	if ucs2 || !IsGSM7(text) {
+		s.Alphabet = AlphabetUCS2
+	}
+	return Encode(s)
+}
+
+// EncodeSubmitData builds an SMS-SUBMIT for a single segment of 8-bit data
+// with a user data header of information elements, eg from AppendElement,
+// which may be empty. It returns the hex PDU and the TPDU length for
+// AT+CMGS.
+func EncodeSubmitData(number string, udh, data []byte) (string, int, error) {
+	return Encode(SMSSubmit{Address: number, UDH: udh, Data: data, Alphabet: Alphabet8Bit})
+}
+
+// Split text into the parts of a concatenated message, each fitting a segment
+// after the concatenation header, or into one part if it fits a single
+// segment. Parts are counted in UCS2 if ucs2 is set or the text is not
+// encodable in the GSM 7-bit alphabet, and never split an escaped character
+// or surrogate pair.
+func Split(text string, ucs2 bool) []string {
+	gsm := !ucs2 && IsGSM7(text)
+	single, multi := 160, 153
+	if !gsm {
+		single, multi = 70, 67
+	}
+	size := func(r rune) int {
+		switch {
+		case gsm:
+			return len(gsm7Reverse[r])
+		case r >= 0x10000:
+			return 2
+		}
+		return 1
+	}
+	n := 0
+	for _, r := range text {
+		n += size(r)
+	}
+	if n <= single {
+		return []string{text}
+	}
+	var parts []string
+	start, n := 0, 0
+	for i, r := range text {
+		if n+size(r) > multi {
+			parts = append(parts, text[start:i])
+			start, n = i, 0
+		}
+		n += size(r)
+	}
+	return append(parts, text[start:])
+}
+
+// AppendElement appends an information element to a user data header.
+func AppendElement(udh []byte, iei byte, data []byte) []byte {
+	return append(append(udh, iei, byte(len(data))), data...)
+}
+
+// Element returns the data of the first information element iei in the user
+// data header, or nil if there is none.
+func (self *Message) Element(iei byte) []byte {
+	for udh := self.UDH; len(udh) >= 2; {
+		n := int(udh[1])
+		if 2+n > len(udh) {
+			return nil
+		}
+		if udh[0] == iei {
+			return udh[2 : 2+n]
+		}
+		udh = udh[2+n:]
+	}
+	return nil
+}
+
+func encodeUCS2(text string) []byte {
+	var ret []byte
+	for _, c := range utf16.Encode([]rune(text)) {
+		ret = append(ret, byte(c>>8), byte(c))
+	}
+	return ret
+}
+
+func decodeUCS2(b []byte) string {
+	codes := make([]uint16, len(b)/2)
+	for i := range codes {
+		codes[i] = uint16(b[i*2])<<8 | uint16(b[i*2+1])
+	}
+	return string(utf16.Decode(codes))
+}
+
+// The alphabet indicated by a data coding scheme
+func alphabet(dcs byte) int {
+	switch {
+	case dcs&0xc0 == 0x00:
+		// general data coding
+		switch (dcs >> 2) & 3 {
+		case 1:
+			return Alphabet8Bit
+		case 2:
+			return AlphabetUCS2
+		}
+	case dcs&0xf0 == 0xe0:
+		return AlphabetUCS2
+	case dcs&0xf0 == 0xf0:
+		if dcs&0x04 != 0 {
+			return Alphabet8Bit
+		}
+	}
+	return AlphabetGSM7
+}
+
+func decodeTimestamp(b []byte) time.Time {
+	d := func(o byte) int {
+		return int(o&0xf)*10 + int(o>>4)
+	}
+	tz := int(b[6]&0x07)*10 + int(b[6]>>4)
+	offset := tz * 15 * 60
+	if b[6]&0x08 != 0 {
+		offset = -offset
+	}
+	loc := time.UTC
+	if offset != 0 {
+		loc = time.FixedZone("", offset)
+	}
+	year := 2000 + d(b[0])
+	if year >= 2070 {
+		year -= 100
+	}
+	return time.Date(year, time.Month(d(b[1])), d(b[2]), d(b[3]), d(b[4]), d(b[5]), 0, loc)
+}
+
+// A reader over PDU octets
+type reader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (self *reader) next(n int) []byte {
+	if self.err != nil || self.pos+n > len(self.b) {
+		self.err = errTruncated
+		return make([]byte, n)
+	}
+	ret := self.b[self.pos : self.pos+n]
+	self.pos += n
+	return ret
+}
+
+func (self *reader) byte() byte {
+	return self.next(1)[0]
+}
+
+// Decode a hex PDU, including the leading SMSC information, as returned by
+// AT+CMGR and AT+CMGL in PDU mode.
+func Decode(s string) (*Message, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{b: b}
+	msg := &Message{}
+	if n := int(r.byte()); n > 0 {
+		smsc := r.next(n)
+		msg.SMSC = decodeAddress(smsc[0], smsc[1:], (n-1)*2)
+	}
+	fo := r.byte()
+	msg.Type = int(fo & 3)
+	switch msg.Type {
+	case Deliver:
+	case Submit, StatusReport:
+		msg.Reference = r.byte()
+	default:
+		return nil, fmt.Errorf("Unsupported message type: %d", msg.Type)
+	}
+	digits := int(r.byte())
+	toa := r.byte()
+	msg.Address = decodeAddress(toa, r.next((digits+1)/2), digits)
+	if msg.Type == StatusReport {
+		msg.Timestamp = decodeTimestamp(r.next(7))
+		msg.Discharged = decodeTimestamp(r.next(7))
+		msg.Status = r.byte()
+		if r.err != nil {
+			return nil, r.err
+		}
+		return msg, nil
+	}
+	msg.PID = r.byte()
+	msg.DCS = r.byte()
+	if msg.Type == Deliver {
+		msg.Timestamp = decodeTimestamp(r.next(7))
+	} else {
+		switch (fo >> 3) & 3 {
+		case 2:
+			r.next(1)
+		case 1, 3:
+			r.next(7)
+		}
+	}
+	udl := int(r.byte())
+	ud := r.b[r.pos:]
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	headerLen := 0
+	if fo&0x40 != 0 && len(ud) > 0 {
+		headerLen = int(ud[0]) + 1
+		if headerLen > len(ud) {
+			return nil, errTruncated
+		}
+		msg.UDH = ud[1:headerLen]
+	}
+	switch alphabet(msg.DCS) {
+	case AlphabetGSM7:
+		fill := uint(0)
+		skip := 0
+		if headerLen > 0 {
+			skip = (headerLen*8 + 6) / 7
+			fill = uint(skip*7 - headerLen*8)
+		}
+		// the header is counted in the length, so must fit within it
+		if udl < skip || len(ud)*8 < (udl*7) {
+			return nil, errTruncated
+		}
+		msg.Text = decodeGSM7(unpack7(ud[headerLen:], udl-skip, fill))
+	case AlphabetUCS2:
+		if headerLen > udl || udl > len(ud) {
+			return nil, errTruncated
+		}
+		msg.Text = decodeUCS2(ud[headerLen:udl])
+	default:
+		if headerLen > udl || udl > len(ud) {
+			return nil, errTruncated
+		}
+		msg.Data = ud[headerLen:udl]
+	}
+	return msg, nil
+}
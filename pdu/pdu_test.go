@@ -0,0 +1,172 @@
+package pdu
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeSubmit(t *testing.T) {
+	tests := []struct {
+		number, text string
+		pdu          string
+		length       int
+	}{
+		{"+46708251358", "hellohello", "0011000B916407281553F80000AA0AE8329BFD4697D9EC37", 23},
+		{"07700900123", "@{", "0011000B817007900021F30000AA03800D0A", 17},
+		{"+44123", "日本", "00110005914421F30008AA0465E5672C", 15},
+	}
+	for _, test := range tests {
+		pdu, length, err := EncodeSubmit(test.number, test.text, false)
+		if err != nil {
+			t.Error("Expected: no error, got:", err)
+		}
+		if pdu != test.pdu || length != test.length {
+			t.Errorf("Expected: %s %d, got %s %d", test.pdu, test.length, pdu, length)
+		}
+	}
+}
+
+func TestDecodeDeliver(t *testing.T) {
+	msg, err := Decode("07917283010010F5040BC87238880900F10000993092516195800AE8329BFD4697D9EC37")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if msg.Type != Deliver || msg.SMSC != "+27381000015" || msg.Address != "27838890001" || msg.Text != "hellohello" {
+		t.Errorf("Unexpected message: %#v", msg)
+	}
+	expected := time.Date(1999, 3, 29, 15, 16, 59, 0, time.FixedZone("", 2*60*60))
+	if !msg.Timestamp.Equal(expected) {
+		t.Errorf("Expected: %v, got %v", expected, msg.Timestamp)
+	}
+}
+
+func TestDecodeAlphanumericUCS2(t *testing.T) {
+	msg, err := Decode("0791447779070652040ED0D637396C7EBBCB0008710141519050000C041F04400438043204350442")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if msg.Address != "Vodafone" || msg.Text != "Привет" {
+		t.Errorf("Unexpected message: %#v", msg)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, text := range []string{"", "a", "1234567", "12345678", "Hello [world] €5", "日本語", "£$¥èéùìòÇØøÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ!\"#¤%&'()*+,-./:;<=>?¡ÄÖÑÜ§¿äöñüà^{}\\[~]|"} {
+		pdu, _, err := EncodeSubmit("+441234567890", text, false)
+		if err != nil {
+			t.Fatal("Expected: no error, got:", err)
+		}
+		msg, err := Decode(pdu)
+		if err != nil {
+			t.Fatal("Expected: no error, got:", err)
+		}
+		if msg.Type != Submit || msg.Address != "+441234567890" || msg.Text != text {
+			t.Errorf("Expected: %q, got %#v", text, msg)
+		}
+	}
+}
+
+func TestSubmitDataRoundTrip(t *testing.T) {
+	udh := AppendElement(AppendElement(nil, 0x05, []byte{0x0b, 0x84, 0x23, 0xf0}), 0x80, []byte{1})
+	pdu, length, err := EncodeSubmitData("+441234567890", udh, []byte{0xde, 0xad})
+	if err != nil || pdu != "0051000C914421436587090004AA0C0905040B8423F0800101DEAD" || length != 26 {
+		t.Errorf("Unexpected PDU: %s %d %v", pdu, length, err)
+	}
+	msg, err := Decode(pdu)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if string(msg.Data) != "\xde\xad" || string(msg.Element(0x80)) != "\x01" || msg.Element(0x00) != nil {
+		t.Errorf("Unexpected message: %#v", msg)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	if _, err := Decode("07917283010010F5040BC87238880900F10000993092516195800AE8329B"); err == nil {
+		t.Error("Expected: error")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	// deliver with a user data header, from 27838890001
+	const prefix = "00440BC87238880900F1"
+	tests := []struct {
+		name string
+		pdu  string
+	}{
+		{"header longer than GSM 7 bit user data", prefix + "000099309251619580020500032A0201AAAAAA"},
+		{"header longer than 8 bit user data", prefix + "000499309251619580030500032A0201AA"},
+		{"header longer than UCS2 user data", prefix + "000899309251619580040500032A02010041"},
+		{"header longer than message", prefix + "000499309251619580030A0003"},
+	}
+	for _, test := range tests {
+		if _, err := Decode(test.pdu); err != errTruncated {
+			t.Errorf("%s: expected: %v, got: %v", test.name, errTruncated, err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	udh := AppendElement(nil, 0x00, []byte{0x2a, 0x02, 0x01})
+	pdu, length, err := Encode(SMSSubmit{SMSC: "+447785016005", Address: "+441234567890", Reference: 7, Validity: time.Hour, StatusReport: true, UDH: udh, Text: "Hi"})
+	if err != nil || length != 22 {
+		t.Fatalf("Unexpected PDU: %s %d %v", pdu, length, err)
+	}
+	msg, err := Decode(pdu)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if msg.SMSC != "+447785016005" || msg.Address != "+441234567890" || msg.Reference != 7 || msg.Text != "Hi" || string(msg.Element(0x00)) != "\x2a\x02\x01" {
+		t.Errorf("Unexpected message: %#v", msg)
+	}
+	if _, _, err := Encode(SMSSubmit{Address: "+441234567890", Text: "日本"}); err == nil {
+		t.Error("Expected: error encoding UCS2 text in GSM 7-bit")
+	}
+}
+
+func TestValidityPeriod(t *testing.T) {
+	for d, expected := range map[time.Duration]byte{
+		0:                      0xaa,
+		time.Hour:              11,
+		13 * time.Hour:         145,
+		3 * 24 * time.Hour:     169,
+		5 * 7 * 24 * time.Hour: 197,
+		1000 * 24 * time.Hour:  0xff,
+	} {
+		if vp := validityPeriod(d); vp != expected {
+			t.Errorf("Expected: %d for %v, got %d", expected, d, vp)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	long := strings.Repeat("x", 152) + "€0123456789"
+	tests := []struct {
+		text  string
+		ucs2  bool
+		parts []string
+	}{
+		{strings.Repeat("x", 160), false, []string{strings.Repeat("x", 160)}},
+		// the escaped € is not split
+		{long, false, []string{strings.Repeat("x", 152), "€0123456789"}},
+		{strings.Repeat("x", 71), true, []string{strings.Repeat("x", 67), "xxxx"}},
+	}
+	for _, test := range tests {
+		if parts := Split(test.text, test.ucs2); !reflect.DeepEqual(parts, test.parts) {
+			t.Errorf("Expected: %q, got %q", test.parts, parts)
+		}
+	}
+}
+
+func TestDecodeStatusReport(t *testing.T) {
+	msg, err := Decode("00062A0C91442143658709412010517034004120105170540000")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	discharged := time.Date(2014, 2, 1, 15, 7, 45, 0, time.UTC)
+	if msg.Type != StatusReport || msg.Reference != 42 || msg.Address != "+441234567890" || !msg.Discharged.Equal(discharged) || msg.Status != 0 {
+		t.Errorf("Unexpected message: %#v", msg)
+	}
+}
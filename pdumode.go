@@ -0,0 +1,89 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+)
+
+// Text mode names of the numeric message status used in PDU mode
+var messageStatuses = []string{"REC UNREAD", "REC READ", "STO UNSENT", "STO SENT", "ALL"}
+
+// The text mode name for a message status, which is numeric in PDU mode
+func messageStatus(stat interface{}) string {
+	if n, ok := stat.(int); ok && n >= 0 && n < len(messageStatuses) {
+		return messageStatuses[n]
+	}
+	return fmt.Sprint(stat)
+}
+
+// The numeric PDU mode status for a text mode status filter, eg 4 for "ALL"
+func pduStat(filter string) interface{} {
+	for i, status := range messageStatuses {
+		if status == filter {
+			return i
+		}
+	}
+	return filter
+}
+
+var reHex = regexp.MustCompile(`^([0-9A-Fa-f]{2})+$`)
+
+// Was the message read in PDU mode, with the hex PDU as its body
+func isPDUMessage(msg Message) bool {
+	return msg.Telephone == "" && reHex.MatchString(msg.Body)
+}
+
+// A PDU read in PDU mode shorter than the length the modem gave for it, as
+// when the read was truncated
+type PDULengthError struct {
+	// Index of the message for +CMGL
+	Index int
+	// TPDU length given by the modem, and octets of TPDU read
+	Length int
+	Octets int
+	// the final packet of the response
+	last bool
+}
+
+func (self PDULengthError) Error() string {
+	return fmt.Sprintf("PDU truncated: %d of %d octets", self.Octets, self.Length)
+}
+
+// Check a hex PDU against the TPDU length from its +CMGR or +CMGL header,
+// returning it with an SMSC prefix: the modem's if it sent one, otherwise
+// "00" for the default SMSC. A length of 0 is not checked.
+func checkPDULength(body string, length int) (string, *PDULengthError) {
+	if length == 0 || !reHex.MatchString(body) {
+		return body, nil
+	}
+	octets := len(body) / 2
+	if octets == length {
+		// no SMSC prefix
+		return "00" + body, nil
+	}
+	smsc, _ := strconv.ParseUint(body[:2], 16, 8)
+	if tpdu := octets - 1 - int(smsc); tpdu < length {
+		return body, &PDULengthError{Length: length, Octets: tpdu}
+	}
+	return body, nil
+}
+
+// Fill in a message read in PDU mode from its PDU
+func decodePDUMessage(msg Message) (*Message, error) {
+	p, err := pdu.Decode(msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	msg.Telephone = p.Address
+	msg.Timestamp = p.Timestamp
+	msg.Body = p.Text
+	msg.Part = decodeMessagePart(p)
+	if p.Data != nil {
+		msg.Body, msg.Compressed = decompressBody(p)
+		msg.Chunk = decodeBlobChunk(p)
+	}
+	return &msg, nil
+}
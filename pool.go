@@ -0,0 +1,536 @@
+package gogsmmodem
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Modems opened at once by OpenPool if PoolOptions.Parallelism is 0
+var DefaultPoolParallelism = 4
+
+// Stages of opening a modem in a Pool
+const (
+	PoolOpening = iota
+	PoolOpened
+	PoolFailed
+)
+
+// Progress opening one of a Pool's modems, see PoolOptions.Status
+type PoolStatus struct {
+	Port  string
+	Stage int
+	// Why the modem failed to open
+	Err error
+	// Time taken to open or fail
+	Elapsed time.Duration
+}
+
+type PoolOptions struct {
+	// Options for each modem
+	Options Options
+	// Modems opened at once, DefaultPoolParallelism if 0
+	Parallelism int
+	// Conversations idle for longer than this are forgotten, so the next
+	// message may be sent by any modem. 0 remembers them until the pool is
+	// closed.
+	ConversationTimeout time.Duration
+	// Ports of modems kept on standby: opened, but only routed to in place
+	// of active modems which failed to open or are down. See Pool.Maintain
+	// for keeping them health checked.
+	Standby []string
+	// Chooses the modem for messages not in conversation, see Router. By
+	// default they are spread over the modems by health.
+	Router Router
+	// Stop routing to modems whose SIM is suspected blocked, see
+	// Modem.SuspectedBlocked, until reinstated with Pool.Reinstate. A
+	// standby modem takes the place of each retired.
+	RetireBlocked bool
+	// Called as each modem starts opening and when it opens or fails, from
+	// the goroutine opening it
+	Status func(PoolStatus)
+}
+
+// The SIM in one of a Pool's modems, see SendFrom
+type Identity struct {
+	Port string
+	// Own number of the SIM, "" if unknown
+	MSISDN string
+	ICCID  string
+	// IMSI of the SIM, and the operator it was registered with when opened
+	IMSI     string
+	Operator string
+}
+
+// Chooses the port of the modem to send a message to telephone by from those
+// available, eg by comparing the number's network with the SIMs' operators.
+// Returning "" leaves the choice to the Pool.
+type Router func(telephone string, available []Identity) string
+
+// A bank of modems opened together, see OpenPool.
+type Pool struct {
+	lock       sync.Mutex
+	ports      []string
+	modems     map[string]*Modem
+	errors     map[string]error
+	identities map[string]Identity
+	// port of the modem in conversation with each number
+	routes  map[string]route
+	timeout time.Duration
+	router  Router
+	health  map[string]*health
+	standby map[string]bool
+	// ports retired for blocked SIMs, see PoolOptions.RetireBlocked
+	retireBlocked bool
+	retired       map[string]bool
+	// sends handed to each modem, see Remove
+	sends map[string]*sends
+	// for modems added, see Add
+	options Options
+	status  func(PoolStatus)
+	// merged stream of received messages, see Incoming
+	incoming  chan PoolMessage
+	receiving map[*Modem]bool
+	receivers sync.WaitGroup
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// The modem a conversation is routed through, and when it was last used
+type route struct {
+	port string
+	at   time.Time
+}
+
+var ErrNoModems = errors.New("No modems available in pool")
+var ErrUnknownIdentity = errors.New("No SIM in pool with that identity")
+var ErrIdentityUnavailable = errors.New("Modem for identity unavailable")
+var ErrNotRetired = errors.New("Modem not retired")
+
+// OpenPool opens the modems on the ports given concurrently, at most
+// opts.Parallelism at a time, returning once all have opened or failed.
+// Modems which fail to open are left out of the pool, with the reason
+// reported by Errors.
+func OpenPool(configs []*serial.Config, opts PoolOptions) *Pool {
+	pool := &Pool{
+		modems:        map[string]*Modem{},
+		errors:        map[string]error{},
+		identities:    map[string]Identity{},
+		routes:        map[string]route{},
+		timeout:       opts.ConversationTimeout,
+		router:        opts.Router,
+		health:        map[string]*health{},
+		standby:       map[string]bool{},
+		retired:       map[string]bool{},
+		retireBlocked: opts.RetireBlocked,
+		sends:         map[string]*sends{},
+		closing:       make(chan struct{}),
+		options:       opts.Options,
+		status:        opts.Status,
+	}
+	for _, port := range opts.Standby {
+		pool.standby[port] = true
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultPoolParallelism
+	}
+	if pool.status == nil {
+		pool.status = func(PoolStatus) {}
+	}
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for _, config := range configs {
+		pool.ports = append(pool.ports, config.Name)
+		wg.Add(1)
+		go func(config *serial.Config) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			pool.open(config)
+		}(config)
+	}
+	wg.Wait()
+	return pool
+}
+
+// Open the modem on a port and add it to the pool, reporting its status
+func (self *Pool) open(config *serial.Config) error {
+	self.status(PoolStatus{Port: config.Name, Stage: PoolOpening})
+	start := DefaultClock.Now()
+	modem, err := OpenWithOptions(config, self.options)
+	var identity Identity
+	if err == nil {
+		identity = identify(config.Name, modem)
+	}
+	elapsed := DefaultClock.Now().Sub(start)
+	self.lock.Lock()
+	if err != nil {
+		self.errors[config.Name] = err
+	} else {
+		delete(self.errors, config.Name)
+		self.modems[config.Name] = modem
+		self.identities[config.Name] = identity
+		self.health[config.Name] = &health{}
+		self.sends[config.Name] = &sends{pending: map[*pendingSend]bool{}}
+	}
+	self.lock.Unlock()
+	if err != nil {
+		self.status(PoolStatus{config.Name, PoolFailed, err, elapsed})
+		return err
+	}
+	self.status(PoolStatus{config.Name, PoolOpened, nil, elapsed})
+	self.receiveFrom(config.Name)
+	return nil
+}
+
+// Modem returns the modem opened on port, or nil if it failed to open.
+func (self *Pool) Modem(port string) *Modem {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.modems[port]
+}
+
+// Modems returns the modems opened, in the order their ports were given.
+func (self *Pool) Modems() []*Modem {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var modems []*Modem
+	for _, port := range self.ports {
+		if modem, ok := self.modems[port]; ok {
+			modems = append(modems, modem)
+		}
+	}
+	return modems
+}
+
+// Errors returns why modems failed to open, by port.
+func (self *Pool) Errors() map[string]error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	errors := map[string]error{}
+	for port, err := range self.errors {
+		errors[port] = err
+	}
+	return errors
+}
+
+// Read the identity of the SIM in a modem. SIMs often don't record their
+// own number, see SetMSISDN.
+func identify(port string, modem *Modem) Identity {
+	identity := Identity{Port: port}
+	var err error
+	if identity.ICCID, err = modem.ICCID(); err != nil {
+		log.Println("Pool: reading ICCID", port, err)
+	}
+	if identity.MSISDN, err = modem.SubscriberNumber(); err != nil {
+		log.Println("Pool: reading own number", port, err)
+	}
+	if identity.IMSI, err = modem.IMSI(); err != nil {
+		log.Println("Pool: reading IMSI", port, err)
+	}
+	if identity.Operator, err = modem.Operator(); err != nil {
+		log.Println("Pool: reading operator", port, err)
+	}
+	return identity
+}
+
+// Identities returns the identities of the SIMs in the pool's modems, in the
+// order their ports were given.
+func (self *Pool) Identities() []Identity {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var identities []Identity
+	for _, port := range self.ports {
+		if identity, ok := self.identities[port]; ok {
+			identities = append(identities, identity)
+		}
+	}
+	return identities
+}
+
+// SetMSISDN records the own number of the SIM on port, for SIMs which don't
+// record it themselves.
+func (self *Pool) SetMSISDN(port, msisdn string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	identity := self.identities[port]
+	identity.Port = port
+	identity.MSISDN = msisdn
+	self.identities[port] = identity
+}
+
+// SendFrom sends a message by the modem whose SIM has the number or ICCID
+// given, so it appears from that number. It fails with ErrUnknownIdentity if
+// no SIM has it, and ErrIdentityUnavailable if its modem failed to open or
+// is down.
+func (self *Pool) SendFrom(identity, telephone, body string) (*SendResult, error) {
+	port, ok := self.lookup(identity)
+	if !ok {
+		return nil, ErrUnknownIdentity
+	}
+	modem := self.Modem(port)
+	if modem == nil || modem.down() {
+		return nil, ErrIdentityUnavailable
+	}
+	ctx, done, ok := self.track(context.Background(), port)
+	if !ok {
+		return nil, ErrIdentityUnavailable
+	}
+	res, err := modem.SendContext(ctx, OutgoingMessage{Telephone: telephone, Body: body})
+	removed := err != nil && ctx.Err() != nil
+	done()
+	if removed {
+		return nil, ErrIdentityUnavailable
+	}
+	self.sent(port, err)
+	if err != nil {
+		return nil, err
+	}
+	self.Converse(telephone, port)
+	return res, nil
+}
+
+// The port of the SIM with the number or ICCID given
+func (self *Pool) lookup(identity string) (string, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for port, id := range self.identities {
+		if identity != "" && (id.MSISDN == identity || id.ICCID == identity) {
+			return port, true
+		}
+	}
+	return "", false
+}
+
+// Send sends a message, returning the port of the modem it was sent by.
+// Messages to a number in conversation go through the modem which last sent
+// to or received from it, so the recipient sees a consistent sender, unless
+// that modem is down. Other messages are spread over the modems in
+// proportion to their health, see HealthWindow.
+func (self *Pool) Send(msg OutgoingMessage) (*SendResult, string, error) {
+	return self.send(context.Background(), msg)
+}
+
+// SendContext is Send with a context for cancelling the send, as for
+// Modem.SendContext.
+func (self *Pool) SendContext(ctx context.Context, msg OutgoingMessage) (*SendResult, error) {
+	res, _, err := self.send(ctx, msg)
+	return res, err
+}
+
+func (self *Pool) send(parent context.Context, msg OutgoingMessage) (*SendResult, string, error) {
+	tried := map[string]bool{}
+	for {
+		port, modem := self.route(msg.Telephone, tried)
+		if modem == nil {
+			return nil, "", ErrNoModems
+		}
+		ctx, done, ok := self.track(parent, port)
+		if !ok {
+			// being removed
+			tried[port] = true
+			continue
+		}
+		res, err := modem.SendContext(ctx, msg)
+		removed := err != nil && ctx.Err() != nil && parent.Err() == nil
+		done()
+		if err != nil && parent.Err() != nil {
+			return nil, port, err
+		}
+		if removed {
+			// reassign a message queued for a modem being removed
+			tried[port] = true
+			continue
+		}
+		self.sent(port, err)
+		if err != nil && modem.down() {
+			// fail over to another modem
+			tried[port] = true
+			continue
+		}
+		if err != nil {
+			return nil, port, err
+		}
+		self.Converse(msg.Telephone, port)
+		return res, port, nil
+	}
+}
+
+// Converse routes later messages to telephone through the modem on port, as
+// when a message is received from it there.
+func (self *Pool) Converse(telephone, port string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.routes[telephone] = route{port, DefaultClock.Now()}
+}
+
+// The modem to send to telephone by, other than those tried: that in
+// conversation with it if up, or else the one chosen by the router, or one
+// chosen by health.
+func (self *Pool) route(telephone string, tried map[string]bool) (string, *Modem) {
+	if port, modem := self.conversation(telephone, tried); modem != nil {
+		return port, modem
+	}
+	if self.router != nil {
+		available := self.available(tried)
+		if len(available) == 0 {
+			return "", nil
+		}
+		if port := self.router(telephone, available); port != "" {
+			for _, identity := range available {
+				if identity.Port == port {
+					return port, self.Modem(port)
+				}
+			}
+			log.Println("Pool: router chose unavailable modem", port)
+		}
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	port := self.weighted(self.routable(tried))
+	return port, self.modems[port]
+}
+
+// Record the outcome of a send by the modem on port
+func (self *Pool) sent(port string, err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if h := self.health[port]; h != nil {
+		h.sent(err)
+	}
+	if modem := self.modems[port]; self.retireBlocked && modem != nil && !self.retired[port] && modem.SuspectedBlocked() {
+		log.Println("Pool: retiring modem with SIM suspected blocked", port)
+		self.retired[port] = true
+	}
+}
+
+// Retired returns the ports of modems retired for blocked SIMs, see
+// PoolOptions.RetireBlocked.
+func (self *Pool) Retired() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ports []string
+	for _, port := range self.ports {
+		if self.retired[port] {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// Reinstate routes to a modem retired for a blocked SIM again, eg once the
+// carrier has lifted the block.
+func (self *Pool) Reinstate(port string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if !self.retired[port] {
+		return ErrNotRetired
+	}
+	delete(self.retired, port)
+	if modem := self.modems[port]; modem != nil {
+		modem.unblocked()
+	}
+	return nil
+}
+
+// The modem in conversation with telephone, if up and not tried
+func (self *Pool) conversation(telephone string, tried map[string]bool) (string, *Modem) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	r, ok := self.routes[telephone]
+	if !ok {
+		return "", nil
+	}
+	if self.timeout > 0 && DefaultClock.Now().Sub(r.at) > self.timeout {
+		delete(self.routes, telephone)
+		return "", nil
+	}
+	if !self.up(r.port, tried) {
+		return "", nil
+	}
+	return r.port, self.modems[r.port]
+}
+
+// The identities of the modems messages may be routed to, in port order
+func (self *Pool) available(tried map[string]bool) []Identity {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var available []Identity
+	for _, port := range self.routable(tried) {
+		available = append(available, self.identities[port])
+	}
+	return available
+}
+
+// The ports messages may be routed to: the active modems up and not tried,
+// and a standby modem in place of each active one which isn't. The caller
+// must hold the lock.
+func (self *Pool) routable(tried map[string]bool) []string {
+	var ports, standby []string
+	failed := 0
+	for _, port := range self.ports {
+		if self.standby[port] {
+			if self.up(port, tried) {
+				standby = append(standby, port)
+			}
+		} else if self.up(port, tried) {
+			ports = append(ports, port)
+		} else {
+			failed++
+		}
+	}
+	if failed > len(standby) {
+		failed = len(standby)
+	}
+	return append(ports, standby[:failed]...)
+}
+
+// Is the modem on port open, up, not retired, not being removed and not
+// tried. The caller must hold the lock.
+func (self *Pool) up(port string, tried map[string]bool) bool {
+	modem := self.modems[port]
+	s := self.sends[port]
+	return modem != nil && !tried[port] && !self.retired[port] && !modem.down() && (s == nil || !s.draining)
+}
+
+// Maintain runs the maintenance tasks on each of the pool's modems,
+// including those on standby, see Modem.Maintain.
+func (self *Pool) Maintain(m Maintenance) (stop func(), err error) {
+	var stops []func()
+	stop = func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+	for _, modem := range self.Modems() {
+		s, err := modem.Maintain(m)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		stops = append(stops, s)
+	}
+	return stop, nil
+}
+
+// Close closes all the modems in the pool, and the stream of Incoming
+// messages. Closing again does nothing.
+func (self *Pool) Close() {
+	self.closeOnce.Do(func() {
+		close(self.closing)
+		for _, modem := range self.Modems() {
+			modem.Close()
+		}
+		self.receivers.Wait()
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		if self.incoming != nil {
+			close(self.incoming)
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+// Replay opening a modem in a pool, with the SIM's identity
+func poolReplay(iccid, number, imsi, operator string) []string {
+	cnum := "<-\r\nOK\r\n"
+	if number != "" {
+		cnum = "<-\r\n+CNUM: \"\",\"" + number + "\",145\r\n\r\nOK\r\n"
+	}
+	return appendLists(initReplay, []string{
+		"->AT+CCID\r\n",
+		"<-\r\n" + iccid + "\r\n\r\nOK\r\n",
+		"->AT+CNUM\r\n",
+		cnum,
+		"->AT+CIMI\r\n",
+		"<-\r\n" + imsi + "\r\n\r\nOK\r\n",
+		"->AT+COPS?\r\n",
+		"<-\r\n+COPS: 0,0,\"" + operator + "\",7\r\n\r\nOK\r\n",
+	})
+}
+
+func TestOpenPool(t *testing.T) {
+	errMissing := errors.New("No such device")
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		if config.Name == "/dev/ttyUSB2" {
+			return nil, errMissing
+		}
+		return NewMockSerialPort(poolReplay("8944110063155561232", "", "234150000000001", "vodafone UK")), nil
+	}
+	var lock sync.Mutex
+	opening, maxOpening := 0, 0
+	var statuses []PoolStatus
+	status := func(s PoolStatus) {
+		lock.Lock()
+		defer lock.Unlock()
+		if s.Stage == PoolOpening {
+			opening++
+		} else {
+			opening--
+		}
+		if opening > maxOpening {
+			maxOpening = opening
+		}
+		statuses = append(statuses, s)
+	}
+	configs := []*serial.Config{{Name: "/dev/ttyUSB0"}, {Name: "/dev/ttyUSB1"}, {Name: "/dev/ttyUSB2"}, {Name: "/dev/ttyUSB3"}}
+	pool := OpenPool(configs, PoolOptions{Parallelism: 2, Status: status})
+	defer pool.Close()
+	if modems := pool.Modems(); len(modems) != 3 || modems[0] != pool.Modem("/dev/ttyUSB0") || modems[2] != pool.Modem("/dev/ttyUSB3") {
+		t.Errorf("Expected: 3 modems in order, got %#v", modems)
+	}
+	if pool.Modem("/dev/ttyUSB2") != nil {
+		t.Error("Expected: no modem for the missing port")
+	}
+	if errs := pool.Errors(); len(errs) != 1 || errs["/dev/ttyUSB2"] != errMissing {
+		t.Errorf("Expected: missing port error, got %#v", errs)
+	}
+	if len(statuses) != 8 || maxOpening > 2 {
+		t.Errorf("Expected: 8 statuses, 2 at once, got %d, %d at once", len(statuses), maxOpening)
+	}
+	for _, s := range statuses {
+		if s.Stage == PoolOpened && s.Elapsed < 0 || s.Stage == PoolFailed && s.Err != errMissing {
+			t.Errorf("Unexpected status: %#v", s)
+		}
+	}
+}
+
+func TestPoolSticky(t *testing.T) {
+	ports := map[string]*MockSerialPort{
+		"/dev/ttyUSB0": NewMockSerialPort(appendLists(poolReplay("8944110063155561232", "", "234150000000001", "vodafone UK"), sendPDUMessageReplay, sendPDUMessageReplay, sendPDUMessageReplay)),
+		"/dev/ttyUSB1": NewMockSerialPort(appendLists(poolReplay("8944110063155561240", "", "234100000000002", "O2 - UK"), sendPDUMessageReplay, sendPDUMessageReplay[:1])),
+	}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return ports[config.Name], nil
+	}
+	pool := OpenPool([]*serial.Config{{Name: "/dev/ttyUSB0"}, {Name: "/dev/ttyUSB1"}}, PoolOptions{})
+	defer pool.Close()
+	msg := OutgoingMessage{Telephone: "441234567890", Body: "Body@"}
+	send := func(expected string) {
+		if _, port, err := pool.Send(msg); err != nil || port != expected {
+			t.Errorf("Expected: sent by %s, got %s, %v", expected, port, err)
+		}
+	}
+	send("/dev/ttyUSB0")
+	// replies stay with the modem in conversation
+	send("/dev/ttyUSB0")
+	// as when the number sent a message to the other modem
+	pool.Converse(msg.Telephone, "/dev/ttyUSB1")
+	send("/dev/ttyUSB1")
+	// failing over when it drops
+	ports["/dev/ttyUSB1"].DisconnectAfter("AT+CMGS=19\r\n")
+	send("/dev/ttyUSB0")
+}
+
+func TestPoolSendFrom(t *testing.T) {
+	ports := map[string]*MockSerialPort{
+		"/dev/ttyUSB0": NewMockSerialPort(appendLists(poolReplay("8944110063155561232", "+447700900123", "234150000000001", "vodafone UK"), sendPDUMessageReplay)),
+		"/dev/ttyUSB1": NewMockSerialPort(appendLists(poolReplay("8944110063155561240", "", "234100000000002", "O2 - UK"), sendPDUMessageReplay, sendPDUMessageReplay[:1])),
+	}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return ports[config.Name], nil
+	}
+	pool := OpenPool([]*serial.Config{{Name: "/dev/ttyUSB0"}, {Name: "/dev/ttyUSB1"}}, PoolOptions{})
+	defer pool.Close()
+	pool.SetMSISDN("/dev/ttyUSB1", "+447700900456")
+	expected := []Identity{
+		{"/dev/ttyUSB0", "+447700900123", "8944110063155561232", "234150000000001", "vodafone UK"},
+		{"/dev/ttyUSB1", "+447700900456", "8944110063155561240", "234100000000002", "O2 - UK"},
+	}
+	if identities := pool.Identities(); !reflect.DeepEqual(identities, expected) {
+		t.Errorf("Expected: %#v, got %#v", expected, identities)
+	}
+	if _, err := pool.SendFrom("+447700900123", "441234567890", "Body@"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if _, err := pool.SendFrom("8944110063155561240", "441234567890", "Body@"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if _, err := pool.SendFrom("+447700900789", "441234567890", "Body@"); err != ErrUnknownIdentity {
+		t.Error("Expected: ErrUnknownIdentity, got:", err)
+	}
+	ports["/dev/ttyUSB1"].DisconnectAfter("AT+CMGS=19\r\n")
+	pool.SendFrom("+447700900456", "441234567890", "Body@")
+	if _, err := pool.SendFrom("+447700900456", "441234567890", "Body@"); err != ErrIdentityUnavailable {
+		t.Error("Expected: ErrIdentityUnavailable, got:", err)
+	}
+}
+
+func TestPoolRouter(t *testing.T) {
+	ports := map[string]*MockSerialPort{
+		"/dev/ttyUSB0": NewMockSerialPort(poolReplay("8944110063155561232", "", "234150000000001", "vodafone UK")),
+		"/dev/ttyUSB1": NewMockSerialPort(appendLists(poolReplay("8944110063155561240", "", "234100000000002", "O2 - UK"), sendPDUMessageReplay)),
+	}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return ports[config.Name], nil
+	}
+	var offered []Identity
+	// on-net to O2 numbers
+	router := func(telephone string, available []Identity) string {
+		offered = available
+		for _, identity := range available {
+			if identity.Operator == "O2 - UK" && strings.HasPrefix(telephone, "4412") {
+				return identity.Port
+			}
+		}
+		return ""
+	}
+	pool := OpenPool([]*serial.Config{{Name: "/dev/ttyUSB0"}, {Name: "/dev/ttyUSB1"}}, PoolOptions{Router: router})
+	defer pool.Close()
+	if _, port, err := pool.Send(OutgoingMessage{Telephone: "441234567890", Body: "Body@"}); err != nil || port != "/dev/ttyUSB1" {
+		t.Errorf("Expected: sent by the router's choice, got %s, %v", port, err)
+	}
+	if len(offered) != 2 || offered[0].IMSI != "234150000000001" {
+		t.Errorf("Expected: both modems offered, got %#v", offered)
+	}
+}
+
+func TestPoolStandby(t *testing.T) {
+	modem := func() *Modem {
+		return &Modem{stats: newStatsCounter(DefaultClock), closed: make(chan struct{})}
+	}
+	pool := &Pool{
+		ports:   []string{"a", "b", "standby1", "standby2"},
+		modems:  map[string]*Modem{"a": modem(), "b": modem(), "standby1": modem(), "standby2": modem()},
+		standby: map[string]bool{"standby1": true, "standby2": true},
+	}
+	if ports := pool.routable(nil); !reflect.DeepEqual(ports, []string{"a", "b"}) {
+		t.Errorf("Expected: only active modems, got %v", ports)
+	}
+	close(pool.modems["a"].closed)
+	if ports := pool.routable(nil); !reflect.DeepEqual(ports, []string{"b", "standby1"}) {
+		t.Errorf("Expected: a standby in place of a, got %v", ports)
+	}
+	if ports := pool.routable(map[string]bool{"b": true}); !reflect.DeepEqual(ports, []string{"standby1", "standby2"}) {
+		t.Errorf("Expected: both standbys, got %v", ports)
+	}
+	delete(pool.modems, "standby1")
+	if ports := pool.routable(map[string]bool{"b": true}); !reflect.DeepEqual(ports, []string{"standby2"}) {
+		t.Errorf("Expected: the remaining standby, got %v", ports)
+	}
+}
+
+func TestPoolRetireBlocked(t *testing.T) {
+	modem := func() *Modem {
+		return &Modem{stats: newStatsCounter(DefaultClock), closed: make(chan struct{})}
+	}
+	pool := &Pool{
+		ports:         []string{"a", "b", "standby"},
+		modems:        map[string]*Modem{"a": modem(), "b": modem(), "standby": modem()},
+		standby:       map[string]bool{"standby": true},
+		retired:       map[string]bool{},
+		retireBlocked: true,
+	}
+	pool.modems["a"].suspectedBlocked = true
+	pool.sent("a", ERROR{"+CMS ERROR", 21})
+	if ports := pool.routable(nil); !reflect.DeepEqual(ports, []string{"b", "standby"}) || !reflect.DeepEqual(pool.Retired(), []string{"a"}) {
+		t.Errorf("Expected: a retired for the standby, got %v", ports)
+	}
+	if err := pool.Reinstate("a"); err != nil || pool.modems["a"].SuspectedBlocked() {
+		t.Error("Expected: a reinstated, got:", err)
+	}
+	if err := pool.Reinstate("a"); err != ErrNotRetired {
+		t.Error("Expected: ErrNotRetired, got:", err)
+	}
+}
@@ -0,0 +1,83 @@
+package gogsmmodem
+
+// Sends remembered per modem for its recent error rate
+var HealthWindow = 20
+
+// Recent sends by one of a Pool's modems, and its credit for smooth weighted
+// round robin
+type health struct {
+	// outcomes of the last HealthWindow sends, true for failures
+	results []bool
+	next    int
+	credit  float64
+}
+
+// Record the outcome of a send. Messages refused before reaching the modem
+// don't count.
+func (self *health) sent(err error) {
+	switch err.(type) {
+	case *BlockedNumberError, *BudgetExceededError, *SegmentLimitError, *GSMEncodingError:
+		return
+	}
+	if err == ErrCancelled || err == ErrReadOnly || err == ErrExpired {
+		return
+	}
+	if len(self.results) < HealthWindow {
+		self.results = append(self.results, err != nil)
+		return
+	}
+	self.results[self.next] = err != nil
+	self.next = (self.next + 1) % len(self.results)
+}
+
+// Fraction of recent sends which failed
+func (self *health) errorRate() float64 {
+	if len(self.results) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, f := range self.results {
+		if f {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(self.results))
+}
+
+// Share of traffic for a modem: higher for fewer recent failures, stronger
+// signal and fewer commands queued. Signal counts as middling until read, eg
+// by Maintain.
+func weight(h *health, modem *Modem) float64 {
+	w := 1 - h.errorRate()
+	// never starve a modem entirely, so it can recover
+	if w < 0.05 {
+		w = 0.05
+	}
+	if stats := modem.Stats(); !stats.SignalAt.IsZero() && stats.Signal.Known() {
+		w *= 0.1 + 0.9*float64(stats.Signal.RSSI)/31
+	} else {
+		w *= 0.5
+	}
+	return w / float64(1+modem.sched.depth())
+}
+
+// Choose among the ports given by smooth weighted round robin, which spreads
+// choices in proportion to weight while interleaving them. The caller must
+// hold the pool's lock.
+func (self *Pool) weighted(ports []string) string {
+	best := ""
+	total := 0.0
+	for _, port := range ports {
+		h := self.health[port]
+		w := weight(h, self.modems[port])
+		h.credit += w
+		total += w
+		if best == "" || h.credit > self.health[best].credit {
+			best = port
+		}
+	}
+	if best != "" {
+		self.health[best].credit -= total
+	}
+	return best
+}
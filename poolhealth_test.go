@@ -0,0 +1,54 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHealthErrorRate(t *testing.T) {
+	h := &health{}
+	for i := 0; i < HealthWindow; i++ {
+		h.sent(errors.New("+CMS ERROR: 500"))
+	}
+	h.sent(&BlockedNumberError{"112", "emergency number"})
+	if rate := h.errorRate(); rate != 1 {
+		t.Error("Expected: all failed, got:", rate)
+	}
+	for i := 0; i < HealthWindow/2; i++ {
+		h.sent(nil)
+	}
+	if rate := h.errorRate(); rate != 0.5 {
+		t.Error("Expected: recent half failed, got:", rate)
+	}
+}
+
+func TestPoolWeighted(t *testing.T) {
+	modem := func(rssi int) *Modem {
+		m := &Modem{stats: newStatsCounter(DefaultClock)}
+		m.stats.signal(SignalQuality{rssi, 0})
+		return m
+	}
+	pool := &Pool{
+		modems: map[string]*Modem{"good": modem(31), "weak": modem(3), "failing": modem(31)},
+		health: map[string]*health{"good": {}, "weak": {}, "failing": {}},
+	}
+	for i := 0; i < HealthWindow; i++ {
+		pool.health["failing"].sent(ErrTimeout)
+	}
+	ports := []string{"good", "weak", "failing"}
+	counts := map[string]int{}
+	for i := 0; i < 100; i++ {
+		counts[pool.weighted(ports)]++
+	}
+	if counts["good"] < 70 || counts["weak"] == 0 || counts["failing"] == 0 || counts["weak"] > counts["good"]/3 {
+		t.Errorf("Expected: most traffic to the healthy modem, got %v", counts)
+	}
+	// equal weights take turns
+	pool.health = map[string]*health{"good": {}, "weak": {}, "failing": {}}
+	pool.modems["weak"] = modem(31)
+	for i, expected := range []string{"good", "weak", "failing", "good"} {
+		if port := pool.weighted(ports); port != expected {
+			t.Errorf("Expected: %s for pick %d, got %s", expected, i, port)
+		}
+	}
+}
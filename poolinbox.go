@@ -0,0 +1,80 @@
+package gogsmmodem
+
+import "log"
+
+// A message received by one of a Pool's modems, see Incoming
+type PoolMessage struct {
+	Message Message
+	// The modem it was received by, and its SIM
+	Identity Identity
+}
+
+// Incoming merges the messages received by the pool's modems, including
+// those added later, into one stream, each tagged with the identity of the
+// modem which received it. The sender is taken to be in conversation with
+// that modem, see Send. Messages are left in storage for the caller to
+// delete.
+//
+// Once called, the pool reads its modems' OOB channels, logging other
+// unsolicited packets. The stream is closed when the pool is.
+func (self *Pool) Incoming() <-chan PoolMessage {
+	self.lock.Lock()
+	if self.incoming != nil {
+		self.lock.Unlock()
+		return self.incoming
+	}
+	self.incoming = make(chan PoolMessage, 16)
+	self.receiving = map[*Modem]bool{}
+	ports := append([]string(nil), self.ports...)
+	self.lock.Unlock()
+	for _, port := range ports {
+		self.receiveFrom(port)
+	}
+	return self.incoming
+}
+
+// Start passing on messages received by the modem on port, if Incoming has
+// been called and they aren't already
+func (self *Pool) receiveFrom(port string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	modem := self.modems[port]
+	if self.incoming == nil || modem == nil || self.receiving[modem] {
+		return
+	}
+	self.receiving[modem] = true
+	self.receivers.Add(1)
+	go func() {
+		defer self.receivers.Done()
+		self.receive(port, modem)
+	}()
+}
+
+// Pass on messages received by a modem until it is closed
+func (self *Pool) receive(port string, modem *Modem) {
+	for p := range modem.OOB {
+		n, ok := p.(MessageNotification)
+		if !ok {
+			log.Printf("Pool: %s packet: %#v", port, p)
+			continue
+		}
+		msg, err := modem.GetMessageFrom(n.Storage, n.Index)
+		if err != nil {
+			log.Println("Pool: reading message", port, n.Storage, n.Index, err)
+			continue
+		}
+		self.Converse(msg.Telephone, port)
+		select {
+		case self.incoming <- PoolMessage{*msg, self.identity(port)}:
+		case <-self.closing:
+			return
+		}
+	}
+}
+
+// The identity of the modem on port
+func (self *Pool) identity(port string) Identity {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.identities[port]
+}
@@ -0,0 +1,40 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+func TestPoolIncoming(t *testing.T) {
+	ports := map[string]*MockSerialPort{
+		"/dev/ttyUSB0": NewMockSerialPort(poolReplay("8944110063155561232", "", "234150000000001", "vodafone UK")),
+		"/dev/ttyUSB1": NewMockSerialPort(appendLists(poolReplay("8944110063155561240", "", "234100000000002", "O2 - UK"), []string{
+			"->AT+CPMS?\r\n",
+			"<-\r\n+CPMS: \"SM\",1,20,\"SM\",1,20,\"SM\",1,20\r\n\r\nOK\r\n",
+			"->AT+CMGR=1\r\n",
+			"<-\r\n+CMGR: 0,,21\r\n00040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+		})),
+	}
+	ports["/dev/ttyUSB1"].InjectAfter("AT+COPS?\r\n", "\r\n+CMTI: \"SM\",1\r\n")
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return ports[config.Name], nil
+	}
+	pool := OpenPool([]*serial.Config{{Name: "/dev/ttyUSB0"}, {Name: "/dev/ttyUSB1"}}, PoolOptions{})
+	incoming := pool.Incoming()
+	in := <-incoming
+	if in.Identity.Port != "/dev/ttyUSB1" || in.Identity.ICCID != "8944110063155561240" || in.Identity.Operator != "O2 - UK" {
+		t.Errorf("Expected: received by USB1, got %#v", in.Identity)
+	}
+	if in.Message.Index != 1 || in.Message.Telephone != "+441234567890" || in.Message.Body != "Hi" {
+		t.Errorf("Expected: message 1, got %#v", in.Message)
+	}
+	if port, _ := pool.conversation(in.Message.Telephone, nil); port != "/dev/ttyUSB1" {
+		t.Error("Expected: sender in conversation with USB1, got:", port)
+	}
+	pool.Close()
+	if _, ok := <-incoming; ok {
+		t.Error("Expected: stream closed with the pool")
+	}
+}
@@ -0,0 +1,135 @@
+package gogsmmodem
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/tarm/serial"
+)
+
+var ErrNotInPool = errors.New("Port not in pool")
+var ErrInPool = errors.New("Port already in pool")
+
+// A send handed to one of a Pool's modems, which has started once the modem
+// is given to it
+type pendingSend struct {
+	cancel  context.CancelFunc
+	started bool
+}
+
+// Sends handed to a modem, and whether it is being removed
+type sends struct {
+	pending  map[*pendingSend]bool
+	wg       sync.WaitGroup
+	draining bool
+}
+
+// Add opens the modem on a port and adds it to the pool at runtime, as when
+// a dongle is plugged in, with the pool's options. Its status is reported as
+// for OpenPool. The port is on standby if listed in PoolOptions.Standby.
+func (self *Pool) Add(config *serial.Config) error {
+	self.lock.Lock()
+	if self.modems[config.Name] != nil {
+		self.lock.Unlock()
+		return ErrInPool
+	}
+	listed := false
+	for _, port := range self.ports {
+		listed = listed || port == config.Name
+	}
+	if !listed {
+		self.ports = append(self.ports, config.Name)
+	}
+	self.lock.Unlock()
+	return self.open(config)
+}
+
+// Remove drains the modem on port and closes it, as before unplugging a
+// dongle. No new messages are routed to it, sends it has started are
+// finished, and sends still queued for it are reassigned to other modems.
+// Conversations with it move to whichever modem next sends to them. A port
+// whose modem failed to open is forgotten.
+func (self *Pool) Remove(port string) error {
+	self.lock.Lock()
+	s := self.sends[port]
+	if _, failed := self.errors[port]; failed && s == nil {
+		delete(self.errors, port)
+		self.forget(port)
+		self.lock.Unlock()
+		return nil
+	}
+	if s == nil || s.draining {
+		self.lock.Unlock()
+		return ErrNotInPool
+	}
+	s.draining = true
+	for p := range s.pending {
+		if !p.started {
+			p.cancel()
+		}
+	}
+	self.lock.Unlock()
+	s.wg.Wait()
+
+	self.lock.Lock()
+	modem := self.modems[port]
+	delete(self.modems, port)
+	delete(self.identities, port)
+	delete(self.health, port)
+	delete(self.sends, port)
+	delete(self.retired, port)
+	delete(self.errors, port)
+	for telephone, r := range self.routes {
+		if r.port == port {
+			delete(self.routes, telephone)
+		}
+	}
+	self.forget(port)
+	self.lock.Unlock()
+	return modem.Close()
+}
+
+// Drop port from the ports listed. The caller must hold the lock.
+func (self *Pool) forget(port string) {
+	for i, p := range self.ports {
+		if p == port {
+			self.ports = append(self.ports[:i], self.ports[i+1:]...)
+			break
+		}
+	}
+}
+
+// Register a send by the modem on port, returning a context derived from
+// parent which is also cancelled if the modem is removed before the send is
+// given it, and a func to call once the send is done. Fails if the modem is
+// being removed.
+func (self *Pool) track(parent context.Context, port string) (context.Context, func(), bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	s := self.sends[port]
+	if s == nil || s.draining {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(parent)
+	p := &pendingSend{cancel: cancel}
+	ctx = withAcquired(ctx, func() bool {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		// cancelled by Remove while waiting for the modem
+		if ctx.Err() != nil {
+			return false
+		}
+		p.started = true
+		return true
+	})
+	s.pending[p] = true
+	s.wg.Add(1)
+	return ctx, func() {
+		self.lock.Lock()
+		delete(s.pending, p)
+		self.lock.Unlock()
+		cancel()
+		s.wg.Done()
+	}, true
+}
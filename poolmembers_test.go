@@ -0,0 +1,93 @@
+package gogsmmodem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestPoolReplaceModem(t *testing.T) {
+	ports := map[string]*MockSerialPort{
+		"/dev/ttyUSB0": NewMockSerialPort(poolReplay("8944110063155561232", "", "234150000000001", "vodafone UK")),
+		"/dev/ttyUSB1": NewMockSerialPort(appendLists(poolReplay("8944110063155561240", "", "234100000000002", "O2 - UK"), sendPDUMessageReplay)),
+		"/dev/ttyUSB2": NewMockSerialPort(appendLists(poolReplay("8944110063155561257", "", "234100000000003", "O2 - UK"), sendPDUMessageReplay)),
+	}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return ports[config.Name], nil
+	}
+	pool := OpenPool([]*serial.Config{{Name: "/dev/ttyUSB0"}, {Name: "/dev/ttyUSB1"}}, PoolOptions{})
+	defer pool.Close()
+
+	// a message queued behind another command on USB0
+	pool.Converse("441234567890", "/dev/ttyUSB0")
+	busy := pool.Modem("/dev/ttyUSB0")
+	busy.sched.acquire(context.Background(), PriorityHigh)
+	sent := make(chan string)
+	go func() {
+		_, port, err := pool.Send(OutgoingMessage{Telephone: "441234567890", Body: "Body@"})
+		if err != nil {
+			t.Error("Expected: no error, got:", err)
+		}
+		sent <- port
+	}()
+	for queued := 0; queued == 0; {
+		time.Sleep(time.Millisecond)
+		pool.lock.Lock()
+		queued = len(pool.sends["/dev/ttyUSB0"].pending)
+		pool.lock.Unlock()
+	}
+	// is reassigned when USB0 is removed
+	if err := pool.Remove("/dev/ttyUSB0"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if port := <-sent; port != "/dev/ttyUSB1" {
+		t.Error("Expected: reassigned to USB1, got:", port)
+	}
+	busy.sched.release()
+	if pool.Modem("/dev/ttyUSB0") != nil || len(pool.Identities()) != 1 {
+		t.Errorf("Expected: USB0 removed, got %#v", pool.Identities())
+	}
+	if err := pool.Remove("/dev/ttyUSB0"); err != ErrNotInPool {
+		t.Error("Expected: ErrNotInPool, got:", err)
+	}
+
+	// swapping USB1 for USB2
+	if err := pool.Add(&serial.Config{Name: "/dev/ttyUSB2"}); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if err := pool.Add(&serial.Config{Name: "/dev/ttyUSB2"}); err != ErrInPool {
+		t.Error("Expected: ErrInPool, got:", err)
+	}
+	if err := pool.Remove("/dev/ttyUSB1"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if _, port, err := pool.Send(OutgoingMessage{Telephone: "441234567890", Body: "Body@"}); err != nil || port != "/dev/ttyUSB2" {
+		t.Errorf("Expected: sent by USB2, got %s, %v", port, err)
+	}
+}
+
+func TestPoolRemoveFailed(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return nil, errors.New("No such device")
+	}
+	pool := OpenPool([]*serial.Config{{Name: "/dev/ttyUSB0"}}, PoolOptions{})
+	if len(pool.Errors()) != 1 {
+		t.Fatalf("Expected: USB0 failed, got %#v", pool.Errors())
+	}
+	if err := pool.Remove("/dev/ttyUSB0"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if len(pool.Errors()) != 0 || len(pool.ports) != 0 {
+		t.Errorf("Expected: USB0 forgotten, got %#v %v", pool.Errors(), pool.ports)
+	}
+	if err := pool.Remove("/dev/ttyUSB0"); err != ErrNotInPool {
+		t.Error("Expected: ErrNotInPool, got:", err)
+	}
+	pool.Close()
+	// closing again does nothing
+	pool.Close()
+}
@@ -0,0 +1,33 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"strings"
+)
+
+// A serial port found by ListPorts.
+type PortInfo struct {
+	// Name to open, eg "COM5"
+	Name string
+	// Device description, eg "HUAWEI Mobile Connect - PC UI Interface"
+	Description string
+}
+
+var ErrPortNotFound = errors.New("No port matching description")
+
+// FindPort finds the port whose description contains desc, ignoring case, so
+// a modem can be opened by its device description rather than its port
+// number.
+func FindPort(desc string) (*PortInfo, error) {
+	ports, err := ListPorts()
+	if err != nil {
+		return nil, err
+	}
+	desc = strings.ToLower(desc)
+	for _, port := range ports {
+		if strings.Contains(strings.ToLower(port.Description), desc) {
+			return &port, nil
+		}
+	}
+	return nil, ErrPortNotFound
+}
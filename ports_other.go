@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package gogsmmodem
+
+import "errors"
+
+// ListPorts lists serial ports with their device descriptions. Only
+// supported on Windows, elsewhere use the stable names under
+// /dev/serial/by-id.
+func ListPorts() ([]PortInfo, error) {
+	return nil, errors.New("Listing ports is only supported on Windows")
+}
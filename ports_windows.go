@@ -0,0 +1,111 @@
+//go:build windows
+// +build windows
+
+package gogsmmodem
+
+import (
+	"regexp"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Registry key for devices, as Enum\<bus>\<device>\<instance>
+const enumKey = `SYSTEM\CurrentControlSet\Enum`
+
+// COM port suffix of a device's friendly name
+var reCOMSuffix = regexp.MustCompile(`\s*\(COM\d+\)$`)
+
+// ListPorts lists serial ports with their device descriptions, from the
+// device instances in the registry with a port name.
+func ListPorts() ([]PortInfo, error) {
+	enum, err := openKey(syscall.HKEY_LOCAL_MACHINE, enumKey)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.RegCloseKey(enum)
+	var ports []PortInfo
+	for _, bus := range subkeys(enum) {
+		busKey, err := openKey(enum, bus)
+		if err != nil {
+			continue
+		}
+		for _, device := range subkeys(busKey) {
+			deviceKey, err := openKey(busKey, device)
+			if err != nil {
+				continue
+			}
+			for _, instance := range subkeys(deviceKey) {
+				if port, ok := portInfo(deviceKey, instance); ok {
+					ports = append(ports, port)
+				}
+			}
+			syscall.RegCloseKey(deviceKey)
+		}
+		syscall.RegCloseKey(busKey)
+	}
+	return ports, nil
+}
+
+// The port of a device instance, if it has one
+func portInfo(device syscall.Handle, instance string) (PortInfo, bool) {
+	params, err := openKey(device, instance+`\Device Parameters`)
+	if err != nil {
+		return PortInfo{}, false
+	}
+	name := stringValue(params, "PortName")
+	syscall.RegCloseKey(params)
+	if !strings.HasPrefix(name, "COM") {
+		return PortInfo{}, false
+	}
+	key, err := openKey(device, instance)
+	if err != nil {
+		return PortInfo{}, false
+	}
+	defer syscall.RegCloseKey(key)
+	desc := reCOMSuffix.ReplaceAllString(stringValue(key, "FriendlyName"), "")
+	if desc == "" {
+		// eg "@oem12.inf,%huawei.pcui%;HUAWEI Mobile Connect - PC UI Interface"
+		desc = stringValue(key, "DeviceDesc")
+		desc = desc[strings.LastIndex(desc, ";")+1:]
+	}
+	return PortInfo{name, desc}, true
+}
+
+func openKey(parent syscall.Handle, path string) (syscall.Handle, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var key syscall.Handle
+	err = syscall.RegOpenKeyEx(parent, p, 0, syscall.KEY_READ, &key)
+	return key, err
+}
+
+func subkeys(key syscall.Handle) []string {
+	var names []string
+	buf := make([]uint16, 256)
+	for i := uint32(0); ; i++ {
+		n := uint32(len(buf))
+		if syscall.RegEnumKeyEx(key, i, &buf[0], &n, nil, nil, nil, nil) != nil {
+			return names
+		}
+		names = append(names, syscall.UTF16ToString(buf[:n]))
+	}
+}
+
+// A string value, empty if missing
+func stringValue(key syscall.Handle, name string) string {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return ""
+	}
+	var typ uint32
+	buf := make([]uint16, 512)
+	n := uint32(len(buf) * 2)
+	err = syscall.RegQueryValueEx(key, p, nil, &typ, (*byte)(unsafe.Pointer(&buf[0])), &n)
+	if err != nil || typ != syscall.REG_SZ {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:n/2])
+}
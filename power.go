@@ -0,0 +1,93 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"time"
+)
+
+// Sleep modes for SetSleepMode (+CSCLK)
+const (
+	SleepDisabled = 0
+	// Sleep while DTR is released, see WakeUp and AllowSleep
+	SleepDTR = 1
+	// Sleep automatically when the serial line is idle
+	SleepAuto = 2
+)
+
+// A port which can drive the DTR line, used by WakeUp and AllowSleep. On
+// Linux the DTR of a serial device opened with Open or OpenWithOptions is
+// driven through the device by name; elsewhere, the port returned by
+// OpenPort must implement DTRSetter. Bluetooth RFCOMM ports have no DTR.
+type DTRSetter interface {
+	SetDTR(on bool) error
+}
+
+// How long DTR is released, then asserted, when waking the module
+var WakeDTRDelay = 100 * time.Millisecond
+
+// Timeout for each attempt to wake the modem
+var WakeTimeout = 1 * time.Second
+
+// Attempts made to wake the modem before giving up
+var WakeAttempts = 5
+
+// PowerDown switches the module off. SIMCom modules use +CPOWD=1 and Quectel
+// modules +QPOWD=1; each is tried in turn.
+func (self *Modem) PowerDown() error {
+	_, err := self.send("+CPOWD", 1)
+	if err != nil {
+		_, err = self.send("+QPOWD", 1)
+	}
+	return err
+}
+
+// SetSleepMode enables or disables the module's low power sleep (+CSCLK).
+func (self *Modem) SetSleepMode(mode int) error {
+	_, err := self.send("+CSCLK", mode)
+	return err
+}
+
+// The port's DTR line, or failing that its device's
+func (self *Modem) dtrSetter() (DTRSetter, bool) {
+	port := self.port
+	if l, ok := port.(LogReadWriteCloser); ok {
+		port = l.f
+	}
+	if d, ok := port.(DTRSetter); ok {
+		return d, true
+	}
+	return deviceDTRSetter(self.device)
+}
+
+// WakeUp wakes the module from sleep. DTR is toggled, released then asserted,
+// if the port supports it, then AT is sent until the module responds; the
+// first characters sent to a sleeping module are discarded. In SleepDTR mode
+// the module stays awake until AllowSleep is called.
+func (self *Modem) WakeUp() error {
+	if d, ok := self.dtrSetter(); ok {
+		for _, on := range []bool{false, true} {
+			if err := d.SetDTR(on); err != nil {
+				return err
+			}
+			self.clock.Sleep(WakeDTRDelay)
+		}
+	}
+	for i := 0; i < WakeAttempts; i++ {
+		if i > 0 {
+			self.stats.retried()
+		}
+		if _, err := self.sendTimeout(WakeTimeout, ""); err == nil {
+			return nil
+		}
+	}
+	return errors.New("Modem did not wake up")
+}
+
+// AllowSleep releases DTR so a module in SleepDTR mode can enter sleep.
+func (self *Modem) AllowSleep() error {
+	d, ok := self.dtrSetter()
+	if !ok {
+		return errors.New("Port does not support DTR")
+	}
+	return d.SetDTR(false)
+}
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package gogsmmodem
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The DTR line of a serial device, set with TIOCMBIS/TIOCMBIC on a
+// descriptor of its own, as tarm/serial's port does not expose its file
+type deviceDTR string
+
+func (self deviceDTR) SetDTR(on bool) error {
+	f, err := os.OpenFile(string(self), os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	req := syscall.TIOCMBIC
+	if on {
+		req = syscall.TIOCMBIS
+	}
+	bits := int32(syscall.TIOCM_DTR)
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(req), uintptr(unsafe.Pointer(&bits))); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// The DTR line of the serial device name, if it has one
+func deviceDTRSetter(name string) (DTRSetter, bool) {
+	if name == "" {
+		return nil, false
+	}
+	return deviceDTR(name), true
+}
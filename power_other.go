@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package gogsmmodem
+
+// DTR of serial devices is only driven on Linux, elsewhere the port must be a
+// DTRSetter
+func deviceDTRSetter(name string) (DTRSetter, bool) {
+	return nil, false
+}
@@ -0,0 +1,257 @@
+package gogsmmodem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Features a Profile can mark unsupported
+const (
+	// PDU mode, so text mode is used
+	FeaturePDU = "pdu"
+	// Listing character sets with +CSCS=?, so GSM and UCS2 are assumed
+	FeatureCharsets = "charsets"
+	// Setting new message indications with +CNMI, for modems configured
+	// by the profile's Init commands instead
+	FeatureCNMI = "cnmi"
+	// UCS2 messages, which in text mode need the UCS2 character set
+	FeatureUCS2 = "ucs2"
+	// Delivery reports, which are routed by +CNMI
+	FeatureDeliveryReports = "delivery-reports"
+	// Listing messages by status, so ListMessages lists "ALL" and filters
+	FeatureListFilters = "list-filters"
+	// LTE registration with +CEREG, for modems registering on LTE alone
+	FeatureEPS = "eps"
+)
+
+// A Duration read from JSON as a string such as "30s"
+type Duration time.Duration
+
+func (self *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*self = Duration(d)
+	return nil
+}
+
+func (self Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(self).String())
+}
+
+// An unsolicited result recognised by a regular expression, reported as a
+// ProfileEvent of type Event
+type UnsolicitedPattern struct {
+	Pattern string
+	Event   string
+	re      *regexp.Regexp
+}
+
+// Quirks of a modem, so unusual modems can be supported by configuration.
+// Profiles are read from JSON with LoadProfile and applied by Open with
+// Options.Profile, eg:
+//
+//	{
+//	  "Name": "ZTE MF190",
+//	  "PreInit": ["+CFUN=1"],
+//	  "Init": ["+ZSNT=0,0,2", "+ZOPRT=5"],
+//	  "CNMI": [2, 1, 0, 2, 0],
+//	  "Unsolicited": [{"Pattern": "^\\+ZDONR: \"(.*)\"", "Event": "operator"}],
+//	  "Timeout": "30s",
+//	  "Unsupported": ["pdu"]
+//	}
+//
+// Profiles for common modems are built in, see Profiles.
+type Profile struct {
+	Name string
+	// Commands without the AT prefix sent after the reset, before waiting
+	// for the SIM, eg to turn the radio on
+	PreInit []string
+	// Commands without the AT prefix sent once the modem is configured
+	Init []string
+	// +CNMI parameters, overriding DefaultCNMI
+	CNMI []int
+	// Unsolicited results to report as ProfileEvents, checked before the
+	// results the library parses
+	Unsolicited []UnsolicitedPattern
+	// Response timeout, overriding DefaultTimeout
+	Timeout Duration
+	// Features the modem lacks, see FeaturePDU etc.
+	Unsupported []string
+}
+
+// Built-in profiles by name, for Options.ProfileName, added to with
+// RegisterProfile, which is safe while modems are opened
+var Profiles = map[string]*Profile{
+	"huawei": {
+		Name: "huawei",
+		// stop periodic ^RSSI, ^MODE and ^BOOT reports
+		Init: []string{"^CURC=0"},
+		CNMI: []int{2, 1, 0, 2, 0},
+	},
+	"simcom": {
+		Name: "simcom",
+		CNMI: []int{2, 1, 0, 0, 0},
+		Unsolicited: []UnsolicitedPattern{
+			{Pattern: "^Call Ready$", Event: "call-ready"},
+			{Pattern: "^SMS Ready$", Event: "sms-ready"},
+		},
+	},
+	"quectel": {
+		Name: "quectel",
+		// unsolicited results on the AT port
+		Init: []string{`+QURCCFG="urcport","usbat"`},
+		CNMI: []int{2, 1, 0, 1, 0},
+		Unsolicited: []UnsolicitedPattern{
+			{Pattern: "^\\+QIND: (.*)", Event: "indication"},
+		},
+	},
+	"telit": {
+		Name: "telit",
+		CNMI: []int{2, 1, 0, 1, 0},
+		Unsolicited: []UnsolicitedPattern{
+			{Pattern: "^\\+CIEV: (.*)", Event: "indicator"},
+		},
+	},
+	"zte": {
+		Name: "zte",
+		Init: []string{"+ZSNT=0,0,2"},
+	},
+}
+
+// Held reading or changing Profiles
+var profilesLock sync.Mutex
+
+// Add or replace a built-in profile
+func RegisterProfile(profile *Profile) {
+	profilesLock.Lock()
+	defer profilesLock.Unlock()
+	Profiles[profile.Name] = profile
+}
+
+// The built-in profile with the name
+func lookupProfile(name string) (*Profile, bool) {
+	profilesLock.Lock()
+	defer profilesLock.Unlock()
+	profile, ok := Profiles[name]
+	return profile, ok
+}
+
+// Parse a profile from JSON
+func ParseProfile(b []byte) (*Profile, error) {
+	var profile Profile
+	if err := json.Unmarshal(b, &profile); err != nil {
+		return nil, err
+	}
+	if err := profile.compile(); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Read a profile from a JSON file
+func LoadProfile(path string) (*Profile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProfile(b)
+}
+
+// Compile the unsolicited patterns
+func (self *Profile) compile() error {
+	for i := range self.Unsolicited {
+		p := &self.Unsolicited[i]
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("Profile pattern %q: %v", p.Pattern, err)
+		}
+		p.re = re
+	}
+	return nil
+}
+
+// Does the profile mark the feature unsupported
+func (self *Profile) lacks(feature string) bool {
+	if self == nil {
+		return false
+	}
+	for _, f := range self.Unsupported {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Patterns of unsolicited results for the parser
+func (self *Profile) patterns() []UnsolicitedPattern {
+	if self == nil {
+		return nil
+	}
+	return self.Unsolicited
+}
+
+// Apply the profile's settings before init
+func (self *Modem) applyProfile(profile *Profile) error {
+	if profile == nil {
+		return nil
+	}
+	// compiled afresh, as built-in profiles are shared by modems
+	copied := *profile
+	copied.Unsolicited = append([]UnsolicitedPattern(nil), profile.Unsolicited...)
+	profile = &copied
+	if err := profile.compile(); err != nil {
+		return err
+	}
+	self.profile = profile
+	if profile.Timeout > 0 {
+		self.Timeout = time.Duration(profile.Timeout)
+	}
+	if len(profile.CNMI) > 0 {
+		self.cnmi = append([]int(nil), profile.CNMI...)
+	}
+	if profile.lacks(FeaturePDU) {
+		self.textMode = true
+	}
+	return nil
+}
+
+// Send the profile's init commands, or its PreInit commands if pre is set
+func (self *Modem) profileInit(pre bool) {
+	if self.profile == nil {
+		return
+	}
+	cmds := self.profile.Init
+	if pre {
+		cmds = self.profile.PreInit
+	}
+	for _, cmd := range cmds {
+		if _, err := self.send(cmd); err != nil {
+			log.Printf("Profile %s: %s failed: %v", self.profile.Name, cmd, err)
+		}
+	}
+}
+
+// Match an unsolicited line against the patterns
+func matchPattern(patterns []UnsolicitedPattern, line string) (Packet, bool) {
+	for _, p := range patterns {
+		if p.re == nil {
+			continue
+		}
+		if m := p.re.FindStringSubmatch(line); m != nil {
+			return ProfileEvent{p.Event, line, m[1:]}, true
+		}
+	}
+	return nil, false
+}
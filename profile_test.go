@@ -0,0 +1,109 @@
+package gogsmmodem
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+var profileJSON = `{
+  "Name": "Quirky",
+  "Init": ["+ZSNT=0,0,2"],
+  "Unsolicited": [{"Pattern": "^\\^MODE: (\\d+),(\\d+)", "Event": "mode"}],
+  "Timeout": "30s",
+  "Unsupported": ["pdu", "cnmi"]
+}`
+
+var profileReplay = appendLists(initPrefix, []string{
+	"->AT+CMGF=1\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+ZSNT=0,0,2\r\n",
+	"<-\r\nOK\r\n",
+	"<-\r\n^MODE: 5,4\r\n",
+})
+
+func TestProfile(t *testing.T) {
+	profile, err := ParseProfile([]byte(profileJSON))
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(profileReplay), nil
+	}
+	modem, err := OpenWithOptions(&serial.Config{}, Options{Debug: true, Profile: profile})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if modem.Timeout != 30*time.Second || !modem.textMode {
+		t.Errorf("Expected: profile applied, got %v %v", modem.Timeout, modem.textMode)
+	}
+	var event Packet
+	for p := range modem.OOB {
+		if _, ok := p.(ProfileEvent); ok {
+			event = p
+			break
+		}
+	}
+	modem.Close()
+	expected := ProfileEvent{"mode", "^MODE: 5,4", []string{"5", "4"}}
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("Expected: %#v, got %#v", expected, event)
+	}
+}
+
+func TestProfileInvalid(t *testing.T) {
+	if _, err := ParseProfile([]byte(`{"Unsolicited": [{"Pattern": "("}]}`)); err == nil {
+		t.Error("Expected: invalid pattern error")
+	}
+	if _, err := ParseProfile([]byte(`{"Timeout": "soon"}`)); err == nil {
+		t.Error("Expected: invalid timeout error")
+	}
+}
+
+func TestBuiltinProfile(t *testing.T) {
+	RegisterProfile(&Profile{Name: "custom", PreInit: []string{"+CFUN=1"}, Init: []string{"^CURC=0"}, CNMI: []int{2, 1, 0, 2, 0}})
+	defer delete(Profiles, "custom")
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(resetReplay, []string{
+			"->AT+CFUN=1\r\n",
+			"<-\r\nOK\r\n",
+		}, simReadyReplay, configureReplay, []string{
+			"->AT+CMGF=0\r\n",
+			"<-\r\nOK\r\n",
+			"->AT+CNMI=2,1,0,2,0\r\n",
+			"<-\r\nOK\r\n",
+			"->AT^CURC=0\r\n",
+			"<-\r\nOK\r\n",
+		})), nil
+	}
+	modem, err := OpenWithOptions(&serial.Config{}, Options{ProfileName: "custom"})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.Close()
+	if _, err := OpenWithOptions(&serial.Config{}, Options{ProfileName: "unknown"}); err == nil {
+		t.Error("Expected: unknown profile error")
+	}
+	for name, profile := range Profiles {
+		if err := profile.compile(); err != nil || profile.Name != name {
+			t.Errorf("Profile %s: invalid %v", name, err)
+		}
+	}
+}
+
+func TestRegisterProfileConcurrent(t *testing.T) {
+	defer delete(Profiles, "custom")
+	done := make(chan struct{})
+	go func() {
+		RegisterProfile(&Profile{Name: "custom"})
+		close(done)
+	}()
+	lookupProfile("zte")
+	<-done
+	if _, ok := lookupProfile("custom"); !ok {
+		t.Error("Expected: custom profile")
+	}
+}
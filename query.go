@@ -0,0 +1,51 @@
+package gogsmmodem
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Client-side filter for ListMessagesWhere. Zero fields match everything.
+type MessageQuery struct {
+	// Status filter passed to the modem, eg "REC UNREAD", default "ALL"
+	Status string
+	// Sender telephone number prefix
+	SenderPrefix string
+	// Received at or after Since and before Until
+	Since time.Time
+	Until time.Time
+	// Substring of the body
+	Contains string
+	// Pattern matching the body
+	Pattern *regexp.Regexp
+}
+
+// Does the message match the query, other than its status
+func (self MessageQuery) Match(msg Message) bool {
+	return strings.HasPrefix(msg.Telephone, self.SenderPrefix) &&
+		(self.Since.IsZero() || !msg.Timestamp.Before(self.Since)) &&
+		(self.Until.IsZero() || msg.Timestamp.Before(self.Until)) &&
+		strings.Contains(msg.Body, self.Contains) &&
+		(self.Pattern == nil || self.Pattern.MatchString(msg.Body))
+}
+
+// ListMessagesWhere lists stored messages matching the query. The modem only
+// filters by status, the rest of the query is applied to the messages listed.
+func (self *Modem) ListMessagesWhere(q MessageQuery) (*MessageList, error) {
+	status := q.Status
+	if status == "" {
+		status = "ALL"
+	}
+	msgs, err := self.ListMessages(status)
+	if err != nil {
+		return nil, err
+	}
+	ret := MessageList{}
+	for _, msg := range *msgs {
+		if q.Match(msg) {
+			ret = append(ret, msg)
+		}
+	}
+	return &ret, nil
+}
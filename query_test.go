@@ -0,0 +1,49 @@
+package gogsmmodem
+
+import (
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestMessageQueryMatch(t *testing.T) {
+	msg := Message{Telephone: "+441234567890", Timestamp: time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC), Body: "Your code is 1234"}
+	tests := []struct {
+		q        MessageQuery
+		expected bool
+	}{
+		{MessageQuery{}, true},
+		{MessageQuery{SenderPrefix: "+44"}, true},
+		{MessageQuery{SenderPrefix: "+33"}, false},
+		{MessageQuery{Since: time.Date(2014, 2, 1, 0, 0, 0, 0, time.UTC)}, true},
+		{MessageQuery{Since: time.Date(2014, 2, 2, 0, 0, 0, 0, time.UTC)}, false},
+		{MessageQuery{Until: time.Date(2014, 2, 1, 15, 7, 43, 0, time.UTC)}, false},
+		{MessageQuery{Contains: "code"}, true},
+		{MessageQuery{Pattern: regexp.MustCompile(`\d{4}$`)}, true},
+		{MessageQuery{Pattern: regexp.MustCompile(`^\d`)}, false},
+	}
+	for _, test := range tests {
+		if test.q.Match(msg) != test.expected {
+			t.Errorf("Expected: %v for %#v", test.expected, test.q)
+		}
+	}
+}
+
+func TestListMessagesWhere(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, listMessagesReplay)), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+
+	msgs, err := modem.ListMessagesWhere(MessageQuery{Contains: "a"})
+	if err != nil || len(*msgs) != 2 || (*msgs)[0].Body != "Ola" || (*msgs)[1].Body != "Ja" {
+		t.Errorf("Unexpected messages: %#v %v", msgs, err)
+	}
+	modem.Close()
+}
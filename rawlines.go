@@ -0,0 +1,76 @@
+package gogsmmodem
+
+import (
+	"sync"
+	"time"
+)
+
+// Lines buffered for the RawLines channel before further lines are dropped.
+var RawLinesBuffer = 256
+
+// A line read from or written to the modem, with the Direction EventRead or
+// EventWrite. Lines are not redacted.
+type RawLine struct {
+	Time      time.Time
+	Direction string
+	Line      string
+}
+
+// Copies lines exchanged with the modem to the RawLines channel, once
+// requested
+type rawTap struct {
+	lock   sync.Mutex
+	lines  chan RawLine
+	closed bool
+}
+
+func (self *rawTap) tap(clock Clock, direction, line string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.lines == nil || self.closed {
+		return
+	}
+	select {
+	case self.lines <- RawLine{clock.Now(), direction, line}:
+	default:
+	}
+}
+
+func (self *rawTap) channel() <-chan RawLine {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.lines == nil {
+		self.lines = make(chan RawLine, RawLinesBuffer)
+		if self.closed {
+			close(self.lines)
+		}
+	}
+	return self.lines
+}
+
+func (self *rawTap) close() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.lines != nil && !self.closed {
+		close(self.lines)
+	}
+	self.closed = true
+}
+
+// RawLines returns a channel of every line read from or written to the modem
+// from now on, including those of URC ports, for protocol debugging and
+// recording transcripts. Lines are dropped if the channel is not read. It is
+// closed with the modem.
+func (self *Modem) RawLines() <-chan RawLine {
+	return self.raw.channel()
+}
+
+func (self *Modem) tapRead(line string) {
+	self.recent.read(line)
+	self.raw.tap(self.clock, EventRead, line)
+}
+
+func (self *Modem) tapWrite(line string) {
+	self.recent.write(line)
+	self.raw.tap(self.clock, EventWrite, line)
+}
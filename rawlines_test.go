@@ -0,0 +1,39 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+func TestRawLines(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, messageReplay)), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	lines := modem.RawLines()
+	modem.GetMessage(1)
+	modem.Close()
+
+	var got []RawLine
+	for line := range lines {
+		got = append(got, line)
+	}
+	if len(got) != 4 {
+		t.Fatalf("Expected: 4 lines, got %#v", got)
+	}
+	if got[0].Direction != EventWrite || got[0].Line != "AT+CMGR=1\r\n" || got[0].Time.IsZero() {
+		t.Errorf("Expected: command written, got %#v", got[0])
+	}
+	// bodies are not redacted
+	if got[2].Direction != EventRead || got[2].Line == "<redacted>" {
+		t.Errorf("Expected: message body, got %#v", got[2])
+	}
+	if got[3].Line != "OK" {
+		t.Errorf("Expected: OK line, got %#v", got[3])
+	}
+}
@@ -0,0 +1,150 @@
+package gogsmmodem
+
+import (
+	"sync"
+	"time"
+)
+
+// Number of recent lines and packets kept for RecentEvents. None are kept if
+// 0.
+var RecentEventsSize = 100
+
+// Directions of a RecentEvent
+const (
+	EventRead   = "read"
+	EventWrite  = "write"
+	EventPacket = "packet"
+)
+
+// A line read from or written to the modem, or a packet parsed from its
+// responses. Lines are redacted as for debug logging, and so are message
+// bodies in packets.
+type RecentEvent struct {
+	Time      time.Time
+	Direction string
+	Line      string
+	Packet    Packet
+}
+
+// Ring buffer of recent events
+type recentEvents struct {
+	lock   sync.Mutex
+	clock  Clock
+	redact redactor
+	events []RecentEvent
+	next   int
+	full   bool
+}
+
+func newRecentEvents(clock Clock) *recentEvents {
+	size := RecentEventsSize
+	if size < 0 {
+		size = 0
+	}
+	return &recentEvents{clock: clock, events: make([]RecentEvent, size)}
+}
+
+func (self *recentEvents) add(e RecentEvent) {
+	if self == nil || len(self.events) == 0 {
+		return
+	}
+	e.Time = self.clock.Now()
+	self.events[self.next] = e
+	self.next = (self.next + 1) % len(self.events)
+	if self.next == 0 {
+		self.full = true
+	}
+}
+
+func (self *recentEvents) read(line string) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.add(RecentEvent{Direction: EventRead, Line: self.redact.read(line)})
+}
+
+func (self *recentEvents) write(line string) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.add(RecentEvent{Direction: EventWrite, Line: self.redact.write(line)})
+}
+
+func (self *recentEvents) packet(p Packet) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.add(RecentEvent{Direction: EventPacket, Packet: redactPacket(p)})
+}
+
+// Events oldest first
+func (self *recentEvents) snapshot() []RecentEvent {
+	if self == nil {
+		return nil
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.ordered()
+}
+
+// Events oldest first. The caller must hold the lock.
+func (self *recentEvents) ordered() []RecentEvent {
+	if !self.full {
+		return append([]RecentEvent(nil), self.events[:self.next]...)
+	}
+	return append(append([]RecentEvent(nil), self.events[self.next:]...), self.events[:self.next]...)
+}
+
+// Drop events older than cutoff
+func (self *recentEvents) expire(cutoff time.Time) {
+	if self == nil {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.events) == 0 {
+		return
+	}
+	kept := []RecentEvent{}
+	for _, e := range self.ordered() {
+		if !e.Time.Before(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	self.events = make([]RecentEvent, len(self.events))
+	self.next = copy(self.events, kept) % len(self.events)
+	self.full = len(kept) == len(self.events)
+}
+
+// Hide message bodies in a packet
+func redactPacket(p Packet) Packet {
+	if !RedactSensitive {
+		return p
+	}
+	switch m := p.(type) {
+	case Message:
+		m.Body = "<redacted>"
+		return m
+	case MessageList:
+		list := make(MessageList, len(m))
+		for i, msg := range m {
+			msg.Body = "<redacted>"
+			list[i] = msg
+		}
+		return list
+	}
+	return p
+}
+
+// RecentEvents returns the last RecentEventsSize lines exchanged with the
+// modem and packets parsed from them, oldest first, for attaching to error
+// reports without debug logging enabled.
+func (self *Modem) RecentEvents() []RecentEvent {
+	return self.recent.snapshot()
+}
@@ -0,0 +1,77 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestRecentEvents(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, messageReplay)), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.GetMessage(1)
+	modem.Close()
+
+	events := modem.RecentEvents()
+	if len(events) < 3 {
+		t.Fatalf("Expected: recent events, got %#v", events)
+	}
+	tail := events[len(events)-3:]
+	if tail[0].Direction != EventRead || tail[0].Line != "<redacted>" {
+		t.Errorf("Expected: redacted body, got %#v", tail[0])
+	}
+	if tail[1].Direction != EventRead || tail[1].Line != "OK" {
+		t.Errorf("Expected: OK line, got %#v", tail[1])
+	}
+	msg, ok := tail[2].Packet.(Message)
+	if tail[2].Direction != EventPacket || !ok || msg.Body != "<redacted>" || msg.Telephone != "+441234567890" {
+		t.Errorf("Expected: redacted message packet, got %#v", tail[2])
+	}
+}
+
+func TestRecentEventsWrap(t *testing.T) {
+	recent := &recentEvents{clock: DefaultClock, events: make([]RecentEvent, 2)}
+	recent.write("AT\r\n")
+	recent.read("OK")
+	recent.packet(OK{})
+	events := recent.snapshot()
+	if len(events) != 2 || events[0].Line != "OK" || events[1].Packet != (OK{}) {
+		t.Errorf("Expected: last two events, got %#v", events)
+	}
+}
+
+func TestRecentEventsExpire(t *testing.T) {
+	clock := NewMockClock(time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC))
+	recent := &recentEvents{clock: clock, events: make([]RecentEvent, 2)}
+	recent.write("AT\r\n")
+	clock.Advance(time.Minute)
+	recent.read("OK")
+	recent.expire(clock.Now().Add(-time.Second))
+	events := recent.snapshot()
+	if len(events) != 1 || events[0].Line != "OK" {
+		t.Errorf("Expected: only the recent event, got %#v", events)
+	}
+	recent.write("AT\r\n")
+	recent.read("OK")
+	if events := recent.snapshot(); len(events) != 2 || events[0].Line != "AT\r\n" {
+		t.Errorf("Expected: ring reused after expiry, got %#v", events)
+	}
+}
+
+func TestRecentEventsNone(t *testing.T) {
+	defer func(size int) { RecentEventsSize = size }(RecentEventsSize)
+	RecentEventsSize = 0
+	recent := newRecentEvents(DefaultClock)
+	recent.write("AT\r\n")
+	recent.expire(DefaultClock.Now())
+	if events := recent.snapshot(); len(events) != 0 {
+		t.Errorf("Expected: no events kept, got %#v", events)
+	}
+}
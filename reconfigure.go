@@ -0,0 +1,118 @@
+package gogsmmodem
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// +CNMI parameters set by Open
+var DefaultCNMI = []int{2, 2, 0, 1, 0}
+
+// Settings of a live modem, changed with Reconfigure
+type Settings struct {
+	// +CNMI parameters for new message indications, unchanged if empty
+	CNMI []int
+	// Response timeout, see Modem.Timeout
+	Timeout time.Duration
+	// Character set for messages, see Modem.SetEncoding
+	Encoding Encoding
+	// Minimum interval between sending messages, 0 for no limit
+	SendInterval time.Duration
+}
+
+// Spaces sends by the SendInterval
+type throttle struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Wait for the next send slot, or until ctx is cancelled
+func (self *throttle) wait(ctx context.Context, clock Clock) error {
+	self.lock.Lock()
+	if self.interval == 0 {
+		self.lock.Unlock()
+		return nil
+	}
+	now := clock.Now()
+	if self.next.Before(now) {
+		self.next = now
+	}
+	wait := self.next.Sub(now)
+	self.next = self.next.Add(self.interval)
+	self.lock.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	select {
+	case <-clock.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (self *throttle) get() time.Duration {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.interval
+}
+
+func (self *throttle) set(interval time.Duration) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.interval = interval
+}
+
+// Settings returns the modem's current settings, for changing with
+// Reconfigure.
+func (self *Modem) Settings() Settings {
+	var s Settings
+	self.hold(context.Background(), func() error {
+		s = Settings{
+			CNMI:         append([]int(nil), self.cnmi...),
+			Timeout:      self.Timeout,
+			Encoding:     self.Encoding(),
+			SendInterval: self.throttle.get(),
+		}
+		return nil
+	})
+	return s
+}
+
+// Reconfigure changes the modem's settings while it is in use, between
+// commands, sending the AT commands needed. Queued commands and messages are
+// kept. If the modem rejects a change, the settings from before it are left
+// in place.
+func (self *Modem) Reconfigure(s Settings) error {
+	return self.hold(context.Background(), func() error {
+		if len(s.CNMI) > 0 && !reflect.DeepEqual(s.CNMI, self.cnmi) {
+			if _, err := self.request(self.Timeout, "+CNMI", intArgs(s.CNMI)...); err != nil {
+				return err
+			}
+			self.cnmi = append([]int(nil), s.CNMI...)
+			self.cnmiSet = true
+		}
+		if enc := self.negotiate(s.Encoding); enc != self.Encoding() {
+			if err := self.setEncoding(enc); err != nil {
+				return err
+			}
+		}
+		if s.Timeout > 0 {
+			self.Timeout = s.Timeout
+		}
+		self.throttle.set(s.SendInterval)
+		return nil
+	})
+}
+
+// Command arguments from ints
+func intArgs(ns []int) []interface{} {
+	args := make([]interface{}, len(ns))
+	for i, n := range ns {
+		args[i] = n
+	}
+	return args
+}
@@ -0,0 +1,77 @@
+package gogsmmodem
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+var reconfigureReplay = []string{
+	"->AT+CNMI=2,1,0,0,0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=1,1,0,0,0\r\n",
+	"<-\r\nERROR\r\n",
+}
+
+func TestReconfigure(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, reconfigureReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	s := modem.Settings()
+	if !reflect.DeepEqual(s.CNMI, DefaultCNMI) || s.Timeout != DefaultTimeout {
+		t.Errorf("Unexpected settings: %#v", s)
+	}
+
+	s.CNMI = []int{2, 1, 0, 0, 0}
+	s.Timeout = 10 * time.Second
+	s.SendInterval = time.Minute
+	if err := modem.Reconfigure(s); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if got := modem.Settings(); !reflect.DeepEqual(got, s) {
+		t.Errorf("Expected: %#v, got %#v", s, got)
+	}
+
+	// rejected
+	rejected := s
+	rejected.CNMI = []int{1, 1, 0, 0, 0}
+	rejected.Timeout = time.Second
+	if err := modem.Reconfigure(rejected); err == nil {
+		t.Error("Expected: error")
+	}
+	if got := modem.Settings(); !reflect.DeepEqual(got, s) {
+		t.Errorf("Expected: settings unchanged, got %#v", got)
+	}
+
+	// no CNMI leaves it unchanged, without a command
+	unset := s
+	unset.CNMI = nil
+	unset.SendInterval = 0
+	if err := modem.Reconfigure(unset); err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if got := modem.Settings(); !reflect.DeepEqual(got.CNMI, s.CNMI) || got.SendInterval != 0 {
+		t.Errorf("Expected: CNMI unchanged, got %#v", got)
+	}
+	modem.Close()
+}
+
+func TestThrottle(t *testing.T) {
+	throttle := &throttle{interval: time.Minute}
+	if err := throttle.wait(context.Background(), DefaultClock); err != nil {
+		t.Error("Expected: first send immediately, got:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := throttle.wait(ctx, DefaultClock); err != context.Canceled {
+		t.Error("Expected: second send to wait, got:", err)
+	}
+}
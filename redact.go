@@ -0,0 +1,72 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A rule replacing sensitive data in logged commands
+type RedactRule struct {
+	Pattern *regexp.Regexp
+	Replace string
+}
+
+// Redact PINs, passwords and message bodies from debug logs. Disable only
+// when debugging with test SIMs.
+var RedactSensitive = true
+
+// Rules applied to logged data when RedactSensitive is set.
+var RedactRules = []RedactRule{
+	// AT+CPIN="1234" or AT+CPIN="PUK","new PIN"
+	{regexp.MustCompile(`(AT\+CPIN=)[^\r\n]*`), `${1}"****"`},
+	// AT+CPWD="SC","old","new"
+	{regexp.MustCompile(`(AT\+CPWD=[^,\r\n]*,)[^\r\n]*`), `${1}"****"`},
+	// AT+CLCK="SC",1,"1234"
+	{regexp.MustCompile(`(AT\+CLCK=[^,\r\n]*,[^,\r\n]*,)[^\r\n]*`), `${1}"****"`},
+}
+
+// Headers followed by message body lines
+var reBodyHeader = regexp.MustCompile(`^\+(CMGR|CMGL|CMT|CDS):`)
+
+// Redacts logged data, tracking whether the lines read next are message
+// bodies.
+type redactor struct {
+	inBody bool
+}
+
+// Redact data written to the modem
+func (self *redactor) write(s string) string {
+	if !RedactSensitive {
+		return s
+	}
+	if strings.HasSuffix(s, "\x1a") {
+		// message body entered after the > prompt
+		return fmt.Sprintf("<redacted %d bytes>\x1a", len(s)-1)
+	}
+	for _, rule := range RedactRules {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replace)
+	}
+	return s
+}
+
+// Redact data read from the modem
+func (self *redactor) read(s string) string {
+	if !RedactSensitive {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case reBodyHeader.MatchString(trimmed):
+			self.inBody = true
+		case isFinalStatus(trimmed):
+			self.inBody = false
+		case self.inBody:
+			lines[i] = "<redacted>" + line[len(strings.TrimRight(line, "\r\n")):]
+		}
+	}
+	return strings.Join(lines, "")
+}
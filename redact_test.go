@@ -0,0 +1,62 @@
+package gogsmmodem
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedactWrite(t *testing.T) {
+	r := &redactor{}
+	tests := []struct{ in, out string }{
+		{"AT+CPIN=\"1234\"\r\n", "AT+CPIN=\"****\"\r\n"},
+		{"AT+CPIN=\"12345678\",\"1234\"\r\n", "AT+CPIN=\"****\"\r\n"},
+		{"AT+CLCK=\"SC\",1,\"1234\"\r\n", "AT+CLCK=\"SC\",1,\"****\"\r\n"},
+		{"AT+CPWD=\"SC\",\"1234\",\"4321\"\r\n", "AT+CPWD=\"SC\",\"****\"\r\n"},
+		{"AT+CPIN?\r\n", "AT+CPIN?\r\n"},
+		{"Secret body\x1a", "<redacted 11 bytes>\x1a"},
+	}
+	for _, test := range tests {
+		if out := r.write(test.in); out != test.out {
+			t.Errorf("Expected: %q, got %q", test.out, out)
+		}
+	}
+}
+
+func TestRedactRead(t *testing.T) {
+	r := &redactor{}
+	reads := []struct{ in, out string }{
+		{"\r\n+CMGR: \"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\"\r\nSecret", "\r\n+CMGR: \"REC READ\",\"+441234567890\",,\"14/02/01,15:07:43+00\"\r\n<redacted>"},
+		{" body\r\n\r\nOK\r\n", "<redacted>\r\n\r\nOK\r\n"},
+		{"\r\n+CSQ: 17,99\r\n", "\r\n+CSQ: 17,99\r\n"},
+	}
+	for _, test := range reads {
+		if out := r.read(test.in); out != test.out {
+			t.Errorf("Expected: %q, got %q", test.out, out)
+		}
+	}
+}
+
+func TestRedactOOBLog(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	modem := newReplayModem(nil)
+	defer modem.Close()
+	msg := Message{Telephone: "+441234567890", Body: "Secret body"}
+
+	modemDispatcher{modem}.Unsolicited(msg)
+	if logged.Len() != 0 {
+		t.Error("Expected: nothing logged without debug, got:", logged.String())
+	}
+	modem.Debug = true
+	modemDispatcher{modem}.Unsolicited(msg)
+	if !strings.Contains(logged.String(), "OOB packet") || strings.Contains(logged.String(), "Secret") {
+		t.Error("Expected: OOB packet logged with the body redacted, got:", logged.String())
+	}
+	if p := <-modem.OOB; p != msg {
+		t.Errorf("Expected: %#v on OOB, got %#v", msg, p)
+	}
+}
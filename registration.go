@@ -0,0 +1,196 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrNotRegistered = errors.New("Not registered on the network")
+
+// Timings of recovering lost registration, see WatchRegistration. Zero
+// fields take the defaults.
+type Reregistration struct {
+	// Wait this long for the modem to register again by itself before
+	// reselecting the network with +COPS=0, default 30s
+	SelectAfter time.Duration
+	// Cycle the radio with +CFUN instead once registration has been lost
+	// this long, default 5 minutes
+	ResetAfter time.Duration
+	// Delay between attempts, doubling after each up to MaxBackoff, default
+	// 30s and 10 minutes
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Recovery in progress
+type registrationWatch struct {
+	Reregistration
+	// latest +CREG and +CEREG statuses
+	cs, eps int
+	// status that lost registration, and when
+	status  int
+	lostAt  time.Time
+	attempt int
+}
+
+// Registration on either network, as an LTE-only modem may not register
+// with +CREG
+func (self *registrationWatch) registration() NetworkRegistration {
+	eps := NetworkRegistration{-1, self.eps}
+	if eps.Registered() || self.cs == RegUnknown {
+		return eps
+	}
+	return NetworkRegistration{-1, self.cs}
+}
+
+// WatchRegistration enables unsolicited +CREG and +CEREG and, when the modem
+// loses registration on both, recovers it until stop is called or the port
+// drops: waiting r.SelectAfter for the modem to register by itself, then
+// reselecting the network and, after r.ResetAfter, cycling the radio, backing
+// off between attempts. Each transition is emitted on OOB as a
+// RegistrationState. Sends wait up to CoverageWait for recovery, then fail
+// with ErrNotRegistered without troubling the modem.
+func (self *Modem) WatchRegistration(r Reregistration) (stop func()) {
+	if r.SelectAfter == 0 {
+		r.SelectAfter = 30 * time.Second
+	}
+	if r.ResetAfter == 0 {
+		r.ResetAfter = 5 * time.Minute
+	}
+	if r.Backoff == 0 {
+		r.Backoff = 30 * time.Second
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = 10 * time.Minute
+	}
+	sub := self.Subscribe(SubscribeOptions{Topics: []Topic{TopicOf(NetworkRegistration{}), TopicOf(EPSRegistration{})}})
+	quit := make(chan struct{})
+	go func() {
+		defer sub.Close()
+		w := &registrationWatch{Reregistration: r, cs: RegUnknown, eps: RegUnknown}
+		// sends no longer wait for a recovery that will not come
+		defer func() {
+			if !w.lostAt.IsZero() {
+				self.emit(RegistrationState{RegistrationStopped, w.status, w.attempt})
+			}
+			self.registered()
+		}()
+		if _, err := self.sendContext(healthCheck, PriorityHigh, "+CREG", 1); err != nil {
+			log.Println("Registration: enabling +CREG", err)
+		}
+		if self.Supports(FeatureEPS) {
+			if _, err := self.sendContext(healthCheck, PriorityHigh, "+CEREG", 1); err != nil {
+				if _, ok := err.(ERROR); ok {
+					self.stateLock.Lock()
+					self.epsRejected = true
+					self.stateLock.Unlock()
+				} else {
+					log.Println("Registration: enabling +CEREG", err)
+				}
+			}
+		}
+		var retry <-chan time.Time
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				switch reg := e.Packet.(type) {
+				case NetworkRegistration:
+					w.cs = reg.Status
+				case EPSRegistration:
+					w.eps = reg.Status
+				}
+				if next := self.registrationChanged(w, w.registration()); next != nil || w.lostAt.IsZero() {
+					retry = next
+				}
+			case <-retry:
+				retry = self.recoverRegistration(w)
+			case <-self.done:
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() { close(quit) }
+}
+
+// Note a registration change, returning when to first attempt recovery if
+// registration has just been lost
+func (self *Modem) registrationChanged(w *registrationWatch, reg NetworkRegistration) <-chan time.Time {
+	self.stats.registered(reg.Status)
+	switch {
+	case reg.Registered():
+		if !w.lostAt.IsZero() {
+			self.registrationRecovered(w)
+		}
+	case reg.Status == RegUnknown || !w.lostAt.IsZero():
+	default:
+		w.status = reg.Status
+		w.lostAt = self.clock.Now()
+		w.attempt = 0
+		self.stateLock.Lock()
+		self.unregistered = make(chan struct{})
+		self.stateLock.Unlock()
+		log.Printf("Registration lost with status %d", reg.Status)
+		self.emit(RegistrationState{RegistrationLost, w.status, 0})
+		return self.clock.After(w.SelectAfter)
+	}
+	return nil
+}
+
+// Make a recovery attempt, returning when to make the next, or nil once
+// registered
+func (self *Modem) recoverRegistration(w *registrationWatch) <-chan time.Time {
+	w.attempt++
+	var err error
+	if self.clock.Now().Sub(w.lostAt) >= w.ResetAfter {
+		self.emit(RegistrationState{RegistrationResetting, w.status, w.attempt})
+		err = self.hold(healthCheck, self.softReset)
+	} else {
+		self.emit(RegistrationState{RegistrationSelecting, w.status, w.attempt})
+		_, err = self.sendContext(healthCheck, PriorityHigh, "+COPS", 0)
+	}
+	if err != nil {
+		log.Println("Registration: recovery attempt", w.attempt, err)
+	}
+	if reg, err := self.networkRegistration(healthCheck); err == nil && reg.Registered() {
+		self.registrationRecovered(w)
+		return nil
+	}
+	backoff := w.Backoff
+	for i := 1; i < w.attempt && backoff < w.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > w.MaxBackoff {
+		backoff = w.MaxBackoff
+	}
+	return self.clock.After(backoff)
+}
+
+func (self *Modem) registrationRecovered(w *registrationWatch) {
+	log.Printf("Registration recovered after %d attempts", w.attempt)
+	self.emit(RegistrationState{RegistrationRecovered, w.status, w.attempt})
+	w.lostAt = time.Time{}
+	self.registered()
+}
+
+// Release sends waiting for registration
+func (self *Modem) registered() {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	if self.unregistered != nil {
+		close(self.unregistered)
+		self.unregistered = nil
+	}
+}
+
+// Closed once lost registration is recovered, or nil if registered
+func (self *Modem) registrationLost() chan struct{} {
+	self.stateLock.Lock()
+	defer self.stateLock.Unlock()
+	return self.unregistered
+}
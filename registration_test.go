@@ -0,0 +1,221 @@
+package gogsmmodem
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+var reregistrationReplay = []string{
+	"->AT+COPS=0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,2\r\n\r\nOK\r\n",
+	// no LTE registration
+	"->AT+CEREG?\r\n",
+	"<-\r\nERROR\r\n",
+	"->AT+CFUN=0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CFUN=1\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,1\r\n\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,1\r\n\r\nOK\r\n",
+}
+
+func TestRecoverRegistration(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, reregistrationReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	w := &registrationWatch{Reregistration: Reregistration{SelectAfter: time.Second, ResetAfter: time.Minute, Backoff: time.Second, MaxBackoff: time.Minute}}
+	if modem.registrationChanged(w, NetworkRegistration{-1, RegSearching}) == nil {
+		t.Error("Expected: recovery scheduled")
+	}
+	// sends fail without reaching the modem
+	if _, err := modem.Send(OutgoingMessage{Telephone: "441234567890", Body: "Body@"}); err != ErrNotRegistered {
+		t.Error("Expected: ErrNotRegistered, got:", err)
+	}
+	if modem.recoverRegistration(w) == nil {
+		t.Error("Expected: another attempt scheduled")
+	}
+	DefaultClock.Sleep(time.Minute)
+	if modem.recoverRegistration(w) != nil || modem.registrationLost() != nil {
+		t.Error("Expected: registration recovered")
+	}
+	modem.Close()
+	assertOOBCommands(t, modem, []Packet{
+		RegistrationState{RegistrationLost, RegSearching, 0},
+		MessageSent{"", "441234567890", 0, ErrNotRegistered},
+		RegistrationState{RegistrationSelecting, RegSearching, 1},
+		RegistrationState{RegistrationResetting, RegSearching, 2},
+		RegistrationState{RegistrationRecovered, RegSearching, 2},
+	})
+}
+
+var registrationReplay = []string{
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,0\r\n\r\nOK\r\n",
+	"->AT+CEREG?\r\n",
+	"<-\r\n+CEREG: 0,5\r\n\r\nOK\r\n",
+	"->AT+COPS?\r\n",
+	"<-\r\n+COPS: 0,0,\"EE\",7\r\n\r\nOK\r\n",
+	"->AT+CREG=2\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CEREG=2\r\n",
+	"<-\r\nOK\r\n",
+	"<-\r\n+CEREG: 1,\"1A2B\",\"01A2B3C4\",7\r\n",
+}
+
+func TestNetworkRegistrationLTE(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, registrationReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	// registered on LTE alone
+	if reg, err := modem.NetworkRegistration(); err != nil || *reg != (NetworkRegistration{0, RegRoaming}) {
+		t.Errorf("Expected: roaming on LTE, got %#v %v", reg, err)
+	}
+	if op, err := modem.OperatorName(); err != nil || *op != (NetworkOperator{0, "EE", 7}) {
+		t.Errorf("Expected: operator, got %#v %v", op, err)
+	}
+	if err := modem.ReportRegistration(); err != nil || !modem.Supports(FeatureEPS) {
+		t.Error("Expected: no error, got:", err)
+	}
+	for p := range modem.OOB {
+		if reg, ok := p.(EPSRegistration); ok {
+			if reg != (EPSRegistration{-1, RegHome}) {
+				t.Errorf("Unexpected registration: %#v", reg)
+			}
+			break
+		}
+	}
+	modem.Close()
+}
+
+func TestWatchRegistrationStopped(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			"->AT+CREG=1\r\n",
+			"<-\r\nOK\r\n",
+			"->AT+CEREG=1\r\n",
+			"<-\r\nOK\r\n",
+			"<-\r\n+CREG: 2\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	stop := modem.WatchRegistration(Reregistration{})
+	nextState := func() RegistrationState {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case p := <-modem.OOB:
+				if r, ok := p.(RegistrationState); ok {
+					return r
+				}
+			case <-timeout:
+				t.Fatal("Expected: registration state")
+			}
+		}
+	}
+	if r := nextState(); r.State != RegistrationLost {
+		t.Error("Expected: registration lost, got:", r)
+	}
+	// stopped before recovery
+	stop()
+	if r := nextState(); r != (RegistrationState{RegistrationStopped, RegSearching, 0}) {
+		t.Error("Expected: watching stopped, got:", r)
+	}
+	if modem.registrationLost() != nil {
+		t.Error("Expected: sends no longer waiting")
+	}
+	modem.Close()
+}
+
+func TestWatchRegistrationClosed(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			"->AT+CREG=1\r\n",
+			"<-\r\nOK\r\n",
+			"->AT+CEREG=1\r\n",
+			"<-\r\nOK\r\n",
+			"<-\r\n+CREG: 2\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.WatchRegistration(Reregistration{})
+	for modem.registrationLost() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	// the watcher stops without emitting on the closed OOB channel
+	modem.Close()
+	for p := range modem.OOB {
+		if r, ok := p.(RegistrationState); ok && r.State == RegistrationStopped {
+			t.Error("Expected: nothing emitted once closed, got:", r)
+		}
+	}
+	timeout := time.After(time.Second)
+	for modem.registrationLost() != nil {
+		select {
+		case <-timeout:
+			t.Fatal("Expected: watching stopped")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if err := modem.Close(); err != nil {
+		t.Error("Expected: closing again does nothing, got:", err)
+	}
+}
+
+func TestWatchRegistrationLTE(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			"->AT+CREG=1\r\n",
+			"<-\r\nOK\r\n",
+			"->AT+CEREG=1\r\n",
+			"<-\r\nOK\r\n",
+			"<-\r\n+CREG: 2\r\n",
+			// registered on LTE, still not with +CREG
+			"<-\r\n+CEREG: 5\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	stop := modem.WatchRegistration(Reregistration{})
+	var states []RegistrationState
+	timeout := time.After(time.Second)
+	for len(states) < 2 {
+		select {
+		case p := <-modem.OOB:
+			if r, ok := p.(RegistrationState); ok {
+				states = append(states, r)
+			}
+		case <-timeout:
+			t.Fatal("Expected: registration states, got:", states)
+		}
+	}
+	expected := []RegistrationState{{RegistrationLost, RegSearching, 0}, {RegistrationRecovered, RegSearching, 0}}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("Expected: lost and recovered, got %#v", states)
+	}
+	stop()
+	modem.Close()
+}
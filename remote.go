@@ -0,0 +1,117 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Commands a RemoteConsole refuses unless Denied is set: those prompting for
+// a body, which cannot be given by SMS, and those which could lock out the
+// SIM.
+var DefaultRemoteDenied = []string{"+CMGS", "+CMGW", "+CMGC", "+CPWD", "+CLCK", "+CPIN"}
+
+var ErrRemoteDenied = errors.New("Command not allowed remotely")
+
+// Lets field support run AT commands on an unreachable device by SMS: a
+// message "AT+CSQ" from an Allowed number is run with Modem.Command and the
+// response texted back. Nothing is run unless numbers are allowed.
+type RemoteConsole struct {
+	// Numbers allowed to run commands, as reported in Message.Telephone
+	Allowed []string
+	// Required before the command if set, eg "1234 AT+CSQ", as sender
+	// numbers can be spoofed
+	PIN string
+	// Commands refused, eg "+CFUN", DefaultRemoteDenied if nil
+	Denied []string
+}
+
+// Is the command, or any chained after it with ";", refused
+func (self RemoteConsole) denied(cmd string) bool {
+	denied := self.Denied
+	if denied == nil {
+		denied = DefaultRemoteDenied
+	}
+	for _, c := range strings.Split(cmd, ";") {
+		// modems ignore spaces within a command name
+		name := strings.Join(strings.Fields(strings.SplitN(c, "=", 2)[0]), "")
+		name = strings.ToUpper(strings.TrimRight(name, "?"))
+		for _, d := range denied {
+			if name == strings.ToUpper(d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The command in a message from an allowed number with the right PIN, or ""
+func (self RemoteConsole) command(msg Message) string {
+	allowed := false
+	for _, n := range self.Allowed {
+		allowed = allowed || n == msg.Telephone
+	}
+	body := strings.TrimSpace(msg.Body)
+	if self.PIN != "" {
+		fields := strings.SplitN(body, " ", 2)
+		if len(fields) != 2 || fields[0] != self.PIN {
+			return ""
+		}
+		body = strings.TrimSpace(fields[1])
+	}
+	if !allowed || len(body) < 2 || strings.ToUpper(body[:2]) != "AT" {
+		return ""
+	}
+	return body
+}
+
+// RemoteCommand runs the command in msg if it is one for the console c, texting
+// the response, or the error, back to the sender. It reports whether msg was a
+// command, which the caller should not treat as an ordinary message. Commands
+// which are refused are answered with ErrRemoteDenied.
+func (self *Modem) RemoteCommand(c RemoteConsole, msg Message) (bool, error) {
+	line := c.command(msg)
+	if line == "" {
+		return false, nil
+	}
+	cmd := line[2:]
+	log.Printf("Remote command from %s: %s", msg.Telephone, line)
+	var reply string
+	if strings.ContainsAny(cmd, "\r\n\x1a\x1b") || c.denied(cmd) {
+		reply = ErrRemoteDenied.Error()
+	} else {
+		reply = remoteReply(self.Command(cmd))
+	}
+	_, err := self.Send(OutgoingMessage{Telephone: msg.Telephone, Body: fitSegment(reply), Encoding: Auto})
+	return true, err
+}
+
+// Text of a command's response
+func remoteReply(p Packet, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	switch r := p.(type) {
+	case OK:
+		return "OK"
+	case InfoText:
+		return r.Text
+	case UnknownPacket:
+		args := make([]string, len(r.Args))
+		for i, a := range r.Args {
+			args[i] = fmt.Sprint(a)
+		}
+		return r.Command + ": " + strings.Join(args, ",")
+	}
+	return fmt.Sprintf("%+v", p)
+}
+
+// Truncate text to a single segment
+func fitSegment(text string) string {
+	runes := []rune(text)
+	for len(runes) > 0 && SegmentCount(string(runes), resolveEncoding(Auto, string(runes))) > 1 {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes)
+}
@@ -0,0 +1,66 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+	"github.com/tarm/serial"
+)
+
+// Replay of texting body to +441234567890
+func replyReplay(body string) []string {
+	hexpdu, length, _ := pdu.EncodeSubmit("+441234567890", body, false)
+	return []string{fmt.Sprintf("->AT+CMGS=%d\r\n", length), "<-> \r\n", "->" + hexpdu + "\x1a", "<-\r\n+CMGS: 12\r\n\r\nOK\r\n"}
+}
+
+func TestRemoteCommand(t *testing.T) {
+	replay := appendLists(initReplay, []string{"->AT+CSQ\r\n", "<-\r\n+CSQ: 20,99\r\n\r\nOK\r\n"}, replyReplay("{RSSI:20 BER:99}"), replyReplay("Command not allowed remotely"))
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(replay), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	c := RemoteConsole{Allowed: []string{"+441234567890"}, PIN: "1234"}
+	tests := []struct {
+		msg     Message
+		handled bool
+	}{
+		{Message{Telephone: "+441234567890", Body: "1234 at+CSQ"}, true},
+		{Message{Telephone: "+449999999999", Body: "1234 AT+CSQ"}, false},
+		{Message{Telephone: "+441234567890", Body: "AT+CSQ"}, false},
+		{Message{Telephone: "+441234567890", Body: "1234 Hello"}, false},
+		{Message{Telephone: "+441234567890", Body: "1234 AT+CPIN=\"0000\""}, true},
+	}
+	for _, test := range tests {
+		if handled, err := modem.RemoteCommand(c, test.msg); handled != test.handled || err != nil {
+			t.Errorf("Expected: %v for %q, got %v %v", test.handled, test.msg.Body, handled, err)
+		}
+	}
+	modem.Close()
+}
+
+func TestRemoteDenied(t *testing.T) {
+	c := RemoteConsole{}
+	tests := []struct {
+		cmd    string
+		denied bool
+	}{
+		{"+CSQ", false},
+		{"+CSQ;+CREG?", false},
+		{"+CPIN?", true},
+		{"+CSQ;+CPIN=\"0000\"", true},
+		{" +CPIN=\"0000\"", true},
+		{"+C PIN=\"0000\"", true},
+		{"+csq;+clck=\"SC\",1,\"0000\"", true},
+		{"+CSQ; +CLCK =\"SC\",1,\"0000\"", true},
+	}
+	for _, test := range tests {
+		if denied := c.denied(test.cmd); denied != test.denied {
+			t.Errorf("Expected: %v for %q, got %v", test.denied, test.cmd, denied)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Responses buffered for the command waiting. Further responses are dropped,
+// and the modem resynchronised.
+const responseBuffer = 16
+
+// How long to wait for stray responses to arrive before resynchronising
+var ResyncDelay = 1 * time.Second
+
+// Timeout for each attempt to resynchronise
+var ResyncTimeout = 5 * time.Second
+
+// Attempts made to resynchronise before giving up
+var ResyncAttempts = 3
+
+var ErrResyncFailed = errors.New("Failed to resynchronise with the modem")
+
+// A response packet and the generation of the command it answers
+type tagged struct {
+	generation uint64
+	packet     Packet
+}
+
+// Resynchronisation after responses lost track of commands, emitted on OOB
+type Resynchronised struct {
+	Attempts int
+}
+
+// Note that responses may no longer match commands, after a timeout, a
+// stale response or a result with no command pending. The modem is
+// resynchronised before the next command.
+func (self *Modem) desynchronise() {
+	atomic.StoreInt32(&self.desynced, 1)
+}
+
+func (self *Modem) desynchronised() bool {
+	return atomic.LoadInt32(&self.desynced) == 1
+}
+
+// Wait for stray responses and discard them, then send AT until the modem
+// answers OK. The caller must hold the modem.
+func (self *Modem) resync() error {
+	for i := 1; i <= ResyncAttempts; i++ {
+		if i > 1 {
+			self.stats.retried()
+		}
+		self.clock.Sleep(ResyncDelay)
+		self.flush()
+		self.generation++
+		if err := self.write(formatCommand("")); err != nil {
+			return err
+		}
+		packet, err := self.receiveTimeout(ResyncTimeout)
+		if err == ErrPortClosed {
+			return err
+		}
+		if _, ok := packet.(OK); ok && err == nil {
+			atomic.StoreInt32(&self.desynced, 0)
+			self.emit(Resynchronised{i})
+			return nil
+		}
+		log.Println("Resync attempt", i, "failed:", packet, err)
+	}
+	self.desynchronise()
+	return ErrResyncFailed
+}
+
+// Discard buffered responses
+func (self *Modem) flush() {
+	for {
+		select {
+		case response := <-self.rx:
+			log.Printf("Discarded stale response: %#v", response.packet)
+		default:
+			return
+		}
+	}
+}
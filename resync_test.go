@@ -0,0 +1,67 @@
+package gogsmmodem
+
+import (
+	"testing"
+	"time"
+)
+
+var resyncReplay = []string{
+	"->AT+CSQ\r\n",
+	"->AT\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,1\r\n\r\nOK\r\n",
+}
+
+func TestResync(t *testing.T) {
+	defer func(delay time.Duration) { ResyncDelay = delay }(ResyncDelay)
+	ResyncDelay = 10 * time.Millisecond
+	modem := newReplayModem(resyncReplay)
+	modem.clock = systemClock{}
+	modem.Timeout = 10 * time.Millisecond
+
+	if _, err := modem.SignalQuality(); err != ErrTimeout {
+		t.Fatal("Expected: timeout, got:", err)
+	}
+	// the response turns up late
+	modem.port.(*MockSerialPort).Inject("\r\n+CSQ: 14,99\r\n\r\nOK\r\n")
+	reg, err := modem.NetworkRegistration()
+	if err != nil || reg.Status != RegHome {
+		t.Fatalf("Expected: registration, got %v %v", reg, err)
+	}
+	if p := <-modem.OOB; p != (Resynchronised{1}) {
+		t.Errorf("Expected: resynchronised, got %#v", p)
+	}
+}
+
+func TestResyncRetries(t *testing.T) {
+	defer func(delay, timeout time.Duration) {
+		ResyncDelay, ResyncTimeout = delay, timeout
+	}(ResyncDelay, ResyncTimeout)
+	ResyncDelay = time.Millisecond
+	ResyncTimeout = 10 * time.Millisecond
+	modem := newReplayModem([]string{
+		"->AT+CSQ\r\n",
+		// no answer to the first attempt
+		"->AT\r\n",
+		"->AT\r\n",
+		"<-\r\nOK\r\n",
+		"->AT+CREG?\r\n",
+		"<-\r\n+CREG: 0,1\r\n\r\nOK\r\n",
+	})
+	modem.clock = systemClock{}
+	modem.Timeout = 10 * time.Millisecond
+
+	if _, err := modem.SignalQuality(); err != ErrTimeout {
+		t.Fatal("Expected: timeout, got:", err)
+	}
+	if _, err := modem.NetworkRegistration(); err != nil {
+		t.Fatal("Expected: registration, got:", err)
+	}
+	if p := <-modem.OOB; p != (Resynchronised{2}) {
+		t.Errorf("Expected: resynchronised at the second attempt, got %#v", p)
+	}
+	if s := modem.Stats(); s.Retries != 1 {
+		t.Error("Expected: 1 retry, got:", s.Retries)
+	}
+}
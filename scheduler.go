@@ -0,0 +1,149 @@
+package gogsmmodem
+
+import (
+	"context"
+	"sync"
+)
+
+// Priority of a command waiting for the modem
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context which queues commands at the given priority.
+// Commands of equal priority run in the order they were issued.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// The priority set on ctx, or def if none
+func priorityFrom(ctx context.Context, def Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return def
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+}
+
+// Grants exclusive use of the modem to one command at a time, highest
+// priority first.
+type scheduler struct {
+	lock    sync.Mutex
+	busy    bool
+	seq     uint64
+	waiting []*waiter
+}
+
+// Wait for the modem, or until ctx is cancelled.
+func (self *scheduler) acquire(ctx context.Context, priority Priority) error {
+	self.lock.Lock()
+	if !self.busy {
+		self.busy = true
+		self.lock.Unlock()
+		return nil
+	}
+	w := &waiter{priority, self.seq, make(chan struct{})}
+	self.seq++
+	self.waiting = append(self.waiting, w)
+	self.lock.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		for i, other := range self.waiting {
+			if other == w {
+				self.waiting = append(self.waiting[:i], self.waiting[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// granted while being cancelled, pass it on
+		self.next()
+		return ctx.Err()
+	}
+}
+
+func (self *scheduler) release() {
+	self.lock.Lock()
+	self.next()
+	self.lock.Unlock()
+}
+
+// Is no command running or waiting
+func (self *scheduler) idle() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return !self.busy && len(self.waiting) == 0
+}
+
+// Commands running or waiting
+func (self *scheduler) depth() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	n := len(self.waiting)
+	if self.busy {
+		n++
+	}
+	return n
+}
+
+// Hand the modem to the best waiter. The caller must hold lock.
+func (self *scheduler) next() {
+	if len(self.waiting) == 0 {
+		self.busy = false
+		return
+	}
+	best := 0
+	for i, w := range self.waiting {
+		b := self.waiting[best]
+		if w.priority > b.priority || (w.priority == b.priority && w.seq < b.seq) {
+			best = i
+		}
+	}
+	w := self.waiting[best]
+	self.waiting = append(self.waiting[:best], self.waiting[best+1:]...)
+	close(w.ready)
+}
+
+type acquiredKey struct{}
+
+// withAcquired returns a context which calls f each time a command queued
+// with it is given the modem, before anything is written to the port. The
+// command is abandoned with the context's error if f returns false.
+func withAcquired(ctx context.Context, f func() bool) context.Context {
+	return context.WithValue(ctx, acquiredKey{}, f)
+}
+
+// Run f with exclusive use of the modem, at the priority from ctx.
+func (self *Modem) exec(ctx context.Context, def Priority, f func() (Packet, error)) (Packet, error) {
+	if err := self.sched.acquire(ctx, priorityFrom(ctx, def)); err != nil {
+		return nil, err
+	}
+	defer self.sched.release()
+	if acquired, ok := ctx.Value(acquiredKey{}).(func() bool); ok && !acquired() {
+		return nil, ctx.Err()
+	}
+	return f()
+}
+
+// Run f with exclusive use of the modem, for sequences of commands which must
+// not be interleaved with others.
+func (self *Modem) hold(ctx context.Context, f func() error) error {
+	_, err := self.exec(ctx, PriorityNormal, func() (Packet, error) {
+		return nil, f()
+	})
+	return err
+}
@@ -0,0 +1,82 @@
+package gogsmmodem
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerPriority(t *testing.T) {
+	s := &scheduler{}
+	bg := context.Background()
+	s.acquire(bg, PriorityNormal)
+
+	order := make(chan Priority, 3)
+	start := func(p Priority) {
+		go func() {
+			s.acquire(bg, p)
+			order <- p
+			s.release()
+		}()
+		// wait until queued
+		for {
+			s.lock.Lock()
+			n := len(s.waiting)
+			queued := n > 0 && s.waiting[n-1].priority == p
+			s.lock.Unlock()
+			if queued {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	start(PriorityLow)
+	start(PriorityNormal)
+	start(PriorityHigh)
+	s.release()
+
+	for _, expected := range []Priority{PriorityHigh, PriorityNormal, PriorityLow} {
+		if p := <-order; p != expected {
+			t.Errorf("Expected: %v, got %v", expected, p)
+		}
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s := &scheduler{}
+	s.acquire(context.Background(), PriorityNormal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.acquire(ctx, PriorityNormal)
+	}()
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected: %v, got %v", context.Canceled, err)
+	}
+	s.release()
+	if s.busy || len(s.waiting) != 0 {
+		t.Error("Expected: scheduler to be idle")
+	}
+}
+
+func TestExecAbandonedWhenAcquired(t *testing.T) {
+	modem := &Modem{}
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = withAcquired(ctx, func() bool {
+		cancel()
+		return false
+	})
+	ran := false
+	_, err := modem.exec(ctx, PriorityNormal, func() (Packet, error) {
+		ran = true
+		return nil, nil
+	})
+	if ran || err != context.Canceled {
+		t.Errorf("Expected: command abandoned, got ran %v, %v", ran, err)
+	}
+	if !modem.sched.idle() {
+		t.Error("Expected: modem released")
+	}
+}
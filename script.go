@@ -0,0 +1,67 @@
+package gogsmmodem
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/barnybug/gogsmmodem/pdu"
+)
+
+// Alphabets reported by DetectScript
+const (
+	AlphabetGSM7   = "GSM-7"
+	AlphabetLatin1 = "Latin-1"
+	AlphabetUCS2   = "UCS2"
+)
+
+// The alphabet and writing systems of a message body, from DetectScript.
+type ScriptInfo struct {
+	// Smallest alphabet the body fits: GSM-7, Latin-1 or UCS2
+	Alphabet string
+	// Unicode scripts of the letters in the body, eg "Latin", "Arabic",
+	// most frequent first
+	Scripts []string
+}
+
+// The most frequent script, or "" if the body has no letters
+func (self ScriptInfo) Dominant() string {
+	if len(self.Scripts) == 0 {
+		return ""
+	}
+	return self.Scripts[0]
+}
+
+// DetectScript reports the alphabet and scripts of a message body, for
+// routing messages by language.
+func DetectScript(body string) ScriptInfo {
+	info := ScriptInfo{Alphabet: AlphabetGSM7}
+	if !pdu.IsGSM7(body) {
+		info.Alphabet = AlphabetLatin1
+		for _, r := range body {
+			if r > 0xff {
+				info.Alphabet = AlphabetUCS2
+				break
+			}
+		}
+	}
+	counts := map[string]int{}
+	for _, r := range body {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for name, table := range unicode.Scripts {
+			if unicode.Is(table, r) {
+				counts[name]++
+				break
+			}
+		}
+	}
+	for name := range counts {
+		info.Scripts = append(info.Scripts, name)
+	}
+	sort.Slice(info.Scripts, func(i, j int) bool {
+		a, b := info.Scripts[i], info.Scripts[j]
+		return counts[a] > counts[b] || counts[a] == counts[b] && a < b
+	})
+	return info
+}
@@ -0,0 +1,30 @@
+package gogsmmodem
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectScript(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected ScriptInfo
+	}{
+		{"Hello 123", ScriptInfo{AlphabetGSM7, []string{"Latin"}}},
+		{"Está bien", ScriptInfo{AlphabetLatin1, []string{"Latin"}}},
+		{"مرحبا hi", ScriptInfo{AlphabetUCS2, []string{"Arabic", "Latin"}}},
+		{"Привет", ScriptInfo{AlphabetUCS2, []string{"Cyrillic"}}},
+		{"123", ScriptInfo{AlphabetGSM7, nil}},
+		{"ΔΣ €5 {x}", ScriptInfo{AlphabetGSM7, []string{"Greek", "Latin"}}},
+		{"ΔΣ €5 á", ScriptInfo{AlphabetUCS2, []string{"Greek", "Latin"}}},
+	}
+	for _, test := range tests {
+		info := DetectScript(test.body)
+		if !reflect.DeepEqual(info, test.expected) {
+			t.Errorf("Expected: %#v for %q, got %#v", test.expected, test.body, info)
+		}
+	}
+	if DetectScript("Привет hi").Dominant() != "Cyrillic" {
+		t.Error("Expected: Cyrillic dominant")
+	}
+}
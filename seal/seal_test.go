@@ -0,0 +1,41 @@
+package seal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, _ := NewKey()
+	plaintext := bytes.Repeat([]byte("x"), MaxPlaintext(1))
+	body, err := Seal(key, plaintext)
+	if err != nil || len(body) > 160 || strings.Trim(body, "S1:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/") != "" {
+		t.Fatalf("Expected: one SMS of GSM text, got %q %v", body, err)
+	}
+	opened, err := Open(key, body)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Expected: plaintext, got %q %v", opened, err)
+	}
+
+	other, _ := NewKey()
+	tampered := body[:10] + "A" + body[11:]
+	if tampered == body {
+		tampered = body[:10] + "B" + body[11:]
+	}
+	for _, test := range []struct {
+		key  []byte
+		body string
+		err  error
+	}{
+		{other, body, ErrOpen},
+		{key, tampered, ErrOpen},
+		{key, "S1:", ErrOpen},
+		{key, "reboot", ErrNotSealed},
+		{key[:16], body, ErrKeySize},
+	} {
+		if _, err := Open(test.key, test.body); err != test.err {
+			t.Errorf("Expected: %v for %q, got %v", test.err, test.body, err)
+		}
+	}
+}
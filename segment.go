@@ -0,0 +1,67 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+// Characters per segment for single and concatenated messages
+const (
+	gsmSingleSegment  = 160
+	gsmMultiSegment   = 153
+	ucs2SingleSegment = 70
+	ucs2MultiSegment  = 67
+)
+
+// Returned when a message needs more segments than Modem.MaxSegments allows.
+type SegmentLimitError struct {
+	Segments int
+	Max      int
+}
+
+func (self *SegmentLimitError) Error() string {
+	return fmt.Sprintf("Message needs %d segments, limit is %d", self.Segments, self.Max)
+}
+
+// Count the septets needed to encode s in the GSM 03.38 alphabet, with
+// extension characters taking two. ok is false if s is not encodable.
+func gsmSeptets(s string) (n int, ok bool) {
+	for _, c := range s {
+		d, found := gsmEncodeRune(c)
+		if !found {
+			return 0, false
+		}
+		n += len(d)
+	}
+	return n, true
+}
+
+func segments(length, single, multi int) int {
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
+
+// SegmentCount returns the number of SMS segments needed to send body in the
+// given encoding. Text that cannot be encoded in GSM is counted as UCS2.
+func SegmentCount(body string, encoding Encoding) int {
+	if encoding == GSM {
+		if n, ok := gsmSeptets(body); ok {
+			return segments(n, gsmSingleSegment, gsmMultiSegment)
+		}
+	}
+	n := len(utf16.Encode([]rune(body)))
+	return segments(n, ucs2SingleSegment, ucs2MultiSegment)
+}
+
+// Check a message fits within MaxSegments
+func (self *Modem) checkSegments(body string, encoding Encoding) error {
+	if self.MaxSegments == 0 {
+		return nil
+	}
+	if n := SegmentCount(body, encoding); n > self.MaxSegments {
+		return &SegmentLimitError{n, self.MaxSegments}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package gogsmmodem
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+func ExampleSegmentCount() {
+	fmt.Println(SegmentCount(strings.Repeat("a", 160), GSM))
+	fmt.Println(SegmentCount(strings.Repeat("a", 161), GSM))
+	fmt.Println(SegmentCount(strings.Repeat("{", 80), GSM))
+	fmt.Println(SegmentCount(strings.Repeat("a", 70), UCS2))
+	fmt.Println(SegmentCount(strings.Repeat("я", 71), GSM))
+	// Output:
+	// 1
+	// 2
+	// 1
+	// 1
+	// 2
+}
+
+func TestSendMessageSegmentLimit(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(initReplay), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.MaxSegments = 2
+	// refused before anything is sent to the modem
+	err = modem.SendMessage("441234567890", strings.Repeat("a", 307))
+	limit, ok := err.(*SegmentLimitError)
+	if !ok || *limit != (SegmentLimitError{3, 2}) {
+		t.Errorf("Expected: SegmentLimitError, got: %#v", err)
+	}
+	err = modem.SendMessage("441234567890", strings.Repeat("я", 135), UCS2)
+	limit, ok = err.(*SegmentLimitError)
+	if !ok || *limit != (SegmentLimitError{3, 2}) {
+		t.Errorf("Expected: SegmentLimitError, got: %#v", err)
+	}
+	modem.Close()
+}
@@ -0,0 +1,131 @@
+package gogsmmodem
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// The result of one self-test check
+type SelfTestCheck struct {
+	Name    string
+	Command string
+	Passed  bool
+	Detail  string
+	Err     error
+}
+
+// The results of SelfTest, in the order the checks were run
+type SelfTestReport struct {
+	Checks []SelfTestCheck
+}
+
+// Did all checks pass
+func (self SelfTestReport) Passed() bool {
+	for _, check := range self.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (self SelfTestReport) String() string {
+	var buf bytes.Buffer
+	for _, check := range self.Checks {
+		result := "PASS"
+		if !check.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(&buf, "%s %-12s %-10s %s", result, check.Name, check.Command, check.Detail)
+		if check.Err != nil {
+			fmt.Fprintf(&buf, " (%v)", check.Err)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// SelfTest runs a battery of checks for commissioning a device:
+//
+//	AT     the modem responds to commands
+//	+CPIN  the SIM is present and unlocked
+//	+CREG  the modem is registered on the network
+//	+CSQ   the signal strength is known
+//	+CSCA  an SMSC address is configured
+//	+CPMS  message storage is available
+//
+// If ownNumber is set a test message is also sent to it. All checks are run
+// even if earlier ones fail.
+func (self *Modem) SelfTest(ownNumber string) SelfTestReport {
+	report := SelfTestReport{}
+	check := func(name, command string, f func() (string, error)) {
+		detail, err := f()
+		report.Checks = append(report.Checks, SelfTestCheck{
+			Name:    name,
+			Command: command,
+			Passed:  err == nil,
+			Detail:  detail,
+			Err:     err,
+		})
+	}
+
+	check("Responding", "AT", func() (string, error) {
+		_, err := self.send("")
+		return "", err
+	})
+	check("SIM", "+CPIN?", func() (string, error) {
+		pin, err := self.SIMStatus()
+		if err != nil {
+			return "", err
+		}
+		if !pin.Ready() {
+			return pin.Status, errors.New("SIM not ready")
+		}
+		return pin.Status, nil
+	})
+	check("Registration", "+CREG?", func() (string, error) {
+		reg, err := self.NetworkRegistration()
+		if err != nil {
+			return "", err
+		}
+		detail := fmt.Sprintf("status %d", reg.Status)
+		if !reg.Registered() {
+			return detail, errors.New("Not registered")
+		}
+		return detail, nil
+	})
+	check("Signal", "+CSQ", func() (string, error) {
+		sq, err := self.SignalQuality()
+		if err != nil {
+			return "", err
+		}
+		if !sq.Known() {
+			return "unknown", errors.New("No signal")
+		}
+		return fmt.Sprintf("%d dBm", sq.DBm()), nil
+	})
+	check("SMSC", "+CSCA?", func() (string, error) {
+		smsc, err := self.SMSCAddress()
+		if err != nil {
+			return "", err
+		}
+		if smsc.Address == "" {
+			return "", errors.New("No SMSC address")
+		}
+		return smsc.Address, nil
+	})
+	check("Storage", "+CPMS?", func() (string, error) {
+		info, err := self.StorageUsage()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %d/%d", info.ReadStorage, info.UsedRead, info.TotalRead), nil
+	})
+	if ownNumber != "" {
+		check("Send", "+CMGS", func() (string, error) {
+			return ownNumber, self.SendMessage(ownNumber, "gogsmmodem self test")
+		})
+	}
+	return report
+}
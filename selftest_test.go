@@ -0,0 +1,48 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var selfTestReplay = []string{
+	"->AT\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CPIN?\r\n",
+	"<-\r\n+CPIN: READY\r\n\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,1\r\n\r\nOK\r\n",
+	"->AT+CSQ\r\n",
+	"<-\r\n+CSQ: 99,99\r\n\r\nOK\r\n",
+	"->AT+CSCA?\r\n",
+	"<-\r\n+CSCA: \"+447802092035\",145\r\n\r\nOK\r\n",
+	"->AT+CPMS?\r\n",
+	"<-\r\n+CPMS: \"SM\",3,20,\"SM\",3,20,\"SM\",3,20\r\n\r\nOK\r\n",
+}
+
+func TestSelfTest(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, selfTestReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+
+	report := modem.SelfTest("")
+	if len(report.Checks) != 6 {
+		t.Fatalf("Expected: 6 checks, got %d", len(report.Checks))
+	}
+	for i, check := range report.Checks {
+		// only the signal check should fail
+		if check.Passed != (i != 3) {
+			t.Errorf("Unexpected result: %#v", check)
+		}
+	}
+	if report.Passed() {
+		t.Error("Expected: report to fail")
+	}
+	modem.Close()
+}
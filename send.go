@@ -0,0 +1,138 @@
+package gogsmmodem
+
+import (
+	"context"
+	"time"
+)
+
+// A message for Send.
+type OutgoingMessage struct {
+	// Caller's ID for tracing the message, reported back in SendResult and
+	// the MessageSent event.
+	ID        string
+	Telephone string
+	Body      string
+	// GSM, UCS2 or Auto, switching the modem's character set for this
+	// message only if it differs from the modem's Encoding.
+	Encoding Encoding
+	// Deflate a message which would take several segments into one, as 8-bit
+	// data marked by its user data header, for a receiving device using this
+	// package. Sent as usual if it would not fit, or in text mode.
+	Compress bool
+	// Request a DeliveryReport, in PDU mode. In text mode reports are always
+	// requested, by the first octet set with +CSMP.
+	StatusReport bool
+	// Go through encoding, segmentation, PDU building and the command queue
+	// but stop short of sending, returning in SendResult.DryRun what would
+	// have been. Nothing is charged, stored or emitted.
+	DryRun bool
+	// Fail with ErrExpired rather than send after this, eg for a one-time
+	// code held up by lost coverage or other commands. Zero never expires.
+	Expires time.Time `json:",omitempty"`
+
+	// 8-bit user data and its header sent instead of Body, see SendBlob
+	udh, data []byte
+}
+
+// Result of Send.
+type SendResult struct {
+	ID string
+	// Message reference from the modem, which identifies the message in
+	// delivery reports.
+	Reference int
+	Sent      time.Time
+	// Index of the copy kept in storage if Modem.KeepSent is set, or -1
+	Stored int
+	// For a dry run, each +CMGS command which would have been sent followed
+	// by its message body
+	DryRun []string `json:",omitempty"`
+}
+
+// Is the message past its expiry
+func (self OutgoingMessage) expired(now time.Time) bool {
+	return !self.Expires.IsZero() && !now.Before(self.Expires)
+}
+
+// Send a message, returning the modem's reference for it.
+func (self *Modem) Send(msg OutgoingMessage) (*SendResult, error) {
+	return self.SendContext(context.Background(), msg)
+}
+
+// SendContext is Send with a context for cancelling while queued behind other
+// commands. Once the modem prompts for the message, cancelling aborts entry
+// with ESC and fails with ErrCancelled, unless the message was already sent.
+func (self *Modem) SendContext(ctx context.Context, msg OutgoingMessage) (*SendResult, error) {
+	var ref, stored int
+	var cost float64
+	var dry *dryRun
+	if msg.DryRun || self.DryRun {
+		dry = &dryRun{}
+		ctx = withDryRun(ctx, dry)
+	}
+	enc := resolveEncoding(msg.Encoding, msg.Body)
+	segments := SegmentCount(msg.Body, enc)
+	udh, data := msg.udh, msg.data
+	if data == nil && msg.Compress && !self.textMode {
+		udh, data = compressBody(msg.Body, enc)
+	}
+	if data != nil {
+		segments = 1
+	}
+	err := self.Numbers.Check(msg.Telephone)
+	if err == nil && msg.expired(self.clock.Now()) {
+		err = ErrExpired
+	}
+	if err == nil && data != nil && self.textMode {
+		err = ErrTextMode
+	}
+	if err == nil && data == nil {
+		err = self.checkSegments(msg.Body, enc)
+	}
+	if err == nil {
+		cost, err = self.Accounting.reserve(self.clock.Now(), msg.Telephone, segments)
+		defer func() {
+			if err != nil || dry != nil {
+				self.Accounting.refund(self.clock.Now(), cost)
+			}
+		}()
+	}
+	if err == nil && dry == nil {
+		err = self.throttle.wait(ctx, self.clock)
+	}
+	if err == nil && dry == nil {
+		err = self.checkCoverage()
+	}
+	if err == nil {
+		err = self.hold(ctx, func() error {
+			// waited too long for coverage or the modem
+			if msg.expired(self.clock.Now()) {
+				return ErrExpired
+			}
+			var err error
+			if data != nil {
+				ref, stored, err = self.sendData(ctx, msg.Telephone, udh, data)
+			} else {
+				ref, stored, err = self.sendMessage(ctx, msg.Telephone, msg.Body, enc, msg.StatusReport)
+			}
+			if dry == nil {
+				self.checkStorm(err)
+				self.checkBlocked(err)
+			}
+			return err
+		})
+	}
+	if dry != nil {
+		if err != nil {
+			return nil, err
+		}
+		return &SendResult{ID: msg.ID, Sent: self.clock.Now(), Stored: -1, DryRun: dry.lines}, nil
+	}
+	self.stats.messageSent(err)
+	self.emit(MessageSent{msg.ID, msg.Telephone, ref, err})
+	if err != nil {
+		return nil, err
+	}
+	now := self.clock.Now()
+	self.Accounting.charged(Charge{msg.ID, msg.Telephone, segments, now, cost})
+	return &SendResult{ID: msg.ID, Reference: ref, Sent: now, Stored: stored}, nil
+}
@@ -0,0 +1,169 @@
+package gogsmmodem
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestSend(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, sendPDUMessageReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+
+	res, err := modem.Send(OutgoingMessage{ID: "order-1", Telephone: "441234567890", Body: "Body@"})
+	if err != nil || res.ID != "order-1" || res.Reference != 12 {
+		t.Errorf("Expected: result for order-1, got %#v %v", res, err)
+	}
+	modem.Close()
+	assertOOBCommands(t, modem, []Packet{MessageSent{"order-1", "441234567890", 12, nil}})
+}
+
+var keepSentReplay = appendLists(sendPDUMessageReplay, []string{
+	"->AT+CMGW=19,3\r\n",
+	"<-> \r\n",
+	"->0011000C814421436587090000AA05C237390F00\x1a",
+	"<-\r\n+CMGW: 4\r\n\r\nOK\r\n",
+})
+
+func TestSendKeepSent(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, keepSentReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.KeepSent = true
+
+	res, err := modem.Send(OutgoingMessage{Telephone: "441234567890", Body: "Body@"})
+	if err != nil || res.Reference != 12 || res.Stored != 4 {
+		t.Errorf("Expected: copy stored at 4, got %#v %v", res, err)
+	}
+	modem.Close()
+}
+
+func TestSendExpired(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(initReplay), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	_, err = modem.Send(OutgoingMessage{Telephone: "441234567890", Body: "Code 1234", Expires: DefaultClock.Now()})
+	if err != ErrExpired {
+		t.Error("Expected: ErrExpired, got:", err)
+	}
+	modem.Close()
+	assertOOBCommands(t, modem, []Packet{MessageSent{"", "441234567890", 0, ErrExpired}})
+}
+
+func TestSendDryRun(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, sendPDUMessageReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.KeepSent = true
+
+	// nothing reaches the port
+	res, err := modem.Send(OutgoingMessage{ID: "dry", Telephone: "441234567890", Body: strings.Repeat("Body@", 40), DryRun: true})
+	if err != nil || len(res.DryRun) != 4 || res.DryRun[0] != "AT+CMGS=154" || res.Stored != -1 {
+		t.Errorf("Expected: two parts, got %#v %v", res, err)
+	}
+	modem.KeepSent = false
+	res, err = modem.Send(OutgoingMessage{Telephone: "441234567890", Body: "Body@"})
+	if err != nil || res.DryRun != nil {
+		t.Errorf("Expected: sent for real, got %#v %v", res, err)
+	}
+	modem.Close()
+	assertOOBCommands(t, modem, []Packet{MessageSent{"", "441234567890", 12, nil}})
+}
+
+func TestSendPromptWithoutNewline(t *testing.T) {
+	replay := replyReplay("Hi")
+	replay[1] = "<-\r\n> "
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, replay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if err := modem.SendMessage("+441234567890", "Hi"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	modem.Close()
+}
+
+func TestSendRefusedBeforePrompt(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			"->AT+CMGS=19\r\n",
+			"<-\r\n+CMS ERROR: 304\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	// the body is never written
+	if err := modem.SendMessage("441234567890", "Body@"); err != (ERROR{"+CMS ERROR", 304}) {
+		t.Error("Expected: CMS error 304, got:", err)
+	}
+	modem.Close()
+}
+
+// Cancels while waiting for the prompt, once the send command is written
+type cancelClock struct {
+	Clock
+	cancel func()
+}
+
+func (self cancelClock) After(d time.Duration) <-chan time.Time {
+	if d == PromptTimeout {
+		self.cancel()
+	}
+	return self.Clock.After(d)
+}
+
+var cancelSendReplay = []string{
+	"->AT+CMGS=19\r\n",
+	"<-> \r\n",
+	"->\x1b",
+	"<-\r\nOK\r\n",
+	"->AT+CSQ\r\n",
+	"<-\r\n+CSQ: 17,99\r\n\r\nOK\r\n",
+}
+
+func TestSendCancelled(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, cancelSendReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	modem.clock = cancelClock{modem.clock, cancel}
+
+	_, err = modem.SendContext(ctx, OutgoingMessage{Telephone: "441234567890", Body: "Body@"})
+	if err != ErrCancelled {
+		t.Error("Expected: cancelled, got:", err)
+	}
+	if sq, err := modem.SignalQuality(); err != nil || sq.RSSI != 17 {
+		t.Errorf("Expected: signal quality, got %v %v", sq, err)
+	}
+	modem.Close()
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// Path prefix of the gRPC service's methods, see modem.proto
+const grpcService = "/gogsmmodem.Modem/"
+
+// Largest request message accepted, as gRPC's default
+const grpcMaxMessage = 4 << 20
+
+// gRPC status codes
+const (
+	grpcOK                = 0
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+)
+
+// A call failed with a gRPC status
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (self grpcError) Error() string {
+	return self.message
+}
+
+// Is the request a gRPC call
+func isGRPC(r *http.Request) bool {
+	return r.Method == "POST" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// Serve a gRPC call, answering with its status in the trailers. The request
+// is read first, as HTTP/1 servers close it once the reply starts.
+func (self *Server) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	req, err := readGRPC(r.Body)
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+	if err == nil {
+		switch strings.TrimPrefix(r.URL.Path, grpcService) {
+		case "SendMessage":
+			err = self.grpcSend(r.Context(), w, req)
+		case "ListMessages":
+			err = self.grpcList(w, req)
+		case "DeleteMessage":
+			err = self.grpcDelete(w, req)
+		case "StreamEvents":
+			err = self.grpcStream(r.Context(), w)
+		default:
+			err = grpcError{grpcUnimplemented, "Unknown method " + r.URL.Path}
+		}
+	}
+	code := grpcOK
+	if err != nil {
+		code = grpcUnknown
+		if e, ok := err.(grpcError); ok {
+			code = e.code
+		}
+		w.Header().Set("Grpc-Message", grpcEscape(err.Error()))
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+}
+
+func (self *Server) grpcSend(ctx context.Context, w http.ResponseWriter, req protoFields) error {
+	msg := gogsmmodem.OutgoingMessage{
+		ID:           req.string(1),
+		Telephone:    req.string(2),
+		Body:         req.string(3),
+		Encoding:     gogsmmodem.Encoding(req.uint(4)),
+		StatusReport: req.uint(5) != 0,
+	}
+	if msg.Telephone == "" {
+		return grpcError{grpcInvalidArgument, "Telephone required"}
+	}
+	res, err := self.backend.SendContext(ctx, msg)
+	if err != nil {
+		return err
+	}
+	reply := protoMessage(nil).string(1, res.ID).int(2, res.Reference).time(3, res.Sent).int(4, res.Stored)
+	return writeGRPC(w, reply)
+}
+
+// The backend's stored messages, or an UNIMPLEMENTED error
+func (self *Server) grpcStorage() (Storage, error) {
+	storage, ok := self.backend.(Storage)
+	if !ok {
+		return nil, grpcError{grpcUnimplemented, "Stored messages not supported"}
+	}
+	return storage, nil
+}
+
+func (self *Server) grpcList(w http.ResponseWriter, req protoFields) error {
+	storage, err := self.grpcStorage()
+	if err != nil {
+		return err
+	}
+	filter := req.string(1)
+	if filter == "" {
+		filter = "ALL"
+	}
+	msgs, err := storage.ListMessages(filter)
+	if err != nil {
+		return err
+	}
+	var reply protoMessage
+	for _, msg := range *msgs {
+		m := protoMessage(nil).int(1, msg.Index).string(2, msg.Status).string(3, msg.Telephone).
+			time(4, msg.Timestamp).string(5, msg.Body).string(6, msg.Storage)
+		reply = reply.message(1, m)
+	}
+	return writeGRPC(w, reply)
+}
+
+func (self *Server) grpcDelete(w http.ResponseWriter, req protoFields) error {
+	storage, err := self.grpcStorage()
+	if err != nil {
+		return err
+	}
+	if err := storage.DeleteMessage(req.int(1)); err != nil {
+		return err
+	}
+	return writeGRPC(w, nil)
+}
+
+func (self *Server) grpcStream(ctx context.Context, w http.ResponseWriter) error {
+	c := self.subscribe()
+	defer self.unsubscribe(c)
+	// the call has started
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	for {
+		select {
+		case e := <-c:
+			data, err := json.Marshal(e.Packet)
+			if err != nil {
+				continue
+			}
+			if err := writeGRPC(w, protoMessage(nil).string(1, e.Type).string(2, string(data))); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Read the single request message of a call
+func readGRPC(body io.Reader) (protoFields, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, grpcError{grpcInvalidArgument, "Reading request: " + err.Error()}
+	}
+	if header[0] != 0 {
+		return nil, grpcError{grpcUnimplemented, "Compressed messages not supported"}
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > grpcMaxMessage {
+		return nil, grpcError{grpcResourceExhausted, fmt.Sprintf("Request of %d bytes too large", n)}
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, grpcError{grpcInvalidArgument, "Reading request: " + err.Error()}
+	}
+	fields, err := decodeProto(msg)
+	if err != nil {
+		return nil, grpcError{grpcInvalidArgument, err.Error()}
+	}
+	return fields, nil
+}
+
+// Write a reply message, flushing it to the client
+func writeGRPC(w http.ResponseWriter, msg protoMessage) error {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	if _, err := w.Write(append(header[:], msg...)); err != nil {
+		return grpcError{grpcInternal, err.Error()}
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Percent-encode a status message for the Grpc-Message trailer
+func grpcEscape(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
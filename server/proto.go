@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errProtoTruncated = errors.New("Truncated protocol buffer message")
+
+// An encoded protocol buffer message, appended to field by field. Fields
+// with their zero value are left out, as proto3 does.
+type protoMessage []byte
+
+func (self protoMessage) key(field, wire int) protoMessage {
+	return self.raw(uint64(field<<3 | wire))
+}
+
+func (self protoMessage) raw(v uint64) protoMessage {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(self, buf[:n]...)
+}
+
+func (self protoMessage) uint(field int, v uint64) protoMessage {
+	if v == 0 {
+		return self
+	}
+	return self.key(field, wireVarint).raw(v)
+}
+
+// An int32 or int64 field, negative values taking ten bytes
+func (self protoMessage) int(field int, v int) protoMessage {
+	return self.uint(field, uint64(int64(v)))
+}
+
+func (self protoMessage) bool(field int, v bool) protoMessage {
+	if !v {
+		return self
+	}
+	return self.uint(field, 1)
+}
+
+func (self protoMessage) string(field int, s string) protoMessage {
+	if s == "" {
+		return self
+	}
+	return self.message(field, protoMessage(s))
+}
+
+// An embedded message, written even if empty, as for repeated fields
+func (self protoMessage) message(field int, m protoMessage) protoMessage {
+	self = self.key(field, wireBytes).raw(uint64(len(m)))
+	return append(self, m...)
+}
+
+// A google.protobuf.Timestamp field
+func (self protoMessage) time(field int, t time.Time) protoMessage {
+	if t.IsZero() {
+		return self
+	}
+	return self.message(field, protoMessage(nil).int(1, int(t.Unix())).int(2, t.Nanosecond()))
+}
+
+// The fields of a message by number, varints as uint64 and length delimited
+// fields as []byte. Fixed width fields are skipped, as the service has none,
+// and of a repeated field the last is kept.
+type protoFields map[int]interface{}
+
+func decodeProto(b []byte) (protoFields, error) {
+	fields := protoFields{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errProtoTruncated
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errProtoTruncated
+			}
+			fields[field] = v
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errProtoTruncated
+			}
+			fields[field] = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errProtoTruncated
+			}
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errProtoTruncated
+			}
+			b = b[4:]
+		default:
+			return nil, errors.New("Unsupported protocol buffer wire type")
+		}
+	}
+	return fields, nil
+}
+
+func (self protoFields) uint(field int) uint64 {
+	v, _ := self[field].(uint64)
+	return v
+}
+
+func (self protoFields) int(field int) int {
+	return int(int64(self.uint(field)))
+}
+
+func (self protoFields) string(field int) string {
+	b, _ := self[field].([]byte)
+	return string(b)
+}
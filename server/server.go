@@ -0,0 +1,213 @@
+// Package server exposes a modem or a pool of modems over a small REST/JSON
+// API and a gRPC service, for consumers not written in Go:
+//
+//	POST   /messages          send {"ID", "Telephone", "Body", "Encoding"}
+//	GET    /messages?filter=  list stored messages, default ALL
+//	DELETE /messages/{index}  delete a stored message
+//	GET    /events            stream of unsolicited packets as Server-Sent Events
+//
+// The gRPC service, gogsmmodem.Modem in modem.proto, has the same four
+// operations and is served on the same handler, needing neither generated
+// code nor the grpc module. gRPC clients require HTTP/2, which net/http
+// serves over TLS, eg with http.ListenAndServeTLS.
+//
+// Stored messages are served for a single modem only, as a pool's modems
+// number their storage independently; for a pool they answer 501 Not
+// Implemented, or UNIMPLEMENTED over gRPC, and received messages are
+// streamed with ForwardPool instead.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+// The modem operations served, as provided by *gogsmmodem.Modem and
+// *gogsmmodem.Pool.
+type Backend interface {
+	SendContext(ctx context.Context, msg gogsmmodem.OutgoingMessage) (*gogsmmodem.SendResult, error)
+}
+
+// Stored message operations, served if the backend provides them, as
+// *gogsmmodem.Modem does.
+type Storage interface {
+	ListMessages(filter string) (*gogsmmodem.MessageList, error)
+	DeleteMessage(n int) error
+}
+
+// An unsolicited packet in the event stream
+type Event struct {
+	// Packet type, eg "MessageNotification"
+	Type   string
+	Packet gogsmmodem.Packet
+}
+
+type Server struct {
+	backend     Backend
+	lock        sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+func New(backend Backend) *Server {
+	return &Server{backend: backend, subscribers: map[chan Event]bool{}}
+}
+
+// Forward packets to the event stream until the channel is closed, usually
+// from the modem's OOB channel.
+func (self *Server) Forward(packets <-chan gogsmmodem.Packet) {
+	for p := range packets {
+		self.Publish(p)
+	}
+}
+
+// Forward messages received by a pool to the event stream until the channel
+// is closed, usually from Pool.Incoming.
+func (self *Server) ForwardPool(messages <-chan gogsmmodem.PoolMessage) {
+	for m := range messages {
+		self.Publish(m)
+	}
+}
+
+// Publish a packet to the event stream, dropping it for slow subscribers.
+func (self *Server) Publish(p gogsmmodem.Packet) {
+	e := Event{strings.TrimPrefix(fmt.Sprintf("%T", p), "gogsmmodem."), p}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for c := range self.subscribers {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+func (self *Server) subscribe() chan Event {
+	c := make(chan Event, 16)
+	self.lock.Lock()
+	self.subscribers[c] = true
+	self.lock.Unlock()
+	return c
+}
+
+func (self *Server) unsubscribe(c chan Event) {
+	self.lock.Lock()
+	delete(self.subscribers, c)
+	self.lock.Unlock()
+}
+
+func (self *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case isGRPC(r):
+		self.serveGRPC(w, r)
+	case r.URL.Path == "/messages" && r.Method == "POST":
+		self.send(w, r)
+	case r.URL.Path == "/messages" && r.Method == "GET":
+		self.list(w, r)
+	case strings.HasPrefix(r.URL.Path, "/messages/") && r.Method == "DELETE":
+		self.delete(w, r)
+	case r.URL.Path == "/events" && r.Method == "GET":
+		self.stream(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (self *Server) send(w http.ResponseWriter, r *http.Request) {
+	var msg gogsmmodem.OutgoingMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.Telephone == "" {
+		http.Error(w, "Telephone required", http.StatusBadRequest)
+		return
+	}
+	res, err := self.backend.SendContext(r.Context(), msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, res)
+}
+
+// The backend's stored messages, or nil having answered 501
+func (self *Server) storage(w http.ResponseWriter) Storage {
+	storage, ok := self.backend.(Storage)
+	if !ok {
+		http.Error(w, "Stored messages not supported", http.StatusNotImplemented)
+	}
+	return storage
+}
+
+func (self *Server) list(w http.ResponseWriter, r *http.Request) {
+	storage := self.storage(w)
+	if storage == nil {
+		return
+	}
+	filter := r.URL.Query().Get("filter")
+	if filter == "" {
+		filter = "ALL"
+	}
+	msgs, err := storage.ListMessages(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, msgs)
+}
+
+func (self *Server) delete(w http.ResponseWriter, r *http.Request) {
+	storage := self.storage(w)
+	if storage == nil {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/messages/"))
+	if err != nil {
+		http.Error(w, "Invalid message index", http.StatusBadRequest)
+		return
+	}
+	if err := storage.DeleteMessage(n); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (self *Server) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := self.subscribe()
+	defer self.unsubscribe(c)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case e := <-c:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
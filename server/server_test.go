@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/barnybug/gogsmmodem"
+)
+
+type fakeBackend struct {
+	sent    []gogsmmodem.OutgoingMessage
+	deleted []int
+}
+
+func (self *fakeBackend) SendContext(ctx context.Context, msg gogsmmodem.OutgoingMessage) (*gogsmmodem.SendResult, error) {
+	self.sent = append(self.sent, msg)
+	return &gogsmmodem.SendResult{ID: msg.ID, Reference: 7}, nil
+}
+
+func (self *fakeBackend) ListMessages(filter string) (*gogsmmodem.MessageList, error) {
+	if filter != "ALL" {
+		return nil, errors.New("Unexpected filter")
+	}
+	return &gogsmmodem.MessageList{{Index: 1, Body: "Hi"}}, nil
+}
+
+func (self *fakeBackend) DeleteMessage(n int) error {
+	self.deleted = append(self.deleted, n)
+	return nil
+}
+
+// Sends only, as a pool
+type sendBackend struct {
+	backend fakeBackend
+}
+
+func (self *sendBackend) SendContext(ctx context.Context, msg gogsmmodem.OutgoingMessage) (*gogsmmodem.SendResult, error) {
+	return self.backend.SendContext(ctx, msg)
+}
+
+var (
+	_ Backend = (*gogsmmodem.Modem)(nil)
+	_ Storage = (*gogsmmodem.Modem)(nil)
+	_ Backend = (*gogsmmodem.Pool)(nil)
+)
+
+func request(t *testing.T, h http.Handler, method, path, body string) (int, string) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestServer(t *testing.T) {
+	backend := &fakeBackend{}
+	s := New(backend)
+
+	code, body := request(t, s, "POST", "/messages", `{"ID":"a1","Telephone":"4412","Body":"Hello"}`)
+	if code != 200 || !strings.Contains(body, `"Reference":7`) || backend.sent[0].Body != "Hello" {
+		t.Errorf("Unexpected send response: %d %s", code, body)
+	}
+	if code, _ := request(t, s, "POST", "/messages", `{"Body":"Hello"}`); code != 400 {
+		t.Errorf("Expected: 400 without telephone, got %d", code)
+	}
+	code, body = request(t, s, "GET", "/messages", "")
+	if code != 200 || !strings.Contains(body, `"Body":"Hi"`) {
+		t.Errorf("Unexpected list response: %d %s", code, body)
+	}
+	if code, _ := request(t, s, "DELETE", "/messages/3", ""); code != 204 || backend.deleted[0] != 3 {
+		t.Errorf("Unexpected delete response: %d", code)
+	}
+	if code, _ := request(t, s, "GET", "/nothing", ""); code != 404 {
+		t.Errorf("Expected: 404, got %d", code)
+	}
+}
+
+func TestServerWithoutStorage(t *testing.T) {
+	backend := &sendBackend{}
+	s := New(backend)
+	if code, _ := request(t, s, "POST", "/messages", `{"Telephone":"4412","Body":"Hello"}`); code != 200 || len(backend.backend.sent) != 1 {
+		t.Errorf("Unexpected send response: %d", code)
+	}
+	if code, _ := request(t, s, "GET", "/messages", ""); code != 501 {
+		t.Errorf("Expected: 501 listing, got %d", code)
+	}
+	if code, _ := request(t, s, "DELETE", "/messages/3", ""); code != 501 {
+		t.Errorf("Expected: 501 deleting, got %d", code)
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	s := New(&fakeBackend{})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer resp.Body.Close()
+	// wait for the subscription before publishing
+	for i := 0; i < 100; i++ {
+		s.lock.Lock()
+		n := len(s.subscribers)
+		s.lock.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Publish(gogsmmodem.MessageNotification{Storage: "SM", Index: 2})
+
+	r := bufio.NewReader(resp.Body)
+	event, _ := r.ReadString('\n')
+	data, _ := r.ReadString('\n')
+	if event != "event: MessageNotification\n" || data != "data: {\"Type\":\"MessageNotification\",\"Packet\":{\"Storage\":\"SM\",\"Index\":2}}\n" {
+		t.Errorf("Unexpected event: %q %q", event, data)
+	}
+}
+
+// Make a gRPC call, returning its status and reply messages
+func grpcCall(t *testing.T, h http.Handler, method string, req protoMessage) (string, []protoFields) {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(req)))
+	r := httptest.NewRequest("POST", grpcService+method, bytes.NewReader(append(header[:], req...)))
+	r.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	res := w.Result()
+	var replies []protoFields
+	body := w.Body.Bytes()
+	for len(body) >= 5 {
+		n := binary.BigEndian.Uint32(body[1:5])
+		fields, err := decodeProto(body[5 : 5+n])
+		if err != nil {
+			t.Fatal("Expected: reply message, got:", err)
+		}
+		replies = append(replies, fields)
+		body = body[5+n:]
+	}
+	return res.Trailer.Get("Grpc-Status"), replies
+}
+
+func TestServerGRPC(t *testing.T) {
+	backend := &fakeBackend{}
+	s := New(backend)
+
+	status, replies := grpcCall(t, s, "SendMessage", protoMessage(nil).string(1, "a1").string(2, "4412").string(3, "Hello").uint(4, 1))
+	if status != "0" || len(replies) != 1 || replies[0].string(1) != "a1" || replies[0].int(2) != 7 {
+		t.Errorf("Unexpected send reply: %s %v", status, replies)
+	}
+	if sent := backend.sent[0]; sent.Telephone != "4412" || sent.Body != "Hello" || sent.Encoding != gogsmmodem.UCS2 {
+		t.Errorf("Unexpected message sent: %#v", sent)
+	}
+	if status, _ := grpcCall(t, s, "SendMessage", protoMessage(nil).string(3, "Hello")); status != "3" {
+		t.Error("Expected: INVALID_ARGUMENT without telephone, got:", status)
+	}
+	status, replies = grpcCall(t, s, "ListMessages", nil)
+	if status != "0" || len(replies) != 1 {
+		t.Fatalf("Unexpected list reply: %s %v", status, replies)
+	}
+	msg, err := decodeProto(replies[0][1].([]byte))
+	if err != nil || msg.int(1) != 1 || msg.string(5) != "Hi" {
+		t.Errorf("Unexpected stored message: %v %v", msg, err)
+	}
+	if status, _ := grpcCall(t, s, "DeleteMessage", protoMessage(nil).int(1, 3)); status != "0" || backend.deleted[0] != 3 {
+		t.Error("Unexpected delete status:", status)
+	}
+	if status, _ := grpcCall(t, s, "Nothing", nil); status != "12" {
+		t.Error("Expected: UNIMPLEMENTED, got:", status)
+	}
+	if status, _ := grpcCall(t, New(&sendBackend{}), "ListMessages", nil); status != "12" {
+		t.Error("Expected: UNIMPLEMENTED without storage, got:", status)
+	}
+}
+
+func TestServerGRPCEvents(t *testing.T) {
+	s := New(&fakeBackend{})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+grpcService+"StreamEvents", "application/grpc", bytes.NewReader(make([]byte, 5)))
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer resp.Body.Close()
+	for i := 0; i < 100; i++ {
+		s.lock.Lock()
+		n := len(s.subscribers)
+		s.lock.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Publish(gogsmmodem.MessageNotification{Storage: "SM", Index: 2})
+
+	var header [5]byte
+	if _, err := io.ReadFull(resp.Body, header[:]); err != nil {
+		t.Fatal("Expected: event, got:", err)
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	io.ReadFull(resp.Body, msg)
+	e, err := decodeProto(msg)
+	if err != nil || e.string(1) != "MessageNotification" || e.string(2) != `{"Storage":"SM","Index":2}` {
+		t.Errorf("Unexpected event: %v %v", e, err)
+	}
+}
+
+func TestProto(t *testing.T) {
+	m := protoMessage(nil).int(1, -1).string(2, "héllo").uint(3, 300).bool(4, true).int(5, 0)
+	fields, err := decodeProto(m)
+	if err != nil || fields.int(1) != -1 || fields.string(2) != "héllo" || fields.uint(3) != 300 || fields.uint(4) != 1 {
+		t.Errorf("Unexpected fields: %v %v", fields, err)
+	}
+	if _, ok := fields[5]; ok {
+		t.Error("Expected: zero value left out")
+	}
+	if _, err := decodeProto(m[:len(m)-1]); err != errProtoTruncated {
+		t.Error("Expected: truncated, got:", err)
+	}
+}
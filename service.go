@@ -0,0 +1,39 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"log"
+)
+
+var ErrSMSServiceUnsupported = errors.New("SMS service supports neither sending nor receiving")
+
+// Select the message service from Options.SMSService if set, and check the
+// modem can send or receive messages
+func (self *Modem) selectSMSService() error {
+	if self.smsService > 0 {
+		if _, err := self.send("+CSMS", self.smsService); err != nil {
+			log.Println("Message service", self.smsService, "not supported:", err)
+		} else if p, err := self.send("+CSMS?"); err == nil {
+			if service, ok := p.(SMSService); ok {
+				self.service = &service
+			}
+		}
+	}
+	if self.service == nil {
+		return nil
+	}
+	log.Printf("Message service: %#v", *self.service)
+	if self.service.MT == 0 && self.service.MO == 0 {
+		return ErrSMSServiceUnsupported
+	}
+	return nil
+}
+
+// SMSService reports the message service selected (+CSMS) and the message
+// types it supports, and false if the modem didn't report it.
+func (self *Modem) SMSService() (SMSService, bool) {
+	if self.service == nil {
+		return SMSService{}, false
+	}
+	return *self.service, true
+}
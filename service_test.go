@@ -0,0 +1,51 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var selectServiceReplay = appendLists(resetReplay, simReadyReplay, []string{
+	"->AT+CSMS=1\r\n",
+	"<-\r\n+CSMS: 1,1,1\r\n\r\nOK\r\n",
+	"->AT+CSMS?\r\n",
+	"<-\r\n+CSMS: 1,1,1,1\r\n\r\nOK\r\n",
+}, configureReplay, []string{
+	"->AT+CMGF=0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CNMI=2,2,0,1,0\r\n",
+	"<-\r\nOK\r\n",
+})
+
+func TestSelectSMSService(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(selectServiceReplay), nil
+	}
+	modem, err := OpenWithOptions(&serial.Config{}, Options{Debug: true, SMSService: 1})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	if service, ok := modem.SMSService(); !ok || service != (SMSService{1, 1, 1, 1}) {
+		t.Errorf("Expected: phase 2+ service, got %#v %v", service, ok)
+	}
+	modem.Close()
+}
+
+var noServiceReplay = appendLists(resetReplay, []string{
+	"->AT+CPIN?\r\n",
+	"<-\r\n+CPIN: READY\r\n\r\nOK\r\n",
+	"->AT+CSMS?\r\n",
+	"<-\r\n+CSMS: 0,0,0,0\r\n\r\nOK\r\n",
+})
+
+func TestSMSServiceUnsupported(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(noServiceReplay), nil
+	}
+	_, err := Open(&serial.Config{}, true)
+	if err != ErrSMSServiceUnsupported {
+		t.Error("Expected: service unsupported, got:", err)
+	}
+}
@@ -0,0 +1,97 @@
+package gogsmmodem
+
+import (
+	"sync"
+	"time"
+)
+
+// Counters for a modem since it was opened
+type Stats struct {
+	Uptime                 time.Duration
+	Commands               int
+	Retries                int
+	MessagesSent           int
+	MessagesReceived       int
+	MessagesFailed         int
+	LastRegistrationChange time.Time
+	// Last signal quality read, and when
+	Signal   SignalQuality
+	SignalAt time.Time
+	// Last registration status read (RegHome etc.), and when
+	Registration   int
+	RegistrationAt time.Time
+}
+
+type statsCounter struct {
+	sync.Mutex
+	clock        Clock
+	started      time.Time
+	stats        Stats
+	registration int
+}
+
+func newStatsCounter(clock Clock) *statsCounter {
+	return &statsCounter{clock: clock, started: clock.Now(), registration: -1}
+}
+
+func (self *statsCounter) update(f func(s *Stats)) {
+	self.Lock()
+	f(&self.stats)
+	self.Unlock()
+}
+
+func (self *statsCounter) commandIssued() {
+	self.update(func(s *Stats) { s.Commands++ })
+}
+
+func (self *statsCounter) retried() {
+	self.update(func(s *Stats) { s.Retries++ })
+}
+
+func (self *statsCounter) messageReceived() {
+	self.update(func(s *Stats) { s.MessagesReceived++ })
+}
+
+func (self *statsCounter) messageSent(err error) {
+	self.update(func(s *Stats) {
+		if err == nil {
+			s.MessagesSent++
+		} else {
+			s.MessagesFailed++
+		}
+	})
+}
+
+// Record the registration status, noting the time when it changes
+func (self *statsCounter) registered(status int) {
+	self.Lock()
+	self.stats.Registration = status
+	self.stats.RegistrationAt = self.clock.Now()
+	if status != self.registration {
+		if self.registration != -1 {
+			self.stats.LastRegistrationChange = self.clock.Now()
+		}
+		self.registration = status
+	}
+	self.Unlock()
+}
+
+func (self *statsCounter) signal(sq SignalQuality) {
+	self.update(func(s *Stats) {
+		s.Signal = sq
+		s.SignalAt = self.clock.Now()
+	})
+}
+
+func (self *statsCounter) snapshot() Stats {
+	self.Lock()
+	defer self.Unlock()
+	ret := self.stats
+	ret.Uptime = self.clock.Now().Sub(self.started)
+	return ret
+}
+
+// Stats returns a snapshot of the modem's counters.
+func (self *Modem) Stats() Stats {
+	return self.stats.snapshot()
+}
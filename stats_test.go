@@ -0,0 +1,90 @@
+package gogsmmodem
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestStatsCounters(t *testing.T) {
+	clock := NewMockClock(time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC))
+	stats := newStatsCounter(clock)
+	stats.commandIssued()
+	stats.commandIssued()
+	stats.retried()
+	stats.messageReceived()
+	stats.messageSent(nil)
+	stats.messageSent(errors.New("Response was ERROR"))
+	stats.messageSent(nil)
+	clock.Advance(time.Minute)
+
+	s := stats.snapshot()
+	expected := Stats{Uptime: time.Minute, Commands: 2, Retries: 1, MessagesSent: 2, MessagesReceived: 1, MessagesFailed: 1}
+	if s != expected {
+		t.Errorf("Expected: %+v, got: %+v", expected, s)
+	}
+}
+
+func TestStatsRegistrationChange(t *testing.T) {
+	start := time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC)
+	clock := NewMockClock(start)
+	stats := newStatsCounter(clock)
+
+	// the first status read is not a change
+	stats.registered(RegHome)
+	if s := stats.snapshot(); !s.LastRegistrationChange.IsZero() || s.Registration != RegHome || !s.RegistrationAt.Equal(start) {
+		t.Errorf("Unexpected stats after first read: %+v", s)
+	}
+	clock.Advance(time.Minute)
+	stats.registered(RegHome)
+	if s := stats.snapshot(); !s.LastRegistrationChange.IsZero() || !s.RegistrationAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("Unexpected stats after same status: %+v", s)
+	}
+	clock.Advance(time.Minute)
+	stats.registered(RegSearching)
+	if s := stats.snapshot(); !s.LastRegistrationChange.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("Expected registration change at %v, got: %v", start.Add(2*time.Minute), s.LastRegistrationChange)
+	}
+}
+
+func TestModemStatsSends(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(textInitReplay, sendMessageReplay, []string{
+			"->AT+CMGS=\"441234567890\"\r\n",
+			"<-> \r\n",
+			"->Body\x00\x1a",
+			"<-\r\n+CMS ERROR: 302\r\n",
+		})), nil
+	}
+	modem, err := openText()
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	// counted from when the modem was opened
+	before := modem.Stats()
+	if before.Commands == 0 || before.MessagesSent != 0 || before.Retries != 0 {
+		t.Errorf("Unexpected stats after init: %+v", before)
+	}
+	if err := modem.SendMessage("441234567890", "Body@"); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	if err := modem.SendMessage("441234567890", "Body@"); err == nil {
+		t.Error("Expected: send failure")
+	}
+	modem.Close()
+	s := modem.Stats()
+	if s.Commands != before.Commands+2 || s.MessagesSent != 1 || s.MessagesFailed != 1 {
+		t.Errorf("Unexpected stats after sends: %+v", s)
+	}
+}
+
+func TestModemStats(t *testing.T) {
+	modem := &Modem{stats: newStatsCounter(DefaultClock)}
+	modem.stats.messageSent(nil)
+	if s := modem.Stats(); s.MessagesSent != 1 {
+		t.Error("Expected: 1 message sent, got:", s.MessagesSent)
+	}
+}
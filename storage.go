@@ -0,0 +1,101 @@
+package gogsmmodem
+
+import (
+	"context"
+	"log"
+)
+
+// The read storage area (+CPMS), querying it if unknown. The caller must hold
+// the modem.
+func (self *Modem) readStorage() (string, error) {
+	if self.storage != "" {
+		return self.storage, nil
+	}
+	packet, err := self.request(self.Timeout, "+CPMS?")
+	if err != nil {
+		return "", err
+	}
+	if info, ok := packet.(StorageInfo); ok {
+		self.storage = info.ReadStorage
+	}
+	return self.storage, nil
+}
+
+// Run f with storage as the read storage area, switching from the current
+// area and back if they differ. An empty storage is the current area. The
+// caller must hold the modem.
+func (self *Modem) inStorage(storage string, f func() error) error {
+	if storage == "" {
+		return f()
+	}
+	current, err := self.readStorage()
+	if err != nil {
+		return err
+	}
+	if storage == current {
+		return f()
+	}
+	if _, err := self.request(self.Timeout, "+CPMS", storage); err != nil {
+		return err
+	}
+	self.storage = storage
+	err = f()
+	if current != "" {
+		if _, err := self.request(self.Timeout, "+CPMS", current); err != nil {
+			log.Println("Restoring storage", current, "failed:", err)
+		} else {
+			self.storage = current
+		}
+	}
+	return err
+}
+
+// GetMessageFrom reads message n from a storage area, eg "ME" as given by a
+// MessageNotification, switching the read storage (+CPMS) for the read if it
+// differs from the current one. An empty storage is the current area.
+func (self *Modem) GetMessageFrom(storage string, n int) (*Message, error) {
+	return self.getMessage(context.Background(), storage, n)
+}
+
+func (self *Modem) getMessage(ctx context.Context, storage string, n int) (*Message, error) {
+	packet, err := self.exec(ctx, PriorityHigh, func() (Packet, error) {
+		var packet Packet
+		err := self.inStorage(storage, func() error {
+			var err error
+			packet, err = self.request(self.Timeout, "+CMGR", n)
+			return err
+		})
+		if storage == "" {
+			storage = self.storage
+		}
+		return packet, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if msg, ok := packet.(Message); ok {
+		if isPDUMessage(msg) {
+			decoded, err := decodePDUMessage(msg)
+			if err != nil {
+				return nil, err
+			}
+			msg = *decoded
+		}
+		msg.Index = n
+		msg.Storage = storage
+		self.received(&msg)
+		return &msg, nil
+	}
+	return nil, ErrMessageNotFound
+}
+
+// DeleteMessageFrom deletes message n from a storage area, as for
+// GetMessageFrom.
+func (self *Modem) DeleteMessageFrom(storage string, n int) error {
+	return self.hold(context.Background(), func() error {
+		return self.inStorage(storage, func() error {
+			_, err := self.request(self.Timeout, "+CMGD", n)
+			return err
+		})
+	})
+}
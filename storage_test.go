@@ -0,0 +1,40 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var storageReplay = []string{
+	"->AT+CPMS?\r\n",
+	"<-\r\n+CPMS: \"SM\",1,20,\"SM\",1,20,\"SM\",1,20\r\n\r\nOK\r\n",
+	"->AT+CPMS=\"ME\"\r\n",
+	"<-\r\n+CPMS: 1,25,1,20,1,20\r\n\r\nOK\r\n",
+	"->AT+CMGR=3\r\n",
+	"<-\r\n+CMGR: 0,,21\r\n00040C9144214365870900004120105170340002C834\r\n\r\nOK\r\n",
+	"->AT+CPMS=\"SM\"\r\n",
+	"<-\r\n+CPMS: 1,20,1,20,1,20\r\n\r\nOK\r\n",
+	// current storage known
+	"->AT+CMGD=3\r\n",
+	"<-\r\nOK\r\n",
+}
+
+func TestGetMessageFrom(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, storageReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	msg, err := modem.GetMessageFrom("ME", 3)
+	if err != nil || msg.Storage != "ME" || msg.Index != 3 {
+		t.Errorf("Expected: message 3 from ME, got %#v %v", msg, err)
+	}
+	if err := modem.DeleteMessageFrom("SM", 3); err != nil {
+		t.Error("Expected: no error, got:", err)
+	}
+	modem.Close()
+}
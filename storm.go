@@ -0,0 +1,71 @@
+package gogsmmodem
+
+import (
+	"log"
+	"time"
+)
+
+// Default for Modem.StormThreshold.
+var DefaultStormThreshold = 5
+
+// Delay between turning the radio off and on again in a soft reset, and how
+// long to wait for registration afterwards.
+var StormResetDelay = 5 * time.Second
+var StormRegistrationWait = 2 * time.Minute
+
+// Is err the unknown error some networks return in bursts
+func isStormError(err error) bool {
+	e, ok := err.(ERROR)
+	return ok && e.Type == "+CMS ERROR" && e.Code == 500
+}
+
+// Count consecutive storm errors from sends, soft resetting the modem at
+// StormThreshold. The caller must hold the modem.
+func (self *Modem) checkStorm(err error) {
+	if isStormError(err) {
+		self.storm++
+	} else {
+		self.storm = 0
+	}
+	if self.StormThreshold <= 0 || self.storm < self.StormThreshold {
+		return
+	}
+	failures := self.storm
+	self.storm = 0
+	log.Printf("%d consecutive send failures, soft resetting modem", failures)
+	self.emit(StormReset{failures, self.softReset()})
+}
+
+// Cycle the radio with +CFUN and wait for the modem to register again. The
+// caller must hold the modem.
+func (self *Modem) softReset() error {
+	self.caps.clear()
+	if _, err := self.request(self.Timeout, "+CFUN", 0); err != nil {
+		return err
+	}
+	self.clock.Sleep(StormResetDelay)
+	if _, err := self.request(self.Timeout, "+CFUN", 1); err != nil {
+		return err
+	}
+	deadline := self.clock.Now().Add(StormRegistrationWait)
+	for {
+		packet, err := self.request(self.Timeout, "+CREG?")
+		if reg, ok := packet.(NetworkRegistration); ok && err == nil {
+			// or on LTE alone
+			if !reg.Registered() && self.Supports(FeatureEPS) {
+				packet, err := self.request(self.Timeout, "+CEREG?")
+				if eps, ok := packet.(EPSRegistration); ok && err == nil && eps.Registered() {
+					reg.Status = eps.Status
+				}
+			}
+			self.stats.registered(reg.Status)
+			if reg.Registered() {
+				return nil
+			}
+		}
+		if !self.clock.Now().Before(deadline) {
+			return ErrNoCoverage
+		}
+		self.clock.Sleep(CoveragePollInterval)
+	}
+}
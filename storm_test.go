@@ -0,0 +1,94 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+
+	"github.com/tarm/serial"
+)
+
+var stormReplay = []string{
+	"->AT+CMGS=19\r\n",
+	"<-> \r\n",
+	"->0011000C814421436587090000AA05C237390F00\x1a",
+	"<-\r\n+CMS ERROR: 500\r\n",
+	"->AT+CMGS=19\r\n",
+	"<-> \r\n",
+	"->0011000C814421436587090000AA05C237390F00\x1a",
+	"<-\r\n+CMS ERROR: 500\r\n",
+	"->AT+CFUN=0\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CFUN=1\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,2\r\n\r\nOK\r\n",
+	"->AT+CEREG?\r\n",
+	"<-\r\n+CEREG: 0,2\r\n\r\nOK\r\n",
+	"->AT+CREG?\r\n",
+	"<-\r\n+CREG: 0,1\r\n\r\nOK\r\n",
+}
+
+func TestStormReset(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, stormReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.StormThreshold = 2
+
+	for i := 0; i < 2; i++ {
+		err = modem.SendMessage("441234567890", "Body@")
+		if err == nil || err.Error() != "Response was +CMS ERROR: 500" {
+			t.Error("Expected: CMS error 500, got:", err)
+		}
+	}
+	modem.Close()
+	storm := ERROR{"+CMS ERROR", 500}
+	assertOOBCommands(t, modem, []Packet{
+		MessageSent{"", "441234567890", 0, storm},
+		StormReset{2, nil},
+		MessageSent{"", "441234567890", 0, storm},
+	})
+}
+
+func TestStormResetLTE(t *testing.T) {
+	// registered on LTE alone at the first poll
+	replay := append([]string{}, stormReplay[:len(stormReplay)-2]...)
+	replay[len(replay)-1] = "<-\r\n+CEREG: 0,1\r\n\r\nOK\r\n"
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, replay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	modem.StormThreshold = 2
+	for i := 0; i < 2; i++ {
+		modem.SendMessage("441234567890", "Body@")
+	}
+	modem.Close()
+	storm := ERROR{"+CMS ERROR", 500}
+	assertOOBCommands(t, modem, []Packet{
+		MessageSent{"", "441234567890", 0, storm},
+		StormReset{2, nil},
+		MessageSent{"", "441234567890", 0, storm},
+	})
+}
+
+func TestStormInterleaved(t *testing.T) {
+	modem := &Modem{StormThreshold: 2}
+	storm := ERROR{"+CMS ERROR", 500}
+	// not consecutive, so no reset
+	modem.checkStorm(storm)
+	modem.checkStorm(ERROR{"+CMS ERROR", 302})
+	modem.checkStorm(storm)
+	if modem.storm != 1 {
+		t.Error("Expected: count restarted by the other error, got:", modem.storm)
+	}
+	modem.checkStorm(ErrTimeout)
+	if modem.storm != 0 {
+		t.Error("Expected: count reset, got:", modem.storm)
+	}
+}
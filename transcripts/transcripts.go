@@ -0,0 +1,80 @@
+// Package transcripts contains recorded AT command exchanges from common
+// modems, for validating the parser against formats seen in the field.
+//
+// Telephone numbers, SMSC addresses and message contents are anonymized.
+package transcripts
+
+// An AT command and the raw response from the modem, including any echo and
+// unsolicited lines interleaved with it.
+type Exchange struct {
+	Command  string
+	Response string
+}
+
+// Recorded exchanges from one modem model
+type Transcript struct {
+	Modem     string
+	Exchanges []Exchange
+}
+
+// Replay the transcript in the "->"/"<-" format used by MockSerialPort.
+func (self Transcript) Replay() []string {
+	var ret []string
+	for _, ex := range self.Exchanges {
+		ret = append(ret, "->"+ex.Command+"\r\n", "<-"+ex.Response)
+	}
+	return ret
+}
+
+// ZTE MF190 USB stick, echo disabled, ZTE URCs enabled.
+var ZTEMF190 = Transcript{
+	Modem: "ZTE MF190",
+	Exchanges: []Exchange{
+		{"AT+CSQ", "\r\n+CSQ: 14,99\r\n\r\nOK\r\n"},
+		{"AT+CREG?", "\r\n+ZPASR: \"UMTS\"\r\n\r\n+CREG: 0,1\r\n\r\nOK\r\n"},
+		{"AT+CSCA?", "\r\n+CSCA: \"+447700900100\",145\r\n\r\nOK\r\n"},
+		{"AT+CPMS=?", "\r\n+CPMS: (\"ME\",\"SM\",\"SR\"),(\"ME\",\"SM\"),(\"ME\",\"SM\")\r\n\r\nOK\r\n"},
+		{"AT+CPMS?", "\r\n+CPMS: \"SM\",3,20,\"SM\",3,20,\"SM\",3,20\r\n\r\nOK\r\n"},
+		{"AT+CMGR=1", "\r\n+CMGR: \"REC READ\",\"+447700900123\",,\"21/03/14,09:26:11+00\"\r\nHello from ZTE\r\n\r\nOK\r\n"},
+	},
+}
+
+// Huawei E3372 in stick mode, echo enabled, ^RSSI reports enabled.
+var HuaweiE3372 = Transcript{
+	Modem: "Huawei E3372",
+	Exchanges: []Exchange{
+		{"AT+CSQ", "AT+CSQ\r\r\n+CSQ: 21,99\r\n\r\nOK\r\n"},
+		{"AT+CREG?", "AT+CREG?\r\r\n^RSSI:21\r\n\r\n+CREG: 0,5\r\n\r\nOK\r\n"},
+		{"AT+CSCA?", "AT+CSCA?\r\r\n+CSCA: \"+447700900200\",145\r\n\r\nOK\r\n"},
+		{"AT+CPMS?", "AT+CPMS?\r\r\n+CPMS: \"SM\",0,50,\"SM\",0,50,\"SM\",0,50\r\n\r\nOK\r\n"},
+		{"AT+CMGR=0", "AT+CMGR=0\r\r\n+CMGR: \"REC UNREAD\",\"+447700900456\",,\"21/03/14,11:00:00+00\"\r\nHuawei test\r\n\r\nOK\r\n"},
+		{"AT+CMGR=7", "AT+CMGR=7\r\r\n+CMS ERROR: 321\r\n"},
+	},
+}
+
+// SIMCom SIM800L module, echo enabled, two storage areas.
+var SIM800L = Transcript{
+	Modem: "SIMCom SIM800L",
+	Exchanges: []Exchange{
+		{"AT+CSQ", "AT+CSQ\r\r\n+CSQ: 9,0\r\n\r\nOK\r\n"},
+		{"AT+CREG?", "AT+CREG?\r\r\n+CREG: 0,2\r\n\r\nOK\r\n"},
+		{"AT+CSCA?", "AT+CSCA?\r\r\n+CSCA: \"+447700900300\",145\r\n\r\nOK\r\n"},
+		{"AT+CPMS?", "AT+CPMS?\r\r\n+CPMS: \"SM_P\",1,30,\"SM_P\",1,30\r\n\r\nOK\r\n"},
+		{"AT+CMGR=1", "AT+CMGR=1\r\r\n+CMGR: \"REC READ\",\"+447700900789\",\"\",\"21/03/14,10:01:02+00\"\r\nSIM800 says hi\r\n\r\nOK\r\n"},
+	},
+}
+
+// Quectel EC25 LTE module, echo disabled.
+var EC25 = Transcript{
+	Modem: "Quectel EC25",
+	Exchanges: []Exchange{
+		{"AT+CSQ", "\r\n+CSQ: 31,99\r\n\r\nOK\r\n"},
+		{"AT+CREG?", "\r\n+CREG: 0,1\r\n\r\nOK\r\n"},
+		{"AT+CSCA?", "\r\n+CSCA: \"+447700900400\",145\r\n\r\nOK\r\n"},
+		{"AT+CPMS?", "\r\n+CPMS: \"ME\",2,255,\"ME\",2,255,\"ME\",2,255\r\n\r\nOK\r\n"},
+		{"AT+CMGL=\"ALL\"", "\r\n+CMGL: 0,\"REC READ\",\"+447700900111\",,\"21/03/14,08:00:00+04\"\r\nFirst\r\n+CMGL: 1,\"REC UNREAD\",\"+447700900222\",,\"21/03/14,08:05:00+04\"\r\nSecond\r\n\r\nOK\r\n"},
+	},
+}
+
+// All recorded transcripts
+var All = []Transcript{ZTEMF190, HuaweiE3372, SIM800L, EC25}
@@ -0,0 +1,101 @@
+package gogsmmodem
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/barnybug/gogsmmodem/transcripts"
+)
+
+// A modem listening on a replay, without running init.
+func newReplayModem(replay []string) *Modem {
+	modem := &Modem{
+		OOB:     make(chan Packet, 16),
+		Timeout: DefaultTimeout,
+		clock:   DefaultClock,
+		port:    NewMockSerialPort(replay),
+		rx:      make(chan tagged, responseBuffer),
+		tx:      make(chan string),
+		stats:   newStatsCounter(DefaultClock),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	modem.reader = bufio.NewReader(modem.port)
+	modem.dispatch = modemDispatcher{modem}
+	go modem.listen()
+	return modem
+}
+
+func tm(s string) time.Time {
+	return parseTime(s)
+}
+
+var transcriptPackets = map[string]map[string][]Packet{
+	"ZTE MF190": {
+		"AT+CSQ":    {SignalQuality{14, 99}},
+		"AT+CREG?":  {NetworkRegistration{0, RegHome}},
+		"AT+CSCA?":  {SMSCAddress{"+447700900100", 145}},
+		"AT+CPMS=?": {StorageAreas{[]string{"ME", "SM", "SR"}, []string{"ME", "SM"}, []string{"ME", "SM"}}},
+		"AT+CPMS?":  {StorageInfo{"SM", 3, 20, "SM", 3, 20, "SM", 3, 20}},
+		"AT+CMGR=1": {Message{Status: "REC READ", Telephone: "+447700900123", Timestamp: tm("21/03/14,09:26:11+00"), Body: "Hello from ZTE"}},
+	},
+	"Huawei E3372": {
+		"AT+CSQ":    {SignalQuality{21, 99}},
+		"AT+CREG?":  {NetworkRegistration{0, RegRoaming}},
+		"AT+CSCA?":  {SMSCAddress{"+447700900200", 145}},
+		"AT+CPMS?":  {StorageInfo{"SM", 0, 50, "SM", 0, 50, "SM", 0, 50}},
+		"AT+CMGR=0": {Message{Status: "REC UNREAD", Telephone: "+447700900456", Timestamp: tm("21/03/14,11:00:00+00"), Body: "Huawei test"}},
+		"AT+CMGR=7": {ERROR{"+CMS ERROR", 321}},
+	},
+	"SIMCom SIM800L": {
+		"AT+CSQ":    {SignalQuality{9, 0}},
+		"AT+CREG?":  {NetworkRegistration{0, RegSearching}},
+		"AT+CSCA?":  {SMSCAddress{"+447700900300", 145}},
+		"AT+CPMS?":  {StorageInfo{"SM_P", 1, 30, "SM_P", 1, 30, "", 0, 0}},
+		"AT+CMGR=1": {Message{Status: "REC READ", Telephone: "+447700900789", Timestamp: tm("21/03/14,10:01:02+00"), Body: "SIM800 says hi"}},
+	},
+	"Quectel EC25": {
+		"AT+CSQ":   {SignalQuality{31, 99}},
+		"AT+CREG?": {NetworkRegistration{0, RegHome}},
+		"AT+CSCA?": {SMSCAddress{"+447700900400", 145}},
+		"AT+CPMS?": {StorageInfo{"ME", 2, 255, "ME", 2, 255, "ME", 2, 255}},
+		"AT+CMGL=\"ALL\"": {
+			Message{Index: 0, Status: "REC READ", Telephone: "+447700900111", Timestamp: tm("21/03/14,08:00:00+04"), Body: "First"},
+			Message{Index: 1, Status: "REC UNREAD", Telephone: "+447700900222", Timestamp: tm("21/03/14,08:05:00+04"), Body: "Second", Last: true},
+		},
+	},
+}
+
+func TestTranscripts(t *testing.T) {
+	for _, transcript := range transcripts.All {
+		expected, ok := transcriptPackets[transcript.Modem]
+		if !ok {
+			t.Errorf("%s: no expected packets", transcript.Modem)
+			continue
+		}
+		modem := newReplayModem(transcript.Replay())
+		for _, ex := range transcript.Exchanges {
+			packets, ok := expected[ex.Command]
+			if !ok {
+				t.Errorf("%s: no expected packets for %s", transcript.Modem, ex.Command)
+				continue
+			}
+			packet, err := modem.send(strings.TrimPrefix(ex.Command, "AT"))
+			if err != nil && packet == nil {
+				t.Errorf("%s %s: %v", transcript.Modem, ex.Command, err)
+				continue
+			}
+			for i, want := range packets {
+				if i > 0 {
+					packet, _ = modem.receive()
+				}
+				if !reflect.DeepEqual(packet, want) {
+					t.Errorf("%s %s: expected %#v, got %#v", transcript.Modem, ex.Command, want, packet)
+				}
+			}
+		}
+	}
+}
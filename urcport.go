@@ -0,0 +1,24 @@
+package gogsmmodem
+
+import (
+	"io"
+	"log"
+)
+
+// AttachURCPort reads unsolicited results from a secondary port, as exposed
+// by many Huawei and ZTE USB modems alongside the command port. Its lines are
+// parsed and delivered on OOB like those from the command port. The port is
+// closed with the modem. Attach ports before using the modem concurrently.
+func (self *Modem) AttachURCPort(port io.ReadCloser) {
+	self.urcPorts = append(self.urcPorts, port)
+	go func() {
+		parser := NewParser()
+		parser.Patterns = self.profile.patterns()
+		parser.Mode = self.parseMode
+		for line := range ReadLines(port) {
+			self.tapRead(line)
+			parser.Line(line, urcDispatcher{self.dispatch})
+		}
+		log.Println("URC port closed")
+	}()
+}
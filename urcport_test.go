@@ -0,0 +1,43 @@
+package gogsmmodem
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestAttachURCPort(t *testing.T) {
+	urc := NewMockSerialPort([]string{
+		"<-\r\n+CMTI: \"SM\",3\r\n",
+	})
+	ports := []io.ReadWriteCloser{NewMockSerialPort(initReplay), urc}
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		port := ports[0]
+		ports = ports[1:]
+		return port, nil
+	}
+	modem, err := OpenWithOptions(&serial.Config{}, Options{Debug: true, URCPort: &serial.Config{}})
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case p := <-modem.OOB:
+			if _, ok := p.(InitProgress); ok {
+				continue
+			}
+			expected := MessageNotification{"SM", 3}
+			if p != expected {
+				t.Errorf("Expected: %#v, got %#v", expected, p)
+			}
+		case <-timeout:
+			t.Error("Expected: notification from URC port")
+		}
+		break
+	}
+	modem.Close()
+}
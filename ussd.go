@@ -0,0 +1,246 @@
+package gogsmmodem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// How long to wait for the network to reply to a USSD request
+var USSDTimeout = 30 * time.Second
+
+// How long an active USSD session waits for the caller to reply before it is
+// closed, so an abandoned session does not hold up other USSD requests
+var USSDSessionTimeout = 2 * time.Minute
+
+// USSD session status (+CUSD)
+const (
+	// No further action required
+	USSDDone = 0
+	// The network expects a reply
+	USSDAction = 1
+	// Terminated by the network
+	USSDTerminated = 2
+	// Answered by another local client
+	USSDOtherClient  = 3
+	USSDNotSupported = 4
+	USSDTimedOut     = 5
+)
+
+// Returned by USSD when the network terminates the session, does not
+// support the request or times out.
+type USSDError struct {
+	Status int
+}
+
+func (self USSDError) Error() string {
+	return fmt.Sprintf("USSD request failed with status %d", self.Status)
+}
+
+var ErrUSSDEnded = errors.New("USSD session ended")
+
+// An interactive USSD session, eg a SIM menu, see SendUSSD. The network
+// holds one session per SIM, so other USSD requests wait until it ends: it
+// must be replied to until it ends, or closed. A session left without a reply
+// for USSDSessionTimeout is closed, and one ended by the network, eg timed
+// out, ends.
+type USSDSession struct {
+	modem *Modem
+	// The network's latest reply
+	Response USSDResponse
+	lock     sync.Mutex
+	ended    bool
+	// replies received, so an expiry is for the latest
+	turn int
+}
+
+// SendUSSD starts a USSD session with a request, eg "*100#", returning it
+// with the network's reply. The session stays active while the network
+// expects a reply, eg to a menu.
+func (self *Modem) SendUSSD(code string) (*USSDSession, error) {
+	self.ussdLock.Lock()
+	r, err := self.ussdRequest(context.Background(), PriorityNormal, code)
+	if err != nil || r.Status != USSDAction {
+		self.ussdLock.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	session := &USSDSession{modem: self, Response: *r, ended: r.Status != USSDAction}
+	if !session.ended {
+		self.stateLock.Lock()
+		self.ussdSession = session
+		self.stateLock.Unlock()
+		go session.expire(0)
+	}
+	return session, nil
+}
+
+// Active reports whether the network expects a reply
+func (self *USSDSession) Active() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return !self.ended
+}
+
+// Reply to the network, eg choosing "1" from a menu, returning its next
+// reply. Fails with ErrUSSDEnded once the session is no longer active, and
+// ends it on failure.
+func (self *USSDSession) Reply(text string) (*USSDResponse, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.ended {
+		return nil, ErrUSSDEnded
+	}
+	r, err := self.modem.ussdRequest(context.Background(), PriorityNormal, text)
+	if err != nil {
+		self.end()
+		return nil, err
+	}
+	self.Response = *r
+	if r.Status != USSDAction {
+		self.end()
+		return r, nil
+	}
+	self.turn++
+	go self.expire(self.turn)
+	return r, nil
+}
+
+// Close terminates the session (+CUSD=2) if still active.
+func (self *USSDSession) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.ended {
+		return nil
+	}
+	// before other requests may start
+	_, err := self.modem.send("+CUSD", 2)
+	self.end()
+	return err
+}
+
+// End the session, letting other USSD requests run. The caller must hold
+// the session's lock.
+func (self *USSDSession) end() {
+	self.ended = true
+	self.modem.stateLock.Lock()
+	if self.modem.ussdSession == self {
+		self.modem.ussdSession = nil
+	}
+	self.modem.stateLock.Unlock()
+	self.modem.ussdLock.Unlock()
+}
+
+// Close the session if the reply of the given turn is still unanswered after
+// USSDSessionTimeout
+func (self *USSDSession) expire(turn int) {
+	select {
+	case <-self.modem.clock.After(USSDSessionTimeout):
+	case <-self.modem.done:
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.ended || self.turn != turn {
+		return
+	}
+	log.Println("USSD session abandoned, closing it")
+	if _, err := self.modem.send("+CUSD", 2); err != nil {
+		log.Println("Closing USSD session:", err)
+	}
+	self.end()
+}
+
+// End the session on the network ending it, unless a reply in progress
+// already has
+func (self *USSDSession) terminated() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if !self.ended {
+		self.end()
+	}
+}
+
+// USSD sends a USSD request, eg "*100#", and waits for the network's reply,
+// after any active session ends.
+func (self *Modem) USSD(code string) (*USSDResponse, error) {
+	return self.ussdContext(context.Background(), PriorityNormal, code)
+}
+
+func (self *Modem) ussdContext(ctx context.Context, def Priority, code string) (*USSDResponse, error) {
+	self.ussdLock.Lock()
+	defer self.ussdLock.Unlock()
+	return self.ussdRequest(ctx, def, code)
+}
+
+// Send a USSD request. The caller must hold ussdLock.
+func (self *Modem) ussdRequest(ctx context.Context, def Priority, code string) (*USSDResponse, error) {
+	// discard a reply to an earlier request that timed out
+	select {
+	case <-self.ussd:
+	default:
+	}
+	// read with the modem held, as setEncoding changes it
+	var charset string
+	p, err := self.exec(ctx, def, func() (Packet, error) {
+		charset = self.charset
+		if charset == "UCS2" {
+			code = unicodeEncode(code)
+		}
+		return self.request(self.Timeout, "+CUSD", 1, code, 15)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// some modems reply before OK, most after it
+	r, ok := p.(USSDResponse)
+	if !ok {
+		select {
+		case r = <-self.ussd:
+		case <-self.clock.After(USSDTimeout):
+			return nil, ErrTimeout
+		case <-self.closed:
+			return nil, ErrPortClosed
+		}
+	}
+	switch r.Status {
+	case USSDTerminated, USSDNotSupported, USSDTimedOut:
+		return nil, USSDError{r.Status}
+	}
+	r.Text = decodeUSSD(r.Text, r.DCS, charset)
+	return &r, nil
+}
+
+// Pass an unsolicited +CUSD to a waiting USSD request, ending the active
+// session if the network no longer expects a reply
+func (self *Modem) ussdReply(r USSDResponse) {
+	select {
+	case self.ussd <- r:
+	default:
+	}
+	if r.Status != USSDAction {
+		self.stateLock.Lock()
+		session := self.ussdSession
+		self.stateLock.Unlock()
+		if session != nil {
+			// a reply in progress holds the session until it has this
+			go session.terminated()
+		}
+	}
+}
+
+// Decode the text of a USSD reply for its data coding scheme (3GPP TS
+// 23.038) or the character set in use
+func decodeUSSD(text string, dcs int, charset string) string {
+	if dcs == 0x11 || dcs&0xf0 == 0x40 && dcs&0x0c == 0x08 || charset == "UCS2" {
+		if d, err := unicodeDecode(text); err == nil {
+			return d
+		}
+		return text
+	}
+	return decodeCharset(text, charset)
+}
@@ -0,0 +1,202 @@
+package gogsmmodem
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+var ussdReplay = []string{
+	"->AT+CUSD=1,\"*100#\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 0,\"Balance: 5.20 GBP\",15\r\n",
+	"->AT+CUSD=1,\"*101#\",15\r\n",
+	"<-\r\n+CUSD: 1,\"1. Top up, 2. Exit\",15\r\n\r\nOK\r\n",
+	"->AT+CUSD=1,\"*102#\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 4\r\n",
+}
+
+func TestUSSD(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, ussdReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer modem.Close()
+	r, err := modem.USSD("*100#")
+	if err != nil || !reflect.DeepEqual(r, &USSDResponse{USSDDone, "Balance: 5.20 GBP", 15}) {
+		t.Errorf("Expected: reply after OK, got %#v, %v", r, err)
+	}
+	r, err = modem.USSD("*101#")
+	if err != nil || !reflect.DeepEqual(r, &USSDResponse{USSDAction, "1. Top up, 2. Exit", 15}) {
+		t.Errorf("Expected: reply before OK, got %#v, %v", r, err)
+	}
+	_, err = modem.USSD("*102#")
+	if err != (USSDError{USSDNotSupported}) {
+		t.Error("Expected: USSDError, got:", err)
+	}
+}
+
+func TestDecodeUSSD(t *testing.T) {
+	if text := decodeUSSD("0042006100200A3", 0x48, "GSM"); text != "0042006100200A3" {
+		t.Error("Expected: invalid UCS2 left as is, got:", text)
+	}
+	if text := decodeUSSD("00A30035", 0x48, "GSM"); text != "£5" {
+		t.Error("Expected: £5, got:", text)
+	}
+	if text := decodeUSSD("00A30035", 15, "GSM"); text != "00A30035" {
+		t.Error("Expected: GSM text, got:", text)
+	}
+}
+
+var ussdSessionReplay = []string{
+	"->AT+CUSD=1,\"*101#\",15\r\n",
+	"<-\r\n+CUSD: 1,\"1. Top up, 2. Exit\",15\r\n\r\nOK\r\n",
+	"->AT+CUSD=1,\"1\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 1,\"0041002000A3\",72\r\n",
+	"->AT+CUSD=2\r\n",
+	"<-\r\nOK\r\n",
+	"->AT+CUSD=1,\"*100#\",15\r\n",
+	"<-\r\nOK\r\n\r\n+CUSD: 0,\"00A30035\",72\r\n",
+}
+
+func TestUSSDSession(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, ussdSessionReplay)), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer modem.Close()
+	s, err := modem.SendUSSD("*101#")
+	if err != nil || !s.Active() || s.Response.Text != "1. Top up, 2. Exit" {
+		t.Fatalf("Expected: menu, got %#v, %v", s, err)
+	}
+	if r, err := s.Reply("1"); err != nil || r.Status != USSDAction || r.Text != "A £" || !s.Active() {
+		t.Errorf("Expected: next menu, got %#v, %v", r, err)
+	}
+	if err := s.Close(); err != nil || s.Active() {
+		t.Error("Expected: session closed, got:", err)
+	}
+	if _, err := s.Reply("2"); err != ErrUSSDEnded {
+		t.Error("Expected: ErrUSSDEnded, got:", err)
+	}
+
+	s, err = modem.SendUSSD("*100#")
+	if err != nil || s.Active() || s.Response.Text != "£5" {
+		t.Errorf("Expected: UCS2 reply ending the session, got %#v, %v", s, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error("Expected: nothing to close, got:", err)
+	}
+}
+
+func TestUSSDWaitsForSession(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			"->AT+CUSD=1,\"*101#\",15\r\n",
+			"<-\r\n+CUSD: 1,\"1. Top up, 2. Exit\",15\r\n\r\nOK\r\n",
+			"->AT+CUSD=1,\"2\",15\r\n",
+			"<-\r\n+CUSD: 0,\"Goodbye\",15\r\n\r\nOK\r\n",
+			"->AT+CUSD=1,\"*100#\",15\r\n",
+			"<-\r\n+CUSD: 0,\"Balance 5.00\",15\r\n\r\nOK\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer modem.Close()
+	s, err := modem.SendUSSD("*101#")
+	if err != nil || !s.Active() {
+		t.Fatalf("Expected: menu, got %#v, %v", s, err)
+	}
+	balance := make(chan string, 1)
+	go func() {
+		r, err := modem.USSD("*100#")
+		if err != nil {
+			balance <- err.Error()
+			return
+		}
+		balance <- r.Text
+	}()
+	// not taken as a reply in the session
+	time.Sleep(10 * time.Millisecond)
+	if r, err := s.Reply("2"); err != nil || r.Text != "Goodbye" || s.Active() {
+		t.Errorf("Expected: session ended, got %#v, %v", r, err)
+	}
+	if text := <-balance; text != "Balance 5.00" {
+		t.Error("Expected: balance after the session, got:", text)
+	}
+}
+
+func TestUSSDSessionTerminated(t *testing.T) {
+	port := NewMockSerialPort(appendLists(initReplay, []string{
+		"->AT+CUSD=1,\"*101#\",15\r\n",
+		"<-\r\n+CUSD: 1,\"1. Top up, 2. Exit\",15\r\n\r\nOK\r\n",
+		"->AT+CUSD=1,\"*100#\",15\r\n",
+		"<-\r\n+CUSD: 0,\"Balance 5.00\",15\r\n\r\nOK\r\n",
+	}))
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return port, nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer modem.Close()
+	s, err := modem.SendUSSD("*101#")
+	if err != nil || !s.Active() {
+		t.Fatalf("Expected: menu, got %#v, %v", s, err)
+	}
+	// the network times the session out
+	port.Inject("\r\n+CUSD: 2\r\n")
+	if r, err := modem.USSD("*100#"); err != nil || r.Text != "Balance 5.00" {
+		t.Errorf("Expected: balance once the session ended, got %#v, %v", r, err)
+	}
+	if s.Active() {
+		t.Error("Expected: session ended")
+	}
+}
+
+func TestUSSDSessionAbandoned(t *testing.T) {
+	OpenPort = func(config *serial.Config) (io.ReadWriteCloser, error) {
+		return NewMockSerialPort(appendLists(initReplay, []string{
+			"->AT+CUSD=1,\"*101#\",15\r\n",
+			"<-\r\n+CUSD: 1,\"1. Top up, 2. Exit\",15\r\n\r\nOK\r\n",
+			"->AT+CUSD=2\r\n",
+			"<-\r\nOK\r\n",
+			"->AT+CUSD=1,\"*100#\",15\r\n",
+			"<-\r\n+CUSD: 0,\"Balance 5.00\",15\r\n\r\nOK\r\n",
+		})), nil
+	}
+	modem, err := Open(&serial.Config{}, true)
+	if err != nil {
+		t.Fatal("Expected: no error, got:", err)
+	}
+	defer modem.Close()
+	clock := NewMockClock(time.Date(2014, 2, 1, 15, 0, 0, 0, time.UTC))
+	modem.clock = clock
+	s, err := modem.SendUSSD("*101#")
+	if err != nil || !s.Active() {
+		t.Fatalf("Expected: menu, got %#v, %v", s, err)
+	}
+	// never replied to
+	timeout := time.After(time.Second)
+	for s.Active() {
+		select {
+		case <-timeout:
+			t.Fatal("Expected: session closed")
+		case <-time.After(time.Millisecond):
+			clock.Advance(USSDSessionTimeout)
+		}
+	}
+	if r, err := modem.USSD("*100#"); err != nil || r.Text != "Balance 5.00" {
+		t.Errorf("Expected: balance once the session closed, got %#v, %v", r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package gogsmmodem
 
 import (
+	"encoding/hex"
 	"fmt"
 	"log"
 	"regexp"
@@ -76,6 +77,25 @@ func unquotes(s string) []interface{} {
 	return args
 }
 
+// Get an int argument, or 0 if missing
+func intArg(args []interface{}, i int) int {
+	if i < len(args) {
+		if v, ok := args[i].(int); ok {
+			return v
+		}
+	}
+	return 0
+}
+
+func stringArg(args []interface{}, i int) string {
+	if i < len(args) {
+		if v, ok := args[i].(string); ok {
+			return v
+		}
+	}
+	return ""
+}
+
 // Unquote a parameter list of strings
 func stringsUnquotes(s string) []string {
 	args := unquotes(s)
@@ -97,10 +117,10 @@ var gsm0338Encode map[rune]string = map[rune]string{
 	'ì':  "\x07",
 	'ò':  "\x08",
 	'Ç':  "\x09",
-	'\r': "\x0a",
+	'\n': "\x0a",
 	'Ø':  "\x0b",
 	'ø':  "\x0c",
-	'\n': "\x0d",
+	'\r': "\x0d",
 	'Å':  "\x0e",
 	'å':  "\x0f",
 	'Δ':  "\x10",
@@ -116,6 +136,7 @@ var gsm0338Encode map[rune]string = map[rune]string{
 	'Ξ':  "\x1a",
 	'Æ':  "\x1c",
 	'æ':  "\x1d",
+	'ß':  "\x1e",
 	'É':  "\x1f",
 	'¤':  "\x24",
 	'%':  "\x25",
@@ -125,17 +146,19 @@ var gsm0338Encode map[rune]string = map[rune]string{
 	'Ñ':  "\x5d",
 	'Ü':  "\x5e",
 	'§':  "\x5f",
+	'¿':  "\x60",
 	'ä':  "\x7b",
 	'ö':  "\x7c",
 	'ñ':  "\x7d",
 	'ü':  "\x7e",
 	'à':  "\x7f",
 	// escaped characters
+	'\f': "\x1b\x0a",
 	'€':  "\x1be",
 	'[':  "\x1b<",
 	'\\': "\x1b/",
 	']':  "\x1b>",
-	'^':  "\x1b^",
+	'^':  "\x1b\x14",
 	'{':  "\x1b(",
 	'|':  "\x1b@",
 	'}':  "\x1b)",
@@ -153,10 +176,10 @@ var gsm0338Decode map[rune]rune = map[rune]rune{
 	'\x07': 'ì',
 	'\x08': 'ò',
 	'\x09': 'Ç',
-	'\x0a': '\r',
+	'\x0a': '\n',
 	'\x0b': 'Ø',
 	'\x0c': 'ø',
-	'\x0d': '\n',
+	'\x0d': '\r',
 	'\x0e': 'Å',
 	'\x0f': 'å',
 	'\x10': 'Δ',
@@ -172,6 +195,7 @@ var gsm0338Decode map[rune]rune = map[rune]rune{
 	'\x1a': 'Ξ',
 	'\x1c': 'Æ',
 	'\x1d': 'æ',
+	'\x1e': 'ß',
 	'\x1f': 'É',
 	'\x24': '¤',
 	'\x25': '%',
@@ -181,29 +205,73 @@ var gsm0338Decode map[rune]rune = map[rune]rune{
 	'\x5d': 'Ñ',
 	'\x5e': 'Ü',
 	'\x5f': '§',
+	'\x60': '¿',
 	'\x7b': 'ä',
 	'\x7c': 'ö',
 	'\x7d': 'ñ',
 	'\x7e': 'ü',
 	'\x7f': 'à',
-	// escaped characters
-	// '\x1be': '€',
-	// '\x1b<': '[',
-	// '\x1b/': '\\',
-	// '\x1b>': ']',
-	// '\x1b^': '^',
-	// '\x1b(': '{',
-	// '\x1b@': '|',
-	// '\x1b)': '}',
-	// '\x1b=': '~',
-}
-
-// Encode the string to GSM03.38
+}
+
+// Escaped characters, by the code following the escape
+var gsm0338DecodeEscape = map[rune]rune{}
+
+func init() {
+	for c, d := range gsm0338Encode {
+		if len(d) == 2 {
+			gsm0338DecodeEscape[rune(d[1])] = c
+		}
+	}
+}
+
+// Encode and decode with the tables of earlier versions, which swapped CR
+// and LF and escaped ^ wrongly, for peers depending on them.
+var LegacyGSMTables bool
+
+// Entries of the tables differing in earlier versions
+var gsm0338LegacyEncode = map[rune]string{'\r': "\x0a", '\n': "\x0d", '^': "\x1b^"}
+var gsm0338LegacyDecode = map[rune]rune{'\x0a': '\r', '\x0d': '\n'}
+var gsm0338LegacyDecodeEscape = map[rune]rune{'^': '^'}
+
+// Fail text mode sends of text outside the GSM 03.38 alphabet in the GSM or
+// HEX character sets with a GSMEncodingError, rather than passing the
+// characters on for the modem to mangle.
+var StrictGSM bool
+
+// Returned in strict mode for a character not in the GSM 03.38 alphabet
+type GSMEncodingError struct {
+	Char rune
+	// Byte offset in the text
+	Offset int
+}
+
+func (self *GSMEncodingError) Error() string {
+	return fmt.Sprintf("Character %q at %d not in GSM alphabet", self.Char, self.Offset)
+}
+
+// The GSM 03.38 code for c, escaped if from the extension table
+func gsmEncodeRune(c rune) (string, bool) {
+	if LegacyGSMTables {
+		if d, ok := gsm0338LegacyEncode[c]; ok {
+			return d, true
+		}
+	}
+	if d, ok := gsm0338Encode[c]; ok {
+		return d, true
+	}
+	if c >= ' ' && c < 0x7f && c != '`' {
+		// same code as ASCII
+		return string(c), true
+	}
+	return "", false
+}
+
+// Encode the string to GSM03.38, passing on characters not in the alphabet
 func gsmEncode(s string) string {
 	res := ""
 	for _, c := range s {
-		if d, ok := gsm0338Encode[c]; ok {
-			res += string(d)
+		if d, ok := gsmEncodeRune(c); ok {
+			res += d
 		} else {
 			res += string(c)
 		}
@@ -211,11 +279,37 @@ func gsmEncode(s string) string {
 	return res
 }
 
+// Encode the string to GSM03.38, failing with a GSMEncodingError for
+// characters not in the alphabet
+func gsmEncodeStrict(s string) (string, error) {
+	res := ""
+	for i, c := range s {
+		d, ok := gsmEncodeRune(c)
+		if !ok {
+			return "", &GSMEncodingError{c, i}
+		}
+		res += d
+	}
+	return res, nil
+}
+
 // Decode the GSM03.38 to string
 func gsmDecode(s string) string {
 	res := ""
+	escaped := false
 	for _, c := range s {
-		if d, ok := gsm0338Decode[c]; ok {
+		if escaped {
+			escaped = false
+			if d, ok := gsmDecodeEscape(c); ok {
+				res += string(d)
+				continue
+			}
+			// unknown extension, decoded as a space as the spec advises
+			res += " "
+		}
+		if c == 0x1b {
+			escaped = true
+		} else if d, ok := gsmDecodeRune(c); ok {
 			res += string(d)
 		} else {
 			res += string(c)
@@ -224,6 +318,26 @@ func gsmDecode(s string) string {
 	return res
 }
 
+func gsmDecodeRune(c rune) (rune, bool) {
+	if LegacyGSMTables {
+		if d, ok := gsm0338LegacyDecode[c]; ok {
+			return d, true
+		}
+	}
+	d, ok := gsm0338Decode[c]
+	return d, ok
+}
+
+func gsmDecodeEscape(c rune) (rune, bool) {
+	if LegacyGSMTables {
+		if d, ok := gsm0338LegacyDecodeEscape[c]; ok {
+			return d, true
+		}
+	}
+	d, ok := gsm0338DecodeEscape[c]
+	return d, ok
+}
+
 func Decode(s string) string {
 	return gsmDecode(s)
 }
@@ -234,20 +348,88 @@ func unicodeEncode(s string) string {
 	return strings.Replace(hex[1:len(hex)-1], " ", "", -1)
 }
 
-// A logging ReadWriteCloser for debugging
+// Decode a unicode hex string (as returned in UCS2 mode)
+func unicodeDecode(s string) (string, error) {
+	if len(s)%4 != 0 {
+		return "", fmt.Errorf("Invalid UCS2 length: %d", len(s))
+	}
+	codes := make([]uint16, len(s)/4)
+	for i := range codes {
+		n, err := strconv.ParseUint(s[i*4:i*4+4], 16, 16)
+		if err != nil {
+			return "", err
+		}
+		codes[i] = uint16(n)
+	}
+	return string(utf16.Decode(codes)), nil
+}
+
+// Encode the string as hex of its GSM03.38 codes, for the HEX character set
+func hexEncode(s string) string {
+	return strings.ToUpper(hex.EncodeToString([]byte(gsmEncode(s))))
+}
+
+// Decode hex of GSM03.38 codes (as returned in HEX mode)
+func hexDecode(s string) (string, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return gsmDecode(string(b)), nil
+}
+
+// Encode the string for the IRA (ASCII) character set, replacing characters
+// it lacks with '?'
+func iraEncode(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 127 {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// Check if s only contains dialling characters
+func isDialString(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("+0123456789*#", c) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Decode a telephone number which may be unicode hex encoded
+func decodeAddress(s string) string {
+	if isDialString(s) && (startsWith(s, "+") || len(s)%4 != 0) {
+		return s
+	}
+	if d, err := unicodeDecode(s); err == nil && isDialString(d) {
+		return d
+	}
+	return s
+}
+
+// A logging ReadWriteCloser for debugging. Sensitive data is redacted from
+// the log, see RedactSensitive.
 type LogReadWriteCloser struct {
-	f io.ReadWriteCloser
+	f      io.ReadWriteCloser
+	redact *redactor
+}
+
+func NewLogReadWriteCloser(f io.ReadWriteCloser) LogReadWriteCloser {
+	return LogReadWriteCloser{f, &redactor{}}
 }
 
 func (self LogReadWriteCloser) Read(b []byte) (int, error) {
 	n, err := self.f.Read(b)
-	log.Printf("Read(%#v) = (%d, %v)\n", string(b[:n]), n, err)
+	log.Printf("Read(%#v) = (%d, %v)\n", self.redact.read(string(b[:n])), n, err)
 	return n, err
 }
 
 func (self LogReadWriteCloser) Write(b []byte) (int, error) {
 	n, err := self.f.Write(b)
-	log.Printf("Write(%#v) = (%d, %v)\n", string(b), n, err)
+	log.Printf("Write(%#v) = (%d, %v)\n", self.redact.write(string(b)), n, err)
 	return n, err
 }
 
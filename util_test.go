@@ -1,6 +1,9 @@
 package gogsmmodem
 
-import "fmt"
+import (
+	"fmt"
+	"testing"
+)
 
 func ExampleParseTime() {
 	t := parseTime("14/02/01,15:07:43+00")
@@ -47,3 +50,92 @@ func ExampleGsmEncode() {
 	// "\x00\x01"
 	// "\x1b(\x1b)"
 }
+
+func TestDecodeAddress(t *testing.T) {
+	if s, err := unicodeDecode("002B00340034"); s != "+44" || err != nil {
+		t.Errorf("Expected: +44, got %q %v", s, err)
+	}
+	if s := decodeAddress("002B00340034"); s != "+44" {
+		t.Error("Expected: UCS2 address decoded, got:", s)
+	}
+	if s := decodeAddress("+44"); s != "+44" {
+		t.Error("Expected: plain address unchanged, got:", s)
+	}
+}
+
+func TestHexEncode(t *testing.T) {
+	if s := hexEncode("@£10"); s != "00013130" {
+		t.Error("Expected: 00013130, got:", s)
+	}
+	if s, err := hexDecode("00013130"); s != "@£10" || err != nil {
+		t.Errorf("Expected: @£10, got %q %v", s, err)
+	}
+}
+
+func TestIraEncode(t *testing.T) {
+	if s := iraEncode("Ça va £5"); s != "?a va ?5" {
+		t.Error("Expected: ?a va ?5, got:", s)
+	}
+}
+
+// GSM 03.38 default alphabet, with the escape as 0
+var gsmSpecAlphabet = [128]rune{
+	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì', 'ò', 'Ç', '\n', 'Ø', 'ø', '\r', 'Å', 'å',
+	'Δ', '_', 'Φ', 'Γ', 'Λ', 'Ω', 'Π', 'Ψ', 'Σ', 'Θ', 'Ξ', 0, 'Æ', 'æ', 'ß', 'É',
+	' ', '!', '"', '#', '¤', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§',
+	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à',
+}
+
+// GSM 03.38 extension table
+var gsmSpecExtension = map[byte]rune{
+	0x0a: '\f', 0x14: '^', 0x28: '{', 0x29: '}', 0x2f: '\\',
+	0x3c: '[', 0x3d: '~', 0x3e: ']', 0x40: '|', 0x65: '€',
+}
+
+func TestGsmTables(t *testing.T) {
+	for i, c := range gsmSpecAlphabet {
+		if c == 0 {
+			continue
+		}
+		code := string([]byte{byte(i)})
+		if got, err := gsmEncodeStrict(string(c)); got != code || err != nil {
+			t.Errorf("Encoding %q: expected %q, got %q %v", c, code, got, err)
+		}
+		if got := gsmDecode(code); got != string(c) {
+			t.Errorf("Decoding %q: expected %q, got %q", code, c, got)
+		}
+	}
+	for b, c := range gsmSpecExtension {
+		code := string([]byte{0x1b, b})
+		if got, err := gsmEncodeStrict(string(c)); got != code || err != nil {
+			t.Errorf("Encoding %q: expected %q, got %q %v", c, code, got, err)
+		}
+		if got := gsmDecode(code); got != string(c) {
+			t.Errorf("Decoding %q: expected %q, got %q", code, c, got)
+		}
+	}
+	// every encodable character is in the tables
+	for c := rune(0); c < 0x3000; c++ {
+		if _, err := gsmEncodeStrict(string(c)); err == nil && gsmDecode(gsmEncode(string(c))) != string(c) {
+			t.Errorf("Round trip of %q failed", c)
+		}
+	}
+	if _, err := gsmEncodeStrict("a°"); err == nil || *err.(*GSMEncodingError) != (GSMEncodingError{'°', 1}) {
+		t.Errorf("Expected: encoding error, got %v", err)
+	}
+}
+
+func TestLegacyGsmTables(t *testing.T) {
+	LegacyGSMTables = true
+	defer func() { LegacyGSMTables = false }()
+	if got := gsmEncode("\r\n^"); got != "\x0a\x0d\x1b^" {
+		t.Errorf("Expected: legacy encoding, got %q", got)
+	}
+	if got := gsmDecode("\x0a\x0d\x1b^"); got != "\r\n^" {
+		t.Errorf("Expected: legacy decoding, got %q", got)
+	}
+}